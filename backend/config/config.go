@@ -4,6 +4,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/rs/zerolog/log"
@@ -39,12 +40,18 @@ type Config struct {
 	CORSOrigins []string
 
 	// Security
-	JWTSecret     string
-	APIKeyPepper  string
+	JWTSecret      string
+	APIKeyPepper   string
+	OperatorAPIKey string // grants access to operator-only routes; unset disables them
 
 	// Rate Limiting
 	RateLimitRequestsPerMinute int
 
+	// Usage metering
+	MeteringBufferSize    int
+	MeteringBatchSize     int
+	MeteringFlushInterval time.Duration
+
 	// Logging
 	LogLevel string
 
@@ -56,6 +63,35 @@ type Config struct {
 	RazorpayKeyID       string
 	RazorpayKeySecret   string
 	RazorpayWebhookSecret string
+
+	// Stripe (disabled unless a secret key is set)
+	StripeSecretKey     string
+	StripeWebhookSecret string
+	StripeAPIBase       string
+
+	// Exchange rates (a file takes precedence over a URL; with neither,
+	// organizations are only invoiced in currencies their plan has prices for)
+	ExchangeRatesFile string
+	ExchangeRatesURL  string
+	ExchangeRatesTTL  time.Duration
+
+	// Tax (seller registration)
+	TaxSellerCountry string
+	TaxSellerState   string
+	TaxSellerTaxID   string
+
+	// Email (notification emails are disabled unless a host is set)
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+
+	// Invoice documents
+	InvoiceCompanyName    string
+	InvoiceCompanyAddress []string
+	InvoiceSupportEmail   string
+	InvoiceAccentColor    string
 }
 
 var AppConfig *Config
@@ -73,8 +109,34 @@ func LoadConfig() (*Config, error) {
 		rateLimit = 100
 	}
 
+	meteringBufferSize, err := strconv.Atoi(getEnv("METERING_BUFFER_SIZE", "10000"))
+	if err != nil {
+		meteringBufferSize = 10000
+	}
+	meteringBatchSize, err := strconv.Atoi(getEnv("METERING_BATCH_SIZE", "500"))
+	if err != nil {
+		meteringBatchSize = 500
+	}
+	meteringFlushInterval, err := time.ParseDuration(getEnv("METERING_FLUSH_INTERVAL", "2s"))
+	if err != nil {
+		meteringFlushInterval = 2 * time.Second
+	}
+
+	exchangeRatesTTL, err := time.ParseDuration(getEnv("EXCHANGE_RATES_TTL", "1h"))
+	if err != nil {
+		exchangeRatesTTL = time.Hour
+	}
+
 	corsOrigins := strings.Split(getEnv("CORS_ORIGINS", "*"), ",")
 
+	// Invoice address lines are separated by semicolons
+	invoiceCompanyAddress := []string{}
+	for _, line := range strings.Split(getEnv("INVOICE_COMPANY_ADDRESS", ""), ";") {
+		if line = strings.TrimSpace(line); line != "" {
+			invoiceCompanyAddress = append(invoiceCompanyAddress, line)
+		}
+	}
+
 	config := &Config{
 		// Server
 		Port:        getEnv("PORT", "8080"),
@@ -105,12 +167,18 @@ func LoadConfig() (*Config, error) {
 		CORSOrigins: corsOrigins,
 
 		// Security
-		JWTSecret:    getEnv("JWT_SECRET", "change-this-secret"),
-		APIKeyPepper: getEnv("API_KEY_PEPPER", "change-this-pepper"),
+		JWTSecret:      getEnv("JWT_SECRET", "change-this-secret"),
+		APIKeyPepper:   getEnv("API_KEY_PEPPER", "change-this-pepper"),
+		OperatorAPIKey: getEnv("OPERATOR_API_KEY", ""),
 
 		// Rate Limiting
 		RateLimitRequestsPerMinute: rateLimit,
 
+		// Usage metering
+		MeteringBufferSize:    meteringBufferSize,
+		MeteringBatchSize:     meteringBatchSize,
+		MeteringFlushInterval: meteringFlushInterval,
+
 		// Logging
 		LogLevel: getEnv("LOG_LEVEL", "info"),
 
@@ -122,6 +190,34 @@ func LoadConfig() (*Config, error) {
 		RazorpayKeyID:         getEnv("RAZORPAY_KEY_ID", "rzp_test_mock"),
 		RazorpayKeySecret:     getEnv("RAZORPAY_KEY_SECRET", "mock_secret"),
 		RazorpayWebhookSecret: getEnv("RAZORPAY_WEBHOOK_SECRET", "mock_webhook_secret"),
+
+		// Stripe
+		StripeSecretKey:     getEnv("STRIPE_SECRET_KEY", ""),
+		StripeWebhookSecret: getEnv("STRIPE_WEBHOOK_SECRET", ""),
+		StripeAPIBase:       getEnv("STRIPE_API_BASE", "https://api.stripe.com"),
+
+		// Exchange rates
+		ExchangeRatesFile: getEnv("EXCHANGE_RATES_FILE", ""),
+		ExchangeRatesURL:  getEnv("EXCHANGE_RATES_URL", ""),
+		ExchangeRatesTTL:  exchangeRatesTTL,
+
+		// Tax
+		TaxSellerCountry: getEnv("TAX_SELLER_COUNTRY", "IN"),
+		TaxSellerState:   getEnv("TAX_SELLER_STATE", "KA"),
+		TaxSellerTaxID:   getEnv("TAX_SELLER_TAX_ID", ""),
+
+		// Email
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     getEnv("SMTP_PORT", "587"),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:     getEnv("SMTP_FROM", "notifications@pulse.io"),
+
+		// Invoice documents
+		InvoiceCompanyName:    getEnv("INVOICE_COMPANY_NAME", "Pulse"),
+		InvoiceCompanyAddress: invoiceCompanyAddress,
+		InvoiceSupportEmail:   getEnv("INVOICE_SUPPORT_EMAIL", "billing@pulse.io"),
+		InvoiceAccentColor:    getEnv("INVOICE_ACCENT_COLOR", "#4F46E5"),
 	}
 
 	AppConfig = config
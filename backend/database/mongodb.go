@@ -135,15 +135,339 @@ func createIndexes(ctx context.Context) error {
 		{
 			Keys: bson.D{{Key: "event_type", Value: 1}},
 		},
+		{
+			// Latest storage reading of a project
+			Keys: bson.D{{Key: "project_id", Value: 1}, {Key: "event_type", Value: 1}, {Key: "timestamp", Value: -1}},
+		},
 		{
 			Keys:    bson.D{{Key: "timestamp", Value: 1}},
 			Options: options.Index().SetExpireAfterSeconds(7776000), // 90 days TTL
 		},
+		{
+			// Dedup replayed usage events; legacy documents without a key are skipped
+			Keys: bson.D{{Key: "idempotency_key", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+				"idempotency_key": bson.M{"$exists": true},
+			}),
+		},
+		{
+			// Finds events written after their period was aggregated
+			Keys: bson.D{{Key: "recorded_at", Value: 1}},
+			Options: options.Index().SetPartialFilterExpression(bson.M{
+				"recorded_at": bson.M{"$exists": true},
+			}),
+		},
 	}
 	if _, err := usageCollection.Indexes().CreateMany(ctx, usageIndexes); err != nil {
 		return fmt.Errorf("failed to create usage metrics indexes: %w", err)
 	}
 
+	// Usage aggregates are upserted by project and period
+	aggregateCollection := Database.Collection("usage_aggregates")
+	aggregateIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "project_id", Value: 1},
+				{Key: "period_type", Value: 1},
+				{Key: "period_start", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+	}
+	if _, err := aggregateCollection.Indexes().CreateMany(ctx, aggregateIndexes); err != nil {
+		return fmt.Errorf("failed to create usage aggregate indexes: %w", err)
+	}
+
+	// A usage alert fires once per metric, severity and period; alerts
+	// stored before periods were recorded are skipped
+	alertCollection := Database.Collection("usage_alerts")
+	alertIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "project_id", Value: 1},
+				{Key: "metric_type", Value: 1},
+				{Key: "severity", Value: 1},
+				{Key: "period_start", Value: 1},
+			},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+				"period_start": bson.M{"$exists": true},
+			}),
+		},
+	}
+	if _, err := alertCollection.Indexes().CreateMany(ctx, alertIndexes); err != nil {
+		return fmt.Errorf("failed to create usage alert indexes: %w", err)
+	}
+
+	// One live room document per project and room name
+	liveRoomCollection := Database.Collection("live_rooms")
+	liveRoomIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "project_id", Value: 1},
+				{Key: "room_name", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+	}
+	if _, err := liveRoomCollection.Indexes().CreateMany(ctx, liveRoomIndexes); err != nil {
+		return fmt.Errorf("failed to create live room indexes: %w", err)
+	}
+
+	// Daily usage per room, participant and tag value
+	dimensionCollection := Database.Collection("usage_dimension_aggregates")
+	dimensionIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "project_id", Value: 1},
+				{Key: "dimension", Value: 1},
+				{Key: "period_start", Value: 1},
+				{Key: "key", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+	}
+	if _, err := dimensionCollection.Indexes().CreateMany(ctx, dimensionIndexes); err != nil {
+		return fmt.Errorf("failed to create usage dimension aggregate indexes: %w", err)
+	}
+
+	// Consolidated organization invoices are listed by org and scope; Stripe
+	// webhooks look invoices up by their Stripe invoice
+	invoiceCollection := Database.Collection("invoices")
+	invoiceIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "org_id", Value: 1},
+				{Key: "scope", Value: 1},
+				{Key: "created_at", Value: -1},
+			},
+		},
+		{
+			Keys:    bson.D{{Key: "stripe_invoice_id", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+	}
+	if _, err := invoiceCollection.Indexes().CreateMany(ctx, invoiceIndexes); err != nil {
+		return fmt.Errorf("failed to create invoice indexes: %w", err)
+	}
+
+	// One document per pricing plan version
+	pricingPlanCollection := Database.Collection("pricing_plans")
+	pricingPlanIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "code", Value: 1},
+				{Key: "version", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+	}
+	if _, err := pricingPlanCollection.Indexes().CreateMany(ctx, pricingPlanIndexes); err != nil {
+		return fmt.Errorf("failed to create pricing plan indexes: %w", err)
+	}
+
+	// Plan history is read per organization in effective order
+	planChangeCollection := Database.Collection("plan_changes")
+	planChangeIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "org_id", Value: 1},
+				{Key: "effective_at", Value: 1},
+			},
+		},
+	}
+	if _, err := planChangeCollection.Indexes().CreateMany(ctx, planChangeIndexes); err != nil {
+		return fmt.Errorf("failed to create plan change indexes: %w", err)
+	}
+
+	// Credit ledger: each grant is recorded once per organization
+	creditCollection := Database.Collection("credit_ledger")
+	creditIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "org_id", Value: 1},
+				{Key: "grant_key", Value: 1},
+			},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"grant_key": bson.M{"$exists": true}}),
+		},
+		{
+			Keys: bson.D{
+				{Key: "org_id", Value: 1},
+				{Key: "created_at", Value: -1},
+			},
+		},
+		{
+			Keys: bson.D{{Key: "invoice_id", Value: 1}},
+		},
+	}
+	if _, err := creditCollection.Indexes().CreateMany(ctx, creditIndexes); err != nil {
+		return fmt.Errorf("failed to create credit ledger indexes: %w", err)
+	}
+
+	promoCodeCollection := Database.Collection("promo_codes")
+	promoCodeIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "code", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	}
+	if _, err := promoCodeCollection.Indexes().CreateMany(ctx, promoCodeIndexes); err != nil {
+		return fmt.Errorf("failed to create promo code indexes: %w", err)
+	}
+
+	// One billing run per organization and period makes billing idempotent
+	billingRunCollection := Database.Collection("billing_runs")
+	billingRunIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "org_id", Value: 1}, {Key: "period_start", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "due_at", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "invoice_id", Value: 1}},
+		},
+	}
+	if _, err := billingRunCollection.Indexes().CreateMany(ctx, billingRunIndexes); err != nil {
+		return fmt.Errorf("failed to create billing run indexes: %w", err)
+	}
+
+	// Provider webhook events are unique per provider event ID so each is
+	// applied once; failed events are picked up by their retry time
+	providerEventCollection := Database.Collection("provider_events")
+	providerEventIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "provider", Value: 1}, {Key: "event_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "received_at", Value: -1}},
+		},
+	}
+	if _, err := providerEventCollection.Indexes().CreateMany(ctx, providerEventIndexes); err != nil {
+		return fmt.Errorf("failed to create provider event indexes: %w", err)
+	}
+
+	// One subscription per organization, found by its provider subscription
+	// for provider webhooks and by scheduled change for the billing worker
+	subscriptionCollection := Database.Collection("subscriptions")
+	subscriptionIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "org_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "provider", Value: 1}, {Key: "provider_subscription_id", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: "scheduled_change.effective_at", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+	}
+	if _, err := subscriptionCollection.Indexes().CreateMany(ctx, subscriptionIndexes); err != nil {
+		return fmt.Errorf("failed to create subscription indexes: %w", err)
+	}
+
+	// One budget per organization and per project; caps in force are
+	// looked up on every quota computation
+	budgetCollection := Database.Collection("budgets")
+	budgetIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "org_id", Value: 1}, {Key: "project_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "org_id", Value: 1}, {Key: "capped_until", Value: 1}},
+		},
+	}
+	if _, err := budgetCollection.Indexes().CreateMany(ctx, budgetIndexes); err != nil {
+		return fmt.Errorf("failed to create budget indexes: %w", err)
+	}
+
+	budgetAlertCollection := Database.Collection("budget_alerts")
+	budgetAlertIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "org_id", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+	}
+	if _, err := budgetAlertCollection.Indexes().CreateMany(ctx, budgetAlertIndexes); err != nil {
+		return fmt.Errorf("failed to create budget alert indexes: %w", err)
+	}
+
+	// Egresses: a recording rule records each room or track once
+	egressCollection := Database.Collection("egresses")
+	egressIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "dedup_key", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"dedup_key": bson.M{"$exists": true}}),
+		},
+		{
+			Keys: bson.D{{Key: "project_id", Value: 1}, {Key: "room_name", Value: 1}, {Key: "status", Value: 1}},
+		},
+	}
+	if _, err := egressCollection.Indexes().CreateMany(ctx, egressIndexes); err != nil {
+		return fmt.Errorf("failed to create egress indexes: %w", err)
+	}
+
+	recordingRuleCollection := Database.Collection("recording_rules")
+	recordingRuleIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "project_id", Value: 1}, {Key: "trigger", Value: 1}, {Key: "enabled", Value: 1}},
+		},
+	}
+	if _, err := recordingRuleCollection.Indexes().CreateMany(ctx, recordingRuleIndexes); err != nil {
+		return fmt.Errorf("failed to create recording rule indexes: %w", err)
+	}
+
+	encodingPresetCollection := Database.Collection("encoding_presets")
+	encodingPresetIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "project_id", Value: 1}, {Key: "name", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	}
+	if _, err := encodingPresetCollection.Indexes().CreateMany(ctx, encodingPresetIndexes); err != nil {
+		return fmt.Errorf("failed to create encoding preset indexes: %w", err)
+	}
+
+	recordingCollection := Database.Collection("recordings")
+	recordingIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "egress_id", Value: 1}, {Key: "storage_key", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "project_id", Value: 1}, {Key: "recorded_at", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "project_id", Value: 1}, {Key: "tags", Value: 1}, {Key: "recorded_at", Value: -1}},
+		},
+	}
+	if _, err := recordingCollection.Indexes().CreateMany(ctx, recordingIndexes); err != nil {
+		return fmt.Errorf("failed to create recording indexes: %w", err)
+	}
+
+	retentionPolicyCollection := Database.Collection("recording_retention_policies")
+	retentionPolicyIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "project_id", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "enabled", Value: 1}},
+		},
+	}
+	if _, err := retentionPolicyCollection.Indexes().CreateMany(ctx, retentionPolicyIndexes); err != nil {
+		return fmt.Errorf("failed to create retention policy indexes: %w", err)
+	}
+
 	log.Info().Msg("MongoDB indexes created successfully")
 	return nil
 }
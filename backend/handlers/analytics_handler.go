@@ -17,9 +17,9 @@ type AnalyticsHandler struct {
 	analyticsService *services.AnalyticsService
 }
 
-func NewAnalyticsHandler() *AnalyticsHandler {
+func NewAnalyticsHandler(analyticsService *services.AnalyticsService) *AnalyticsHandler {
 	return &AnalyticsHandler{
-		analyticsService: services.NewAnalyticsService(),
+		analyticsService: analyticsService,
 	}
 }
 
@@ -1,10 +1,15 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"pulse-control-plane/models"
 	"pulse-control-plane/services"
 
 	"github.com/gin-gonic/gin"
@@ -13,13 +18,19 @@ import (
 
 // BillingHandler handles billing-related HTTP requests
 type BillingHandler struct {
-	billingService *services.BillingService
+	billingService    *services.BillingService
+	documentService   *services.InvoiceDocumentService
+	billingRunService *services.BillingRunService
+	paymentService    *services.PaymentService
 }
 
 // NewBillingHandler creates a new billing handler
-func NewBillingHandler(billingService *services.BillingService) *BillingHandler {
+func NewBillingHandler(billingService *services.BillingService, documentService *services.InvoiceDocumentService, billingRunService *services.BillingRunService, paymentService *services.PaymentService) *BillingHandler {
 	return &BillingHandler{
-		billingService: billingService,
+		billingService:    billingService,
+		documentService:   documentService,
+		billingRunService: billingRunService,
+		paymentService:    paymentService,
 	}
 }
 
@@ -110,6 +121,43 @@ func (h *BillingHandler) GetInvoice(c *gin.Context) {
 	c.JSON(http.StatusOK, invoice)
 }
 
+// GetInvoicePDF renders an invoice as a PDF document. With store=true the
+// document is also saved to the project's storage bucket.
+// GET /v1/billing/invoice/:invoice_id/pdf
+func (h *BillingHandler) GetInvoicePDF(c *gin.Context) {
+	invoiceID, err := primitive.ObjectIDFromHex(c.Param("invoice_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return
+	}
+
+	invoice, pdf, err := h.documentService.RenderPDF(c.Request.Context(), invoiceID)
+	if err != nil {
+		if err.Error() == "invoice not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render invoice"})
+		}
+		return
+	}
+
+	if c.Query("store") == "true" {
+		url, err := h.documentService.StorePDF(c.Request.Context(), invoice, pdf)
+		if err != nil {
+			status := http.StatusBadGateway
+			if errors.Is(err, services.ErrStorageNotConfigured) {
+				status = http.StatusBadRequest
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("X-Invoice-PDF-URL", url)
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pdf"`, invoice.InvoiceNumber))
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
+
 // ListInvoices retrieves invoices for a project
 // GET /v1/billing/:project_id/invoices
 func (h *BillingHandler) ListInvoices(c *gin.Context) {
@@ -151,11 +199,16 @@ func (h *BillingHandler) ListInvoices(c *gin.Context) {
 	})
 }
 
-// UpdateInvoiceStatus updates the status of an invoice
-// PUT /v1/billing/invoice/:invoice_id/status
-func (h *BillingHandler) UpdateInvoiceStatus(c *gin.Context) {
-	invoiceIDStr := c.Param("invoice_id")
-	invoiceID, err := primitive.ObjectIDFromHex(invoiceIDStr)
+// SetOrganizationInvoiceStatus sets the status of an organization's invoice
+// PUT /v1/organizations/:id/billing/invoices/:invoice_id/status
+func (h *BillingHandler) SetOrganizationInvoiceStatus(c *gin.Context) {
+	orgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return
+	}
+
+	invoiceID, err := primitive.ObjectIDFromHex(c.Param("invoice_id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
 		return
@@ -170,14 +223,8 @@ func (h *BillingHandler) UpdateInvoiceStatus(c *gin.Context) {
 		return
 	}
 
-	// Update status
-	err = h.billingService.UpdateInvoiceStatus(c.Request.Context(), invoiceID, req.Status)
-	if err != nil {
-		if err.Error() == "invoice not found" {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update invoice status"})
-		}
+	if err := h.billingService.SetOrgInvoiceStatus(c.Request.Context(), orgID, invoiceID, req.Status); err != nil {
+		c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -187,29 +234,341 @@ func (h *BillingHandler) UpdateInvoiceStatus(c *gin.Context) {
 	})
 }
 
-// IntegrateStripe is a placeholder for Stripe integration
+// GetOrganizationBilling retrieves consolidated billing data for an organization
+// GET /v1/organizations/:id/billing
+func (h *BillingHandler) GetOrganizationBilling(c *gin.Context) {
+	orgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return
+	}
+
+	dashboard, err := h.billingService.GetOrgBillingDashboard(c.Request.Context(), orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve organization billing"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dashboard)
+}
+
+// GenerateOrganizationInvoice generates a consolidated invoice for an organization
+// POST /v1/organizations/:id/billing/invoice
+func (h *BillingHandler) GenerateOrganizationInvoice(c *gin.Context) {
+	orgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return
+	}
+
+	var req struct {
+		PeriodStart string `json:"period_start" binding:"required"`
+		PeriodEnd   string `json:"period_end" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	periodStart, err := time.Parse("2006-01-02", req.PeriodStart)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid period_start format (use YYYY-MM-DD)"})
+		return
+	}
+
+	periodEnd, err := time.Parse("2006-01-02", req.PeriodEnd)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid period_end format (use YYYY-MM-DD)"})
+		return
+	}
+
+	invoice, err := h.billingService.GenerateOrgInvoice(c.Request.Context(), orgID, periodStart, periodEnd)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate invoice"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, invoice)
+}
+
+// ListOrganizationInvoices retrieves consolidated invoices for an organization
+// GET /v1/organizations/:id/billing/invoices
+func (h *BillingHandler) ListOrganizationInvoices(c *gin.Context) {
+	orgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	invoices, total, err := h.billingService.ListOrgInvoices(c.Request.Context(), orgID, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve invoices"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"invoices": invoices,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// ListBillingRuns lists an organization's scheduled billing runs with their
+// payment and dunning state
+// GET /v1/organizations/:id/billing/runs
+func (h *BillingHandler) ListBillingRuns(c *gin.Context) {
+	orgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return
+	}
+
+	runs, err := h.billingRunService.ListRuns(c.Request.Context(), orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve billing runs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"runs": runs, "count": len(runs)})
+}
+
+// IntegrateStripe pushes an invoice to Stripe, which charges the
+// organization's default payment method
 // POST /v1/billing/:project_id/stripe/integrate
 func (h *BillingHandler) IntegrateStripe(c *gin.Context) {
-	c.JSON(http.StatusNotImplemented, gin.H{
-		"message": "Stripe integration coming soon",
-		"status":  "placeholder",
+	if _, err := primitive.ObjectIDFromHex(c.Param("project_id")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	var req struct {
+		InvoiceID string `json:"invoice_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	invoiceID, err := primitive.ObjectIDFromHex(req.InvoiceID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return
+	}
+
+	pushed, err := h.paymentService.PushInvoice(c.Request.Context(), invoiceID, models.PaymentProviderStripe)
+	if err != nil {
+		c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"stripe_invoice_id":  pushed.ID,
+		"hosted_invoice_url": pushed.URL,
+		"status":             pushed.Status,
 	})
 }
 
-// CreateStripeCustomer is a placeholder for creating a Stripe customer
+// CreateStripeCustomer registers an organization as a Stripe customer
 // POST /v1/billing/stripe/customer
 func (h *BillingHandler) CreateStripeCustomer(c *gin.Context) {
-	c.JSON(http.StatusNotImplemented, gin.H{
-		"message": "Stripe customer creation coming soon",
-		"status":  "placeholder",
-	})
+	var req struct {
+		OrgID string `json:"org_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	orgID, err := primitive.ObjectIDFromHex(req.OrgID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return
+	}
+
+	customerID, err := h.paymentService.CreateCustomer(c.Request.Context(), orgID, models.PaymentProviderStripe)
+	if err != nil {
+		c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"customer_id": customerID})
 }
 
-// AttachPaymentMethod is a placeholder for attaching payment method
+// AttachPaymentMethod attaches a Stripe payment method to an organization and
+// makes it the default for invoices
 // POST /v1/billing/stripe/payment-method
 func (h *BillingHandler) AttachPaymentMethod(c *gin.Context) {
-	c.JSON(http.StatusNotImplemented, gin.H{
-		"message": "Payment method attachment coming soon",
-		"status":  "placeholder",
+	var req struct {
+		OrgID           string `json:"org_id" binding:"required"`
+		PaymentMethodID string `json:"payment_method_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	orgID, err := primitive.ObjectIDFromHex(req.OrgID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return
+	}
+
+	err = h.paymentService.AttachPaymentMethod(c.Request.Context(), orgID, models.PaymentProviderStripe, req.PaymentMethodID)
+	if err != nil {
+		c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Payment method attached"})
+}
+
+// CreatePaymentIntent starts a client-side payment of an invoice through the
+// organization's payment provider
+// POST /v1/billing/invoice/:invoice_id/payment-intent
+func (h *BillingHandler) CreatePaymentIntent(c *gin.Context) {
+	invoiceID, err := primitive.ObjectIDFromHex(c.Param("invoice_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return
+	}
+
+	intent, err := h.paymentService.CreatePaymentIntent(c.Request.Context(), invoiceID)
+	if err != nil {
+		c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, intent)
+}
+
+// RefundInvoicePayment refunds a payment made against an invoice, in full if
+// no amount is given
+// POST /v1/billing/invoice/:invoice_id/refund
+func (h *BillingHandler) RefundInvoicePayment(c *gin.Context) {
+	invoiceID, err := primitive.ObjectIDFromHex(c.Param("invoice_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return
+	}
+
+	var req struct {
+		PaymentID string `json:"payment_id" binding:"required"`
+		Amount    int64  `json:"amount" binding:"gte=0"` // minor units of the invoice currency
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	refundID, err := h.paymentService.RefundInvoicePayment(c.Request.Context(), invoiceID, req.PaymentID, req.Amount)
+	if err != nil {
+		c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Refund processed successfully",
+		"refund_id": refundID,
 	})
 }
+
+// GetPaymentSettings retrieves the provider and currency an organization pays
+// with
+// GET /v1/organizations/:id/payment-settings
+func (h *BillingHandler) GetPaymentSettings(c *gin.Context) {
+	orgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return
+	}
+
+	settings, err := h.paymentService.GetPaymentSettings(c.Request.Context(), orgID)
+	if err != nil {
+		c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdatePaymentSettings sets the provider and currency an organization pays
+// with
+// PUT /v1/organizations/:id/payment-settings
+func (h *BillingHandler) UpdatePaymentSettings(c *gin.Context) {
+	orgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return
+	}
+
+	var req models.PaymentSettingsUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+
+	settings, err := h.paymentService.UpdatePaymentSettings(c.Request.Context(), orgID, &req)
+	if err != nil {
+		c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// HandleStripeWebhook verifies a Stripe webhook's signature and stores it for
+// processing. Handler failures are retried from the store, not reported to
+// Stripe.
+// POST /v1/webhooks/stripe
+func (h *BillingHandler) HandleStripeWebhook(c *gin.Context) {
+	payload, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read webhook payload"})
+		return
+	}
+
+	event, err := h.paymentService.HandleWebhook(c.Request.Context(), models.PaymentProviderStripe, payload, c.Request.Header)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidWebhookSignature) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": "Webhook processing failed", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"received": true, "event_id": event.EventID, "status": event.Status})
+}
+
+// paymentErrorStatus maps payment service errors to HTTP statuses
+func paymentErrorStatus(err error) int {
+	var stripeErr *services.StripeError
+	switch {
+	case errors.Is(err, services.ErrPaymentProviderNotConfigured), errors.Is(err, services.ErrPaymentOperationUnsupported),
+		errors.Is(err, services.ErrInvalidInvoiceStatus):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrInvoiceNotCollectable):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrPaymentNotConfirmed):
+		return http.StatusPaymentRequired
+	case errors.As(err, &stripeErr):
+		if stripeErr.Type == "card_error" {
+			return http.StatusPaymentRequired
+		}
+		return http.StatusBadGateway
+	case strings.HasSuffix(err.Error(), "not found"):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"pulse-control-plane/models"
+	"pulse-control-plane/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// BudgetHandler handles organization and project budgets
+type BudgetHandler struct {
+	budgetService *services.BudgetService
+}
+
+// NewBudgetHandler creates a new budget handler
+func NewBudgetHandler(budgetService *services.BudgetService) *BudgetHandler {
+	return &BudgetHandler{budgetService: budgetService}
+}
+
+// ListBudgets lists an organization's budget and its projects' budgets
+// GET /v1/organizations/:id/budgets
+func (h *BudgetHandler) ListBudgets(c *gin.Context) {
+	orgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return
+	}
+
+	budgets, err := h.budgetService.ListBudgets(c.Request.Context(), orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"budgets": budgets, "count": len(budgets)})
+}
+
+// ListBudgetAlerts lists an organization's most recent budget alerts
+// GET /v1/organizations/:id/budgets/alerts
+func (h *BudgetHandler) ListBudgetAlerts(c *gin.Context) {
+	orgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return
+	}
+
+	alerts, err := h.budgetService.ListAlerts(c.Request.Context(), orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"alerts": alerts, "count": len(alerts)})
+}
+
+// GetBudget returns an organization's budget, or a project's
+// GET /v1/organizations/:id/budget
+// GET /v1/organizations/:id/projects/:project_id/budget
+func (h *BudgetHandler) GetBudget(c *gin.Context) {
+	orgID, projectID, ok := budgetScope(c)
+	if !ok {
+		return
+	}
+
+	budget, err := h.budgetService.GetBudget(c.Request.Context(), orgID, projectID)
+	if err != nil {
+		c.JSON(budgetErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, budget)
+}
+
+// SetBudget creates or replaces an organization's budget, or a project's
+// PUT /v1/organizations/:id/budget
+// PUT /v1/organizations/:id/projects/:project_id/budget
+func (h *BudgetHandler) SetBudget(c *gin.Context) {
+	orgID, projectID, ok := budgetScope(c)
+	if !ok {
+		return
+	}
+
+	var req models.BudgetInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	budget, err := h.budgetService.SetBudget(c.Request.Context(), orgID, projectID, &req)
+	if err != nil {
+		c.JSON(budgetErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Budget saved successfully",
+		"budget":  budget,
+	})
+}
+
+// DeleteBudget removes an organization's budget, or a project's, lifting
+// its hard cap
+// DELETE /v1/organizations/:id/budget
+// DELETE /v1/organizations/:id/projects/:project_id/budget
+func (h *BudgetHandler) DeleteBudget(c *gin.Context) {
+	orgID, projectID, ok := budgetScope(c)
+	if !ok {
+		return
+	}
+
+	if err := h.budgetService.DeleteBudget(c.Request.Context(), orgID, projectID); err != nil {
+		c.JSON(budgetErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Budget deleted successfully"})
+}
+
+// budgetScope reads the organization and optional project of a budget
+// route, writing the error response if either is invalid
+func budgetScope(c *gin.Context) (primitive.ObjectID, *primitive.ObjectID, bool) {
+	orgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return orgID, nil, false
+	}
+	if c.Param("project_id") == "" {
+		return orgID, nil, true
+	}
+
+	projectID, err := primitive.ObjectIDFromHex(c.Param("project_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return orgID, nil, false
+	}
+	return orgID, &projectID, true
+}
+
+// budgetErrorStatus maps budget errors to HTTP status codes
+func budgetErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrBudgetNotFound), strings.HasSuffix(err.Error(), "not found"):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"pulse-control-plane/models"
+	"pulse-control-plane/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreditHandler handles credit ledger and promo code HTTP requests
+type CreditHandler struct {
+	creditService  *services.CreditService
+	paymentService *services.PaymentService
+}
+
+// NewCreditHandler creates a new credit handler
+func NewCreditHandler(creditService *services.CreditService, paymentService *services.PaymentService) *CreditHandler {
+	return &CreditHandler{
+		creditService:  creditService,
+		paymentService: paymentService,
+	}
+}
+
+// GetCreditBalance returns an organization's unexpired credit
+// GET /v1/organizations/:id/credits
+func (h *CreditHandler) GetCreditBalance(c *gin.Context) {
+	orgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return
+	}
+
+	balance, err := h.creditService.GetBalance(c.Request.Context(), orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, balance)
+}
+
+// ListCreditLedger lists an organization's credit ledger entries
+// GET /v1/organizations/:id/credits/ledger
+func (h *CreditHandler) ListCreditLedger(c *gin.Context) {
+	orgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	entries, total, err := h.creditService.ListEntries(c.Request.Context(), orgID, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries": entries,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// PurchaseCredits adds prepaid credit for a payment the provider confirms
+// POST /v1/organizations/:id/credits/purchase
+func (h *CreditHandler) PurchaseCredits(c *gin.Context) {
+	orgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return
+	}
+
+	var req models.CreditPurchase
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	payment, err := h.paymentService.VerifyPayment(c.Request.Context(), orgID, req.Provider, req.PaymentID)
+	if err != nil {
+		c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	entry, err := h.creditService.PurchaseCredits(c.Request.Context(), orgID, payment)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, entry)
+}
+
+// RedeemPromoCode grants a promo code's credit to an organization
+// POST /v1/organizations/:id/credits/redeem
+func (h *CreditHandler) RedeemPromoCode(c *gin.Context) {
+	orgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return
+	}
+
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entry, err := h.creditService.RedeemPromoCode(c.Request.Context(), orgID, req.Code)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, entry)
+}
+
+// CreatePromoCode creates a promo code
+// POST /v1/promo-codes
+func (h *CreditHandler) CreatePromoCode(c *gin.Context) {
+	var promo models.PromoCode
+	if err := c.ShouldBindJSON(&promo); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.creditService.CreatePromoCode(c.Request.Context(), &promo); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, promo)
+}
+
+// ListPromoCodes lists promo codes
+// GET /v1/promo-codes
+func (h *CreditHandler) ListPromoCodes(c *gin.Context) {
+	promos, err := h.creditService.ListPromoCodes(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"promo_codes": promos, "count": len(promos)})
+}
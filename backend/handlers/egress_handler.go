@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"pulse-control-plane/models"
 	"pulse-control-plane/services"
@@ -18,9 +21,9 @@ type EgressHandler struct {
 }
 
 // NewEgressHandler creates a new egress handler
-func NewEgressHandler() *EgressHandler {
+func NewEgressHandler(quotaService *services.QuotaService, concurrencyService *services.ConcurrencyService, usageService *services.UsageService, egressClients *services.LiveKitEgressClients, encodingPresets *services.EncodingPresetService) *EgressHandler {
 	return &EgressHandler{
-		egressService: services.NewEgressService(),
+		egressService: services.NewEgressService(quotaService, concurrencyService, usageService, egressClients, encodingPresets),
 	}
 }
 
@@ -46,24 +49,22 @@ func (h *EgressHandler) StartEgress(c *gin.Context) {
 	// Validate egress type
 	if req.EgressType != models.EgressTypeRoomComposite && 
 	   req.EgressType != models.EgressTypeTrackComposite && 
-	   req.EgressType != models.EgressTypeTrack {
+	   req.EgressType != models.EgressTypeTrack && 
+	   req.EgressType != models.EgressTypeWeb {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid egress type"})
 		return
 	}
 	
-	// Validate output type
-	if req.OutputType != models.OutputTypeHLS && 
-	   req.OutputType != models.OutputTypeRTMP && 
-	   req.OutputType != models.OutputTypeFile {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid output type"})
-		return
-	}
+	// Outputs are validated with the egress type by the service
 	
 	// Start egress
 	egress, err := h.egressService.StartEgress(c.Request.Context(), proj.ID, proj, &req)
 	if err != nil {
+		if respondLimitExceeded(c, err) {
+			return
+		}
 		log.Error().Err(err).Msg("Failed to start egress")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(egressErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 	
@@ -80,6 +81,15 @@ func (h *EgressHandler) StartEgress(c *gin.Context) {
 
 // StopEgress handles POST /v1/media/egress/stop
 func (h *EgressHandler) StopEgress(c *gin.Context) {
+	// Get project from context
+	project, exists := c.Get("project")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	
+	proj := project.(*models.Project)
+	
 	// Get egress ID from request body
 	var req struct {
 		EgressID string `json:"egress_id" binding:"required"`
@@ -98,10 +108,10 @@ func (h *EgressHandler) StopEgress(c *gin.Context) {
 	}
 	
 	// Stop egress
-	egress, err := h.egressService.StopEgress(c.Request.Context(), egressID)
+	egress, err := h.egressService.StopEgress(c.Request.Context(), proj, egressID)
 	if err != nil {
 		log.Error().Err(err).Str("egress_id", req.EgressID).Msg("Failed to stop egress")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(egressErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 	
@@ -116,6 +126,90 @@ func (h *EgressHandler) StopEgress(c *gin.Context) {
 	})
 }
 
+// UpdateLayout handles POST /v1/media/egress/:id/layout
+func (h *EgressHandler) UpdateLayout(c *gin.Context) {
+	// Get project from context
+	project, exists := c.Get("project")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	
+	proj := project.(*models.Project)
+	
+	// Parse egress ID
+	egressID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid egress ID"})
+		return
+	}
+	
+	var req models.EgressLayoutUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	egress, err := h.egressService.UpdateLayout(c.Request.Context(), proj, egressID, req.LayoutType)
+	if err != nil {
+		log.Error().Err(err).Str("egress_id", egressID.Hex()).Msg("Failed to update egress layout")
+		c.JSON(egressErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Egress layout updated successfully",
+		"egress": h.egressService.ToResponse(egress),
+	})
+}
+
+// AddStreamURLs handles POST /v1/media/egress/:id/streams
+func (h *EgressHandler) AddStreamURLs(c *gin.Context) {
+	h.updateStream(c, h.egressService.AddStreamURLs)
+}
+
+// RemoveStreamURLs handles DELETE /v1/media/egress/:id/streams
+func (h *EgressHandler) RemoveStreamURLs(c *gin.Context) {
+	h.updateStream(c, h.egressService.RemoveStreamURLs)
+}
+
+// updateStream adds or removes RTMP destinations of a running egress
+func (h *EgressHandler) updateStream(c *gin.Context, update func(context.Context, *models.Project, primitive.ObjectID, []string) (*models.Egress, error)) {
+	// Get project from context
+	project, exists := c.Get("project")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	
+	proj := project.(*models.Project)
+	
+	// Parse egress ID
+	egressID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid egress ID"})
+		return
+	}
+	
+	var req models.EgressStreamURLs
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	egress, err := update(c.Request.Context(), proj, egressID, req.URLs)
+	if err != nil {
+		log.Error().Err(err).Str("egress_id", egressID.Hex()).Msg("Failed to update egress streams")
+		c.JSON(egressErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Egress streams updated successfully",
+		"egress": h.egressService.ToResponse(egress),
+	})
+}
+
 // GetEgress handles GET /v1/media/egress/:id
 func (h *EgressHandler) GetEgress(c *gin.Context) {
 	// Get egress ID from URL
@@ -185,3 +279,39 @@ func (h *EgressHandler) ListEgresses(c *gin.Context) {
 		"limit": limit,
 	})
 }
+
+// egressErrorStatus maps egress errors, including LiveKit's Twirp error
+// codes, to HTTP status codes
+func egressErrorStatus(err error) int {
+	var liveKitErr *services.LiveKitError
+	switch {
+	case errors.Is(err, services.ErrInvalidEgressRequest), errors.Is(err, services.ErrEncodingPresetNotFound):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrEncodingNotAllowed):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrLiveKitNotConfigured):
+		return http.StatusServiceUnavailable
+	case errors.As(err, &liveKitErr):
+		switch liveKitErr.Code {
+		case "invalid_argument", "malformed", "out_of_range":
+			return http.StatusBadRequest
+		case "not_found":
+			return http.StatusNotFound
+		case "already_exists", "failed_precondition":
+			return http.StatusConflict
+		case "resource_exhausted":
+			return http.StatusTooManyRequests
+		case "unavailable", "deadline_exceeded":
+			return http.StatusServiceUnavailable
+		default:
+			// Includes unauthenticated, i.e. our region credentials are wrong
+			return http.StatusBadGateway
+		}
+	case strings.HasSuffix(err.Error(), "not found"):
+		return http.StatusNotFound
+	case strings.HasSuffix(err.Error(), "not active"):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"pulse-control-plane/models"
+	"pulse-control-plane/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EncodingPresetHandler handles a project's egress encoding presets
+type EncodingPresetHandler struct {
+	encodingPresetService *services.EncodingPresetService
+}
+
+// NewEncodingPresetHandler creates a new encoding preset handler
+func NewEncodingPresetHandler(encodingPresetService *services.EncodingPresetService) *EncodingPresetHandler {
+	return &EncodingPresetHandler{encodingPresetService: encodingPresetService}
+}
+
+// ListPresets lists the built-in presets and the project's own
+// GET /v1/media/encoding-presets
+func (h *EncodingPresetHandler) ListPresets(c *gin.Context) {
+	project, ok := requestProject(c)
+	if !ok {
+		return
+	}
+
+	presets, err := h.encodingPresetService.ListPresets(c.Request.Context(), project.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"presets": presets, "count": len(presets)})
+}
+
+// GetPreset returns a preset by name
+// GET /v1/media/encoding-presets/:name
+func (h *EncodingPresetHandler) GetPreset(c *gin.Context) {
+	project, ok := requestProject(c)
+	if !ok {
+		return
+	}
+
+	preset, err := h.encodingPresetService.GetPreset(c.Request.Context(), project.ID, c.Param("name"))
+	if err != nil {
+		c.JSON(encodingPresetErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, preset)
+}
+
+// SavePreset creates or replaces a project preset
+// POST /v1/media/encoding-presets
+// PUT /v1/media/encoding-presets/:name
+func (h *EncodingPresetHandler) SavePreset(c *gin.Context) {
+	project, ok := requestProject(c)
+	if !ok {
+		return
+	}
+
+	var req models.EncodingPresetInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if name := c.Param("name"); name != "" {
+		// The name in the path wins over the body
+		req.Name = name
+	}
+
+	preset, err := h.encodingPresetService.SavePreset(c.Request.Context(), project, &req)
+	if err != nil {
+		c.JSON(encodingPresetErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Encoding preset saved successfully",
+		"preset":  preset,
+	})
+}
+
+// DeletePreset deletes a project preset
+// DELETE /v1/media/encoding-presets/:name
+func (h *EncodingPresetHandler) DeletePreset(c *gin.Context) {
+	project, ok := requestProject(c)
+	if !ok {
+		return
+	}
+
+	if err := h.encodingPresetService.DeletePreset(c.Request.Context(), project.ID, c.Param("name")); err != nil {
+		c.JSON(encodingPresetErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Encoding preset deleted successfully"})
+}
+
+// encodingPresetErrorStatus maps encoding preset errors to HTTP status codes
+func encodingPresetErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrEncodingPresetNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidEgressRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrEncodingNotAllowed):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
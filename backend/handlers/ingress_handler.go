@@ -18,9 +18,9 @@ type IngressHandler struct {
 }
 
 // NewIngressHandler creates a new ingress handler
-func NewIngressHandler() *IngressHandler {
+func NewIngressHandler(quotaService *services.QuotaService, concurrencyService *services.ConcurrencyService) *IngressHandler {
 	return &IngressHandler{
-		ingressService: services.NewIngressService(),
+		ingressService: services.NewIngressService(quotaService, concurrencyService),
 	}
 }
 
@@ -54,6 +54,9 @@ func (h *IngressHandler) CreateIngress(c *gin.Context) {
 	// Create ingress
 	ingress, err := h.ingressService.CreateIngress(c.Request.Context(), proj.ID, proj, &req)
 	if err != nil {
+		if respondLimitExceeded(c, err) {
+			return
+		}
 		log.Error().Err(err).Msg("Failed to create ingress")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
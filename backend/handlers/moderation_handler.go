@@ -8,7 +8,6 @@ import (
 	"pulse-control-plane/services"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // ModerationHandler handles moderation-related requests
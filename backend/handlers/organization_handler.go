@@ -170,6 +170,82 @@ func (h *OrganizationHandler) UpdateOrganization(c *gin.Context) {
 	c.JSON(http.StatusOK, org)
 }
 
+// GetTaxProfile retrieves an organization's billing address and tax ID
+// @Summary Get tax profile
+// @Description Get an organization's billing address and tax ID
+// @Tags organizations
+// @Produce json
+// @Param id path string true "Organization ID"
+// @Success 200 {object} models.TaxProfile
+// @Router /v1/organizations/{id}/tax-profile [get]
+func (h *OrganizationHandler) GetTaxProfile(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid organization ID format",
+		})
+		return
+	}
+
+	org, err := h.service.GetOrganization(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if org.TaxProfile == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "tax profile not set",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, org.TaxProfile)
+}
+
+// UpdateTaxProfile sets an organization's billing address and tax ID
+// @Summary Update tax profile
+// @Description Set an organization's billing address and GSTIN or EU VAT ID
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param id path string true "Organization ID"
+// @Param profile body models.TaxProfile true "Tax profile"
+// @Success 200 {object} models.TaxProfile
+// @Router /v1/organizations/{id}/tax-profile [put]
+func (h *OrganizationHandler) UpdateTaxProfile(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid organization ID format",
+		})
+		return
+	}
+
+	var profile models.TaxProfile
+	if err := c.ShouldBindJSON(&profile); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid input: " + err.Error(),
+		})
+		return
+	}
+
+	org, err := h.service.UpdateTaxProfile(c.Request.Context(), id, &profile)
+	if err != nil {
+		status := http.StatusBadRequest
+		if err.Error() == "organization not found" {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, org.TaxProfile)
+}
+
 // DeleteOrganization soft deletes an organization
 // @Summary Delete organization
 // @Description Soft delete an organization
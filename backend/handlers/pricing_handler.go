@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"pulse-control-plane/models"
+	"pulse-control-plane/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PricingHandler handles pricing plan HTTP requests
+type PricingHandler struct {
+	pricingService *services.PricingService
+	quotaService   *services.QuotaService
+}
+
+// NewPricingHandler creates a new pricing handler
+func NewPricingHandler(pricingService *services.PricingService, quotaService *services.QuotaService) *PricingHandler {
+	return &PricingHandler{
+		pricingService: pricingService,
+		quotaService:   quotaService,
+	}
+}
+
+// CreatePricingPlan creates version 1 of a new pricing plan
+// POST /v1/pricing-plans
+func (h *PricingHandler) CreatePricingPlan(c *gin.Context) {
+	var plan models.PricingPlan
+	if err := c.ShouldBindJSON(&plan); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.pricingService.CreatePlan(c.Request.Context(), &plan); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, plan)
+}
+
+// ListPricingPlans lists the active version of each plan, or every version of
+// one plan when code is given. Custom plans are listed with custom=true.
+// GET /v1/pricing-plans
+func (h *PricingHandler) ListPricingPlans(c *gin.Context) {
+	plans, err := h.pricingService.ListPlans(c.Request.Context(), c.Query("code"), c.Query("custom") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"plans": plans, "count": len(plans)})
+}
+
+// GetPricingPlan retrieves a plan version
+// GET /v1/pricing-plans/:id
+func (h *PricingHandler) GetPricingPlan(c *gin.Context) {
+	planID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pricing plan ID format"})
+		return
+	}
+
+	plan, err := h.pricingService.GetPlan(c.Request.Context(), planID)
+	if err != nil {
+		c.JSON(pricingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
+
+// PublishPricingPlanVersion publishes a new version of the plan that :id is a
+// version of. Existing subscribers stay on the version they have.
+// POST /v1/pricing-plans/:id/versions
+func (h *PricingHandler) PublishPricingPlanVersion(c *gin.Context) {
+	planID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pricing plan ID format"})
+		return
+	}
+
+	existing, err := h.pricingService.GetPlan(c.Request.Context(), planID)
+	if err != nil {
+		c.JSON(pricingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	var plan models.PricingPlan
+	if err := c.ShouldBindJSON(&plan); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.pricingService.PublishVersion(c.Request.Context(), existing.Code, &plan); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, plan)
+}
+
+// GetOrganizationPricingPlan returns the plan version an organization is billed on
+// GET /v1/organizations/:id/pricing-plan
+func (h *PricingHandler) GetOrganizationPricingPlan(c *gin.Context) {
+	orgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return
+	}
+
+	org, plan, err := h.pricingService.ResolveOrgPlan(c.Request.Context(), orgID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"plan":          plan,
+		"grandfathered": org.PricingPlanID != nil && plan.Status == models.PricingPlanStatusSuperseded,
+	})
+}
+
+// AssignOrganizationPricingPlan pins an organization to a plan version, or to
+// the latest version of a plan code
+// PUT /v1/organizations/:id/pricing-plan
+func (h *PricingHandler) AssignOrganizationPricingPlan(c *gin.Context) {
+	orgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return
+	}
+
+	var req models.PricingPlanAssignment
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var plan *models.PricingPlan
+	switch {
+	case req.PlanID != "":
+		planID, err := primitive.ObjectIDFromHex(req.PlanID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pricing plan ID format"})
+			return
+		}
+		plan, err = h.pricingService.GetPlan(c.Request.Context(), planID)
+		if err != nil {
+			c.JSON(pricingErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+	case req.Code != "":
+		plan, err = h.pricingService.GetLatestPlan(c.Request.Context(), req.Code)
+		if err != nil {
+			c.JSON(pricingErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "plan_id or code is required"})
+		return
+	}
+
+	change, err := h.pricingService.AssignPlan(c.Request.Context(), orgID, plan, req.ChangedBy)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if change == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Organization is already on this pricing plan",
+			"plan":    plan,
+		})
+		return
+	}
+
+	// The plan's limits apply from now on
+	h.quotaService.Invalidate()
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Pricing plan assigned successfully",
+		"plan":    plan,
+		"change":  change,
+	})
+}
+
+// GetOrganizationPlanHistory lists an organization's plan changes, newest first
+// GET /v1/organizations/:id/plan-history
+func (h *PricingHandler) GetOrganizationPlanHistory(c *gin.Context) {
+	orgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return
+	}
+
+	changes, err := h.pricingService.ListPlanChanges(c.Request.Context(), orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"changes": changes, "count": len(changes)})
+}
+
+// pricingErrorStatus maps pricing plan lookup errors to HTTP status codes
+func pricingErrorStatus(err error) int {
+	if errors.Is(err, services.ErrPricingPlanNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
@@ -16,9 +16,9 @@ type ProjectHandler struct {
 	service *services.ProjectService
 }
 
-func NewProjectHandler() *ProjectHandler {
+func NewProjectHandler(service *services.ProjectService) *ProjectHandler {
 	return &ProjectHandler{
-		service: services.NewProjectService(),
+		service: service,
 	}
 }
 
@@ -213,6 +213,48 @@ func (h *ProjectHandler) UpdateProject(c *gin.Context) {
 	c.JSON(http.StatusOK, project.ToResponse())
 }
 
+// SetConcurrencyOverrides replaces a project's concurrency limit overrides
+// PUT /v1/projects/:id/concurrency-limits
+func (h *ProjectHandler) SetConcurrencyOverrides(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+
+	var overrides models.ConcurrencyLimitOverrides
+	if err := c.ShouldBindJSON(&overrides); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	project, err := h.service.SetConcurrencyOverrides(c.Request.Context(), id, &overrides)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, project.ToResponse())
+}
+
+// ClearConcurrencyOverrides removes a project's concurrency limit overrides
+// DELETE /v1/projects/:id/concurrency-limits
+func (h *ProjectHandler) ClearConcurrencyOverrides(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+
+	project, err := h.service.SetConcurrencyOverrides(c.Request.Context(), id, nil)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, project.ToResponse())
+}
+
 // DeleteProject soft deletes a project
 // @Summary Delete project
 // @Description Soft delete a project
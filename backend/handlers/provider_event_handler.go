@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"pulse-control-plane/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ProviderEventHandler handles operator requests on stored payment provider
+// webhook events
+type ProviderEventHandler struct {
+	eventStore *services.ProviderEventStore
+}
+
+// NewProviderEventHandler creates a new provider event handler
+func NewProviderEventHandler(eventStore *services.ProviderEventStore) *ProviderEventHandler {
+	return &ProviderEventHandler{
+		eventStore: eventStore,
+	}
+}
+
+// ListEvents lists stored provider events, filtered by provider, status and type
+// GET /v1/billing/provider-events
+func (h *ProviderEventHandler) ListEvents(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	events, total, err := h.eventStore.List(c.Request.Context(), c.Query("provider"), c.Query("status"), c.Query("type"), page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve provider events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// GetEvent retrieves a stored provider event with its payload and outcome
+// GET /v1/billing/provider-events/:event_id
+func (h *ProviderEventHandler) GetEvent(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("event_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+		return
+	}
+
+	event, err := h.eventStore.Get(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, event)
+}
+
+// ReprocessEvent applies a stored provider event again
+// POST /v1/billing/provider-events/:event_id/reprocess
+func (h *ProviderEventHandler) ReprocessEvent(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("event_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+		return
+	}
+
+	event, err := h.eventStore.Reprocess(c.Request.Context(), id)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch err.Error() {
+		case "provider event not found":
+			status = http.StatusNotFound
+		case "provider event is being processed":
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, event)
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pulse-control-plane/models"
+	"pulse-control-plane/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// QuotaHandler handles quota, concurrency and limit override HTTP requests
+type QuotaHandler struct {
+	quotaService       *services.QuotaService
+	concurrencyService *services.ConcurrencyService
+}
+
+// NewQuotaHandler creates a new quota handler
+func NewQuotaHandler(quotaService *services.QuotaService, concurrencyService *services.ConcurrencyService) *QuotaHandler {
+	return &QuotaHandler{
+		quotaService:       quotaService,
+		concurrencyService: concurrencyService,
+	}
+}
+
+// GetQuota returns the quota state of the authenticated project's
+// organization for the current month
+// GET /v1/usage/:project_id/quota
+func (h *QuotaHandler) GetQuota(c *gin.Context) {
+	project, exists := c.Get("project")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	state, err := h.quotaService.GetQuotaState(c.Request.Context(), project.(*models.Project).OrgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, state)
+}
+
+// GetOrganizationQuota returns an organization's quota state for the current month
+// GET /v1/organizations/:id/usage/limits
+func (h *QuotaHandler) GetOrganizationQuota(c *gin.Context) {
+	orgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return
+	}
+
+	state, err := h.quotaService.GetQuotaState(c.Request.Context(), orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, state)
+}
+
+// GetConcurrency returns the authenticated project's live rooms, egresses and
+// ingresses against its concurrency limits. Pass reconcile=true to recount
+// egresses and ingresses from their records first.
+// GET /v1/usage/:project_id/concurrency
+func (h *QuotaHandler) GetConcurrency(c *gin.Context) {
+	project, exists := c.Get("project")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	proj := project.(*models.Project)
+
+	if c.Query("reconcile") == "true" {
+		if err := h.concurrencyService.Reconcile(c.Request.Context(), proj.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	state, err := h.concurrencyService.GetConcurrency(c.Request.Context(), proj)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, state)
+}
+
+// GetLimitOverrides returns an organization's limit overrides
+// GET /v1/organizations/:id/limits
+func (h *QuotaHandler) GetLimitOverrides(c *gin.Context) {
+	orgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return
+	}
+
+	overrides, err := h.quotaService.GetLimitOverrides(c.Request.Context(), orgID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"overrides": overrides})
+}
+
+// SetLimitOverrides replaces an organization's limit overrides
+// PUT /v1/organizations/:id/limits
+func (h *QuotaHandler) SetLimitOverrides(c *gin.Context) {
+	orgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return
+	}
+
+	var overrides models.PlanLimitOverrides
+	if err := c.ShouldBindJSON(&overrides); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if overrides.GracePercentage != nil && (*overrides.GracePercentage < 0 || *overrides.GracePercentage > 100) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "grace_percentage must be between 0 and 100"})
+		return
+	}
+
+	if err := h.quotaService.SetLimitOverrides(c.Request.Context(), orgID, &overrides); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Limit overrides updated successfully",
+		"overrides": overrides,
+	})
+}
+
+// ClearLimitOverrides removes an organization's limit overrides
+// DELETE /v1/organizations/:id/limits
+func (h *QuotaHandler) ClearLimitOverrides(c *gin.Context) {
+	orgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return
+	}
+
+	if err := h.quotaService.SetLimitOverrides(c.Request.Context(), orgID, nil); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Limit overrides cleared successfully"})
+}
+
+// respondLimitExceeded writes a structured quota or concurrency error and
+// reports whether err was one
+func respondLimitExceeded(c *gin.Context, err error) bool {
+	var concurrencyErr *services.ConcurrencyLimitError
+	if errors.As(err, &concurrencyErr) {
+		c.JSON(concurrencyErr.HTTPStatus, gin.H{
+			"error":       concurrencyErr.Error(),
+			"concurrency": concurrencyErr,
+		})
+		return true
+	}
+
+	var quotaErr *services.QuotaExceededError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+
+	if quotaErr.HTTPStatus == http.StatusTooManyRequests {
+		retryAfter := int(time.Until(quotaErr.ResetsAt).Seconds())
+		if retryAfter > 0 {
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+		}
+	}
+
+	c.JSON(quotaErr.HTTPStatus, gin.H{
+		"error": quotaErr.Error(),
+		"quota": quotaErr,
+	})
+	return true
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"io"
 	"net/http"
 	"strconv"
@@ -200,14 +201,22 @@ func (h *RazorpayHandler) HandleWebhook(c *gin.Context) {
 		return
 	}
 
-	// Process webhook
-	err = h.razorpayService.ProcessWebhook(c.Request.Context(), payload, signature)
+	// Store and process webhook; handler failures are retried from the store
+	event, err := h.razorpayService.ProcessWebhook(c.Request.Context(), payload, signature, c.GetHeader("X-Razorpay-Event-Id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Webhook processing failed", "details": err.Error()})
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidWebhookSignature) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": "Webhook processing failed", "details": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Webhook processed successfully"})
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Webhook received",
+		"event_id": event.EventID,
+		"status":   event.Status,
+	})
 }
 
 // GetInvoices retrieves Razorpay invoices for a project
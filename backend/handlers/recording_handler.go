@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"pulse-control-plane/models"
+	"pulse-control-plane/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RecordingHandler handles a project's recording library and retention
+// policies
+type RecordingHandler struct {
+	recordingService *services.RecordingService
+}
+
+// NewRecordingHandler creates a new recording handler
+func NewRecordingHandler(recordingService *services.RecordingService) *RecordingHandler {
+	return &RecordingHandler{recordingService: recordingService}
+}
+
+// ListRecordings searches the project's recordings
+// GET /v1/media/recordings
+func (h *RecordingHandler) ListRecordings(c *gin.Context) {
+	project, ok := requestProject(c)
+	if !ok {
+		return
+	}
+
+	var filter models.RecordingFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for param, date := range map[string]*time.Time{"start_date": &filter.StartDate, "end_date": &filter.EndDate} {
+		if value := c.Query(param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param + ", expected RFC 3339"})
+				return
+			}
+			*date = t
+		}
+	}
+
+	recordings, total, err := h.recordingService.ListRecordings(c.Request.Context(), project.ID, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"recordings": recordings,
+		"total":      total,
+		"page":       filter.Page,
+		"limit":      filter.Limit,
+	})
+}
+
+// GetRecording returns a recording
+// GET /v1/media/recordings/:id
+func (h *RecordingHandler) GetRecording(c *gin.Context) {
+	project, recordingID, ok := recordingScope(c)
+	if !ok {
+		return
+	}
+
+	recording, err := h.recordingService.GetRecording(c.Request.Context(), project.ID, recordingID)
+	if err != nil {
+		c.JSON(recordingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, recording)
+}
+
+// SetTags replaces the tags of a recording
+// PUT /v1/media/recordings/:id/tags
+func (h *RecordingHandler) SetTags(c *gin.Context) {
+	project, recordingID, ok := recordingScope(c)
+	if !ok {
+		return
+	}
+
+	var req models.RecordingTagsUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	recording, err := h.recordingService.SetTags(c.Request.Context(), project.ID, recordingID, req.Tags)
+	if err != nil {
+		c.JSON(recordingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recording": recording})
+}
+
+// DeleteRecording deletes a recording and removes it from storage
+// DELETE /v1/media/recordings/:id
+func (h *RecordingHandler) DeleteRecording(c *gin.Context) {
+	project, recordingID, ok := recordingScope(c)
+	if !ok {
+		return
+	}
+
+	if err := h.recordingService.DeleteRecording(c.Request.Context(), project, recordingID); err != nil {
+		c.JSON(recordingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Recording deleted successfully"})
+}
+
+// ListPolicies lists the project's retention policies
+// GET /v1/media/recording-retention-policies
+func (h *RecordingHandler) ListPolicies(c *gin.Context) {
+	project, ok := requestProject(c)
+	if !ok {
+		return
+	}
+
+	policies, err := h.recordingService.ListPolicies(c.Request.Context(), project.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"policies": policies, "count": len(policies)})
+}
+
+// CreatePolicy creates a retention policy
+// POST /v1/media/recording-retention-policies
+func (h *RecordingHandler) CreatePolicy(c *gin.Context) {
+	project, ok := requestProject(c)
+	if !ok {
+		return
+	}
+
+	var req models.RetentionPolicyInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy, err := h.recordingService.CreatePolicy(c.Request.Context(), project.ID, &req)
+	if err != nil {
+		c.JSON(recordingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Retention policy created successfully",
+		"policy":  policy,
+	})
+}
+
+// DeletePolicy deletes a retention policy
+// DELETE /v1/media/recording-retention-policies/:id
+func (h *RecordingHandler) DeletePolicy(c *gin.Context) {
+	project, policyID, ok := recordingScope(c)
+	if !ok {
+		return
+	}
+
+	if err := h.recordingService.DeletePolicy(c.Request.Context(), project.ID, policyID); err != nil {
+		c.JSON(recordingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Retention policy deleted successfully"})
+}
+
+// recordingScope reads the project and ID of a recording or retention
+// policy route, writing the error response if either is invalid
+func recordingScope(c *gin.Context) (*models.Project, primitive.ObjectID, bool) {
+	project, ok := requestProject(c)
+	if !ok {
+		return nil, primitive.NilObjectID, false
+	}
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return nil, primitive.NilObjectID, false
+	}
+	return project, id, true
+}
+
+// recordingErrorStatus maps recording errors to HTTP status codes
+func recordingErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrRecordingNotFound), errors.Is(err, services.ErrRetentionPolicyNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidRecordingRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrStorageNotConfigured):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
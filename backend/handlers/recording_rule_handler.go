@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"pulse-control-plane/models"
+	"pulse-control-plane/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RecordingRuleHandler handles a project's auto-recording rules
+type RecordingRuleHandler struct {
+	recordingRuleService *services.RecordingRuleService
+}
+
+// NewRecordingRuleHandler creates a new recording rule handler
+func NewRecordingRuleHandler(recordingRuleService *services.RecordingRuleService) *RecordingRuleHandler {
+	return &RecordingRuleHandler{recordingRuleService: recordingRuleService}
+}
+
+// ListRules lists the project's recording rules
+// GET /v1/media/recording-rules
+func (h *RecordingRuleHandler) ListRules(c *gin.Context) {
+	project, ok := requestProject(c)
+	if !ok {
+		return
+	}
+
+	rules, err := h.recordingRuleService.ListRules(c.Request.Context(), project.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": rules, "count": len(rules)})
+}
+
+// CreateRule creates a recording rule
+// POST /v1/media/recording-rules
+func (h *RecordingRuleHandler) CreateRule(c *gin.Context) {
+	project, ok := requestProject(c)
+	if !ok {
+		return
+	}
+
+	var req models.RecordingRuleInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule, err := h.recordingRuleService.CreateRule(c.Request.Context(), project.ID, &req)
+	if err != nil {
+		c.JSON(recordingRuleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Recording rule created successfully",
+		"rule":    rule,
+	})
+}
+
+// GetRule returns a recording rule
+// GET /v1/media/recording-rules/:id
+func (h *RecordingRuleHandler) GetRule(c *gin.Context) {
+	project, ruleID, ok := recordingRuleScope(c)
+	if !ok {
+		return
+	}
+
+	rule, err := h.recordingRuleService.GetRule(c.Request.Context(), project.ID, ruleID)
+	if err != nil {
+		c.JSON(recordingRuleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// UpdateRule replaces a recording rule
+// PUT /v1/media/recording-rules/:id
+func (h *RecordingRuleHandler) UpdateRule(c *gin.Context) {
+	project, ruleID, ok := recordingRuleScope(c)
+	if !ok {
+		return
+	}
+
+	var req models.RecordingRuleInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule, err := h.recordingRuleService.UpdateRule(c.Request.Context(), project.ID, ruleID, &req)
+	if err != nil {
+		c.JSON(recordingRuleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Recording rule updated successfully",
+		"rule":    rule,
+	})
+}
+
+// EnableRule switches a recording rule on
+// POST /v1/media/recording-rules/:id/enable
+func (h *RecordingRuleHandler) EnableRule(c *gin.Context) {
+	h.setEnabled(c, true)
+}
+
+// DisableRule switches a recording rule off
+// POST /v1/media/recording-rules/:id/disable
+func (h *RecordingRuleHandler) DisableRule(c *gin.Context) {
+	h.setEnabled(c, false)
+}
+
+// setEnabled switches a recording rule on or off
+func (h *RecordingRuleHandler) setEnabled(c *gin.Context, enabled bool) {
+	project, ruleID, ok := recordingRuleScope(c)
+	if !ok {
+		return
+	}
+
+	rule, err := h.recordingRuleService.SetEnabled(c.Request.Context(), project.ID, ruleID, enabled)
+	if err != nil {
+		c.JSON(recordingRuleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rule": rule})
+}
+
+// DeleteRule deletes a recording rule
+// DELETE /v1/media/recording-rules/:id
+func (h *RecordingRuleHandler) DeleteRule(c *gin.Context) {
+	project, ruleID, ok := recordingRuleScope(c)
+	if !ok {
+		return
+	}
+
+	if err := h.recordingRuleService.DeleteRule(c.Request.Context(), project.ID, ruleID); err != nil {
+		c.JSON(recordingRuleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Recording rule deleted successfully"})
+}
+
+// requestProject returns the authenticated project, writing the error
+// response if there is none
+func requestProject(c *gin.Context) (*models.Project, bool) {
+	project, exists := c.Get("project")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return nil, false
+	}
+	return project.(*models.Project), true
+}
+
+// recordingRuleScope reads the project and rule of a recording rule route,
+// writing the error response if either is invalid
+func recordingRuleScope(c *gin.Context) (*models.Project, primitive.ObjectID, bool) {
+	project, ok := requestProject(c)
+	if !ok {
+		return nil, primitive.NilObjectID, false
+	}
+	ruleID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recording rule ID"})
+		return nil, primitive.NilObjectID, false
+	}
+	return project, ruleID, true
+}
+
+// recordingRuleErrorStatus maps recording rule errors to HTTP status codes
+func recordingRuleErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrRecordingRuleNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidEgressRequest):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -19,10 +19,10 @@ type SLAHandler struct {
 }
 
 // NewSLAHandler creates a new SLA handler
-func NewSLAHandler() *SLAHandler {
+func NewSLAHandler(creditService *services.CreditService) *SLAHandler {
 	db := database.GetDB()
 	return &SLAHandler{
-		service: services.NewSLAService(db),
+		service: services.NewSLAService(db, creditService),
 	}
 }
 
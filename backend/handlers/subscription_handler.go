@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"pulse-control-plane/models"
+	"pulse-control-plane/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SubscriptionHandler handles self-service subscription changes
+type SubscriptionHandler struct {
+	subscriptionService *services.SubscriptionService
+	pricingService      *services.PricingService
+}
+
+// NewSubscriptionHandler creates a new subscription handler
+func NewSubscriptionHandler(subscriptionService *services.SubscriptionService, pricingService *services.PricingService) *SubscriptionHandler {
+	return &SubscriptionHandler{
+		subscriptionService: subscriptionService,
+		pricingService:      pricingService,
+	}
+}
+
+// GetSubscription returns an organization's subscription and billing cycle
+// GET /v1/organizations/:id/subscription
+func (h *SubscriptionHandler) GetSubscription(c *gin.Context) {
+	orgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return
+	}
+
+	details, err := h.subscriptionService.GetSubscription(c.Request.Context(), orgID)
+	if err != nil {
+		c.JSON(subscriptionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, details)
+}
+
+// Upgrade moves an organization onto a higher plan immediately, prorated on
+// the next invoice
+// POST /v1/organizations/:id/subscription/upgrade
+func (h *SubscriptionHandler) Upgrade(c *gin.Context) {
+	orgID, plan, ok := h.bindPlanChange(c)
+	if !ok {
+		return
+	}
+
+	details, err := h.subscriptionService.Upgrade(c.Request.Context(), orgID, plan, principal(c))
+	if err != nil {
+		c.JSON(subscriptionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Subscription upgraded successfully",
+		"subscription": details,
+	})
+}
+
+// Downgrade schedules a move onto a lower plan at the end of the billing cycle
+// POST /v1/organizations/:id/subscription/downgrade
+func (h *SubscriptionHandler) Downgrade(c *gin.Context) {
+	orgID, plan, ok := h.bindPlanChange(c)
+	if !ok {
+		return
+	}
+
+	details, err := h.subscriptionService.Downgrade(c.Request.Context(), orgID, plan, principal(c))
+	if err != nil {
+		c.JSON(subscriptionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Downgrade scheduled for the end of the billing cycle",
+		"subscription": details,
+	})
+}
+
+// Cancel cancels a subscription now or at the end of the billing cycle
+// POST /v1/organizations/:id/subscription/cancel
+func (h *SubscriptionHandler) Cancel(c *gin.Context) {
+	orgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return
+	}
+
+	var req models.SubscriptionCancel
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	details, err := h.subscriptionService.Cancel(c.Request.Context(), orgID, &req, principal(c))
+	if err != nil {
+		c.JSON(subscriptionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	message := "Subscription cancelled successfully"
+	if req.AtPeriodEnd {
+		message = "Cancellation scheduled for the end of the billing cycle"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":      message,
+		"subscription": details,
+	})
+}
+
+// Pause pauses a subscription, keeping Free plan limits until it resumes
+// POST /v1/organizations/:id/subscription/pause
+func (h *SubscriptionHandler) Pause(c *gin.Context) {
+	orgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return
+	}
+
+	details, err := h.subscriptionService.Pause(c.Request.Context(), orgID, principal(c))
+	if err != nil {
+		c.JSON(subscriptionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Subscription paused successfully",
+		"subscription": details,
+	})
+}
+
+// Resume resumes a paused subscription on the plan it was paused on
+// POST /v1/organizations/:id/subscription/resume
+func (h *SubscriptionHandler) Resume(c *gin.Context) {
+	orgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return
+	}
+
+	details, err := h.subscriptionService.Resume(c.Request.Context(), orgID, principal(c))
+	if err != nil {
+		c.JSON(subscriptionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Subscription resumed successfully",
+		"subscription": details,
+	})
+}
+
+// bindPlanChange reads the organization and target plan of an upgrade or
+// downgrade, writing the error response if either is invalid
+func (h *SubscriptionHandler) bindPlanChange(c *gin.Context) (primitive.ObjectID, *models.PricingPlan, bool) {
+	orgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return orgID, nil, false
+	}
+
+	var req models.PricingPlanAssignment
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return orgID, nil, false
+	}
+
+	var plan *models.PricingPlan
+	switch {
+	case req.PlanID != "":
+		planID, err := primitive.ObjectIDFromHex(req.PlanID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pricing plan ID format"})
+			return orgID, nil, false
+		}
+		plan, err = h.pricingService.GetPlan(c.Request.Context(), planID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return orgID, nil, false
+		}
+	case req.Code != "":
+		plan, err = h.pricingService.GetLatestPlan(c.Request.Context(), req.Code)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return orgID, nil, false
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "plan_id or code is required"})
+		return orgID, nil, false
+	}
+
+	return orgID, plan, true
+}
+
+// principal names the credentials that made a request, recorded in the
+// organization's plan history
+func principal(c *gin.Context) string {
+	return "project:" + c.GetString("project_id")
+}
+
+// subscriptionErrorStatus maps subscription errors to HTTP status codes
+func subscriptionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidPlanChange):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrSubscriptionState):
+		return http.StatusConflict
+	default:
+		return paymentErrorStatus(err)
+	}
+}
@@ -15,9 +15,9 @@ type TokenHandler struct {
 	service *services.TokenService
 }
 
-func NewTokenHandler(cfg *config.Config) *TokenHandler {
+func NewTokenHandler(cfg *config.Config, quotaService *services.QuotaService, concurrencyService *services.ConcurrencyService) *TokenHandler {
 	return &TokenHandler{
-		service: services.NewTokenService(cfg),
+		service: services.NewTokenService(cfg, quotaService, concurrencyService),
 	}
 }
 
@@ -30,6 +30,9 @@ func NewTokenHandler(cfg *config.Config) *TokenHandler {
 // @Security ApiKeyAuth
 // @Param request body services.TokenRequest true "Token request"
 // @Success 200 {object} services.TokenResponse
+// @Failure 402 {object} services.QuotaExceededError
+// @Failure 429 {object} services.QuotaExceededError
+// @Failure 429 {object} services.ConcurrencyLimitError
 // @Router /v1/tokens/create [post]
 func (h *TokenHandler) CreateToken(c *gin.Context) {
 	// Get project from context (set by AuthenticateProject middleware)
@@ -68,6 +71,9 @@ func (h *TokenHandler) CreateToken(c *gin.Context) {
 	// Create token
 	tokenResp, err := h.service.CreateToken(c.Request.Context(), projectID, &req)
 	if err != nil {
+		if respondLimitExceeded(c, err) {
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": err.Error(),
 		})
@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"pulse-control-plane/models"
@@ -141,7 +143,7 @@ func (h *UsageHandler) GetUsageSummary(c *gin.Context) {
 	// Get project to get organization plan
 	project, _ := c.Get("project")
 	if project != nil {
-		proj := project.(models.Project)
+		proj := project.(*models.Project)
 		// Get organization to get plan
 		// For now, we'll use a placeholder
 		_ = proj
@@ -249,7 +251,7 @@ func (h *UsageHandler) CheckLimits(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Project not found in context"})
 		return
 	}
-	proj := project.(models.Project)
+	proj := project.(*models.Project)
 
 	// Get organization to get plan (placeholder - would need actual org fetch)
 	plan := "Free" // Default to Free
@@ -280,3 +282,139 @@ func (h *UsageHandler) CheckLimits(c *gin.Context) {
 		})
 	}
 }
+
+// GetUsageBreakdown returns usage grouped by room, participant or a token
+// metadata tag. format=csv returns every row as a CSV download.
+// GET /v1/usage/:project_id/breakdown?group_by=room|participant|tag:<key>
+func (h *UsageHandler) GetUsageBreakdown(c *gin.Context) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("project_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	groupBy := c.Query("group_by")
+	if err := services.ValidateBreakdownDimension(groupBy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Dates are UTC days; end_date is inclusive
+	now := time.Now().UTC()
+	startDate := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	endDate := now
+	if startDateStr := c.Query("start_date"); startDateStr != "" {
+		startDate, err = time.Parse("2006-01-02", startDateStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_date format (use YYYY-MM-DD)"})
+			return
+		}
+	}
+	if endDateStr := c.Query("end_date"); endDateStr != "" {
+		endDate, err = time.Parse("2006-01-02", endDateStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date format (use YYYY-MM-DD)"})
+			return
+		}
+		endDate = endDate.AddDate(0, 0, 1)
+	}
+	if !startDate.Before(endDate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start_date must be before end_date"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 500 {
+		limit = 50
+	}
+
+	asCSV := c.Query("format") == "csv"
+	if asCSV {
+		page, limit = 1, 0
+	}
+
+	breakdown, err := h.usageService.GetUsageBreakdown(c.Request.Context(), projectID, groupBy, startDate, endDate, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve usage breakdown"})
+		return
+	}
+
+	if !asCSV {
+		c.JSON(http.StatusOK, breakdown)
+		return
+	}
+
+	csvData, err := services.UsageBreakdownCSV(breakdown)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("usage_%s_%s_%s.csv", strings.ReplaceAll(groupBy, ":", "_"), startDate.Format("2006-01-02"), endDate.Format("2006-01-02"))
+	c.Header("Content-Description", "File Transfer")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Length", fmt.Sprintf("%d", len(csvData)))
+
+	c.String(http.StatusOK, csvData)
+}
+
+// GetOrganizationUsage retrieves usage summed across an organization's projects
+// GET /v1/organizations/:id/usage
+func (h *UsageHandler) GetOrganizationUsage(c *gin.Context) {
+	orgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return
+	}
+
+	// Default to the current UTC month
+	now := time.Now().UTC()
+	startDate := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	endDate := now
+	if startDateStr := c.Query("start_date"); startDateStr != "" {
+		startDate, err = time.Parse("2006-01-02", startDateStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_date format (use YYYY-MM-DD)"})
+			return
+		}
+	}
+	if endDateStr := c.Query("end_date"); endDateStr != "" {
+		endDate, err = time.Parse("2006-01-02", endDateStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date format (use YYYY-MM-DD)"})
+			return
+		}
+	}
+
+	summary, err := h.usageService.GetOrgUsageSummary(c.Request.Context(), orgID, startDate, endDate)
+	if err != nil {
+		if err.Error() == "organization not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve organization usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// GetMeteringStats returns metering pipeline throughput and drop counters
+// GET /v1/status/metering
+func (h *UsageHandler) GetMeteringStats(c *gin.Context) {
+	stats := h.usageService.MeteringStats()
+	if stats == nil {
+		c.JSON(http.StatusOK, gin.H{"enabled": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled": true,
+		"stats":   stats,
+	})
+}
@@ -1,29 +1,43 @@
 package handlers
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"pulse-control-plane/models"
 	"pulse-control-plane/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // WebhookHandler handles webhook-related HTTP requests
 type WebhookHandler struct {
 	webhookService *services.WebhookService
+	eventBus       *services.EventBus
 	egressService  *services.EgressService
 	ingressService *services.IngressService
+	concurrency    *services.ConcurrencyService
+	usageService   *services.UsageService
+	recordingRules *services.RecordingRuleService
+	recordings     *services.RecordingService
 }
 
 // NewWebhookHandler creates a new webhook handler
-func NewWebhookHandler() *WebhookHandler {
+func NewWebhookHandler(webhookService *services.WebhookService, eventBus *services.EventBus, concurrencyService *services.ConcurrencyService, usageService *services.UsageService, recordingRules *services.RecordingRuleService, recordings *services.RecordingService) *WebhookHandler {
 	return &WebhookHandler{
-		webhookService: services.NewWebhookService(),
-		egressService:  services.NewEgressService(),
-		ingressService: services.NewIngressService(),
+		webhookService: webhookService,
+		eventBus:       eventBus,
+		usageService:   usageService,
+		egressService:  services.NewEgressService(nil, concurrencyService, usageService, nil, nil),
+		ingressService: services.NewIngressService(nil, concurrencyService),
+		concurrency:    concurrencyService,
+		recordingRules: recordingRules,
+		recordings:     recordings,
 	}
 }
 
@@ -54,6 +68,8 @@ func (h *WebhookHandler) HandleLiveKitWebhook(c *gin.Context) {
 		h.handleEgressStarted(c, payload)
 	case "egress_ended":
 		h.handleEgressEnded(c, payload)
+	case "recording_available":
+		h.handleRecordingAvailable(c, payload)
 	case "ingress_started":
 		h.handleIngressStarted(c, payload)
 	case "ingress_ended":
@@ -66,6 +82,8 @@ func (h *WebhookHandler) HandleLiveKitWebhook(c *gin.Context) {
 		h.handleRoomStarted(c, payload)
 	case "room_ended":
 		h.handleRoomEnded(c, payload)
+	case "track_published":
+		h.handleTrackPublished(c, payload)
 	default:
 		log.Warn().Str("event", eventType).Msg("Unknown webhook event type")
 	}
@@ -110,7 +128,65 @@ func (h *WebhookHandler) handleEgressEnded(c *gin.Context, payload map[string]in
 	err := h.egressService.UpdateEgressStatus(c.Request.Context(), egressID, status, errorMsg)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to update egress status")
+		return
+	}
+	
+	// Add what the egress stored to the recording library
+	if status == models.EgressStatusEnded {
+		if _, err := h.recordings.RecordEgress(c.Request.Context(), egressID, services.RecordingFiles(egressInfo(payload))); err != nil {
+			log.Error().Err(err).Str("egress_id", egressID).Msg("Failed to add egress recordings")
+		}
+	}
+}
+
+// handleRecordingAvailable processes a file an egress finished uploading,
+// adding it to the recording library
+func (h *WebhookHandler) handleRecordingAvailable(c *gin.Context, payload map[string]interface{}) {
+	egressID, ok := payload["egress_id"].(string)
+	if !ok {
+		return
+	}
+	
+	file, _ := payload["file"].(map[string]interface{})
+	key, _ := file["filename"].(string)
+	if key == "" {
+		key, _ = file["location"].(string)
+	}
+	if key == "" {
+		return
+	}
+	recordingFile := services.RecordingFile{Key: key}
+	recordingFile.Checksum, _ = file["checksum"].(string)
+	if size, ok := file["size"].(float64); ok {
+		recordingFile.SizeBytes = int64(size)
 	}
+	if duration, ok := file["duration"].(float64); ok {
+		recordingFile.Duration = time.Duration(duration) // nanoseconds, as LiveKit reports them
+	}
+	
+	if _, err := h.recordings.RecordEgress(c.Request.Context(), egressID, []services.RecordingFile{recordingFile}); err != nil {
+		log.Error().Err(err).Str("egress_id", egressID).Msg("Failed to add recording")
+	}
+	h.forwardEvent(models.WebhookEventRecordingAvailable, payload)
+}
+
+// egressInfo reads the egress info LiveKit sends with egress events, or nil
+// if there is none
+func egressInfo(payload map[string]interface{}) *services.LiveKitEgressInfo {
+	raw, ok := payload["egress_info"]
+	if !ok {
+		return nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+	var info services.LiveKitEgressInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		log.Warn().Err(err).Msg("Invalid egress info in webhook")
+		return nil
+	}
+	return &info
 }
 
 // handleIngressStarted processes ingress started event
@@ -159,24 +235,174 @@ func (h *WebhookHandler) handleParticipantJoined(c *gin.Context, payload map[str
 	projectIDStr, _ := payload["project_id"].(string)
 	roomName, _ := payload["room_name"].(string)
 	
-	// Forward to customer webhook
-	// Note: You would need to get the project from DB first
 	log.Info().Str("event", "participant_joined").Str("room", roomName).Str("project_id", projectIDStr).Msg("Participant joined")
+
+	if projectID, err := primitive.ObjectIDFromHex(projectIDStr); err == nil {
+		if err := h.concurrency.ParticipantJoined(c.Request.Context(), projectID, roomName, participantSID(payload)); err != nil {
+			log.Error().Err(err).Msg("Failed to track participant join")
+		}
+		participant, _ := payload["participant"].(map[string]interface{})
+		identity, _ := participant["identity"].(string)
+		if err := h.egressService.AddParticipant(c.Request.Context(), projectID, roomName, identity); err != nil {
+			log.Error().Err(err).Msg("Failed to record participant on egresses")
+		}
+	}
+	h.forwardEvent(models.WebhookEventParticipantJoined, payload)
 }
 
 // handleParticipantLeft processes participant left event
 func (h *WebhookHandler) handleParticipantLeft(c *gin.Context, payload map[string]interface{}) {
 	log.Info().Str("event", "participant_left").Msg("Participant left")
+
+	projectIDStr, _ := payload["project_id"].(string)
+	roomName, _ := payload["room_name"].(string)
+	if projectID, err := primitive.ObjectIDFromHex(projectIDStr); err == nil {
+		if err := h.concurrency.ParticipantLeft(c.Request.Context(), projectID, roomName, participantSID(payload)); err != nil {
+			log.Error().Err(err).Msg("Failed to track participant leave")
+		}
+		h.trackParticipantMinutes(c, projectID, roomName, payload)
+	}
+	h.forwardEvent(models.WebhookEventParticipantLeft, payload)
 }
 
 // handleRoomStarted processes room started event
 func (h *WebhookHandler) handleRoomStarted(c *gin.Context, payload map[string]interface{}) {
 	log.Info().Str("event", "room_started").Msg("Room started")
+
+	projectIDStr, _ := payload["project_id"].(string)
+	roomName, _ := payload["room_name"].(string)
+	if projectID, err := primitive.ObjectIDFromHex(projectIDStr); err == nil {
+		if err := h.concurrency.RoomStarted(c.Request.Context(), projectID, roomName); err != nil {
+			log.Error().Err(err).Msg("Failed to track room start")
+		}
+		if _, err := h.recordingRules.RoomStarted(c.Request.Context(), projectID, roomName); err != nil {
+			log.Error().Err(err).Msg("Failed to apply recording rules")
+		}
+	}
+	h.forwardEvent(models.WebhookEventRoomStarted, payload)
 }
 
 // handleRoomEnded processes room ended event
 func (h *WebhookHandler) handleRoomEnded(c *gin.Context, payload map[string]interface{}) {
 	log.Info().Str("event", "room_ended").Msg("Room ended")
+
+	projectIDStr, _ := payload["project_id"].(string)
+	roomName, _ := payload["room_name"].(string)
+	if projectID, err := primitive.ObjectIDFromHex(projectIDStr); err == nil {
+		if err := h.concurrency.RoomEnded(c.Request.Context(), projectID, roomName); err != nil {
+			log.Error().Err(err).Msg("Failed to track room end")
+		}
+		if _, err := h.recordingRules.RoomEnded(c.Request.Context(), projectID, roomName); err != nil {
+			log.Error().Err(err).Msg("Failed to stop rule recordings")
+		}
+	}
+	h.forwardEvent(models.WebhookEventRoomEnded, payload)
+}
+
+// handleTrackPublished processes track published event, starting the
+// recordings of matching track rules
+func (h *WebhookHandler) handleTrackPublished(c *gin.Context, payload map[string]interface{}) {
+	projectIDStr, _ := payload["project_id"].(string)
+	roomName, _ := payload["room_name"].(string)
+	track, _ := payload["track"].(map[string]interface{})
+	trackSID, _ := track["sid"].(string)
+	trackKind, _ := track["type"].(string)
+
+	log.Info().Str("event", "track_published").Str("room", roomName).Str("track", trackSID).Msg("Track published")
+
+	projectID, err := primitive.ObjectIDFromHex(projectIDStr)
+	if err != nil || trackSID == "" {
+		return
+	}
+	if _, err := h.recordingRules.TrackPublished(c.Request.Context(), projectID, roomName, trackSID, trackKind); err != nil {
+		log.Error().Err(err).Msg("Failed to apply recording rules")
+	}
+}
+
+// trackParticipantMinutes meters the session that just ended, tagged with the
+// participant's identity and token metadata for usage breakdowns
+func (h *WebhookHandler) trackParticipantMinutes(c *gin.Context, projectID primitive.ObjectID, roomName string, payload map[string]interface{}) {
+	if h.usageService == nil {
+		return
+	}
+
+	participant, _ := payload["participant"].(map[string]interface{})
+	joinedAt, ok := participant["joined_at"].(float64)
+	if !ok || joinedAt <= 0 {
+		return
+	}
+
+	leftAt := float64(time.Now().Unix())
+	if createdAt, ok := payload["created_at"].(float64); ok && createdAt > 0 {
+		leftAt = createdAt
+	}
+	minutes := (leftAt - joinedAt) / 60
+	if minutes <= 0 {
+		return
+	}
+
+	identity, _ := participant["identity"].(string)
+	err := h.usageService.TrackParticipantMinutes(c.Request.Context(), projectID, roomName, participantSID(payload), identity, participantTags(participant), minutes)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to track participant minutes")
+	}
+}
+
+// participantTags reads the token metadata LiveKit echoes back on the
+// participant, either as a JSON string or an object
+func participantTags(participant map[string]interface{}) map[string]string {
+	var raw map[string]interface{}
+	switch metadata := participant["metadata"].(type) {
+	case string:
+		if metadata == "" || json.Unmarshal([]byte(metadata), &raw) != nil {
+			return nil
+		}
+	case map[string]interface{}:
+		raw = metadata
+	default:
+		return nil
+	}
+
+	tags := make(map[string]string, len(raw))
+	for k, v := range raw {
+		tags[k] = fmt.Sprint(v)
+	}
+	return tags
+}
+
+// participantSID extracts the participant SID, falling back to identity
+func participantSID(payload map[string]interface{}) string {
+	participant, _ := payload["participant"].(map[string]interface{})
+	if sid, ok := participant["sid"].(string); ok && sid != "" {
+		return sid
+	}
+	identity, _ := participant["identity"].(string)
+	return identity
+}
+
+// forwardEvent publishes a LiveKit event to the project's customer webhook
+func (h *WebhookHandler) forwardEvent(event models.WebhookEventType, payload map[string]interface{}) {
+	projectIDStr, _ := payload["project_id"].(string)
+	projectID, err := primitive.ObjectIDFromHex(projectIDStr)
+	if err != nil {
+		return
+	}
+
+	roomName, _ := payload["room_name"].(string)
+	webhookPayload := &models.WebhookPayload{
+		Event:    event,
+		RoomName: roomName,
+	}
+
+	if participant, ok := payload["participant"].(map[string]interface{}); ok {
+		info := &models.ParticipantInfo{}
+		info.ID, _ = participant["sid"].(string)
+		info.Identity, _ = participant["identity"].(string)
+		info.Name, _ = participant["name"].(string)
+		webhookPayload.Participant = info
+	}
+
+	h.eventBus.PublishAsync(projectID, webhookPayload)
 }
 
 // GetWebhookLogs handles GET /v1/webhooks/logs
@@ -216,3 +442,23 @@ func (h *WebhookHandler) GetWebhookLogs(c *gin.Context) {
 		"limit": limit,
 	})
 }
+
+// PreviewWebhook handles POST /v1/webhooks/preview
+// Runs a sample payload through the filter and template without delivering it
+func (h *WebhookHandler) PreviewWebhook(c *gin.Context) {
+	project, exists := c.Get("project")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	
+	proj := project.(*models.Project)
+	
+	var req models.WebhookPreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+	
+	c.JSON(http.StatusOK, h.webhookService.PreviewWebhook(proj, &req))
+}
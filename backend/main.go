@@ -14,6 +14,7 @@ import (
 	"pulse-control-plane/routes"
 	"pulse-control-plane/services"
 	"pulse-control-plane/utils"
+	"pulse-control-plane/workers"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
@@ -46,6 +47,17 @@ func main() {
 		log.Error().Err(err).Msg("Failed to initialize regions")
 	}
 
+	// Initialize built-in pricing plans
+	pricingService := services.NewPricingService(database.GetDB())
+	if err := pricingService.InitializeDefaultPlans(ctx); err != nil {
+		log.Error().Err(err).Msg("Failed to initialize pricing plans")
+	}
+
+	// Convert amounts stored before invoices and credit used minor units
+	if err := services.MigrateMinorUnits(ctx, database.GetDB()); err != nil {
+		log.Error().Err(err).Msg("Failed to migrate amounts to minor units")
+	}
+
 	// Start region health check loop (every 5 minutes)
 	go regionService.RunHealthCheckLoop(ctx, 5*time.Minute)
 
@@ -61,8 +73,56 @@ func main() {
 	router := gin.New()
 	router.Use(gin.Recovery())
 
+	// Start usage metering pipeline
+	meteringPipeline := services.NewMeteringPipeline(database.GetDB(), services.MeteringConfig{
+		BufferSize:    cfg.MeteringBufferSize,
+		BatchSize:     cfg.MeteringBatchSize,
+		FlushInterval: cfg.MeteringFlushInterval,
+	})
+	meteringPipeline.Start()
+
+	// Build the services once; the routes and the workers share them
+	svc, err := routes.NewServices(cfg, meteringPipeline)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize services")
+	}
+
 	// Setup routes
-	routes.SetupRoutes(router, cfg)
+	routes.SetupRoutes(router, cfg, svc)
+
+	// Start usage aggregation (only the replica holding the lock aggregates)
+	db := database.GetDB()
+	aggregatorWorker := workers.NewUsageAggregatorWorker(
+		svc.AggregatorService,
+		services.NewLeaderLock(db, "usage_aggregator", 90*time.Minute),
+	)
+	aggregatorWorker.Start()
+
+	// Start scheduled billing (only the replica holding the lock bills)
+	billingWorker := workers.NewBillingWorker(
+		svc.BillingRunService,
+		svc.SubscriptionService,
+		services.NewLeaderLock(db, "billing_run", 2*time.Hour),
+	)
+	billingWorker.Start()
+
+	// Evaluate budgets for alerts and spend caps (only the lock holder)
+	budgetWorker := workers.NewBudgetWorker(
+		svc.BudgetService,
+		services.NewLeaderLock(db, "budget_evaluation", 30*time.Minute),
+	)
+	budgetWorker.Start()
+
+	// Delete expired recordings and sample recording storage (only the lock holder)
+	recordingRetentionWorker := workers.NewRecordingRetentionWorker(
+		svc.RecordingService,
+		services.NewLeaderLock(db, "recording_retention", 2*time.Hour),
+	)
+	recordingRetentionWorker.Start()
+
+	// Retry payment provider webhook events whose handler failed
+	providerEventWorker := workers.NewProviderEventWorker(svc.ProviderEventStore)
+	providerEventWorker.Start()
 
 	// Create HTTP server
 	srv := &http.Server{
@@ -93,8 +153,32 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	// Keep going on failure so buffered usage is still flushed
+	failed := false
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal().Err(err).Msg("Server forced to shutdown")
+		log.Error().Err(err).Msg("Server forced to shutdown")
+		failed = true
+	}
+
+	aggregatorWorker.Stop()
+	billingWorker.Stop()
+	budgetWorker.Stop()
+	recordingRetentionWorker.Stop()
+	providerEventWorker.Stop()
+
+	// Flush buffered usage after in-flight requests have finished
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer flushCancel()
+	if err := meteringPipeline.Stop(flushCtx); err != nil {
+		log.Error().Err(err).Msg("Failed to flush usage events")
+		failed = true
+	}
+
+	if failed {
+		// os.Exit skips deferred calls
+		database.DisconnectMongoDB()
+		log.Error().Msg("Server exited with errors")
+		os.Exit(1)
 	}
 
 	log.Info().Msg("✅ Server exited gracefully")
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"context"
+	"crypto/subtle"
 	"net/http"
 	"strings"
 
@@ -56,7 +57,7 @@ func AuthenticateProject() gin.HandlerFunc {
 
 		// Store project information in context
 		c.Set("project_id", project.ID.Hex())
-		c.Set("project", project)
+		c.Set("project", &project)
 		c.Set("org_id", project.OrgID.Hex())
 
 		log.Debug().Str("project_id", project.ID.Hex()).Str("project_name", project.Name).Msg("Project authenticated")
@@ -108,7 +109,7 @@ func AuthenticateAPISecret() gin.HandlerFunc {
 
 		// Store project information in context
 		c.Set("project_id", project.ID.Hex())
-		c.Set("project", project)
+		c.Set("project", &project)
 		c.Set("org_id", project.OrgID.Hex())
 
 		c.Next()
@@ -165,3 +166,41 @@ func RequireOrganization() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// RequireOrganizationAdmin restricts a route to the organization in its :id
+// parameter. It follows AuthenticateAPISecret: a project's key and secret are
+// the admin credentials of the organization that owns the project.
+func RequireOrganizationAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("org_id") == "" || c.GetString("org_id") != c.Param("id") {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Credentials do not belong to this organization",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// AuthenticateOperator restricts a route to Pulse operators, who present the
+// configured operator key in the X-Pulse-Operator-Key header. Operator routes
+// are disabled when no key is configured.
+func AuthenticateOperator(operatorKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("X-Pulse-Operator-Key")
+		if operatorKey == "" || key == "" || subtle.ConstantTimeCompare([]byte(key), []byte(operatorKey)) != 1 {
+			log.Warn().Str("path", c.FullPath()).Msg("Rejected operator request")
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Operator credentials required",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Set("operator", true)
+
+		c.Next()
+	}
+}
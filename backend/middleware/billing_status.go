@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"pulse-control-plane/database"
+	"pulse-control-plane/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RestrictSuspendedOrganizations makes the projects of organizations
+// suspended for non-payment read-only: only GET and HEAD requests are let
+// through, which also blocks token issuance. It must run after project
+// authentication.
+func RestrictSuspendedOrganizations() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		orgID, err := primitive.ObjectIDFromHex(c.GetString("org_id"))
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		var org models.Organization
+		err = database.GetCollection(models.Organization{}.TableName()).FindOne(
+			context.Background(),
+			bson.M{"_id": orgID},
+			options.FindOne().SetProjection(bson.M{"billing_status": 1}),
+		).Decode(&org)
+		if err == nil && org.BillingStatus == models.OrgBillingStatusSuspended {
+			c.JSON(http.StatusPaymentRequired, gin.H{
+				"error": "Organization is suspended for non-payment and is read-only until overdue invoices are paid",
+				"code":  "organization_suspended",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"pulse-control-plane/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MeterAPIRequests records one api_request usage event per authenticated
+// project request. It runs after the handler so project authentication
+// applied on route groups has already populated the context.
+func MeterAPIRequests(usageService *services.UsageService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		projectIDStr := c.GetString("project_id")
+		if projectIDStr == "" {
+			return
+		}
+
+		projectID, err := primitive.ObjectIDFromHex(projectIDStr)
+		if err != nil {
+			return
+		}
+
+		endpoint := c.FullPath()
+		if endpoint == "" {
+			endpoint = c.Request.URL.Path
+		}
+
+		// Enqueue is non-blocking, so this never slows the response down
+		if err := usageService.TrackAPIRequest(c.Request.Context(), projectID, c.Request.Method+" "+endpoint); err != nil {
+			log.Debug().Err(err).Str("project_id", projectIDStr).Msg("Failed to meter API request")
+		}
+	}
+}
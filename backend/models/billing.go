@@ -8,24 +8,49 @@ import (
 
 // Invoice represents a billing invoice
 type Invoice struct {
-	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	ProjectID       primitive.ObjectID `bson:"project_id" json:"project_id"`
-	OrgID           primitive.ObjectID `bson:"org_id" json:"org_id"`
-	InvoiceNumber   string             `bson:"invoice_number" json:"invoice_number"`
-	BillingPeriod   string             `bson:"billing_period" json:"billing_period"` // e.g., "2025-01"
-	PeriodStart     time.Time          `bson:"period_start" json:"period_start"`
-	PeriodEnd       time.Time          `bson:"period_end" json:"period_end"`
-	Status          string             `bson:"status" json:"status"` // draft, issued, paid, overdue
-	LineItems       []InvoiceLineItem  `bson:"line_items" json:"line_items"`
-	Subtotal        float64            `bson:"subtotal" json:"subtotal"`
-	Tax             float64            `bson:"tax" json:"tax"`
-	Total           float64            `bson:"total" json:"total"`
-	Currency        string             `bson:"currency" json:"currency"`
-	DueDate         time.Time          `bson:"due_date" json:"due_date"`
-	PaidAt          *time.Time         `bson:"paid_at,omitempty" json:"paid_at,omitempty"`
-	StripeInvoiceID string             `bson:"stripe_invoice_id,omitempty" json:"stripe_invoice_id,omitempty"`
-	CreatedAt       time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt       time.Time          `bson:"updated_at" json:"updated_at"`
+	ID              primitive.ObjectID     `bson:"_id,omitempty" json:"id"`
+	ProjectID       primitive.ObjectID     `bson:"project_id" json:"project_id"` // zero for organization invoices
+	OrgID           primitive.ObjectID     `bson:"org_id" json:"org_id"`
+	Scope           string                 `bson:"scope,omitempty" json:"scope,omitempty"` // project (default) or organization
+	InvoiceNumber   string                 `bson:"invoice_number" json:"invoice_number"`
+	BillingPeriod   string                 `bson:"billing_period" json:"billing_period"` // e.g., "2025-01"
+	PeriodStart     time.Time              `bson:"period_start" json:"period_start"`
+	PeriodEnd       time.Time              `bson:"period_end" json:"period_end"`
+	Status          string                 `bson:"status" json:"status"` // draft, issued, paid, overdue
+	LineItems       []InvoiceLineItem      `bson:"line_items" json:"line_items"`
+	Subtotal        int64                  `bson:"subtotal" json:"subtotal"` // amounts in the currency's minor units
+	Tax             int64                  `bson:"tax" json:"tax"`
+	TaxLines        []TaxLine              `bson:"tax_lines,omitempty" json:"tax_lines,omitempty"`
+	ReverseCharge   bool                   `bson:"reverse_charge,omitempty" json:"reverse_charge,omitempty"`
+	TaxNote         string                 `bson:"tax_note,omitempty" json:"tax_note,omitempty"`
+	CustomerTaxID   string                 `bson:"customer_tax_id,omitempty" json:"customer_tax_id,omitempty"`
+	BillingAddress  *BillingAddress        `bson:"billing_address,omitempty" json:"billing_address,omitempty"` // snapshot at invoicing
+	CreditsApplied  int64                  `bson:"credits_applied" json:"credits_applied"`                     // listed as negative line items; not in Subtotal
+	Total           int64                  `bson:"total" json:"total"`
+	Currency        string                 `bson:"currency" json:"currency"`
+	ExchangeRates   []ExchangeRateSnapshot `bson:"exchange_rates,omitempty" json:"exchange_rates,omitempty"` // rates plan prices were converted at
+	PricingPlanID   primitive.ObjectID     `bson:"pricing_plan_id,omitempty" json:"pricing_plan_id,omitempty"`
+	PlanVersion     int                    `bson:"plan_version,omitempty" json:"plan_version,omitempty"`
+	DueDate         time.Time              `bson:"due_date" json:"due_date"`
+	PaidAt          *time.Time             `bson:"paid_at,omitempty" json:"paid_at,omitempty"`
+	PaymentProvider string                 `bson:"payment_provider,omitempty" json:"payment_provider,omitempty"` // provider the invoice was pushed to
+	StripeInvoiceID string                 `bson:"stripe_invoice_id,omitempty" json:"stripe_invoice_id,omitempty"`
+	PDFURL          string                 `bson:"pdf_url,omitempty" json:"pdf_url,omitempty"` // rendered PDF in the project's bucket
+	PaymentLink     string                 `bson:"payment_link,omitempty" json:"payment_link,omitempty"`
+	CreatedAt       time.Time              `bson:"created_at" json:"created_at"`
+	UpdatedAt       time.Time              `bson:"updated_at" json:"updated_at"`
+}
+
+// InvoiceSequence allocates an organization's sequential invoice numbers,
+// shared by its project and consolidated invoices
+type InvoiceSequence struct {
+	OrgID primitive.ObjectID `bson:"_id" json:"org_id"`
+	Seq   int64              `bson:"seq" json:"seq"`
+}
+
+// TableName returns the collection name
+func (InvoiceSequence) TableName() string {
+	return "invoice_sequences"
 }
 
 // InvoiceLineItem represents a single line item in an invoice
@@ -33,8 +58,10 @@ type InvoiceLineItem struct {
 	Description string  `bson:"description" json:"description"`
 	Quantity    float64 `bson:"quantity" json:"quantity"`
 	Unit        string  `bson:"unit" json:"unit"` // minutes, GB, requests
-	UnitPrice   float64 `bson:"unit_price" json:"unit_price"`
-	Amount      float64 `bson:"amount" json:"amount"`
+	UnitPrice   float64 `bson:"unit_price" json:"unit_price"` // decimal, in the invoice currency
+	Amount      int64   `bson:"amount" json:"amount"`         // minor units
+	ProjectID   string  `bson:"project_id,omitempty" json:"project_id,omitempty"` // set on organization invoices
+	ProjectName string  `bson:"project_name,omitempty" json:"project_name,omitempty"`
 }
 
 // TableName returns the collection name
@@ -51,6 +78,12 @@ const (
 	InvoiceStatusVoid    = "void"
 )
 
+// Invoice scopes
+const (
+	InvoiceScopeProject      = "project"
+	InvoiceScopeOrganization = "organization"
+)
+
 // PricingModel represents the pricing structure
 type PricingModel struct {
 	ID                      primitive.ObjectID `bson:"_id,omitempty" json:"id"`
@@ -107,6 +140,18 @@ var (
 	}
 )
 
+// GetPricing returns the pricing for a plan, defaulting to Free
+func GetPricing(plan string) PricingModel {
+	switch plan {
+	case "Pro":
+		return ProPricing
+	case "Enterprise":
+		return EnterprisePricing
+	default:
+		return FreePricing
+	}
+}
+
 // BillingDashboardResponse represents the billing dashboard data
 type BillingDashboardResponse struct {
 	ProjectID       string                `json:"project_id"`
@@ -115,7 +160,21 @@ type BillingDashboardResponse struct {
 	UsageSummary    UsageSummary          `json:"usage_summary"`
 	CurrentCharges  float64               `json:"current_charges"`
 	ProjectedTotal  float64               `json:"projected_total"`
+	PricingPlan     *PricingPlan          `json:"pricing_plan"`
 	PlanLimits      PlanLimits            `json:"plan_limits"`
 	Alerts          []UsageAlert          `json:"alerts"`
 	RecentInvoices  []Invoice             `json:"recent_invoices"`
 }
+
+// OrgBillingDashboardResponse is the consolidated billing view of an organization
+type OrgBillingDashboardResponse struct {
+	OrgID          string          `json:"org_id"`
+	CurrentPlan    string          `json:"current_plan"`
+	BillingPeriod  string          `json:"billing_period"`
+	Usage          OrgUsageSummary `json:"usage"`
+	CurrentCharges float64         `json:"current_charges"`
+	ProjectedTotal float64         `json:"projected_total"`
+	PricingPlan    *PricingPlan    `json:"pricing_plan"`
+	PlanLimits     PlanLimits      `json:"plan_limits"`
+	RecentInvoices []Invoice       `json:"recent_invoices"`
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// BillingRun records the scheduled invoicing of one organization for one
+// billing cycle. It is unique per organization and period, so re-running the
+// billing job never invoices a cycle twice.
+type BillingRun struct {
+	ID             primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	OrgID          primitive.ObjectID  `bson:"org_id" json:"org_id"`
+	PeriodStart    time.Time           `bson:"period_start" json:"period_start"`
+	PeriodEnd      time.Time           `bson:"period_end" json:"period_end"`
+	Status         string              `bson:"status" json:"status"`
+	InvoiceID      *primitive.ObjectID `bson:"invoice_id,omitempty" json:"invoice_id,omitempty"`
+	PaymentMethod  string              `bson:"payment_method,omitempty" json:"payment_method,omitempty"` // payment_link or subscription
+	PaymentLink    string              `bson:"payment_link,omitempty" json:"payment_link,omitempty"`
+	SubscriptionID string              `bson:"subscription_id,omitempty" json:"subscription_id,omitempty"` // Razorpay subscription charged
+	DueAt          time.Time           `bson:"due_at" json:"due_at"`
+	PaymentError   string              `bson:"payment_error,omitempty" json:"payment_error,omitempty"` // last failed charge or link creation
+	DunningStage   int                 `bson:"dunning_stage" json:"dunning_stage"`                     // reminders sent, see DunningSchedule
+	LastReminderAt *time.Time          `bson:"last_reminder_at,omitempty" json:"last_reminder_at,omitempty"`
+	Attempts       int                 `bson:"attempts" json:"attempts"`
+	Error          string              `bson:"error,omitempty" json:"error,omitempty"`
+	PaidAt         *time.Time          `bson:"paid_at,omitempty" json:"paid_at,omitempty"`
+	CreatedAt      time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt      time.Time           `bson:"updated_at" json:"updated_at"`
+}
+
+// TableName returns the collection name
+func (BillingRun) TableName() string {
+	return "billing_runs"
+}
+
+// Billing run statuses
+const (
+	BillingRunStatusInvoicing = "invoicing" // claimed; invoice being generated
+	BillingRunStatusFailed    = "failed"    // invoicing failed; retried on the next run
+	BillingRunStatusUnpaid    = "unpaid"    // invoiced and awaiting payment
+	BillingRunStatusPaid      = "paid"
+	BillingRunStatusVoid      = "void" // invoice voided; nothing to collect
+)
+
+// Billing run payment methods
+const (
+	BillingPaymentLink         = "payment_link" // provider's hosted payment page: a Razorpay payment link or Stripe invoice
+	BillingPaymentSubscription = "subscription" // charged on the org's Razorpay subscription
+)
+
+// DunningSchedule is the number of days after an unpaid invoice is due that
+// each payment reminder is sent. The organization is suspended with the last
+// one.
+var DunningSchedule = []int{3, 7, 14}
+
+// DunningStageDue returns how many reminders should have been sent daysOverdue
+// days after the due date
+func DunningStageDue(daysOverdue int) int {
+	stage := 0
+	for _, day := range DunningSchedule {
+		if daysOverdue >= day {
+			stage++
+		}
+	}
+	return stage
+}
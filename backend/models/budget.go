@@ -0,0 +1,135 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Budget alert kinds
+const (
+	BudgetAlertThreshold = "threshold" // cycle-to-date spend crossed a threshold
+	BudgetAlertForecast  = "forecast"  // spend is forecast to exceed the budget by the end of the cycle
+)
+
+// DefaultBudgetThresholds are the alert thresholds, in percent of the
+// budget, of budgets created without their own
+var DefaultBudgetThresholds = []int{50, 80, 100}
+
+// Budget is a monthly spending budget for an organization, or for one of its
+// projects. Spend is evaluated over the organization's billing cycle; alerts
+// go out once per threshold per cycle, and a budget with a hard cap blocks
+// new billable operations once spend reaches it, until the cycle ends.
+type Budget struct {
+	ID           primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	OrgID        primitive.ObjectID  `bson:"org_id" json:"org_id"`
+	ProjectID    *primitive.ObjectID `bson:"project_id" json:"project_id,omitempty"` // nil for the whole organization
+	Amount       float64             `bson:"amount" json:"amount"`
+	Currency     string              `bson:"currency" json:"currency"` // the organization's plan currency
+	Thresholds   []int               `bson:"thresholds" json:"thresholds"`
+	HardCap      bool                `bson:"hard_cap" json:"hard_cap"`
+	NotifyEmails []string            `bson:"notify_emails,omitempty" json:"notify_emails,omitempty"` // the admin email if empty
+
+	// Evaluation of the current billing cycle
+	PeriodStart       time.Time  `bson:"period_start,omitempty" json:"period_start,omitempty"`
+	PeriodEnd         time.Time  `bson:"period_end,omitempty" json:"period_end,omitempty"`
+	Spend             float64    `bson:"spend" json:"spend"`
+	ForecastSpend     float64    `bson:"forecast_spend" json:"forecast_spend"`
+	AlertedThresholds []int      `bson:"alerted_thresholds,omitempty" json:"alerted_thresholds,omitempty"`
+	ForecastAlerted   bool       `bson:"forecast_alerted" json:"forecast_alerted"`
+	CappedUntil       *time.Time `bson:"capped_until,omitempty" json:"capped_until,omitempty"`
+	EvaluatedAt       *time.Time `bson:"evaluated_at,omitempty" json:"evaluated_at,omitempty"`
+
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// TableName returns the collection name
+func (Budget) TableName() string {
+	return "budgets"
+}
+
+// Capped reports whether the budget's hard cap is blocking billable
+// operations at t
+func (b *Budget) Capped(t time.Time) bool {
+	return b.HardCap && b.CappedUntil != nil && t.Before(*b.CappedUntil)
+}
+
+// DueThresholds returns the thresholds a spend has reached that have not
+// been alerted on this cycle, lowest first
+func (b *Budget) DueThresholds(spend float64) []int {
+	if b.Amount <= 0 {
+		return nil
+	}
+
+	alerted := make(map[int]bool, len(b.AlertedThresholds))
+	for _, threshold := range b.AlertedThresholds {
+		alerted[threshold] = true
+	}
+
+	var due []int
+	for _, threshold := range b.Thresholds {
+		if !alerted[threshold] && spend >= b.Amount*float64(threshold)/100 {
+			due = append(due, threshold)
+		}
+	}
+	sort.Ints(due)
+	return due
+}
+
+// BudgetInput is the input for setting a budget
+type BudgetInput struct {
+	Amount       float64  `json:"amount" binding:"required,gt=0"`
+	Thresholds   []int    `json:"thresholds"` // DefaultBudgetThresholds if empty
+	HardCap      bool     `json:"hard_cap"`
+	NotifyEmails []string `json:"notify_emails"`
+}
+
+// Validate checks the thresholds and notification addresses
+func (in *BudgetInput) Validate() error {
+	seen := make(map[int]bool, len(in.Thresholds))
+	for _, threshold := range in.Thresholds {
+		if threshold <= 0 || threshold > 1000 {
+			return fmt.Errorf("threshold %d%% must be between 1%% and 1000%%", threshold)
+		}
+		if seen[threshold] {
+			return fmt.Errorf("threshold %d%% is listed twice", threshold)
+		}
+		seen[threshold] = true
+	}
+	for _, email := range in.NotifyEmails {
+		if _, err := mail.ParseAddress(email); err != nil {
+			return fmt.Errorf("invalid notification email %q", email)
+		}
+	}
+	if len(in.NotifyEmails) > 20 {
+		return errors.New("at most 20 notification emails can be set")
+	}
+	return nil
+}
+
+// BudgetAlert is an alert sent for a budget
+type BudgetAlert struct {
+	ID            primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	BudgetID      primitive.ObjectID  `bson:"budget_id" json:"budget_id"`
+	OrgID         primitive.ObjectID  `bson:"org_id" json:"org_id"`
+	ProjectID     *primitive.ObjectID `bson:"project_id,omitempty" json:"project_id,omitempty"`
+	Kind          string              `bson:"kind" json:"kind"`
+	Threshold     int                 `bson:"threshold" json:"threshold"` // percent of the budget
+	Amount        float64             `bson:"amount" json:"amount"`
+	Spend         float64             `bson:"spend" json:"spend"`
+	ForecastSpend float64             `bson:"forecast_spend" json:"forecast_spend"`
+	Currency      string              `bson:"currency" json:"currency"`
+	CapReached    bool                `bson:"cap_reached" json:"cap_reached"`
+	PeriodStart   time.Time           `bson:"period_start" json:"period_start"`
+	CreatedAt     time.Time           `bson:"created_at" json:"created_at"`
+}
+
+// TableName returns the collection name
+func (BudgetAlert) TableName() string {
+	return "budget_alerts"
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Concurrency limit names
+const (
+	ConcurrencyLimitRooms               = "concurrent_rooms"
+	ConcurrencyLimitParticipantsPerRoom = "participants_per_room"
+	ConcurrencyLimitEgresses            = "concurrent_egresses"
+	ConcurrencyLimitIngresses           = "active_ingresses"
+)
+
+// ConcurrencyLimits caps what a project may run at the same time. -1 means unlimited.
+type ConcurrencyLimits struct {
+	MaxConcurrentRooms     int `bson:"max_concurrent_rooms" json:"max_concurrent_rooms"`
+	MaxParticipantsPerRoom int `bson:"max_participants_per_room" json:"max_participants_per_room"`
+	MaxConcurrentEgresses  int `bson:"max_concurrent_egresses" json:"max_concurrent_egresses"`
+	MaxActiveIngresses     int `bson:"max_active_ingresses" json:"max_active_ingresses"`
+}
+
+// ConcurrencyLimitOverrides replaces individual plan concurrency limits for a
+// project. Nil fields fall back to the plan.
+type ConcurrencyLimitOverrides struct {
+	MaxConcurrentRooms     *int `bson:"max_concurrent_rooms,omitempty" json:"max_concurrent_rooms,omitempty"`
+	MaxParticipantsPerRoom *int `bson:"max_participants_per_room,omitempty" json:"max_participants_per_room,omitempty"`
+	MaxConcurrentEgresses  *int `bson:"max_concurrent_egresses,omitempty" json:"max_concurrent_egresses,omitempty"`
+	MaxActiveIngresses     *int `bson:"max_active_ingresses,omitempty" json:"max_active_ingresses,omitempty"`
+}
+
+// Apply returns limits with the overrides applied
+func (o *ConcurrencyLimitOverrides) Apply(limits ConcurrencyLimits) ConcurrencyLimits {
+	if o == nil {
+		return limits
+	}
+	if o.MaxConcurrentRooms != nil {
+		limits.MaxConcurrentRooms = *o.MaxConcurrentRooms
+	}
+	if o.MaxParticipantsPerRoom != nil {
+		limits.MaxParticipantsPerRoom = *o.MaxParticipantsPerRoom
+	}
+	if o.MaxConcurrentEgresses != nil {
+		limits.MaxConcurrentEgresses = *o.MaxConcurrentEgresses
+	}
+	if o.MaxActiveIngresses != nil {
+		limits.MaxActiveIngresses = *o.MaxActiveIngresses
+	}
+	return limits
+}
+
+// ConcurrencyCounter holds a project's live egress and ingress counters
+type ConcurrencyCounter struct {
+	ProjectID       primitive.ObjectID `bson:"_id" json:"project_id"`
+	ActiveEgresses  int                `bson:"active_egresses" json:"active_egresses"`
+	ActiveIngresses int                `bson:"active_ingresses" json:"active_ingresses"`
+	UpdatedAt       time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// TableName returns the collection name
+func (ConcurrencyCounter) TableName() string {
+	return "concurrency_counters"
+}
+
+// LiveRoom is a room LiveKit has reported as started and not yet ended
+type LiveRoom struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ProjectID    primitive.ObjectID `bson:"project_id" json:"project_id"`
+	RoomName     string             `bson:"room_name" json:"room_name"`
+	Participants []string           `bson:"participants" json:"-"` // participant SIDs, so redelivered webhooks are idempotent
+	StartedAt    time.Time          `bson:"started_at" json:"started_at"`
+	UpdatedAt    time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// TableName returns the collection name
+func (LiveRoom) TableName() string {
+	return "live_rooms"
+}
+
+// RoomConcurrency is the live participant count of one room
+type RoomConcurrency struct {
+	RoomName     string    `json:"room_name"`
+	Participants int       `json:"participants"`
+	StartedAt    time.Time `json:"started_at"`
+}
+
+// ConcurrencyState is a project's current concurrency and its limits
+type ConcurrencyState struct {
+	ProjectID       string            `json:"project_id"`
+	ActiveRooms     int               `json:"active_rooms"`
+	ActiveEgresses  int               `json:"active_egresses"`
+	ActiveIngresses int               `json:"active_ingresses"`
+	Rooms           []RoomConcurrency `json:"rooms"`
+	Limits          ConcurrencyLimits `json:"limits"`
+}
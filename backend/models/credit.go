@@ -0,0 +1,85 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreditEntry is one movement in an organization's credit ledger. Grants add
+// credit and track what is left of them in Remaining; every debit (an invoice
+// drawdown or an expiry) references the grant it draws from, so each grant's
+// history sums to its remaining balance.
+type CreditEntry struct {
+	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	OrgID       primitive.ObjectID  `bson:"org_id" json:"org_id"`
+	Type        string              `bson:"type" json:"type"`
+	Amount      int64               `bson:"amount" json:"amount"` // minor units; positive for grants, negative for debits
+	Currency    string              `bson:"currency" json:"currency"`
+	Remaining   int64               `bson:"remaining,omitempty" json:"remaining,omitempty"` // grants only
+	ExpiresAt   *time.Time          `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	GrantID     *primitive.ObjectID `bson:"grant_id,omitempty" json:"grant_id,omitempty"` // debits only
+	GrantKey    string              `bson:"grant_key,omitempty" json:"-"`                 // dedupes grants, e.g. "promo:LAUNCH"
+	InvoiceID   *primitive.ObjectID `bson:"invoice_id,omitempty" json:"invoice_id,omitempty"`
+	Reference   string              `bson:"reference,omitempty" json:"reference,omitempty"` // promo code, SLA metric or payment ID
+	Description string              `bson:"description" json:"description"`
+	CreatedAt   time.Time           `bson:"created_at" json:"created_at"`
+}
+
+// TableName returns the collection name
+func (CreditEntry) TableName() string {
+	return "credit_ledger"
+}
+
+// Credit entry types
+const (
+	CreditTypePurchase = "purchase" // prepaid credit bought by the customer
+	CreditTypePromo    = "promo"    // promotional credit from a promo code
+	CreditTypeSLA      = "sla"      // compensation for an SLA breach
+	CreditTypeDrawdown = "drawdown" // credit applied to an invoice
+	CreditTypeRelease  = "release"  // drawdown returned when its invoice was voided
+	CreditTypeExpiry   = "expiry"   // unused credit that expired
+)
+
+// CreditDrawdownOrder is the order grant types are applied to invoices:
+// expiring promotional credit first, then SLA credit, then prepaid credit.
+// Within a type, credit that expires soonest and then the oldest goes first.
+var CreditDrawdownOrder = []string{CreditTypePromo, CreditTypeSLA, CreditTypePurchase}
+
+// IsCreditGrant reports whether an entry type adds credit
+func IsCreditGrant(entryType string) bool {
+	return entryType == CreditTypePurchase || entryType == CreditTypePromo || entryType == CreditTypeSLA
+}
+
+// PromoCode grants promotional credit when redeemed
+type PromoCode struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Code            string             `bson:"code" json:"code" binding:"required"`
+	Amount          int64              `bson:"amount" json:"amount" binding:"required,gt=0"` // minor units of Currency
+	Currency        string             `bson:"currency" json:"currency"`
+	CreditValidDays int                `bson:"credit_valid_days" json:"credit_valid_days"` // redeemed credit expires after this many days; 0 never
+	RedeemBy        *time.Time         `bson:"redeem_by,omitempty" json:"redeem_by,omitempty"`
+	MaxRedemptions  int                `bson:"max_redemptions" json:"max_redemptions"` // 0 for unlimited
+	Redemptions     int                `bson:"redemptions" json:"redemptions"`
+	IsActive        bool               `bson:"is_active" json:"is_active"`
+	CreatedAt       time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// TableName returns the collection name
+func (PromoCode) TableName() string {
+	return "promo_codes"
+}
+
+// CreditBalance summarizes an organization's unexpired credit
+type CreditBalance struct {
+	OrgID    string           `json:"org_id"`
+	Balances map[string]int64 `json:"balances"` // minor units, by currency
+	Grants   []CreditEntry    `json:"grants"`   // grants with credit left, in drawdown order
+}
+
+// CreditPurchase is the input for crediting a completed payment. The amount
+// and currency the provider confirms were paid are credited, once per payment.
+type CreditPurchase struct {
+	Provider  string `json:"provider"`                      // the organization's provider if empty
+	PaymentID string `json:"payment_id" binding:"required"` // e.g. a Stripe payment intent or Razorpay payment ID
+}
@@ -13,6 +13,7 @@ const (
 	EgressTypeRoomComposite EgressType = "room_composite"
 	EgressTypeTrackComposite EgressType = "track_composite"
 	EgressTypeTrack EgressType = "track"
+	EgressTypeWeb EgressType = "web"
 )
 
 // EgressStatus represents the current status of an egress
@@ -32,6 +33,7 @@ const (
 	OutputTypeHLS OutputType = "hls"
 	OutputTypeRTMP OutputType = "rtmp"
 	OutputTypeFile OutputType = "file"
+	OutputTypeImages OutputType = "images"
 )
 
 // LayoutType for room composite
@@ -51,12 +53,24 @@ type Egress struct {
 	
 	// Egress configuration
 	EgressType EgressType `bson:"egress_type" json:"egress_type"`
+	SourceURL string `bson:"source_url,omitempty" json:"source_url,omitempty"` // web egress
 	OutputType OutputType `bson:"output_type" json:"output_type"`
 	LayoutType LayoutType `bson:"layout_type" json:"layout_type"`
+	Preset string `bson:"preset,omitempty" json:"preset,omitempty"`
+	Encoding *EncodingOptions `bson:"encoding,omitempty" json:"encoding,omitempty"` // resolved from the preset or request
+	TemplateURL string `bson:"template_url,omitempty" json:"template_url,omitempty"`
 	
 	// LiveKit egress ID
 	LiveKitEgressID string `bson:"livekit_egress_id" json:"livekit_egress_id"`
 	
+	// Recording rule that started the egress, and the key that records a
+	// room or track once per rule until the room ends
+	RuleID *primitive.ObjectID `bson:"rule_id,omitempty" json:"rule_id,omitempty"`
+	DedupKey string `bson:"dedup_key,omitempty" json:"-"`
+	
+	// Identities of the participants that joined the room while it recorded
+	Participants []string `bson:"participants,omitempty" json:"participants,omitempty"`
+	
 	// Status and metadata
 	Status EgressStatus `bson:"status" json:"status"`
 	Error string `bson:"error,omitempty" json:"error,omitempty"`
@@ -66,6 +80,9 @@ type Egress struct {
 	CDNPlaybackURL string `bson:"cdn_playback_url" json:"cdn_playback_url"` // CDN URL for playback
 	RTMPURL string `bson:"rtmp_url,omitempty" json:"rtmp_url,omitempty"`
 	
+	// Every destination with its own status; the fields above describe the first
+	Outputs []EgressOutputInfo `bson:"outputs,omitempty" json:"outputs,omitempty"`
+	
 	// Storage configuration
 	StorageBucket string `bson:"storage_bucket" json:"storage_bucket"`
 	StorageRegion string `bson:"storage_region" json:"storage_region"`
@@ -83,14 +100,85 @@ type Egress struct {
 	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
 }
 
-// EgressRequest represents a request to start an egress
+// EgressOutputInfo tracks one destination of an egress. A stream output
+// has one entry per RTMP URL.
+type EgressOutputInfo struct {
+	Type OutputType `bson:"type" json:"type"`
+	URL string `bson:"url" json:"url"` // storage location or RTMP URL
+	CDNPlaybackURL string `bson:"cdn_playback_url,omitempty" json:"cdn_playback_url,omitempty"`
+	StorageBucket string `bson:"storage_bucket,omitempty" json:"storage_bucket,omitempty"`
+	Status EgressStatus `bson:"status" json:"status"`
+	Error string `bson:"error,omitempty" json:"error,omitempty"`
+}
+
+// EgressRequest represents a request to start an egress. Outputs lists
+// every destination; OutputType, RTMPURL and Filename describe a single one.
 type EgressRequest struct {
-	RoomName string `json:"room_name" binding:"required"`
+	RoomName string `json:"room_name"` // required except for web egress
 	EgressType EgressType `json:"egress_type" binding:"required"`
-	OutputType OutputType `json:"output_type" binding:"required"`
+	OutputType OutputType `json:"output_type"` // required without outputs
 	LayoutType LayoutType `json:"layout_type"`
 	RTMPURL string `json:"rtmp_url,omitempty"`
 	Filename string `json:"filename,omitempty"`
+	Outputs []EgressOutput `json:"outputs,omitempty" binding:"omitempty,dive"`
+	
+	// Encoding by preset name or custom options, and a custom layout
+	// template page for room composite egress
+	Preset string `json:"preset,omitempty"`
+	Encoding *EncodingOptions `json:"encoding,omitempty"`
+	TemplateURL string `json:"template_url,omitempty"`
+
+	// Sources for track, track composite and web egress
+	TrackID string `json:"track_id,omitempty"`
+	AudioTrackID string `json:"audio_track_id,omitempty"`
+	VideoTrackID string `json:"video_track_id,omitempty"`
+	URL string `json:"url,omitempty"`
+}
+
+// OutputList returns the request's outputs, converting a single output
+func (r *EgressRequest) OutputList() []EgressOutput {
+	if len(r.Outputs) > 0 || r.OutputType == "" {
+		return r.Outputs
+	}
+	output := EgressOutput{Type: r.OutputType, Filename: r.Filename}
+	if r.RTMPURL != "" {
+		output.URLs = []string{r.RTMPURL}
+	}
+	return []EgressOutput{output}
+}
+
+// EgressOutput is one destination of an egress request
+type EgressOutput struct {
+	Type OutputType `bson:"type" json:"type" binding:"required"`
+	Filename string `bson:"filename,omitempty" json:"filename,omitempty"` // file name, or name prefix for HLS and images
+	URLs []string `bson:"urls,omitempty" json:"urls,omitempty"` // RTMP destinations
+	
+	// Storage overrides the project's storage for file, HLS and image outputs
+	Storage *EgressStorage `bson:"storage,omitempty" json:"storage,omitempty"`
+	
+	// Image snapshots
+	CaptureInterval int `bson:"capture_interval,omitempty" json:"capture_interval,omitempty"` // seconds
+	Width int `bson:"width,omitempty" json:"width,omitempty"`
+	Height int `bson:"height,omitempty" json:"height,omitempty"`
+}
+
+// EgressStorage is an S3-compatible bucket an output is uploaded to
+type EgressStorage struct {
+	Bucket string `bson:"bucket" json:"bucket" binding:"required"`
+	Region string `bson:"region" json:"region"`
+	Endpoint string `bson:"endpoint,omitempty" json:"endpoint,omitempty"`
+	AccessKeyID string `bson:"access_key_id" json:"access_key_id" binding:"required"`
+	SecretAccessKey string `bson:"secret_access_key" json:"secret_access_key,omitempty" binding:"required"`
+}
+
+// EgressStreamURLs adds or removes RTMP destinations of a running egress
+type EgressStreamURLs struct {
+	URLs []string `json:"urls" binding:"required,min=1,dive,required"`
+}
+
+// EgressLayoutUpdate changes the layout of a room composite egress
+type EgressLayoutUpdate struct {
+	LayoutType LayoutType `json:"layout_type" binding:"required"`
 }
 
 // EgressResponse represents a safe egress response (without sensitive data)
@@ -101,9 +189,14 @@ type EgressResponse struct {
 	EgressType EgressType `json:"egress_type"`
 	OutputType OutputType `json:"output_type"`
 	LayoutType LayoutType `json:"layout_type"`
+	RuleID string `json:"rule_id,omitempty"`
+	Preset string `json:"preset,omitempty"`
+	Encoding *EncodingOptions `json:"encoding,omitempty"`
+	TemplateURL string `json:"template_url,omitempty"`
 	Status EgressStatus `json:"status"`
 	Error string `json:"error,omitempty"`
 	CDNPlaybackURL string `json:"cdn_playback_url,omitempty"`
+	Outputs []EgressOutputInfo `json:"outputs,omitempty"` // RTMP URLs are redacted
 	DurationSeconds int64 `json:"duration_seconds"`
 	FileSizeBytes int64 `json:"file_size_bytes"`
 	StartedAt *time.Time `json:"started_at,omitempty"`
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Codecs an egress can encode with
+const (
+	AudioCodecOpus = "opus"
+	AudioCodecAAC  = "aac"
+
+	VideoCodecH264Baseline = "h264_baseline"
+	VideoCodecH264Main     = "h264_main"
+	VideoCodecH264High     = "h264_high"
+	VideoCodecVP8          = "vp8"
+)
+
+// EncodingOptions controls how a composite or web egress is transcoded.
+// Unset fields use LiveKit's defaults (720p30 H.264 with Opus audio).
+type EncodingOptions struct {
+	AudioOnly        bool    `bson:"audio_only,omitempty" json:"audio_only,omitempty"`
+	Width            int     `bson:"width,omitempty" json:"width,omitempty"`
+	Height           int     `bson:"height,omitempty" json:"height,omitempty"`
+	Framerate        int     `bson:"framerate,omitempty" json:"framerate,omitempty"`
+	VideoCodec       string  `bson:"video_codec,omitempty" json:"video_codec,omitempty"`
+	VideoBitrate     int     `bson:"video_bitrate,omitempty" json:"video_bitrate,omitempty"`           // kbps
+	KeyFrameInterval float64 `bson:"key_frame_interval,omitempty" json:"key_frame_interval,omitempty"` // seconds
+	AudioCodec       string  `bson:"audio_codec,omitempty" json:"audio_codec,omitempty"`
+	AudioBitrate     int     `bson:"audio_bitrate,omitempty" json:"audio_bitrate,omitempty"`     // kbps
+	AudioFrequency   int     `bson:"audio_frequency,omitempty" json:"audio_frequency,omitempty"` // Hz
+}
+
+// Validate checks the options are ones LiveKit can encode
+func (o *EncodingOptions) Validate() error {
+	switch o.AudioCodec {
+	case "", AudioCodecOpus, AudioCodecAAC:
+	default:
+		return fmt.Errorf("unknown audio codec %q", o.AudioCodec)
+	}
+	if o.AudioBitrate < 0 || o.AudioBitrate > 512 {
+		return errors.New("audio_bitrate must be between 0 and 512 kbps")
+	}
+	if o.AudioFrequency != 0 && o.AudioFrequency != 44100 && o.AudioFrequency != 48000 {
+		return errors.New("audio_frequency must be 44100 or 48000 Hz")
+	}
+
+	if o.AudioOnly {
+		if o.Width != 0 || o.Height != 0 || o.Framerate != 0 || o.VideoCodec != "" || o.VideoBitrate != 0 || o.KeyFrameInterval != 0 {
+			return errors.New("audio-only encoding cannot set video options")
+		}
+		return nil
+	}
+
+	switch o.VideoCodec {
+	case "", VideoCodecH264Baseline, VideoCodecH264Main, VideoCodecH264High, VideoCodecVP8:
+	default:
+		return fmt.Errorf("unknown video codec %q", o.VideoCodec)
+	}
+	if (o.Width == 0) != (o.Height == 0) {
+		return errors.New("width and height must be set together")
+	}
+	if o.Width < 0 || o.Width > 3840 || o.Height < 0 || o.Height > 3840 || o.Width%2 != 0 || o.Height%2 != 0 {
+		return errors.New("width and height must be even and at most 3840")
+	}
+	if o.Framerate < 0 || o.Framerate > 60 {
+		return errors.New("framerate must be at most 60")
+	}
+	if o.VideoBitrate < 0 || o.VideoBitrate > 20000 {
+		return errors.New("video_bitrate must be between 0 and 20000 kbps")
+	}
+	if o.KeyFrameInterval < 0 || o.KeyFrameInterval > 20 {
+		return errors.New("key_frame_interval must be between 0 and 20 seconds")
+	}
+	return nil
+}
+
+// BuiltinEncodingPresets are the presets every project can use by name
+var BuiltinEncodingPresets = map[string]EncodingOptions{
+	"720p30": {
+		Width: 1280, Height: 720, Framerate: 30, VideoCodec: VideoCodecH264Main, VideoBitrate: 3000, KeyFrameInterval: 4,
+		AudioCodec: AudioCodecOpus, AudioBitrate: 128, AudioFrequency: 44100,
+	},
+	"720p60": {
+		Width: 1280, Height: 720, Framerate: 60, VideoCodec: VideoCodecH264Main, VideoBitrate: 4500, KeyFrameInterval: 4,
+		AudioCodec: AudioCodecOpus, AudioBitrate: 128, AudioFrequency: 44100,
+	},
+	"1080p30": {
+		Width: 1920, Height: 1080, Framerate: 30, VideoCodec: VideoCodecH264Main, VideoBitrate: 4500, KeyFrameInterval: 4,
+		AudioCodec: AudioCodecOpus, AudioBitrate: 128, AudioFrequency: 44100,
+	},
+	"1080p60": {
+		Width: 1920, Height: 1080, Framerate: 60, VideoCodec: VideoCodecH264High, VideoBitrate: 6000, KeyFrameInterval: 4,
+		AudioCodec: AudioCodecOpus, AudioBitrate: 128, AudioFrequency: 44100,
+	},
+	"audio-only-opus": {
+		AudioOnly: true, AudioCodec: AudioCodecOpus, AudioBitrate: 128, AudioFrequency: 48000,
+	},
+}
+
+// EncodingPreset is named encoding options an egress request can refer to.
+// Projects add their own presets next to the built-in ones.
+type EncodingPreset struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	ProjectID   primitive.ObjectID `bson:"project_id" json:"project_id,omitempty"`
+	Name        string             `bson:"name" json:"name"`
+	Description string             `bson:"description,omitempty" json:"description,omitempty"`
+	Options     EncodingOptions    `bson:"options" json:"options"`
+	Builtin     bool               `bson:"-" json:"builtin"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at,omitempty"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at,omitempty"`
+}
+
+// TableName returns the collection name
+func (EncodingPreset) TableName() string {
+	return "encoding_presets"
+}
+
+// presetNamePattern is what preset names may look like, so they are safe in URLs
+var presetNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// EncodingPresetInput is the input for creating or replacing a project preset
+type EncodingPresetInput struct {
+	Name        string          `json:"name"` // taken from the path when replacing
+	Description string          `json:"description"`
+	Options     EncodingOptions `json:"options"`
+}
+
+// Validate checks the preset name and options
+func (in *EncodingPresetInput) Validate() error {
+	if !presetNamePattern.MatchString(in.Name) {
+		return errors.New("preset names are up to 64 lower-case letters, digits, dashes and underscores")
+	}
+	if _, ok := BuiltinEncodingPresets[in.Name]; ok {
+		return fmt.Errorf("%q is a built-in preset", in.Name)
+	}
+	return in.Options.Validate()
+}
+
+// EncodingLimits restricts the encodings and layouts a plan's egresses use
+type EncodingLimits struct {
+	MaxHeight       int  `bson:"max_height" json:"max_height"`       // shorter side in pixels; -1 for unlimited
+	MaxFramerate    int  `bson:"max_framerate" json:"max_framerate"` // -1 for unlimited
+	CustomTemplates bool `bson:"custom_templates" json:"custom_templates"`
+}
+
+// Allows returns an error describing why the limits rule out some encoding
+// options, or nil
+func (l EncodingLimits) Allows(o *EncodingOptions) error {
+	if o.AudioOnly {
+		return nil
+	}
+	height := o.Height
+	if o.Width < height {
+		height = o.Width // portrait
+	}
+	if l.MaxHeight >= 0 && height > l.MaxHeight {
+		return fmt.Errorf("resolutions above %dp", l.MaxHeight)
+	}
+	if l.MaxFramerate >= 0 && o.Framerate > l.MaxFramerate {
+		return fmt.Errorf("framerates above %d fps", l.MaxFramerate)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Invoice amounts are stored in the currency's minor units, e.g. paise or
+// cents, so totals add up exactly. Unit prices stay decimal since usage is
+// priced in fractions of a minor unit.
+
+// currencyExponents are the currencies whose minor unit is not a hundredth
+var currencyExponents = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// CurrencyExponent returns the number of decimal places of a currency's minor
+// unit: 2 for most, 0 for e.g. JPY, 3 for e.g. KWD
+func CurrencyExponent(currency string) int {
+	if exponent, ok := currencyExponents[strings.ToUpper(currency)]; ok {
+		return exponent
+	}
+	return 2
+}
+
+// ToMinorUnits converts a decimal amount to the currency's minor units,
+// rounding half away from zero
+func ToMinorUnits(amount float64, currency string) int64 {
+	return int64(math.Round(amount * math.Pow10(CurrencyExponent(currency))))
+}
+
+// FromMinorUnits converts minor units to a decimal amount
+func FromMinorUnits(minor int64, currency string) float64 {
+	return float64(minor) / math.Pow10(CurrencyExponent(currency))
+}
+
+// FormatMinorUnits formats minor units as a decimal string with the
+// currency's number of decimal places, e.g. 4900 USD as "49.00"
+func FormatMinorUnits(minor int64, currency string) string {
+	return strconv.FormatFloat(FromMinorUnits(minor, currency), 'f', CurrencyExponent(currency), 64)
+}
+
+// ExchangeRateSnapshot is the exchange rate an invoice was converted at,
+// recorded when the invoice is finalized so it can be reproduced later
+type ExchangeRateSnapshot struct {
+	From   string    `bson:"from" json:"from"` // pricing plan currency
+	To     string    `bson:"to" json:"to"`     // invoice currency
+	Rate   float64   `bson:"rate" json:"rate"` // units of To per unit of From
+	Source string    `bson:"source" json:"source"`
+	AsOf   time.Time `bson:"as_of" json:"as_of"` // when the source published the rate
+}
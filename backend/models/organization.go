@@ -8,13 +8,41 @@ import (
 
 // Organization represents a customer organization/account
 type Organization struct {
-	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Name       string             `bson:"name" json:"name" binding:"required"`
-	AdminEmail string             `bson:"admin_email" json:"admin_email" binding:"required,email"`
-	Plan       string             `bson:"plan" json:"plan"` // Free, Pro, Enterprise
-	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt  time.Time          `bson:"updated_at" json:"updated_at"`
-	IsDeleted  bool               `bson:"is_deleted" json:"-"` // Soft delete flag
+	ID               primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Name             string              `bson:"name" json:"name" binding:"required"`
+	AdminEmail       string              `bson:"admin_email" json:"admin_email" binding:"required,email"`
+	Plan             string              `bson:"plan" json:"plan"` // Free, Pro, Enterprise
+	LimitOverrides   *PlanLimitOverrides `bson:"limit_overrides,omitempty" json:"limit_overrides,omitempty"`
+	PricingPlanID    *primitive.ObjectID `bson:"pricing_plan_id,omitempty" json:"pricing_plan_id,omitempty"` // pinned plan version; latest for Plan if unset
+	BillingDay       int                 `bson:"billing_day,omitempty" json:"billing_day,omitempty"`         // day of month billing cycles start; 1 if unset
+	TaxProfile       *TaxProfile         `bson:"tax_profile,omitempty" json:"tax_profile,omitempty"`
+	BillingStatus    string              `bson:"billing_status,omitempty" json:"billing_status,omitempty"` // active if unset
+	SuspendedAt      *time.Time          `bson:"suspended_at,omitempty" json:"suspended_at,omitempty"`
+	PaymentProvider  string              `bson:"payment_provider,omitempty" json:"payment_provider,omitempty"`   // razorpay if unset
+	BillingCurrency  string              `bson:"billing_currency,omitempty" json:"billing_currency,omitempty"`   // currency payments are collected in; the plan's if unset
+	PaymentCustomers map[string]string   `bson:"payment_customers,omitempty" json:"payment_customers,omitempty"` // provider customer ID by provider
+	CreatedAt        time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt        time.Time           `bson:"updated_at" json:"updated_at"`
+	IsDeleted        bool                `bson:"is_deleted" json:"-"` // Soft delete flag
+}
+
+// Organization billing statuses
+const (
+	OrgBillingStatusActive    = "active"
+	OrgBillingStatusPastDue   = "past_due"  // an invoice is overdue; payment reminders are being sent
+	OrgBillingStatusSuspended = "suspended" // read-only until overdue invoices are paid
+)
+
+// Payment providers an organization can be billed through
+const (
+	PaymentProviderRazorpay = "razorpay"
+	PaymentProviderStripe   = "stripe"
+)
+
+// PaymentSettingsUpdate represents the input for choosing how an organization pays
+type PaymentSettingsUpdate struct {
+	Provider string `json:"provider" binding:"required,oneof=razorpay stripe"`
+	Currency string `json:"currency" binding:"omitempty,len=3"`
 }
 
 // OrganizationCreate represents the input for creating an organization
@@ -27,7 +55,7 @@ type OrganizationCreate struct {
 // OrganizationUpdate represents the input for updating an organization
 type OrganizationUpdate struct {
 	Name string `json:"name" binding:"omitempty,min=3,max=100"`
-	Plan string `json:"plan" binding:"omitempty,oneof=Free Pro Enterprise"`
+	Plan string `json:"plan" binding:"omitempty,oneof=Free Pro Enterprise"` // must be the current plan; changes go through the subscription endpoints
 }
 
 // TableName returns the collection name
@@ -42,6 +70,7 @@ func NewOrganization(name, adminEmail string) *Organization {
 		Name:       name,
 		AdminEmail: adminEmail,
 		Plan:       "Free", // Default plan
+		BillingDay: time.Now().UTC().Day(),
 		CreatedAt:  time.Now(),
 		UpdatedAt:  time.Now(),
 		IsDeleted:  false,
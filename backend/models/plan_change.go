@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PlanChange records an organization moving between pricing plan versions.
+// Both versions are stored as snapshots so invoices for past periods can be
+// regenerated from the history alone.
+type PlanChange struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	OrgID       primitive.ObjectID `bson:"org_id" json:"org_id"`
+	FromPlan    PricingPlan        `bson:"from_plan" json:"from_plan"`
+	ToPlan      PricingPlan        `bson:"to_plan" json:"to_plan"`
+	EffectiveAt time.Time          `bson:"effective_at" json:"effective_at"`
+	ChangedBy   string             `bson:"changed_by,omitempty" json:"changed_by,omitempty"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// TableName returns the collection name
+func (PlanChange) TableName() string {
+	return "plan_changes"
+}
@@ -0,0 +1,345 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PricingPlan is one version of a price list. Every version is its own
+// document; changing a plan publishes version N+1 and leaves earlier versions
+// in place so grandfathered subscribers keep being billed on them.
+type PricingPlan struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Code          string             `bson:"code" json:"code"` // stable across versions, e.g. "pro"
+	Name          string             `bson:"name" json:"name" binding:"required"`
+	Version       int                `bson:"version" json:"version"`
+	Status        string             `bson:"status" json:"status"`
+	LimitsPlan    string             `bson:"limits_plan" json:"limits_plan"` // Free, Pro or Enterprise: which plan limits apply
+	Currency      string             `bson:"currency" json:"currency"`
+	BasePrice     float64            `bson:"base_price" json:"base_price"`         // per month
+	MinimumCommit float64            `bson:"minimum_commit" json:"minimum_commit"` // per month, including the base price
+	Metrics       []MetricPricing    `bson:"metrics" json:"metrics"`
+	Prices        []CurrencyPrices   `bson:"prices,omitempty" json:"prices,omitempty"`                 // explicit prices in other currencies
+	ProviderPlans map[string]string  `bson:"provider_plans,omitempty" json:"provider_plans,omitempty"` // recurring plan or price ID by payment provider; plans without one have no provider subscription
+	IsCustom      bool               `bson:"is_custom" json:"is_custom"`                               // negotiated by sales, hidden from the catalog
+	CreatedBy     string             `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	SupersededAt  *time.Time         `bson:"superseded_at,omitempty" json:"superseded_at,omitempty"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// TableName returns the collection name
+func (PricingPlan) TableName() string {
+	return "pricing_plans"
+}
+
+// Pricing plan statuses
+const (
+	PricingPlanStatusActive     = "active"     // latest version, offered to new subscribers
+	PricingPlanStatusSuperseded = "superseded" // still billed for grandfathered subscribers
+)
+
+// CurrencyPrices is a plan's price list in a currency other than its own.
+// Invoices in a currency without explicit prices are converted from the
+// plan's currency at the exchange rate when they are finalized.
+type CurrencyPrices struct {
+	Currency      string          `bson:"currency" json:"currency"`
+	BasePrice     float64         `bson:"base_price" json:"base_price"`
+	MinimumCommit float64         `bson:"minimum_commit" json:"minimum_commit"`
+	Metrics       []MetricPricing `bson:"metrics" json:"metrics"` // same metrics as the plan's own
+}
+
+// MetricPricing prices one usage metric. Quantities are in billed units
+// (raw usage divided by UnitSize). The included allowance is deducted first
+// and the graduated tiers apply to what remains.
+type MetricPricing struct {
+	Metric           string        `bson:"metric" json:"metric"` // participant_minutes, egress_minutes, storage_gb, bandwidth_gb, api_requests
+	Unit             string        `bson:"unit" json:"unit"`
+	UnitSize         float64       `bson:"unit_size" json:"unit_size"` // raw quantity per billed unit, e.g. 1000 requests
+	IncludedQuantity float64       `bson:"included_quantity" json:"included_quantity"`
+	Tiers            []PricingTier `bson:"tiers" json:"tiers"`
+}
+
+// PricingTier is one band of a graduated price. UpTo is the cumulative upper
+// bound in billed units; 0 leaves the last tier open-ended.
+type PricingTier struct {
+	UpTo      float64 `bson:"up_to" json:"up_to"`
+	UnitPrice float64 `bson:"unit_price" json:"unit_price"`
+}
+
+// TierCharge is the part of a metric's usage billed in one tier
+type TierCharge struct {
+	From      float64 `json:"from"`
+	To        float64 `json:"to"` // 0 for the open-ended tier
+	Quantity  float64 `json:"quantity"`
+	UnitPrice float64 `json:"unit_price"`
+	Amount    float64 `json:"amount"`
+}
+
+// pricingMetricNames are the invoice descriptions of billable metrics, in
+// invoice order
+var pricingMetricNames = []struct{ metric, name string }{
+	{QuotaMetricParticipantMinutes, "Participant Minutes"},
+	{QuotaMetricEgressMinutes, "Egress/Streaming Minutes"},
+	{QuotaMetricStorageGB, "Storage"},
+	{QuotaMetricBandwidthGB, "Bandwidth"},
+	{QuotaMetricAPIRequests, "API Requests"},
+}
+
+// PricingMetrics returns the billable metrics in invoice order
+func PricingMetrics() []string {
+	metrics := make([]string, len(pricingMetricNames))
+	for i, m := range pricingMetricNames {
+		metrics[i] = m.metric
+	}
+	return metrics
+}
+
+// PricingMetricName returns the invoice description of a metric
+func PricingMetricName(metric string) string {
+	for _, m := range pricingMetricNames {
+		if m.metric == metric {
+			return m.name
+		}
+	}
+	return metric
+}
+
+// UsageQuantity returns the raw quantity of a metric in a usage summary
+func UsageQuantity(summary *UsageSummary, metric string) float64 {
+	switch metric {
+	case QuotaMetricParticipantMinutes:
+		return summary.ParticipantMinutes
+	case QuotaMetricEgressMinutes:
+		return summary.EgressMinutes
+	case QuotaMetricStorageGB:
+		return summary.StorageGB
+	case QuotaMetricBandwidthGB:
+		return summary.BandwidthGB
+	case QuotaMetricAPIRequests:
+		return float64(summary.APIRequests)
+	default:
+		return 0
+	}
+}
+
+// MetricPricing returns the pricing of a metric; unpriced metrics are free
+func (p *PricingPlan) MetricPricing(metric string) (MetricPricing, bool) {
+	for _, m := range p.Metrics {
+		if m.Metric == metric {
+			return m, true
+		}
+	}
+	return MetricPricing{}, false
+}
+
+// InCurrency returns the plan priced in currency: the plan itself if it is
+// in that currency, or a copy carrying its explicit prices for it. It
+// returns false if the plan has no prices in currency.
+func (p *PricingPlan) InCurrency(currency string) (*PricingPlan, bool) {
+	if strings.EqualFold(p.Currency, currency) {
+		return p, true
+	}
+	for _, prices := range p.Prices {
+		if strings.EqualFold(prices.Currency, currency) {
+			localized := *p
+			localized.Currency = strings.ToUpper(prices.Currency)
+			localized.BasePrice = prices.BasePrice
+			localized.MinimumCommit = prices.MinimumCommit
+			localized.Metrics = prices.Metrics
+			localized.Prices = nil
+			return &localized, true
+		}
+	}
+	return nil, false
+}
+
+// BilledQuantity converts a raw quantity to billed units
+func (m MetricPricing) BilledQuantity(raw float64) float64 {
+	if m.UnitSize > 0 {
+		return raw / m.UnitSize
+	}
+	return raw
+}
+
+// Price splits a billed quantity over the allowance and the graduated tiers.
+// It returns the quantity covered by the allowance and the charge per tier
+// that was reached.
+func (m MetricPricing) Price(quantity float64) (included float64, charges []TierCharge) {
+	included = quantity
+	if included > m.IncludedQuantity {
+		included = m.IncludedQuantity
+	}
+	remaining := quantity - included
+
+	from := 0.0
+	for _, tier := range m.Tiers {
+		if remaining <= 0 {
+			break
+		}
+		band := remaining
+		if tier.UpTo > 0 && tier.UpTo-from < band {
+			band = tier.UpTo - from
+		}
+		if band > 0 {
+			charges = append(charges, TierCharge{
+				From:      from,
+				To:        tier.UpTo,
+				Quantity:  band,
+				UnitPrice: tier.UnitPrice,
+				Amount:    band * tier.UnitPrice,
+			})
+			remaining -= band
+		}
+		from = tier.UpTo
+	}
+
+	return included, charges
+}
+
+// Amount returns the total charge for a billed quantity
+func (m MetricPricing) Amount(quantity float64) float64 {
+	_, charges := m.Price(quantity)
+	total := 0.0
+	for _, c := range charges {
+		total += c.Amount
+	}
+	return total
+}
+
+// Validate checks that the plan can price usage unambiguously
+func (p *PricingPlan) Validate() error {
+	if p.Currency == "" {
+		return errors.New("currency is required")
+	}
+	switch p.LimitsPlan {
+	case "Free", "Pro", "Enterprise":
+	default:
+		return errors.New("limits_plan must be one of Free, Pro, Enterprise")
+	}
+	if p.BasePrice < 0 || p.MinimumCommit < 0 {
+		return errors.New("base_price and minimum_commit must not be negative")
+	}
+
+	if err := validateMetrics(p.Metrics); err != nil {
+		return err
+	}
+
+	currencies := map[string]bool{strings.ToUpper(p.Currency): true}
+	for _, prices := range p.Prices {
+		currency := strings.ToUpper(prices.Currency)
+		if currency == "" {
+			return errors.New("prices: currency is required")
+		}
+		if currencies[currency] {
+			return fmt.Errorf("prices: %s is priced twice", currency)
+		}
+		currencies[currency] = true
+
+		if prices.BasePrice < 0 || prices.MinimumCommit < 0 {
+			return fmt.Errorf("prices %s: base_price and minimum_commit must not be negative", currency)
+		}
+		if len(prices.Metrics) != len(p.Metrics) {
+			return fmt.Errorf("prices %s: must price the same metrics as the plan", currency)
+		}
+		for _, m := range prices.Metrics {
+			if _, ok := p.MetricPricing(m.Metric); !ok {
+				return fmt.Errorf("prices %s: must price the same metrics as the plan", currency)
+			}
+		}
+		if err := validateMetrics(prices.Metrics); err != nil {
+			return fmt.Errorf("prices %s: %w", currency, err)
+		}
+	}
+
+	return nil
+}
+
+// validateMetrics checks that each metric is known, priced once and has
+// well-formed graduated tiers
+func validateMetrics(metrics []MetricPricing) error {
+	seen := make(map[string]bool)
+	for _, m := range metrics {
+		if PricingMetricName(m.Metric) == m.Metric {
+			return fmt.Errorf("unknown metric %q", m.Metric)
+		}
+		if seen[m.Metric] {
+			return fmt.Errorf("metric %q is priced twice", m.Metric)
+		}
+		seen[m.Metric] = true
+
+		if m.IncludedQuantity < 0 || m.UnitSize < 0 {
+			return fmt.Errorf("%s: included_quantity and unit_size must not be negative", m.Metric)
+		}
+		if len(m.Tiers) == 0 {
+			return fmt.Errorf("%s: at least one tier is required", m.Metric)
+		}
+		prev := 0.0
+		for i, tier := range m.Tiers {
+			if tier.UnitPrice < 0 {
+				return fmt.Errorf("%s: tier %d has a negative price", m.Metric, i+1)
+			}
+			last := i == len(m.Tiers)-1
+			if tier.UpTo == 0 && !last {
+				return fmt.Errorf("%s: only the last tier can be open-ended", m.Metric)
+			}
+			if tier.UpTo != 0 && tier.UpTo <= prev {
+				return fmt.Errorf("%s: tier bounds must increase", m.Metric)
+			}
+			prev = tier.UpTo
+		}
+		if m.Tiers[len(m.Tiers)-1].UpTo != 0 {
+			return fmt.Errorf("%s: the last tier must be open-ended", m.Metric)
+		}
+	}
+
+	return nil
+}
+
+// PlanCode returns the pricing plan code of a built-in plan name
+func PlanCode(plan string) string {
+	return strings.ToLower(plan)
+}
+
+// DefaultPricingPlan returns version 1 of a built-in plan, built from its
+// flat-rate PricingModel. It prices usage when no plan document exists.
+func DefaultPricingPlan(plan string) PricingPlan {
+	pricing := GetPricing(plan)
+
+	flat := func(metric, unit string, unitSize, price float64) MetricPricing {
+		return MetricPricing{
+			Metric:   metric,
+			Unit:     unit,
+			UnitSize: unitSize,
+			Tiers:    []PricingTier{{UnitPrice: price}},
+		}
+	}
+
+	return PricingPlan{
+		Code:       PlanCode(pricing.PlanName),
+		Name:       pricing.PlanName,
+		Version:    1,
+		Status:     PricingPlanStatusActive,
+		LimitsPlan: pricing.PlanName,
+		Currency:   pricing.Currency,
+		BasePrice:  pricing.MonthlyBasePrice,
+		Metrics: []MetricPricing{
+			flat(QuotaMetricParticipantMinutes, "minutes", 1, pricing.ParticipantMinutePrice),
+			flat(QuotaMetricEgressMinutes, "minutes", 1, pricing.EgressMinutePrice),
+			flat(QuotaMetricStorageGB, "GB", 1, pricing.StorageGBPrice),
+			flat(QuotaMetricBandwidthGB, "GB", 1, pricing.BandwidthGBPrice),
+			flat(QuotaMetricAPIRequests, "per 1000", 1000, pricing.APIRequestPrice),
+		},
+	}
+}
+
+// PricingPlanAssignment is the input for moving an organization onto a plan.
+// Set PlanID to pin a specific version, or Code for its latest version.
+type PricingPlanAssignment struct {
+	PlanID    string `json:"plan_id"`
+	Code      string `json:"code"`
+	ChangedBy string `json:"changed_by"`
+}
@@ -13,6 +13,7 @@ type StorageConfig struct {
 	AccessKeyID     string `bson:"access_key_id" json:"access_key_id,omitempty"`
 	SecretAccessKey string `bson:"secret_access_key" json:"-"` // Never expose in JSON
 	Region          string `bson:"region" json:"region"`
+	Endpoint        string `bson:"endpoint,omitempty" json:"endpoint,omitempty"` // S3-compatible endpoint; required for r2
 }
 
 // Project represents a customer project/application
@@ -23,10 +24,15 @@ type Project struct {
 	PulseAPIKey    string             `bson:"pulse_api_key" json:"pulse_api_key"`
 	PulseAPISecret string             `bson:"pulse_api_secret" json:"-"` // Never expose
 	WebhookURL     string             `bson:"webhook_url" json:"webhook_url"`
+	WebhookFilter   string            `bson:"webhook_filter,omitempty" json:"webhook_filter,omitempty"`     // e.g. room_name startsWith "prod-"
+	WebhookTemplate string            `bson:"webhook_template,omitempty" json:"webhook_template,omitempty"` // JSON body with {{ expr }} placeholders
 	StorageConfig  StorageConfig      `bson:"storage_config" json:"storage_config"`
 	LiveKitURL     string             `bson:"livekit_url" json:"livekit_url"`
 	Region         string             `bson:"region" json:"region"` // us-east, eu-west, asia-south
 
+	// Per-project concurrency limits; unset fields use the org's plan
+	ConcurrencyOverrides *ConcurrencyLimitOverrides `bson:"concurrency_overrides,omitempty" json:"concurrency_overrides,omitempty"`
+
 	// Feature flags
 	ChatEnabled        bool `bson:"chat_enabled" json:"chat_enabled"`
 	VideoEnabled       bool `bson:"video_enabled" json:"video_enabled"`
@@ -42,6 +48,8 @@ type Project struct {
 type ProjectCreate struct {
 	Name       string        `json:"name" binding:"required,min=3,max=100"`
 	WebhookURL string        `json:"webhook_url" binding:"omitempty,url"`
+	WebhookFilter   string   `json:"webhook_filter"`
+	WebhookTemplate string   `json:"webhook_template"`
 	Region     string        `json:"region" binding:"required,oneof=us-east us-west eu-west eu-central asia-south asia-east"`
 	Storage    StorageConfig `json:"storage_config" binding:"omitempty"`
 }
@@ -50,6 +58,8 @@ type ProjectCreate struct {
 type ProjectUpdate struct {
 	Name       string        `json:"name" binding:"omitempty,min=3,max=100"`
 	WebhookURL string        `json:"webhook_url" binding:"omitempty,url"`
+	WebhookFilter   *string  `json:"webhook_filter"`   // empty string clears the filter
+	WebhookTemplate *string  `json:"webhook_template"` // empty string clears the template
 	Storage    StorageConfig `json:"storage_config" binding:"omitempty"`
 }
 
@@ -60,9 +70,12 @@ type ProjectResponse struct {
 	Name                string        `json:"name"`
 	PulseAPIKey         string        `json:"pulse_api_key"`
 	WebhookURL          string        `json:"webhook_url"`
+	WebhookFilter       string        `json:"webhook_filter,omitempty"`
+	WebhookTemplate     string        `json:"webhook_template,omitempty"`
 	StorageConfig       StorageConfig `json:"storage_config"`
 	LiveKitURL          string        `json:"livekit_url"`
 	Region              string        `json:"region"`
+	ConcurrencyOverrides *ConcurrencyLimitOverrides `json:"concurrency_overrides,omitempty"`
 	ChatEnabled         bool          `json:"chat_enabled"`
 	VideoEnabled        bool          `json:"video_enabled"`
 	ActivityFeedEnabled bool          `json:"activity_feed_enabled"`
@@ -84,9 +97,12 @@ func (p *Project) ToResponse() *ProjectResponse {
 		Name:                p.Name,
 		PulseAPIKey:         p.PulseAPIKey,
 		WebhookURL:          p.WebhookURL,
+		WebhookFilter:       p.WebhookFilter,
+		WebhookTemplate:     p.WebhookTemplate,
 		StorageConfig:       p.StorageConfig,
 		LiveKitURL:          p.LiveKitURL,
 		Region:              p.Region,
+		ConcurrencyOverrides: p.ConcurrencyOverrides,
 		ChatEnabled:         p.ChatEnabled,
 		VideoEnabled:        p.VideoEnabled,
 		ActivityFeedEnabled: p.ActivityFeedEnabled,
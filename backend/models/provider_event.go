@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ProviderEvent is a verified webhook event received from a payment provider.
+// It is unique per provider and event ID, so redeliveries are recognised and
+// each event is applied once; failed events are retried from the store.
+type ProviderEvent struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Provider      string             `bson:"provider" json:"provider"` // razorpay or stripe
+	EventID       string             `bson:"event_id" json:"event_id"` // provider's event ID
+	Type          string             `bson:"type" json:"type"`         // e.g. payment.captured, invoice.paid
+	Payload       string             `bson:"payload" json:"payload"`   // raw JSON body as received
+	Status        string             `bson:"status" json:"status"`
+	Attempts      int                `bson:"attempts" json:"attempts"`
+	Deliveries    int                `bson:"deliveries" json:"deliveries"` // times the provider sent the event
+	Error         string             `bson:"error,omitempty" json:"error,omitempty"`
+	NextAttemptAt *time.Time         `bson:"next_attempt_at,omitempty" json:"next_attempt_at,omitempty"`
+	ProcessedAt   *time.Time         `bson:"processed_at,omitempty" json:"processed_at,omitempty"`
+	ReceivedAt    time.Time          `bson:"received_at" json:"received_at"`
+	UpdatedAt     time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// TableName returns the collection name
+func (ProviderEvent) TableName() string {
+	return "provider_events"
+}
+
+// Provider event statuses
+const (
+	ProviderEventStatusReceived   = "received"   // stored, not yet processed
+	ProviderEventStatusProcessing = "processing" // claimed by a handler
+	ProviderEventStatusProcessed  = "processed"
+	ProviderEventStatusFailed     = "failed" // handler failed; retried at next_attempt_at
+	ProviderEventStatusDead       = "dead"   // retries exhausted; reprocess manually
+)
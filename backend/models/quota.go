@@ -0,0 +1,100 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Quota statuses
+const (
+	QuotaStatusOK       = "ok"       // below the plan limit
+	QuotaStatusGrace    = "grace"    // over the limit but within the soft-limit grace
+	QuotaStatusExceeded = "exceeded" // over the limit and the grace; requests are rejected
+)
+
+// Quota metrics
+const (
+	QuotaMetricParticipantMinutes = "participant_minutes"
+	QuotaMetricEgressMinutes      = "egress_minutes"
+	QuotaMetricStorageGB          = "storage_gb"
+	QuotaMetricBandwidthGB        = "bandwidth_gb"
+	QuotaMetricAPIRequests        = "api_requests"
+)
+
+// PlanLimitOverrides lets sales raise or lower individual limits for an
+// organization. Nil fields fall back to the plan's limit; -1 means unlimited.
+type PlanLimitOverrides struct {
+	MaxParticipantMinutes *float64  `bson:"max_participant_minutes,omitempty" json:"max_participant_minutes,omitempty"`
+	MaxEgressMinutes      *float64  `bson:"max_egress_minutes,omitempty" json:"max_egress_minutes,omitempty"`
+	MaxStorageGB          *float64  `bson:"max_storage_gb,omitempty" json:"max_storage_gb,omitempty"`
+	MaxBandwidthGB        *float64  `bson:"max_bandwidth_gb,omitempty" json:"max_bandwidth_gb,omitempty"`
+	MaxAPIRequests        *int64    `bson:"max_api_requests,omitempty" json:"max_api_requests,omitempty"`
+	GracePercentage       *int      `bson:"grace_percentage,omitempty" json:"grace_percentage,omitempty"`
+	Note                  string    `bson:"note,omitempty" json:"note,omitempty"` // e.g. deal reference
+	UpdatedBy             string    `bson:"updated_by,omitempty" json:"updated_by,omitempty"`
+	UpdatedAt             time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// Apply returns limits with the overrides applied
+func (o *PlanLimitOverrides) Apply(limits PlanLimits) PlanLimits {
+	if o == nil {
+		return limits
+	}
+	if o.MaxParticipantMinutes != nil {
+		limits.MaxParticipantMinutes = *o.MaxParticipantMinutes
+	}
+	if o.MaxEgressMinutes != nil {
+		limits.MaxEgressMinutes = *o.MaxEgressMinutes
+	}
+	if o.MaxStorageGB != nil {
+		limits.MaxStorageGB = *o.MaxStorageGB
+	}
+	if o.MaxBandwidthGB != nil {
+		limits.MaxBandwidthGB = *o.MaxBandwidthGB
+	}
+	if o.MaxAPIRequests != nil {
+		limits.MaxAPIRequests = *o.MaxAPIRequests
+	}
+	if o.GracePercentage != nil {
+		limits.GracePercentage = *o.GracePercentage
+	}
+	return limits
+}
+
+// QuotaMetricState is the quota position of a single metric
+type QuotaMetricState struct {
+	Metric     string  `json:"metric"`
+	Usage      float64 `json:"usage"`
+	Limit      float64 `json:"limit"`      // -1 means unlimited
+	HardLimit  float64 `json:"hard_limit"` // limit plus grace
+	Percentage float64 `json:"percentage"`
+	Status     string  `json:"status"`
+}
+
+// QuotaState is an organization's cached quota position for the current period
+type QuotaState struct {
+	OrgID       string                      `json:"org_id"`
+	Plan        string                      `json:"plan"`
+	PeriodStart time.Time                   `json:"period_start"`
+	PeriodEnd   time.Time                   `json:"period_end"`
+	Metrics     map[string]QuotaMetricState `json:"metrics"`
+	SpendCaps   []SpendCap                  `json:"spend_caps,omitempty"`
+	ComputedAt  time.Time                   `json:"computed_at"`
+}
+
+// SpendCap is a budget hard cap that has been reached and blocks billable
+// operations, for the whole organization or one project, until it lifts
+type SpendCap struct {
+	BudgetID  string    `json:"budget_id"`
+	ProjectID string    `json:"project_id,omitempty"` // empty for the whole organization
+	Amount    float64   `json:"amount"`
+	Spend     float64   `json:"spend"`
+	Currency  string    `json:"currency"`
+	Until     time.Time `json:"until"`
+}
+
+// Applies reports whether the cap blocks a project
+func (c SpendCap) Applies(projectID primitive.ObjectID) bool {
+	return c.ProjectID == "" || c.ProjectID == projectID.Hex()
+}
@@ -0,0 +1,190 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Recording is a file or HLS playlist an egress wrote to storage
+type Recording struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ProjectID    primitive.ObjectID `bson:"project_id" json:"project_id"`
+	EgressID     primitive.ObjectID `bson:"egress_id" json:"egress_id"`
+	RoomName     string             `bson:"room_name" json:"room_name"`
+	Participants []string           `bson:"participants,omitempty" json:"participants,omitempty"` // identities that joined while recording
+
+	DurationSeconds int64  `bson:"duration_seconds" json:"duration_seconds"`
+	SizeBytes       int64  `bson:"size_bytes" json:"size_bytes"`
+	Format          string `bson:"format" json:"format"` // file extension, e.g. mp4 or ogg, or hls
+	Checksum        string `bson:"checksum,omitempty" json:"checksum,omitempty"`
+
+	// Where the recording is stored. External recordings are in a bucket
+	// given in the egress request rather than the project's, so deleting
+	// them only removes them from the library.
+	StorageBucket string `bson:"storage_bucket" json:"storage_bucket"`
+	StorageKey    string `bson:"storage_key" json:"storage_key"`
+	External      bool   `bson:"external,omitempty" json:"external,omitempty"`
+	CDNURL        string `bson:"cdn_url,omitempty" json:"cdn_url,omitempty"`
+
+	Tags []string `bson:"tags" json:"tags"`
+
+	RecordedAt time.Time `bson:"recorded_at" json:"recorded_at"` // when the egress started
+	CreatedAt  time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// TableName returns the collection name
+func (Recording) TableName() string {
+	return "recordings"
+}
+
+// RecordingFormat returns the format of a recording from its storage key
+func RecordingFormat(outputType OutputType, key string) string {
+	if outputType == OutputTypeHLS {
+		return "hls"
+	}
+	return strings.ToLower(strings.TrimPrefix(path.Ext(key), "."))
+}
+
+// RecordingFilter represents filters for searching recordings
+type RecordingFilter struct {
+	RoomName    string    `form:"room_name"` // prefix
+	Participant string    `form:"participant"`
+	Tag         string    `form:"tag"`
+	Format      string    `form:"format"`
+	StartDate   time.Time `form:"-"`
+	EndDate     time.Time `form:"-"`
+	Page        int       `form:"page"`
+	Limit       int       `form:"limit"`
+}
+
+// RecordingTagsUpdate replaces the tags of a recording
+type RecordingTagsUpdate struct {
+	Tags []string `json:"tags" binding:"required,dive,required"`
+}
+
+// RetentionPolicy deletes a project's recordings some days after they were
+// recorded. A recording is deleted once any policy matching it expires it.
+type RetentionPolicy struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ProjectID     primitive.ObjectID `bson:"project_id" json:"project_id"`
+	Name          string             `bson:"name" json:"name"`
+	RetentionDays int                `bson:"retention_days" json:"retention_days"`
+	RoomPattern   string             `bson:"room_pattern,omitempty" json:"room_pattern,omitempty"` // glob; empty matches every room
+	Tag           string             `bson:"tag,omitempty" json:"tag,omitempty"`                   // empty matches every recording
+	Enabled       bool               `bson:"enabled" json:"enabled"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt     time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// TableName returns the collection name
+func (RetentionPolicy) TableName() string {
+	return "recording_retention_policies"
+}
+
+// Matches reports whether the policy covers a recording, leaving its age
+// aside
+func (p *RetentionPolicy) Matches(recording *Recording) bool {
+	if p.RoomPattern != "" {
+		if matched, _ := path.Match(p.RoomPattern, recording.RoomName); !matched {
+			return false
+		}
+	}
+	if p.Tag == "" {
+		return true
+	}
+	for _, tag := range recording.Tags {
+		if tag == p.Tag {
+			return true
+		}
+	}
+	return false
+}
+
+// RoomRegex translates RoomPattern into an anchored regular expression that
+// matches the room names path.Match does, so the pattern can be applied in
+// recording queries. The pattern must be valid.
+func (p *RetentionPolicy) RoomRegex() string {
+	var b strings.Builder
+	b.WriteString("^")
+	pattern := p.RoomPattern
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '\\':
+			i++
+			if i < len(pattern) {
+				b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			}
+		case '[':
+			// Members are copied as literals; ranges keep their dash
+			b.WriteString("[")
+			i++
+			if i < len(pattern) && pattern[i] == '^' {
+				b.WriteByte('^')
+				i++
+			}
+			for ; i < len(pattern) && pattern[i] != ']'; i++ {
+				switch c := pattern[i]; {
+				case c == '-':
+					b.WriteByte(c)
+				case c == '\\':
+					i++
+					if i < len(pattern) {
+						b.WriteString(classMember(pattern[i]))
+					}
+				default:
+					b.WriteString(classMember(c))
+				}
+			}
+			b.WriteString("]")
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// classMember escapes a literal byte of a regular expression character class
+func classMember(c byte) string {
+	if strings.IndexByte(`\]-^[`, c) >= 0 {
+		return `\` + string(c)
+	}
+	return string([]byte{c})
+}
+
+// ExpiresBefore returns the recording time before which the policy deletes
+// recordings
+func (p *RetentionPolicy) ExpiresBefore(now time.Time) time.Time {
+	return now.AddDate(0, 0, -p.RetentionDays)
+}
+
+// RetentionPolicyInput is the input for creating a retention policy
+type RetentionPolicyInput struct {
+	Name          string `json:"name" binding:"required"`
+	RetentionDays int    `json:"retention_days" binding:"required"`
+	RoomPattern   string `json:"room_pattern"`
+	Tag           string `json:"tag"`
+	Enabled       *bool  `json:"enabled"` // true if unset
+}
+
+// Validate checks the retention period and room pattern
+func (in *RetentionPolicyInput) Validate() error {
+	if in.RetentionDays < 1 || in.RetentionDays > 3650 {
+		return errors.New("retention_days must be between 1 and 3650")
+	}
+	if _, err := path.Match(in.RoomPattern, ""); err != nil {
+		return fmt.Errorf("invalid room pattern %q", in.RoomPattern)
+	}
+	return nil
+}
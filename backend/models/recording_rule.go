@@ -0,0 +1,103 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Recording rule triggers, named after the LiveKit webhook that fires them
+const (
+	RecordingTriggerRoomStarted    = "room_started"
+	RecordingTriggerTrackPublished = "track_published"
+)
+
+// RecordingRule starts an egress automatically for a project's rooms, or for
+// tracks published in them. A rule records each room once, or each track
+// once for track rules, and its recordings stop when the room ends.
+type RecordingRule struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ProjectID   primitive.ObjectID `bson:"project_id" json:"project_id"`
+	Name        string             `bson:"name" json:"name"`
+	Enabled     bool               `bson:"enabled" json:"enabled"`
+	Trigger     string             `bson:"trigger" json:"trigger"`
+	RoomPattern string             `bson:"room_pattern" json:"room_pattern"`                 // glob, e.g. class-*; empty matches every room
+	TrackKind   string             `bson:"track_kind,omitempty" json:"track_kind,omitempty"` // audio or video; empty matches both
+
+	// The egress to start
+	EgressType  EgressType     `bson:"egress_type" json:"egress_type"`
+	LayoutType  LayoutType     `bson:"layout_type,omitempty" json:"layout_type,omitempty"`
+	Preset      string         `bson:"preset,omitempty" json:"preset,omitempty"`
+	TemplateURL string         `bson:"template_url,omitempty" json:"template_url,omitempty"`
+	Outputs     []EgressOutput `bson:"outputs" json:"outputs"`
+
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// TableName returns the collection name
+func (RecordingRule) TableName() string {
+	return "recording_rules"
+}
+
+// MatchesRoom reports whether the rule records a room
+func (r *RecordingRule) MatchesRoom(roomName string) bool {
+	if r.RoomPattern == "" {
+		return true
+	}
+	matched, _ := path.Match(r.RoomPattern, roomName)
+	return matched
+}
+
+// MatchesTrack reports whether the rule records a track of a kind, as
+// LiveKit reports it (AUDIO or VIDEO)
+func (r *RecordingRule) MatchesTrack(kind string) bool {
+	return r.TrackKind == "" || strings.EqualFold(r.TrackKind, kind)
+}
+
+// RecordingRuleInput is the input for creating or replacing a recording rule
+type RecordingRuleInput struct {
+	Name        string         `json:"name" binding:"required"`
+	Enabled     *bool          `json:"enabled"` // true if unset
+	Trigger     string         `json:"trigger" binding:"required"`
+	RoomPattern string         `json:"room_pattern"`
+	TrackKind   string         `json:"track_kind"`
+	EgressType  EgressType     `json:"egress_type" binding:"required"`
+	LayoutType  LayoutType     `json:"layout_type"`
+	Preset      string         `json:"preset"`
+	TemplateURL string         `json:"template_url"`
+	Outputs     []EgressOutput `json:"outputs" binding:"required,min=1,dive"`
+}
+
+// Validate checks the trigger can start the rule's egress type
+func (in *RecordingRuleInput) Validate() error {
+	if _, err := path.Match(in.RoomPattern, ""); err != nil {
+		return fmt.Errorf("invalid room pattern %q", in.RoomPattern)
+	}
+	switch in.TrackKind {
+	case "", "audio", "video":
+	default:
+		return fmt.Errorf("unknown track kind %q", in.TrackKind)
+	}
+
+	switch in.Trigger {
+	case RecordingTriggerRoomStarted:
+		if in.EgressType != EgressTypeRoomComposite {
+			return errors.New("room_started rules record room composite egress")
+		}
+		if in.TrackKind != "" {
+			return errors.New("track_kind only applies to track_published rules")
+		}
+	case RecordingTriggerTrackPublished:
+		if in.EgressType != EgressTypeTrack && in.EgressType != EgressTypeTrackComposite {
+			return errors.New("track_published rules record track or track composite egress")
+		}
+	default:
+		return fmt.Errorf("unknown trigger %q", in.Trigger)
+	}
+	return nil
+}
@@ -12,6 +12,8 @@ type RegionConfig struct {
 	Code             string             `bson:"code" json:"code"` // us-east, eu-west, etc.
 	Name             string             `bson:"name" json:"name"`
 	LiveKitURL       string             `bson:"livekit_url" json:"livekit_url"`
+	APIKey           string             `bson:"api_key,omitempty" json:"-"`    // the default LiveKit credentials if empty
+	APISecret        string             `bson:"api_secret,omitempty" json:"-"` // Never expose
 	LatencyEndpoint  string             `bson:"latency_endpoint" json:"latency_endpoint"`
 	IsActive         bool               `bson:"is_active" json:"is_active"`
 	Priority         int                `bson:"priority" json:"priority"` // Lower = higher priority
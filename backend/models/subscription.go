@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Subscription is an organization's self-service subscription: the state of
+// its plan and of the recurring subscription with its payment provider. The
+// plan itself lives on the organization and in its plan history.
+type Subscription struct {
+	ID                     primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
+	OrgID                  primitive.ObjectID   `bson:"org_id" json:"org_id"`
+	Status                 string               `bson:"status" json:"status"`
+	Provider               string               `bson:"provider,omitempty" json:"provider,omitempty"`
+	ProviderSubscriptionID string               `bson:"provider_subscription_id,omitempty" json:"provider_subscription_id,omitempty"` // empty while on a plan without a provider plan
+	ScheduledChange        *ScheduledPlanChange `bson:"scheduled_change,omitempty" json:"scheduled_change,omitempty"`
+	PausedPlan             *PricingPlan         `bson:"paused_plan,omitempty" json:"paused_plan,omitempty"` // restored on resume
+	PausedAt               *time.Time           `bson:"paused_at,omitempty" json:"paused_at,omitempty"`
+	CancelledAt            *time.Time           `bson:"cancelled_at,omitempty" json:"cancelled_at,omitempty"`
+	CreatedAt              time.Time            `bson:"created_at" json:"created_at"`
+	UpdatedAt              time.Time            `bson:"updated_at" json:"updated_at"`
+}
+
+// TableName returns the collection name
+func (Subscription) TableName() string {
+	return "subscriptions"
+}
+
+// Subscription statuses
+const (
+	SubscriptionStatusActive    = "active"
+	SubscriptionStatusPaused    = "paused"    // on Free limits and not charged until resumed
+	SubscriptionStatusCancelled = "cancelled" // on the Free plan
+)
+
+// Scheduled plan change actions
+const (
+	ScheduledChangeDowngrade = "downgrade"
+	ScheduledChangeCancel    = "cancel"
+)
+
+// ScheduledPlanChange is a plan change that takes effect at the end of the
+// current billing cycle, so the cycle already paid for is not prorated
+type ScheduledPlanChange struct {
+	Action      string      `bson:"action" json:"action"` // downgrade or cancel
+	Plan        PricingPlan `bson:"plan" json:"plan"`
+	EffectiveAt time.Time   `bson:"effective_at" json:"effective_at"`
+	RequestedBy string      `bson:"requested_by,omitempty" json:"requested_by,omitempty"`
+	RequestedAt time.Time   `bson:"requested_at" json:"requested_at"`
+}
+
+// SubscriptionCancel is the input for cancelling a subscription
+type SubscriptionCancel struct {
+	AtPeriodEnd bool `json:"at_period_end"` // keep the plan until the billing cycle ends
+}
@@ -0,0 +1,44 @@
+package models
+
+// BillingAddress is where an organization is billed. Country is an ISO 3166-1
+// alpha-2 code; for India, State is the ISO 3166-2 subdivision code without
+// the "IN-" prefix (e.g. "KA").
+type BillingAddress struct {
+	Line1      string `bson:"line1" json:"line1"`
+	Line2      string `bson:"line2,omitempty" json:"line2,omitempty"`
+	City       string `bson:"city" json:"city"`
+	State      string `bson:"state,omitempty" json:"state,omitempty"`
+	PostalCode string `bson:"postal_code" json:"postal_code"`
+	Country    string `bson:"country" json:"country" binding:"required,len=2"`
+}
+
+// Tax ID types
+const (
+	TaxIDTypeGSTIN = "gstin"  // Indian GST identification number
+	TaxIDTypeEUVAT = "eu_vat" // EU VAT identification number
+)
+
+// TaxProfile is an organization's billing address and tax registration
+type TaxProfile struct {
+	BillingAddress BillingAddress `bson:"billing_address" json:"billing_address" binding:"required"`
+	TaxID          string         `bson:"tax_id,omitempty" json:"tax_id,omitempty"`
+	TaxIDType      string         `bson:"tax_id_type,omitempty" json:"tax_id_type,omitempty"`
+	TaxIDValid     bool           `bson:"tax_id_valid" json:"tax_id_valid"`
+}
+
+// TaxLine is one tax charged on an invoice. Amounts are in minor units.
+type TaxLine struct {
+	Name          string  `bson:"name" json:"name"`                 // CGST, SGST, IGST, VAT
+	Jurisdiction  string  `bson:"jurisdiction" json:"jurisdiction"` // e.g. IN-KA, DE
+	Rate          float64 `bson:"rate" json:"rate"`                 // percent
+	TaxableAmount int64   `bson:"taxable_amount" json:"taxable_amount"`
+	Amount        int64   `bson:"amount" json:"amount"`
+}
+
+// TaxResult is the tax due on a taxable amount
+type TaxResult struct {
+	Lines         []TaxLine `json:"lines"`
+	Total         int64     `json:"total"` // minor units
+	ReverseCharge bool      `json:"reverse_charge"`
+	Note          string    `json:"note,omitempty"` // printed on the invoice, e.g. the reverse charge notice
+}
@@ -28,6 +28,23 @@ func (UsageAggregate) TableName() string {
 	return "usage_aggregates"
 }
 
+// AggregationWatermark records how far usage aggregation has progressed
+// for a period type, so missed periods can be backfilled after downtime
+type AggregationWatermark struct {
+	PeriodType      string    `bson:"_id" json:"period_type"`
+	AggregatedUntil time.Time `bson:"aggregated_until" json:"aggregated_until"` // end of the last aggregated period
+	UpdatedAt       time.Time `bson:"updated_at" json:"updated_at"`
+
+	// Events recorded since this time with timestamps before AggregatedUntil
+	// arrived after their period was rolled up, so the period is re-aggregated
+	LateEventsCheckedAt time.Time `bson:"late_events_checked_at,omitempty" json:"late_events_checked_at,omitempty"`
+}
+
+// TableName returns the collection name
+func (AggregationWatermark) TableName() string {
+	return "aggregation_watermarks"
+}
+
 // Period types
 const (
 	PeriodHourly  = "hourly"
@@ -45,6 +62,9 @@ type PlanLimits struct {
 	MaxBandwidthGB           float64            `bson:"max_bandwidth_gb" json:"max_bandwidth_gb"`
 	MaxAPIRequests           int64              `bson:"max_api_requests" json:"max_api_requests"`
 	AlertThresholdPercentage int                `bson:"alert_threshold_percentage" json:"alert_threshold_percentage"` // e.g., 80
+	GracePercentage          int                `bson:"grace_percentage" json:"grace_percentage"`                     // soft-limit overage allowed before blocking
+	Concurrency              ConcurrencyLimits  `bson:"concurrency" json:"concurrency"`
+	Encoding                 EncodingLimits     `bson:"encoding" json:"encoding"`
 	CreatedAt                time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt                time.Time          `bson:"updated_at" json:"updated_at"`
 }
@@ -64,6 +84,18 @@ var (
 		MaxBandwidthGB:           10,      // 10 GB
 		MaxAPIRequests:           10000,   // 10k requests
 		AlertThresholdPercentage: 80,      // Alert at 80%
+		GracePercentage:          0,       // Hard stop at the limit
+		Concurrency: ConcurrencyLimits{
+			MaxConcurrentRooms:     5,
+			MaxParticipantsPerRoom: 10,
+			MaxConcurrentEgresses:  1,
+			MaxActiveIngresses:     1,
+		},
+		Encoding: EncodingLimits{
+			MaxHeight:       720,
+			MaxFramerate:    30,
+			CustomTemplates: false,
+		},
 	}
 
 	ProPlanLimits = PlanLimits{
@@ -74,6 +106,18 @@ var (
 		MaxBandwidthGB:           1000,    // 1 TB
 		MaxAPIRequests:           1000000, // 1M requests
 		AlertThresholdPercentage: 80,
+		GracePercentage:          10,      // 10% overage before blocking
+		Concurrency: ConcurrencyLimits{
+			MaxConcurrentRooms:     200,
+			MaxParticipantsPerRoom: 100,
+			MaxConcurrentEgresses:  20,
+			MaxActiveIngresses:     20,
+		},
+		Encoding: EncodingLimits{
+			MaxHeight:       1080,
+			MaxFramerate:    60,
+			CustomTemplates: true,
+		},
 	}
 
 	EnterprisePlanLimits = PlanLimits{
@@ -84,6 +128,18 @@ var (
 		MaxBandwidthGB:           -1, // Unlimited
 		MaxAPIRequests:           -1, // Unlimited
 		AlertThresholdPercentage: 90, // Alert at 90%
+		GracePercentage:          0,
+		Concurrency: ConcurrencyLimits{
+			MaxConcurrentRooms:     -1,
+			MaxParticipantsPerRoom: -1,
+			MaxConcurrentEgresses:  -1,
+			MaxActiveIngresses:     -1,
+		},
+		Encoding: EncodingLimits{
+			MaxHeight:       -1,
+			MaxFramerate:    -1,
+			CustomTemplates: true,
+		},
 	}
 )
 
@@ -98,6 +154,7 @@ type UsageAlert struct {
 	Severity    string             `bson:"severity" json:"severity"` // warning, critical
 	Message     string             `bson:"message" json:"message"`
 	Notified    bool               `bson:"notified" json:"notified"`
+	PeriodStart time.Time          `bson:"period_start" json:"period_start"` // an alert fires once per metric, severity and period
 	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
 }
 
@@ -111,3 +168,15 @@ const (
 	SeverityWarning  = "warning"  // 80% threshold
 	SeverityCritical = "critical" // 95% threshold
 )
+
+// GetPlanLimits returns the limits for a plan, defaulting to Free
+func GetPlanLimits(plan string) PlanLimits {
+	switch plan {
+	case "Pro":
+		return ProPlanLimits
+	case "Enterprise":
+		return EnterprisePlanLimits
+	default:
+		return FreePlanLimits
+	}
+}
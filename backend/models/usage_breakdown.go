@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Breakdown dimensions. Tag dimensions are "tag:<key>" for a key passed in
+// token metadata.
+const (
+	DimensionRoom        = "room"
+	DimensionParticipant = "participant"
+	DimensionTagPrefix   = "tag:"
+)
+
+// UsageDimensionAggregate is one day of usage for a single value of a
+// breakdown dimension, e.g. room "standup" or tag:customer "acme"
+type UsageDimensionAggregate struct {
+	ID                 primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ProjectID          primitive.ObjectID `bson:"project_id" json:"project_id"`
+	PeriodStart        time.Time          `bson:"period_start" json:"period_start"` // UTC day
+	Dimension          string             `bson:"dimension" json:"dimension"`
+	Key                string             `bson:"key" json:"key"`
+	ParticipantMinutes float64            `bson:"participant_minutes" json:"participant_minutes"`
+	EgressMinutes      float64            `bson:"egress_minutes" json:"egress_minutes"`
+	BandwidthGB        float64            `bson:"bandwidth_gb" json:"bandwidth_gb"`
+	Sessions           int64              `bson:"sessions" json:"sessions"` // participant sessions
+	UpdatedAt          time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// TableName returns the collection name
+func (UsageDimensionAggregate) TableName() string {
+	return "usage_dimension_aggregates"
+}
+
+// UsageBreakdownRow is the usage attributed to one dimension value
+type UsageBreakdownRow struct {
+	Key                string  `json:"key"`
+	ParticipantMinutes float64 `json:"participant_minutes"`
+	EgressMinutes      float64 `json:"egress_minutes"`
+	BandwidthGB        float64 `json:"bandwidth_gb"`
+	Sessions           int64   `json:"sessions"`
+}
+
+// UsageBreakdown is a page of usage grouped by a dimension
+type UsageBreakdown struct {
+	ProjectID string              `json:"project_id"`
+	GroupBy   string              `json:"group_by"`
+	StartDate time.Time           `json:"start_date"`
+	EndDate   time.Time           `json:"end_date"`
+	Rows      []UsageBreakdownRow `json:"rows"`
+	Total     int                 `json:"total"`
+	Page      int                 `json:"page"`
+	Limit     int                 `json:"limit"`
+}
@@ -14,6 +14,8 @@ type UsageMetric struct {
 	Value     float64                `bson:"value" json:"value"`           // duration in minutes, size in GB, etc.
 	Timestamp time.Time              `bson:"timestamp" json:"timestamp"`
 	Metadata  map[string]interface{} `bson:"metadata" json:"metadata"`
+	IdempotencyKey string            `bson:"idempotency_key,omitempty" json:"-"` // unique per project and source event
+	RecordedAt     time.Time         `bson:"recorded_at,omitempty" json:"-"`     // when the event was written; later than Timestamp if it waited in the metering buffer
 }
 
 // UsageMetricCreate represents the input for creating a usage metric
@@ -56,3 +58,19 @@ const (
 	EventBandwidthUsed     = "bandwidth_used"
 	EventAPIRequest        = "api_request"
 )
+
+// ProjectUsage is one project's share of an organization's usage
+type ProjectUsage struct {
+	ProjectName string `json:"project_name"`
+	UsageSummary
+}
+
+// OrgUsageSummary is usage summed across all of an organization's projects
+type OrgUsageSummary struct {
+	OrgID     string         `json:"org_id"`
+	Plan      string         `json:"plan"`
+	StartDate time.Time      `json:"start_date"`
+	EndDate   time.Time      `json:"end_date"`
+	Totals    UsageSummary   `json:"totals"`
+	Projects  []ProjectUsage `json:"projects"`
+}
@@ -19,6 +19,19 @@ const (
 	WebhookEventRecordingAvailable WebhookEventType = "recording_available"
 	WebhookEventIngressStarted WebhookEventType = "ingress_started"
 	WebhookEventIngressEnded WebhookEventType = "ingress_ended"
+
+	// Control-plane events
+	WebhookEventUsageThresholdReached WebhookEventType = "usage.threshold_reached"
+	WebhookEventBudgetThresholdReached WebhookEventType = "budget.threshold_reached"
+	WebhookEventBudgetForecastExceeded WebhookEventType = "budget.forecast_exceeded"
+	WebhookEventInvoiceGenerated WebhookEventType = "invoice.generated"
+	WebhookEventInvoicePaid WebhookEventType = "invoice.paid"
+	WebhookEventInvoicePaymentReminder WebhookEventType = "invoice.payment_reminder"
+	WebhookEventOrganizationSuspended WebhookEventType = "organization.suspended"
+	WebhookEventOrganizationReinstated WebhookEventType = "organization.reinstated"
+	WebhookEventModerationFlagged WebhookEventType = "moderation.flagged"
+	WebhookEventAlertTriggered WebhookEventType = "alert.triggered"
+	WebhookEventProjectKeyRotated WebhookEventType = "project.key_rotated"
 )
 
 // WebhookDeliveryStatus represents the delivery status
@@ -73,6 +86,11 @@ type WebhookPayload struct {
 	Egress *EgressInfo `json:"egress,omitempty"`
 	Ingress *IngressInfo `json:"ingress,omitempty"`
 	Recording *RecordingInfo `json:"recording,omitempty"`
+	Usage *UsageInfo `json:"usage,omitempty"`
+	Budget *BudgetInfo `json:"budget,omitempty"`
+	Invoice *InvoiceInfo `json:"invoice,omitempty"`
+	Moderation *ModerationInfo `json:"moderation,omitempty"`
+	Alert *AlertInfo `json:"alert,omitempty"`
 	Metadata map[string]interface{} `json:"metadata,omitempty"`
 }
 
@@ -110,3 +128,75 @@ type RecordingInfo struct {
 	Duration int64 `json:"duration"`
 	FileSize int64 `json:"file_size"`
 }
+
+// UsageInfo contains usage threshold details for webhooks
+type UsageInfo struct {
+	MetricType string `json:"metric_type"`
+	CurrentUsage float64 `json:"current_usage"`
+	Limit float64 `json:"limit"`
+	Percentage float64 `json:"percentage"`
+	Severity string `json:"severity"`
+}
+
+// BudgetInfo contains budget alert details for webhooks
+type BudgetInfo struct {
+	BudgetID string `json:"budget_id"`
+	ProjectID string `json:"project_id,omitempty"` // empty for organization budgets
+	Threshold int `json:"threshold"` // percent of the budget
+	Amount float64 `json:"amount"`
+	Spend float64 `json:"spend"`
+	ForecastSpend float64 `json:"forecast_spend"`
+	Currency string `json:"currency"`
+	HardCap bool `json:"hard_cap"`
+	CapReached bool `json:"cap_reached"`
+	PeriodEnd int64 `json:"period_end"`
+}
+
+// InvoiceInfo contains invoice details for webhooks
+type InvoiceInfo struct {
+	ID string `json:"id"`
+	InvoiceNumber string `json:"invoice_number"`
+	BillingPeriod string `json:"billing_period"`
+	Status string `json:"status"`
+	Total int64 `json:"total"` // minor units
+	Currency string `json:"currency"`
+	DueDate int64 `json:"due_date,omitempty"`
+	PaymentLink string `json:"payment_link,omitempty"`
+	DunningStage int `json:"dunning_stage,omitempty"`
+}
+
+// ModerationInfo contains moderation details for webhooks
+type ModerationInfo struct {
+	AnalysisID string `json:"analysis_id"`
+	ContentID string `json:"content_id,omitempty"`
+	ContentType string `json:"content_type"`
+	UserID string `json:"user_id,omitempty"`
+	Severity string `json:"severity"`
+	Action string `json:"action"`
+	Reason string `json:"reason"`
+}
+
+// AlertInfo contains metric alert details for webhooks
+type AlertInfo struct {
+	AlertID string `json:"alert_id"`
+	TriggerID string `json:"trigger_id"`
+	MetricValue float64 `json:"metric_value"`
+	Threshold float64 `json:"threshold"`
+	Severity string `json:"severity"`
+	Message string `json:"message"`
+}
+
+// WebhookPreviewRequest runs a sample payload through a filter and template.
+// When Filter or Template is nil the project's configured value is used.
+type WebhookPreviewRequest struct {
+	Filter *string `json:"filter"`
+	Template *string `json:"template"`
+	Payload WebhookPayload `json:"payload" binding:"required"`
+}
+
+// WebhookPreviewResponse is the result of a webhook preview
+type WebhookPreviewResponse struct {
+	Matched bool `json:"matched"`
+	Body interface{} `json:"body,omitempty"`
+	Error string `json:"error,omitempty"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// WorkerLock is a lease that lets one replica run a background job
+type WorkerLock struct {
+	Name       string    `bson:"_id" json:"name"`
+	Owner      string    `bson:"owner" json:"owner"`
+	ExpiresAt  time.Time `bson:"expires_at" json:"expires_at"`
+	AcquiredAt time.Time `bson:"acquired_at" json:"acquired_at"`
+}
+
+// TableName returns the collection name
+func (WorkerLock) TableName() string {
+	return "worker_locks"
+}
@@ -5,7 +5,6 @@ import (
 	"sync"
 	"time"
 
-	"pulse-control-plane/models"
 	"pulse-control-plane/services"
 
 	"github.com/rs/zerolog/log"
@@ -12,8 +12,8 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// SetupRoutes configures all API routes
-func SetupRoutes(router *gin.Engine, cfg *config.Config) {
+// SetupRoutes configures all API routes on the shared service graph
+func SetupRoutes(router *gin.Engine, cfg *config.Config, svc *Services) {
 	// Apply security headers middleware
 	router.Use(middleware.SecurityHeaders())
 
@@ -37,33 +37,70 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 	// Apply audit logging middleware
 	router.Use(middleware.AuditMiddleware())
 
-	// Initialize services
+	// Services shared with the background workers
 	db := database.GetDB()
-	usageService := services.NewUsageService(db)
-	aggregatorService := services.NewAggregatorService(db)
-	billingService := services.NewBillingService(db, usageService)
-	razorpayService := services.NewRazorpayService(db, cfg.RazorpayKeyID, cfg.RazorpayKeySecret, cfg.RazorpayWebhookSecret, billingService)
+	webhookService := svc.WebhookService
+	eventBus := svc.EventBus
+	usageService := svc.UsageService
+	aggregatorService := svc.AggregatorService
+	quotaService := svc.QuotaService
+	concurrencyService := svc.ConcurrencyService
+	pricingService := svc.PricingService
+	creditService := svc.CreditService
+	billingService := svc.BillingService
+	providerEventStore := svc.ProviderEventStore
+	razorpayService := svc.RazorpayService
+	paymentService := svc.PaymentService
+	billingRunService := svc.BillingRunService
+	subscriptionService := svc.SubscriptionService
+	analyticsService := svc.AnalyticsService
+	budgetService := svc.BudgetService
+	projectService := svc.ProjectService
+	recordingService := svc.RecordingService
+
+	// Meter API requests per authenticated project
+	router.Use(middleware.MeterAPIRequests(usageService))
+
+	invoiceDocumentService := services.NewInvoiceDocumentService(db, billingService, services.NewObjectStorage(), services.InvoiceBranding{
+		CompanyName:  cfg.InvoiceCompanyName,
+		Address:      cfg.InvoiceCompanyAddress,
+		TaxID:        cfg.TaxSellerTaxID,
+		SupportEmail: cfg.InvoiceSupportEmail,
+		AccentColor:  cfg.InvoiceAccentColor,
+	})
 
 	// Initialize all services
 	feedService := services.NewFeedService(db)
 	presenceService := services.NewPresenceService(db)
-	moderationService := services.NewModerationService(db, cfg.GeminiAPIKey)
+	moderationService := services.NewModerationService(db, cfg.GeminiAPIKey, eventBus)
 
 	// Initialize handlers
 	organizationHandler := handlers.NewOrganizationHandler()
-	projectHandler := handlers.NewProjectHandler()
-	tokenHandler := handlers.NewTokenHandler(cfg)
-	egressHandler := handlers.NewEgressHandler()
-	ingressHandler := handlers.NewIngressHandler()
-	webhookHandler := handlers.NewWebhookHandler()
+	projectHandler := handlers.NewProjectHandler(projectService)
+	tokenHandler := handlers.NewTokenHandler(cfg, quotaService, concurrencyService)
+	egressClients := services.NewLiveKitEgressClients(services.NewRegionService(), cfg.LiveKitHost, cfg.LiveKitAPIKey, cfg.LiveKitAPISecret)
+	encodingPresetService := services.NewEncodingPresetService(db)
+	egressHandler := handlers.NewEgressHandler(quotaService, concurrencyService, usageService, egressClients, encodingPresetService)
+	encodingPresetHandler := handlers.NewEncodingPresetHandler(encodingPresetService)
+	recordingRuleService := services.NewRecordingRuleService(db, services.NewEgressService(quotaService, concurrencyService, usageService, egressClients, encodingPresetService), projectService)
+	recordingRuleHandler := handlers.NewRecordingRuleHandler(recordingRuleService)
+	ingressHandler := handlers.NewIngressHandler(quotaService, concurrencyService)
+	recordingHandler := handlers.NewRecordingHandler(recordingService)
+	webhookHandler := handlers.NewWebhookHandler(webhookService, eventBus, concurrencyService, usageService, recordingRuleService, recordingService)
 	usageHandler := handlers.NewUsageHandler(usageService, aggregatorService)
-	billingHandler := handlers.NewBillingHandler(billingService)
+	quotaHandler := handlers.NewQuotaHandler(quotaService, concurrencyService)
+	billingHandler := handlers.NewBillingHandler(billingService, invoiceDocumentService, billingRunService, paymentService)
+	pricingHandler := handlers.NewPricingHandler(pricingService, quotaService)
+	subscriptionHandler := handlers.NewSubscriptionHandler(subscriptionService, pricingService)
+	budgetHandler := handlers.NewBudgetHandler(budgetService)
+	creditHandler := handlers.NewCreditHandler(creditService, paymentService)
 	razorpayHandler := handlers.NewRazorpayHandler(razorpayService)
+	providerEventHandler := handlers.NewProviderEventHandler(providerEventStore)
 	teamHandler := handlers.NewTeamHandler()
 	auditHandler := handlers.NewAuditHandler()
 	statusHandler := handlers.NewStatusHandler()
 	regionHandler := handlers.NewRegionHandler()
-	analyticsHandler := handlers.NewAnalyticsHandler()
+	analyticsHandler := handlers.NewAnalyticsHandler(analyticsService)
 	feedHandler := handlers.NewFeedHandler(feedService)
 	presenceHandler := handlers.NewPresenceHandler(presenceService)
 	moderationHandler := handlers.NewModerationHandler(moderationService)
@@ -77,6 +114,9 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 		})
 	})
 
+	// Operator-only routes (catalog, overrides, internal status) require the operator key
+	operatorAuth := middleware.AuthenticateOperator(cfg.OperatorAPIKey)
+
 	// API routes with /api prefix for Kubernetes ingress routing
 	api := router.Group("/api")
 	{
@@ -104,11 +144,16 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 				projects.PUT("/:id", projectHandler.UpdateProject)
 				projects.DELETE("/:id", projectHandler.DeleteProject)
 				projects.POST("/:id/regenerate-keys", projectHandler.RegenerateAPIKeys)
+
+				// Per-project concurrency limit overrides (set by sales)
+				projects.PUT("/:id/concurrency-limits", operatorAuth, projectHandler.SetConcurrencyOverrides)
+				projects.DELETE("/:id/concurrency-limits", operatorAuth, projectHandler.ClearConcurrencyOverrides)
 			}
 
 			// Token routes (requires API key authentication)
 			tokens := v1.Group("/tokens")
 			tokens.Use(middleware.AuthenticateProject())
+			tokens.Use(middleware.RestrictSuspendedOrganizations())
 			tokens.Use(middleware.ProjectRateLimiter())
 			{
 				tokens.POST("/create", tokenHandler.CreateToken)
@@ -120,6 +165,7 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 			// Media routes (requires API key authentication)
 			media := v1.Group("/media")
 			media.Use(middleware.AuthenticateProject())
+			media.Use(middleware.RestrictSuspendedOrganizations())
 			media.Use(middleware.ProjectRateLimiter())
 			{
 				// Egress routes
@@ -127,10 +173,52 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 				{
 					egress.POST("/start", egressHandler.StartEgress)
 					egress.POST("/stop", egressHandler.StopEgress)
+					egress.POST("/:id/layout", egressHandler.UpdateLayout)
+					egress.POST("/:id/streams", egressHandler.AddStreamURLs)
+					egress.DELETE("/:id/streams", egressHandler.RemoveStreamURLs)
 					egress.GET("/:id", egressHandler.GetEgress)
 					egress.GET("", egressHandler.ListEgresses)
 				}
 
+				// Encoding presets, referenced by name when starting egresses
+				encodingPresets := media.Group("/encoding-presets")
+				{
+					encodingPresets.GET("", encodingPresetHandler.ListPresets)
+					encodingPresets.POST("", encodingPresetHandler.SavePreset)
+					encodingPresets.GET("/:name", encodingPresetHandler.GetPreset)
+					encodingPresets.PUT("/:name", encodingPresetHandler.SavePreset)
+					encodingPresets.DELETE("/:name", encodingPresetHandler.DeletePreset)
+				}
+
+				// Auto-recording rules
+				recordingRules := media.Group("/recording-rules")
+				{
+					recordingRules.GET("", recordingRuleHandler.ListRules)
+					recordingRules.POST("", recordingRuleHandler.CreateRule)
+					recordingRules.GET("/:id", recordingRuleHandler.GetRule)
+					recordingRules.PUT("/:id", recordingRuleHandler.UpdateRule)
+					recordingRules.POST("/:id/enable", recordingRuleHandler.EnableRule)
+					recordingRules.POST("/:id/disable", recordingRuleHandler.DisableRule)
+					recordingRules.DELETE("/:id", recordingRuleHandler.DeleteRule)
+				}
+
+				// Recording library
+				recordings := media.Group("/recordings")
+				{
+					recordings.GET("", recordingHandler.ListRecordings)
+					recordings.GET("/:id", recordingHandler.GetRecording)
+					recordings.PUT("/:id/tags", recordingHandler.SetTags)
+					recordings.DELETE("/:id", recordingHandler.DeleteRecording)
+				}
+
+				// Recording retention policies, enforced by the retention worker
+				retentionPolicies := media.Group("/recording-retention-policies")
+				{
+					retentionPolicies.GET("", recordingHandler.ListPolicies)
+					retentionPolicies.POST("", recordingHandler.CreatePolicy)
+					retentionPolicies.DELETE("/:id", recordingHandler.DeletePolicy)
+				}
+
 				// Ingress routes
 				ingress := media.Group("/ingress")
 				{
@@ -147,8 +235,12 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 				// Internal webhook endpoint (receives webhooks from LiveKit)
 				webhooks.POST("/livekit", webhookHandler.HandleLiveKitWebhook)
 
+				// Stripe payment events (verified by Stripe-Signature)
+				webhooks.POST("/stripe", billingHandler.HandleStripeWebhook)
+
 				// Webhook logs (requires authentication)
 				webhooks.GET("/logs", middleware.AuthenticateProject(), webhookHandler.GetWebhookLogs)
+				webhooks.POST("/preview", middleware.AuthenticateProject(), webhookHandler.PreviewWebhook)
 			}
 
 			// ======= Phase 4: Usage Tracking & Billing =======
@@ -163,6 +255,9 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 				usage.GET("/:project_id/aggregated", usageHandler.GetAggregatedUsage)
 				usage.GET("/:project_id/alerts", usageHandler.GetAlerts)
 				usage.POST("/:project_id/check-limits", usageHandler.CheckLimits)
+				usage.GET("/:project_id/quota", quotaHandler.GetQuota)
+				usage.GET("/:project_id/concurrency", quotaHandler.GetConcurrency)
+				usage.GET("/:project_id/breakdown", usageHandler.GetUsageBreakdown)
 			}
 
 			// Billing routes (requires API key authentication)
@@ -173,10 +268,12 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 				billing.GET("/:project_id/dashboard", billingHandler.GetBillingDashboard)
 				billing.POST("/:project_id/invoice", billingHandler.GenerateInvoice)
 				billing.GET("/invoice/:invoice_id", billingHandler.GetInvoice)
+				billing.GET("/invoice/:invoice_id/pdf", billingHandler.GetInvoicePDF)
 				billing.GET("/:project_id/invoices", billingHandler.ListInvoices)
-				billing.PUT("/invoice/:invoice_id/status", billingHandler.UpdateInvoiceStatus)
+				billing.POST("/invoice/:invoice_id/payment-intent", billingHandler.CreatePaymentIntent)
+				billing.POST("/invoice/:invoice_id/refund", billingHandler.RefundInvoicePayment)
 
-				// Stripe integration (placeholder)
+				// Stripe integration
 				billing.POST("/:project_id/stripe/integrate", billingHandler.IntegrateStripe)
 				billing.POST("/stripe/customer", billingHandler.CreateStripeCustomer)
 				billing.POST("/stripe/payment-method", billingHandler.AttachPaymentMethod)
@@ -193,6 +290,30 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 				billing.GET("/razorpay/subscription/:project_id", razorpayHandler.GetSubscription)
 			}
 
+			// Stored provider webhook events span every organization
+			providerEvents := v1.Group("/billing/provider-events", operatorAuth)
+			{
+				providerEvents.GET("", providerEventHandler.ListEvents)
+				providerEvents.GET("/:event_id", providerEventHandler.GetEvent)
+				providerEvents.POST("/:event_id/reprocess", providerEventHandler.ReprocessEvent)
+			}
+
+			// Pricing plan catalog (versioned; managed by sales)
+			pricingPlans := v1.Group("/pricing-plans")
+			{
+				pricingPlans.POST("", operatorAuth, pricingHandler.CreatePricingPlan)
+				pricingPlans.GET("", pricingHandler.ListPricingPlans)
+				pricingPlans.GET("/:id", pricingHandler.GetPricingPlan)
+				pricingPlans.POST("/:id/versions", operatorAuth, pricingHandler.PublishPricingPlanVersion)
+			}
+
+			// Promo codes redeemable for promotional credit
+			promoCodes := v1.Group("/promo-codes")
+			{
+				promoCodes.POST("", operatorAuth, creditHandler.CreatePromoCode)
+				promoCodes.GET("", operatorAuth, creditHandler.ListPromoCodes)
+			}
+
 			// ======= Phase 5: Admin Dashboard Features =======
 
 			// Team management routes (organization context)
@@ -205,6 +326,61 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 				orgs.PUT("/members/:user_id/role", teamHandler.UpdateTeamMemberRole)
 				orgs.GET("/invitations", teamHandler.ListPendingInvitations)
 				orgs.DELETE("/invitations/:invitation_id", teamHandler.RevokeInvitation)
+
+				// Organization-wide usage and consolidated billing
+				orgs.GET("/usage", usageHandler.GetOrganizationUsage)
+				orgs.GET("/usage/limits", quotaHandler.GetOrganizationQuota)
+				orgs.GET("/billing", billingHandler.GetOrganizationBilling)
+				orgs.GET("/billing/invoices", billingHandler.ListOrganizationInvoices)
+				orgs.GET("/billing/runs", billingHandler.ListBillingRuns)
+				orgs.PUT("/billing/invoices/:invoice_id/status", operatorAuth, billingHandler.SetOrganizationInvoiceStatus)
+				orgs.GET("/payment-settings", billingHandler.GetPaymentSettings)
+
+				// Pricing plan version the organization is billed on
+				orgs.GET("/pricing-plan", pricingHandler.GetOrganizationPricingPlan)
+				orgs.PUT("/pricing-plan", operatorAuth, pricingHandler.AssignOrganizationPricingPlan)
+				orgs.GET("/plan-history", pricingHandler.GetOrganizationPlanHistory)
+
+				// Subscription and billing cycle (changes need admin credentials, below)
+				orgs.GET("/subscription", subscriptionHandler.GetSubscription)
+
+				// Budgets, alerts and spend caps
+				orgs.GET("/budgets", budgetHandler.ListBudgets)
+				orgs.GET("/budgets/alerts", budgetHandler.ListBudgetAlerts)
+				orgs.GET("/budget", budgetHandler.GetBudget)
+				orgs.GET("/projects/:project_id/budget", budgetHandler.GetBudget)
+
+				// Billing address and tax ID used to tax invoices
+				orgs.GET("/tax-profile", organizationHandler.GetTaxProfile)
+
+				// Credit ledger (drawn down by invoices)
+				orgs.GET("/credits", creditHandler.GetCreditBalance)
+				orgs.GET("/credits/ledger", creditHandler.ListCreditLedger)
+
+				// Per-organization limit overrides (set by sales)
+				orgs.GET("/limits", quotaHandler.GetLimitOverrides)
+				orgs.PUT("/limits", operatorAuth, quotaHandler.SetLimitOverrides)
+				orgs.DELETE("/limits", operatorAuth, quotaHandler.ClearLimitOverrides)
+
+				// Routes that change what the organization pays need its project
+				// key and secret
+				orgAdmin := orgs.Group("", middleware.AuthenticateAPISecret(), middleware.RequireOrganizationAdmin())
+				{
+					orgAdmin.POST("/credits/purchase", creditHandler.PurchaseCredits)
+					orgAdmin.POST("/credits/redeem", creditHandler.RedeemPromoCode)
+					orgAdmin.POST("/billing/invoice", billingHandler.GenerateOrganizationInvoice)
+					orgAdmin.PUT("/tax-profile", organizationHandler.UpdateTaxProfile)
+					orgAdmin.PUT("/payment-settings", billingHandler.UpdatePaymentSettings)
+					orgAdmin.PUT("/budget", budgetHandler.SetBudget)
+					orgAdmin.DELETE("/budget", budgetHandler.DeleteBudget)
+					orgAdmin.PUT("/projects/:project_id/budget", budgetHandler.SetBudget)
+					orgAdmin.DELETE("/projects/:project_id/budget", budgetHandler.DeleteBudget)
+					orgAdmin.POST("/subscription/upgrade", subscriptionHandler.Upgrade)
+					orgAdmin.POST("/subscription/downgrade", subscriptionHandler.Downgrade)
+					orgAdmin.POST("/subscription/cancel", subscriptionHandler.Cancel)
+					orgAdmin.POST("/subscription/pause", subscriptionHandler.Pause)
+					orgAdmin.POST("/subscription/resume", subscriptionHandler.Resume)
+				}
 			}
 
 			// Invitation acceptance (public)
@@ -226,6 +402,7 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 			v1.GET("/status", statusHandler.GetSystemStatus)
 			v1.GET("/status/projects/:id", statusHandler.GetProjectHealth)
 			v1.GET("/status/regions", statusHandler.GetRegionAvailability)
+			v1.GET("/status/metering", operatorAuth, usageHandler.GetMeteringStats)
 
 			// ======= Phase 8: Advanced Features =======
 
@@ -243,6 +420,7 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 			// Analytics routes (Phase 8.2: Advanced Analytics)
 			analytics := v1.Group("/analytics")
 			analytics.Use(middleware.AuthenticateProject())
+			analytics.Use(middleware.RestrictSuspendedOrganizations())
 			analytics.Use(middleware.ProjectRateLimiter())
 			{
 				// Custom metrics
@@ -271,6 +449,7 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 			// Activity Feeds routes (Phase 1)
 			feeds := v1.Group("/feeds")
 			feeds.Use(middleware.AuthenticateProject())
+			feeds.Use(middleware.RestrictSuspendedOrganizations())
 			feeds.Use(middleware.ProjectRateLimiter())
 			{
 				// Activity management
@@ -298,6 +477,7 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 			// Presence routes (Phase 2)
 			presence := v1.Group("/presence")
 			presence.Use(middleware.AuthenticateProject())
+			presence.Use(middleware.RestrictSuspendedOrganizations())
 			presence.Use(middleware.ProjectRateLimiter())
 			{
 				// Online/Offline status
@@ -323,6 +503,7 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 			// Moderation routes (Phase 3)
 			moderation := v1.Group("/moderation")
 			moderation.Use(middleware.AuthenticateProject())
+			moderation.Use(middleware.RestrictSuspendedOrganizations())
 			moderation.Use(middleware.ProjectRateLimiter())
 			{
 				// Content analysis
@@ -350,7 +531,7 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 			// Developer tools handlers
 			developerToolsHandler := handlers.NewDeveloperToolsHandler()
 			ssoHandler := handlers.NewSSOHandler()
-			slaHandler := handlers.NewSLAHandler()
+			slaHandler := handlers.NewSLAHandler(creditService)
 			supportHandler := handlers.NewSupportHandler()
 			deploymentHandler := handlers.NewDeploymentHandler()
 
@@ -0,0 +1,75 @@
+package routes
+
+import (
+	"fmt"
+
+	"pulse-control-plane/config"
+	"pulse-control-plane/database"
+	"pulse-control-plane/services"
+)
+
+// Services is the service graph shared by the API routes and the background
+// workers. Built once, so state such as the quota cache is the same wherever
+// it is read or invalidated.
+type Services struct {
+	WebhookService      *services.WebhookService
+	EventBus            *services.EventBus
+	UsageService        *services.UsageService
+	AggregatorService   *services.AggregatorService
+	QuotaService        *services.QuotaService
+	ConcurrencyService  *services.ConcurrencyService
+	PricingService      *services.PricingService
+	CreditService       *services.CreditService
+	BillingService      *services.BillingService
+	ProviderEventStore  *services.ProviderEventStore
+	RazorpayService     *services.RazorpayService
+	PaymentService      *services.PaymentService
+	BillingRunService   *services.BillingRunService
+	SubscriptionService *services.SubscriptionService
+	AnalyticsService    *services.AnalyticsService
+	BudgetService       *services.BudgetService
+	ProjectService      *services.ProjectService
+	RecordingService    *services.RecordingService
+}
+
+// NewServices builds the service graph. meteringPipeline may be nil, in which
+// case usage events are written synchronously.
+func NewServices(cfg *config.Config, meteringPipeline *services.MeteringPipeline) (*Services, error) {
+	db := database.GetDB()
+
+	exchangeRates, err := services.NewExchangeRateSource(cfg.ExchangeRatesFile, cfg.ExchangeRatesURL, cfg.ExchangeRatesTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load exchange rates: %w", err)
+	}
+
+	s := &Services{WebhookService: services.NewWebhookService()}
+	s.EventBus = services.NewEventBus(db, s.WebhookService)
+	s.UsageService = services.NewUsageService(db, s.EventBus, meteringPipeline)
+	s.AggregatorService = services.NewAggregatorService(db)
+	s.QuotaService = services.NewQuotaService(db, s.UsageService)
+	s.ConcurrencyService = services.NewConcurrencyService(db)
+	s.PricingService = services.NewPricingService(db)
+
+	// Credit is granted by API requests and drawn down by the billing worker
+	s.CreditService = services.NewCreditService(db, s.PricingService)
+	taxEngine := services.NewTaxEngine(cfg.TaxSellerCountry, cfg.TaxSellerState)
+	s.BillingService = services.NewBillingService(db, s.UsageService, s.PricingService, s.CreditService, taxEngine, exchangeRates, s.EventBus)
+
+	s.ProviderEventStore = services.NewProviderEventStore(db)
+	s.RazorpayService = services.NewRazorpayService(db, cfg.RazorpayKeyID, cfg.RazorpayKeySecret, cfg.RazorpayWebhookSecret, s.BillingService, s.ProviderEventStore)
+	paymentProviders := []services.PaymentProvider{s.RazorpayService}
+	if cfg.StripeSecretKey != "" {
+		paymentProviders = append(paymentProviders, services.NewStripeService(cfg.StripeSecretKey, cfg.StripeWebhookSecret, cfg.StripeAPIBase))
+	}
+	s.PaymentService = services.NewPaymentService(db, s.BillingService, s.ProviderEventStore, paymentProviders...)
+	s.BillingRunService = services.NewBillingRunService(db, s.BillingService, s.PaymentService, s.EventBus)
+	s.SubscriptionService = services.NewSubscriptionService(db, s.PricingService, s.PaymentService, s.QuotaService)
+
+	s.AnalyticsService = services.NewAnalyticsService(db, s.UsageService, s.EventBus)
+	mailer := services.NewMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPFrom)
+	s.BudgetService = services.NewBudgetService(db, s.UsageService, s.BillingService, s.PricingService, s.AnalyticsService, s.QuotaService, mailer, s.EventBus)
+	s.ProjectService = services.NewProjectService(s.EventBus)
+	s.RecordingService = services.NewRecordingService(db, services.NewObjectStorage(), s.UsageService, s.ProjectService)
+
+	return s, nil
+}
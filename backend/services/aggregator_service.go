@@ -14,7 +14,13 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// AggregatorService handles usage metrics aggregation
+// lateEventSkew is how far the late-event check overlaps the previous one,
+// covering inserts still in flight when it ran. Re-aggregating a period
+// twice is harmless since aggregates are upserted.
+const lateEventSkew = time.Minute
+
+// AggregatorService handles usage metrics aggregation. All periods are
+// aligned to UTC so rollups line up with GetUsageSummary's rollup reads.
 type AggregatorService struct {
 	db *mongo.Database
 }
@@ -24,86 +30,154 @@ func NewAggregatorService(db *mongo.Database) *AggregatorService {
 	return &AggregatorService{db: db}
 }
 
-// AggregateHourlyUsage aggregates usage metrics for the last hour
-func (s *AggregatorService) AggregateHourlyUsage(ctx context.Context) error {
-	log.Info().Msg("Starting hourly usage aggregation")
+// PeriodBounds returns the UTC period of the given type that contains t
+func PeriodBounds(periodType string, t time.Time) (time.Time, time.Time) {
+	t = t.UTC()
+	switch periodType {
+	case models.PeriodMonthly:
+		start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0)
+	case models.PeriodDaily:
+		start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 0, 1)
+	default:
+		start := t.Truncate(time.Hour)
+		return start, start.Add(time.Hour)
+	}
+}
 
-	// Calculate time range (last hour)
-	now := time.Now()
-	periodEnd := now.Truncate(time.Hour)
-	periodStart := periodEnd.Add(-time.Hour)
+// CatchUp re-aggregates periods that received late events, then aggregates
+// every complete period of the given type between the persisted watermark
+// and now, advancing the watermark after each one. On first run it starts
+// with the most recent complete period. It returns the number of periods
+// aggregated, including re-aggregated ones.
+func (s *AggregatorService) CatchUp(ctx context.Context, periodType string, now time.Time) (int, error) {
+	// The current (incomplete) period ends the catch-up
+	currentStart, _ := PeriodBounds(periodType, now)
 
-	// Get all projects
-	projectCollection := s.db.Collection(models.Project{}.TableName())
-	projectCursor, err := projectCollection.Find(ctx, bson.M{"is_deleted": false})
+	watermark, err := s.getWatermark(ctx, periodType)
 	if err != nil {
-		return fmt.Errorf("failed to find projects: %w", err)
+		return 0, err
 	}
-	defer projectCursor.Close(ctx)
 
-	var projects []models.Project
-	if err := projectCursor.All(ctx, &projects); err != nil {
-		return fmt.Errorf("failed to decode projects: %w", err)
+	aggregated, err := s.reaggregateLateEvents(ctx, periodType, watermark, now)
+	if err != nil {
+		return aggregated, err
 	}
 
-	// Aggregate usage for each project
-	for _, project := range projects {
-		if err := s.aggregateForProject(ctx, project.ID, periodStart, periodEnd, models.PeriodHourly); err != nil {
-			log.Error().Err(err).Str("project_id", project.ID.Hex()).Msg("Failed to aggregate usage for project")
-			continue
+	next := watermark.AggregatedUntil
+	if next.IsZero() {
+		next, _ = PeriodBounds(periodType, currentStart.Add(-time.Nanosecond))
+	}
+
+	for next.Before(currentStart) {
+		periodStart, periodEnd := PeriodBounds(periodType, next)
+		if err := s.AggregatePeriod(ctx, periodType, periodStart, periodEnd); err != nil {
+			return aggregated, err
 		}
+		if err := s.setWatermark(ctx, periodType, periodEnd); err != nil {
+			return aggregated, err
+		}
+		aggregated++
+		next = periodEnd
 	}
 
-	log.Info().Msgf("Completed hourly aggregation for %d projects", len(projects))
-	return nil
+	if aggregated > 1 {
+		log.Info().Str("period_type", periodType).Int("periods", aggregated).Msg("Caught up on missed usage aggregation periods")
+	}
+	return aggregated, nil
 }
 
-// AggregateDailyUsage aggregates usage metrics for the last day
-func (s *AggregatorService) AggregateDailyUsage(ctx context.Context) error {
-	log.Info().Msg("Starting daily usage aggregation")
-
-	// Calculate time range (yesterday)
-	now := time.Now()
-	periodEnd := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-	periodStart := periodEnd.Add(-24 * time.Hour)
+// reaggregateLateEvents recomputes the already aggregated periods that
+// received events since the last check, e.g. events that waited in the
+// metering buffer past the aggregation delay. Without this their rollups
+// would undercount and drift from the raw metrics.
+func (s *AggregatorService) reaggregateLateEvents(ctx context.Context, periodType string, watermark models.AggregationWatermark, now time.Time) (int, error) {
+	if watermark.AggregatedUntil.IsZero() {
+		return 0, nil
+	}
 
-	// Get all projects
-	projectCollection := s.db.Collection(models.Project{}.TableName())
-	projectCursor, err := projectCollection.Find(ctx, bson.M{"is_deleted": false})
-	if err != nil {
-		return fmt.Errorf("failed to find projects: %w", err)
+	// Before the first check, anything recorded since the watermark last
+	// moved may have missed its period
+	since := watermark.LateEventsCheckedAt
+	if since.IsZero() {
+		since = watermark.UpdatedAt
 	}
-	defer projectCursor.Close(ctx)
+	since = since.Add(-lateEventSkew)
 
-	var projects []models.Project
-	if err := projectCursor.All(ctx, &projects); err != nil {
-		return fmt.Errorf("failed to decode projects: %w", err)
+	periods, err := s.latePeriods(ctx, periodType, since, watermark.AggregatedUntil)
+	if err != nil {
+		return 0, err
 	}
 
-	// Aggregate usage for each project
-	for _, project := range projects {
-		if err := s.aggregateForProject(ctx, project.ID, periodStart, periodEnd, models.PeriodDaily); err != nil {
-			log.Error().Err(err).Str("project_id", project.ID.Hex()).Msg("Failed to aggregate usage for project")
-			continue
+	for _, periodStart := range periods {
+		_, periodEnd := PeriodBounds(periodType, periodStart)
+		if err := s.AggregatePeriod(ctx, periodType, periodStart, periodEnd); err != nil {
+			return 0, err
 		}
 	}
+	if len(periods) > 0 {
+		log.Info().Str("period_type", periodType).Int("periods", len(periods)).Msg("Re-aggregated usage periods with late events")
+	}
 
-	log.Info().Msgf("Completed daily aggregation for %d projects", len(projects))
-	return nil
+	// Only advance the check once every late period is re-aggregated, so a
+	// failure retries them on the next run
+	if err := s.setLateEventsCheckedAt(ctx, periodType, now); err != nil {
+		return len(periods), err
+	}
+	return len(periods), nil
 }
 
-// AggregateMonthlyUsage aggregates usage metrics for the last month
-func (s *AggregatorService) AggregateMonthlyUsage(ctx context.Context) error {
-	log.Info().Msg("Starting monthly usage aggregation")
+// latePeriods returns the starts of the periods before until that contain
+// events recorded since the given time, oldest first
+func (s *AggregatorService) latePeriods(ctx context.Context, periodType string, since, until time.Time) ([]time.Time, error) {
+	usageCollection := s.db.Collection(models.UsageMetric{}.TableName())
 
-	// Calculate time range (last month)
-	now := time.Now()
-	periodEnd := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
-	periodStart := periodEnd.AddDate(0, -1, 0)
+	// Late events are few, so group them by hour in Mongo and map the hours
+	// onto periods here; months have no fixed length to group by
+	hourMillis := time.Hour.Milliseconds()
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"recorded_at": bson.M{"$gte": since},
+			"timestamp":   bson.M{"$lt": until},
+		}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{{Key: "$subtract", Value: bson.A{
+				"$timestamp",
+				bson.D{{Key: "$mod", Value: bson.A{bson.D{{Key: "$toLong", Value: "$timestamp"}}, hourMillis}}},
+			}}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+	}
 
-	// Get all projects
+	cursor, err := usageCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find late usage events: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var hours []struct {
+		Hour time.Time `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &hours); err != nil {
+		return nil, fmt.Errorf("failed to decode late usage events: %w", err)
+	}
+
+	var periods []time.Time
+	for _, hour := range hours {
+		periodStart, _ := PeriodBounds(periodType, hour.Hour)
+		if n := len(periods); n == 0 || !periods[n-1].Equal(periodStart) {
+			periods = append(periods, periodStart)
+		}
+	}
+	return periods, nil
+}
+
+// AggregatePeriod aggregates one period for all projects. Aggregates are
+// upserted by (project, period type, period start) so re-runs are idempotent.
+func (s *AggregatorService) AggregatePeriod(ctx context.Context, periodType string, periodStart, periodEnd time.Time) error {
 	projectCollection := s.db.Collection(models.Project{}.TableName())
-	projectCursor, err := projectCollection.Find(ctx, bson.M{"is_deleted": false})
+	projectCursor, err := projectCollection.Find(ctx, bson.M{"is_deleted": false}, options.Find().SetProjection(bson.M{"_id": 1}))
 	if err != nil {
 		return fmt.Errorf("failed to find projects: %w", err)
 	}
@@ -114,187 +188,236 @@ func (s *AggregatorService) AggregateMonthlyUsage(ctx context.Context) error {
 		return fmt.Errorf("failed to decode projects: %w", err)
 	}
 
-	// Aggregate usage for each project
+	usage, err := s.sumPeriodUsage(ctx, periodStart, periodEnd)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	writes := make([]mongo.WriteModel, 0, len(usage))
 	for _, project := range projects {
-		if err := s.aggregateForProject(ctx, project.ID, periodStart, periodEnd, models.PeriodMonthly); err != nil {
-			log.Error().Err(err).Str("project_id", project.ID.Hex()).Msg("Failed to aggregate usage for project")
+		// Projects without usage get no rollup; summaries scan the (empty)
+		// raw range instead
+		agg := usage[project.ID]
+		if agg == nil {
 			continue
 		}
+
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{
+				"project_id":   project.ID,
+				"period_type":  periodType,
+				"period_start": periodStart,
+			}).
+			SetUpdate(bson.M{
+				"$set": bson.M{
+					"period_end":          periodEnd,
+					"participant_minutes": agg.ParticipantMinutes,
+					"egress_minutes":      agg.EgressMinutes,
+					"storage_gb":          agg.StorageGB,
+					"bandwidth_gb":        agg.BandwidthGB,
+					"api_requests":        agg.APIRequests,
+					"total_cost":          0.0, // Calculated by billing service
+					"updated_at":          now,
+				},
+				"$setOnInsert": bson.M{
+					"created_at": now,
+				},
+			}).
+			SetUpsert(true))
+	}
+
+	if len(writes) > 0 {
+		aggregateCollection := s.db.Collection(models.UsageAggregate{}.TableName())
+		if _, err := aggregateCollection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+			return fmt.Errorf("failed to upsert aggregates: %w", err)
+		}
 	}
 
-	log.Info().Msgf("Completed monthly aggregation for %d projects", len(projects))
+	// Room, participant and tag breakdowns are rolled up per day
+	if periodType == models.PeriodDaily {
+		if err := s.aggregateDimensions(ctx, periodStart, periodEnd); err != nil {
+			return err
+		}
+	}
+
+	log.Info().
+		Str("period_type", periodType).
+		Time("period_start", periodStart).
+		Int("projects", len(writes)).
+		Msg("Usage aggregated successfully")
 	return nil
 }
 
-// aggregateForProject aggregates usage for a single project
-func (s *AggregatorService) aggregateForProject(ctx context.Context, projectID primitive.ObjectID, periodStart, periodEnd time.Time, periodType string) error {
+// sumPeriodUsage groups raw metrics in a period by project and event type
+func (s *AggregatorService) sumPeriodUsage(ctx context.Context, periodStart, periodEnd time.Time) (map[primitive.ObjectID]*models.UsageAggregate, error) {
 	usageCollection := s.db.Collection(models.UsageMetric{}.TableName())
-	aggregateCollection := s.db.Collection(models.UsageAggregate{}.TableName())
-
-	// Check if aggregate already exists
-	existingFilter := bson.M{
-		"project_id":   projectID,
-		"period_type":  periodType,
-		"period_start": periodStart,
-	}
-
-	var existing models.UsageAggregate
-	err := aggregateCollection.FindOne(ctx, existingFilter).Decode(&existing)
-	if err == nil {
-		// Already aggregated
-		log.Debug().Str("project_id", projectID.Hex()).Str("period_type", periodType).Msg("Usage already aggregated")
-		return nil
-	}
 
-	// Aggregate participant minutes
-	participantFilter := bson.M{
-		"project_id": projectID,
-		"event_type": models.EventParticipantLeft,
-		"timestamp": bson.M{
-			"$gte": periodStart,
-			"$lt":  periodEnd,
-		},
-	}
-	participantPipeline := mongo.Pipeline{
-		{{Key: "$match", Value: participantFilter}},
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"timestamp": bson.M{
+				"$gte": periodStart,
+				"$lt":  periodEnd,
+			},
+		}}},
 		{{Key: "$group", Value: bson.D{
-			{Key: "_id", Value: nil},
+			{Key: "_id", Value: bson.D{
+				{Key: "project_id", Value: "$project_id"},
+				{Key: "event_type", Value: "$event_type"},
+			}},
 			{Key: "total", Value: bson.D{{Key: "$sum", Value: "$value"}}},
+			{Key: "average", Value: bson.D{{Key: "$avg", Value: "$value"}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
 		}}},
 	}
-	var participantMinutes float64
-	participantCursor, err := usageCollection.Aggregate(ctx, participantPipeline)
-	if err == nil {
-		defer participantCursor.Close(ctx)
-		var results []bson.M
-		if err := participantCursor.All(ctx, &results); err == nil && len(results) > 0 {
-			if total, ok := results[0]["total"].(float64); ok {
-				participantMinutes = total
-			}
-		}
+
+	cursor, err := usageCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate usage: %w", err)
 	}
+	defer cursor.Close(ctx)
 
-	// Aggregate egress minutes
-	egressFilter := bson.M{
-		"project_id": projectID,
-		"event_type": models.EventEgressEnded,
-		"timestamp": bson.M{
-			"$gte": periodStart,
-			"$lt":  periodEnd,
-		},
+	var rows []struct {
+		ID struct {
+			ProjectID primitive.ObjectID `bson:"project_id"`
+			EventType string             `bson:"event_type"`
+		} `bson:"_id"`
+		Total   float64 `bson:"total"`
+		Average float64 `bson:"average"`
+		Count   int64   `bson:"count"`
 	}
-	egressPipeline := mongo.Pipeline{
-		{{Key: "$match", Value: egressFilter}},
-		{{Key: "$group", Value: bson.D{
-			{Key: "_id", Value: nil},
-			{Key: "total", Value: bson.D{{Key: "$sum", Value: "$value"}}},
-		}}},
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("failed to decode usage: %w", err)
 	}
-	var egressMinutes float64
-	egressCursor, err := usageCollection.Aggregate(ctx, egressPipeline)
-	if err == nil {
-		defer egressCursor.Close(ctx)
-		var results []bson.M
-		if err := egressCursor.All(ctx, &results); err == nil && len(results) > 0 {
-			if total, ok := results[0]["total"].(float64); ok {
-				egressMinutes = total
-			}
+
+	usage := make(map[primitive.ObjectID]*models.UsageAggregate)
+	for _, row := range rows {
+		agg, ok := usage[row.ID.ProjectID]
+		if !ok {
+			agg = &models.UsageAggregate{}
+			usage[row.ID.ProjectID] = agg
 		}
-	}
 
-	// Aggregate storage (average for period)
-	storageFilter := bson.M{
-		"project_id": projectID,
-		"event_type": models.EventStorageUsed,
-		"timestamp": bson.M{
-			"$gte": periodStart,
-			"$lt":  periodEnd,
-		},
+		switch row.ID.EventType {
+		case models.EventParticipantLeft:
+			agg.ParticipantMinutes = row.Total
+		case models.EventEgressEnded:
+			agg.EgressMinutes = row.Total
+		case models.EventStorageUsed:
+			// Storage is a level, not a flow: average it over the period
+			agg.StorageGB = row.Average
+		case models.EventBandwidthUsed:
+			agg.BandwidthGB = row.Total
+		case models.EventAPIRequest:
+			agg.APIRequests = row.Count
+		}
 	}
-	storagePipeline := mongo.Pipeline{
-		{{Key: "$match", Value: storageFilter}},
-		{{Key: "$group", Value: bson.D{
-			{Key: "_id", Value: nil},
-			{Key: "average", Value: bson.D{{Key: "$avg", Value: "$value"}}},
-		}}},
+
+	return usage, nil
+}
+
+// aggregateDimensions upserts one usage_dimension_aggregates document per
+// project, day and room, participant or tag value
+func (s *AggregatorService) aggregateDimensions(ctx context.Context, periodStart, periodEnd time.Time) error {
+	usageCollection := s.db.Collection(models.UsageMetric{}.TableName())
+	match := bson.M{
+		"timestamp":  bson.M{"$gte": periodStart, "$lt": periodEnd},
+		"event_type": bson.M{"$in": dimensionEventTypes},
 	}
-	var storageGB float64
-	storageCursor, err := usageCollection.Aggregate(ctx, storagePipeline)
-	if err == nil {
-		defer storageCursor.Close(ctx)
-		var results []bson.M
-		if err := storageCursor.All(ctx, &results); err == nil && len(results) > 0 {
-			if avg, ok := results[0]["average"].(float64); ok {
-				storageGB = avg
-			}
+
+	now := time.Now()
+	var writes []mongo.WriteModel
+	for _, dimension := range []string{models.DimensionRoom, models.DimensionParticipant, models.DimensionTagPrefix} {
+		cursor, err := usageCollection.Aggregate(ctx, dimensionUsagePipeline(match, dimension))
+		if err != nil {
+			return fmt.Errorf("failed to aggregate %s usage: %w", dimension, err)
 		}
-	}
 
-	// Aggregate bandwidth
-	bandwidthFilter := bson.M{
-		"project_id": projectID,
-		"event_type": models.EventBandwidthUsed,
-		"timestamp": bson.M{
-			"$gte": periodStart,
-			"$lt":  periodEnd,
-		},
+		var rows []dimensionUsageRow
+		err = cursor.All(ctx, &rows)
+		cursor.Close(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to decode %s usage: %w", dimension, err)
+		}
+
+		for _, row := range rows {
+			writes = append(writes, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{
+					"project_id":   row.ID.ProjectID,
+					"period_start": periodStart,
+					"dimension":    row.ID.Dimension,
+					"key":          row.ID.Key,
+				}).
+				SetUpdate(bson.M{"$set": bson.M{
+					"participant_minutes": row.ParticipantMinutes,
+					"egress_minutes":      row.EgressMinutes,
+					"bandwidth_gb":        row.BandwidthGB,
+					"sessions":            row.Sessions,
+					"updated_at":          now,
+				}}).
+				SetUpsert(true))
+		}
 	}
-	bandwidthPipeline := mongo.Pipeline{
-		{{Key: "$match", Value: bandwidthFilter}},
-		{{Key: "$group", Value: bson.D{
-			{Key: "_id", Value: nil},
-			{Key: "total", Value: bson.D{{Key: "$sum", Value: "$value"}}},
-		}}},
+
+	if len(writes) == 0 {
+		return nil
 	}
-	var bandwidthGB float64
-	bandwidthCursor, err := usageCollection.Aggregate(ctx, bandwidthPipeline)
-	if err == nil {
-		defer bandwidthCursor.Close(ctx)
-		var results []bson.M
-		if err := bandwidthCursor.All(ctx, &results); err == nil && len(results) > 0 {
-			if total, ok := results[0]["total"].(float64); ok {
-				bandwidthGB = total
-			}
-		}
+
+	dimensionCollection := s.db.Collection(models.UsageDimensionAggregate{}.TableName())
+	if _, err := dimensionCollection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+		return fmt.Errorf("failed to upsert dimension aggregates: %w", err)
 	}
+	return nil
+}
 
-	// Count API requests
-	apiFilter := bson.M{
-		"project_id": projectID,
-		"event_type": models.EventAPIRequest,
-		"timestamp": bson.M{
-			"$gte": periodStart,
-			"$lt":  periodEnd,
-		},
+// getWatermark returns the aggregation progress for a period type. Its
+// AggregatedUntil is zero if nothing has been aggregated yet.
+func (s *AggregatorService) getWatermark(ctx context.Context, periodType string) (models.AggregationWatermark, error) {
+	collection := s.db.Collection(models.AggregationWatermark{}.TableName())
+
+	var watermark models.AggregationWatermark
+	err := collection.FindOne(ctx, bson.M{"_id": periodType}).Decode(&watermark)
+	if err == mongo.ErrNoDocuments {
+		return models.AggregationWatermark{PeriodType: periodType}, nil
 	}
-	apiRequests, _ := usageCollection.CountDocuments(ctx, apiFilter)
-
-	// Calculate cost (will be done by billing service)
-	totalCost := 0.0
-
-	// Create aggregate record
-	aggregate := models.UsageAggregate{
-		ProjectID:          projectID,
-		PeriodType:         periodType,
-		PeriodStart:        periodStart,
-		PeriodEnd:          periodEnd,
-		ParticipantMinutes: participantMinutes,
-		EgressMinutes:      egressMinutes,
-		StorageGB:          storageGB,
-		BandwidthGB:        bandwidthGB,
-		APIRequests:        apiRequests,
-		TotalCost:          totalCost,
-		CreatedAt:          time.Now(),
-		UpdatedAt:          time.Now(),
-	}
-
-	// Insert aggregate
-	_, err = aggregateCollection.InsertOne(ctx, aggregate)
 	if err != nil {
-		return fmt.Errorf("failed to insert aggregate: %w", err)
+		return watermark, fmt.Errorf("failed to get aggregation watermark: %w", err)
+	}
+
+	watermark.AggregatedUntil = watermark.AggregatedUntil.UTC()
+	return watermark, nil
+}
+
+// setWatermark records that all periods ending at or before until are aggregated
+func (s *AggregatorService) setWatermark(ctx context.Context, periodType string, until time.Time) error {
+	collection := s.db.Collection(models.AggregationWatermark{}.TableName())
+
+	_, err := collection.UpdateOne(ctx,
+		bson.M{"_id": periodType},
+		bson.M{"$set": bson.M{
+			"aggregated_until": until,
+			"updated_at":       time.Now(),
+		}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set aggregation watermark: %w", err)
 	}
+	return nil
+}
 
-	log.Info().Str("project_id", projectID.Hex()).Str("period_type", periodType).Msg("Usage aggregated successfully")
+// setLateEventsCheckedAt records that late events recorded before checkedAt
+// have been re-aggregated
+func (s *AggregatorService) setLateEventsCheckedAt(ctx context.Context, periodType string, checkedAt time.Time) error {
+	collection := s.db.Collection(models.AggregationWatermark{}.TableName())
+
+	_, err := collection.UpdateOne(ctx,
+		bson.M{"_id": periodType},
+		bson.M{"$set": bson.M{"late_events_checked_at": checkedAt}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set late event check time: %w", err)
+	}
 	return nil
 }
 
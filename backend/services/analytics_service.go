@@ -23,12 +23,14 @@ import (
 type AnalyticsService struct {
 	db           *mongo.Database
 	usageService *UsageService
+	eventBus     *EventBus
 }
 
-func NewAnalyticsService(db *mongo.Database, usageService *UsageService) *AnalyticsService {
+func NewAnalyticsService(db *mongo.Database, usageService *UsageService, eventBus *EventBus) *AnalyticsService {
 	return &AnalyticsService{
 		db:           db,
 		usageService: usageService,
+		eventBus:     eventBus,
 	}
 }
 
@@ -172,6 +174,18 @@ func (s *AnalyticsService) CheckAlerts(ctx context.Context, projectID primitive.
 				continue
 			}
 
+			s.eventBus.PublishAsync(projectID, &models.WebhookPayload{
+				Event: models.WebhookEventAlertTriggered,
+				Alert: &models.AlertInfo{
+					AlertID:     alert.ID.Hex(),
+					TriggerID:   trigger.ID.Hex(),
+					MetricValue: trigger.MetricValue,
+					Threshold:   trigger.Threshold,
+					Severity:    trigger.Severity,
+					Message:     trigger.Message,
+				},
+			})
+
 			// Update alert last triggered time
 			alertCollection := s.db.Collection(models.MetricAlert{}.TableName())
 			now := time.Now()
@@ -0,0 +1,49 @@
+package services
+
+import "time"
+
+// BillingCycle returns the UTC billing cycle containing t for an organization
+// billed on billingDay. Cycles run from the billing day of one month to the
+// billing day of the next; in months too short for the day, the cycle starts
+// on the last day of the month instead. Days outside 1-31 mean the 1st.
+func BillingCycle(billingDay int, t time.Time) (time.Time, time.Time) {
+	if billingDay < 1 || billingDay > 31 {
+		billingDay = 1
+	}
+
+	t = t.UTC()
+	start := cycleStart(t.Year(), t.Month(), billingDay)
+	if t.Before(start) {
+		start = cycleStart(t.Year(), t.Month()-1, billingDay)
+	}
+	end := cycleStart(start.Year(), start.Month()+1, billingDay)
+
+	return start, end
+}
+
+// cycleStart returns the billing day in a month, clamped to the month's
+// length. month may be out of range and is normalized like time.Date.
+func cycleStart(year int, month time.Month, billingDay int) time.Time {
+	lastDay := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if billingDay > lastDay {
+		billingDay = lastDay
+	}
+	return time.Date(year, month, billingDay, 0, 0, 0, 0, time.UTC)
+}
+
+// CycleProration returns how many billing cycles [periodStart, periodEnd)
+// covers, measuring each part against the length of its own cycle. A full
+// February counts the same as a full March.
+func CycleProration(billingDay int, periodStart, periodEnd time.Time) float64 {
+	proration := 0.0
+	for cursor := periodStart.UTC(); cursor.Before(periodEnd); {
+		cycleStart, cycleEnd := BillingCycle(billingDay, cursor)
+		partEnd := cycleEnd
+		if periodEnd.Before(partEnd) {
+			partEnd = periodEnd
+		}
+		proration += partEnd.Sub(cursor).Seconds() / cycleEnd.Sub(cycleStart).Seconds()
+		cursor = partEnd
+	}
+	return proration
+}
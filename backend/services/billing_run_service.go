@@ -0,0 +1,371 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"pulse-control-plane/models"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// staleBillingRunClaim is how long an invoicing claim is honoured before
+// another run may take it over, e.g. after a crash mid-run
+const staleBillingRunClaim = time.Hour
+
+// BillingRunService closes organizations' billing cycles: it invoices each
+// closed cycle once, collects payment through the organization's payment
+// provider and chases unpaid invoices through the dunning schedule,
+// suspending organizations that do not pay
+type BillingRunService struct {
+	db             *mongo.Database
+	billingService *BillingService
+	paymentService *PaymentService
+	eventBus       *EventBus
+}
+
+// BillingRunSummary counts what one billing run did
+type BillingRunSummary struct {
+	Invoiced  int `json:"invoiced"`
+	Failed    int `json:"failed"`
+	Reminded  int `json:"reminded"`
+	Suspended int `json:"suspended"`
+}
+
+// NewBillingRunService creates a new billing run service. paymentService may
+// be nil, in which case invoices are issued without collecting payment.
+func NewBillingRunService(db *mongo.Database, billingService *BillingService, paymentService *PaymentService, eventBus *EventBus) *BillingRunService {
+	return &BillingRunService{
+		db:             db,
+		billingService: billingService,
+		paymentService: paymentService,
+		eventBus:       eventBus,
+	}
+}
+
+// Run invoices every organization whose billing cycle has closed by now and
+// advances dunning on overdue invoices. It is safe to run repeatedly.
+func (s *BillingRunService) Run(ctx context.Context, now time.Time) (*BillingRunSummary, error) {
+	summary := &BillingRunSummary{}
+
+	cursor, err := s.db.Collection(models.Organization{}.TableName()).Find(ctx, bson.M{"is_deleted": false})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organizations: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var org models.Organization
+		if err := cursor.Decode(&org); err != nil {
+			return nil, fmt.Errorf("failed to decode organization: %w", err)
+		}
+
+		invoiced, err := s.closeCycle(ctx, &org, now)
+		if err != nil {
+			summary.Failed++
+			log.Error().Err(err).Str("org_id", org.ID.Hex()).Msg("Failed to invoice billing cycle")
+			continue
+		}
+		if invoiced {
+			summary.Invoiced++
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate organizations: %w", err)
+	}
+
+	if err := s.runDunning(ctx, now, summary); err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+// LastClosedCycle returns the organization's most recent billing cycle that
+// ended by now, starting no earlier than the organization itself. ok is false
+// if the organization did not exist before the cycle ended.
+func LastClosedCycle(org *models.Organization, now time.Time) (time.Time, time.Time, bool) {
+	currentStart, _ := BillingCycle(org.BillingDay, now)
+	start, end := BillingCycle(org.BillingDay, currentStart.Add(-time.Nanosecond))
+	if !org.CreatedAt.IsZero() && org.CreatedAt.After(start) {
+		start = org.CreatedAt.UTC()
+	}
+	return start, end, start.Before(end)
+}
+
+// closeCycle invoices the organization's last closed cycle unless a run for
+// it already exists. It reports whether an invoice was issued.
+func (s *BillingRunService) closeCycle(ctx context.Context, org *models.Organization, now time.Time) (bool, error) {
+	periodStart, periodEnd, ok := LastClosedCycle(org, now)
+	if !ok {
+		return false, nil
+	}
+
+	run, err := s.claim(ctx, org.ID, periodStart, periodEnd, now)
+	if err != nil || run == nil {
+		return false, err
+	}
+
+	// Reuses the invoice a previous attempt created before it could record it
+	invoice, err := s.billingService.GenerateOrgInvoice(ctx, run.OrgID, run.PeriodStart, run.PeriodEnd)
+	if err != nil {
+		s.fail(ctx, run, err)
+		return false, err
+	}
+
+	update := bson.M{
+		"invoice_id": invoice.ID,
+		"due_at":     invoice.DueDate,
+		"updated_at": time.Now(),
+	}
+	if invoice.Total <= 0 {
+		// Fully covered by credit: nothing to collect
+		if err := s.billingService.UpdateInvoiceStatus(ctx, invoice.ID, models.InvoiceStatusPaid); err != nil {
+			s.fail(ctx, run, err)
+			return false, err
+		}
+		update["status"] = models.BillingRunStatusPaid
+		update["paid_at"] = time.Now()
+	} else {
+		if err := s.billingService.UpdateInvoiceStatus(ctx, invoice.ID, models.InvoiceStatusIssued); err != nil {
+			s.fail(ctx, run, err)
+			return false, err
+		}
+		update["status"] = models.BillingRunStatusUnpaid
+		for key, value := range s.collectPayment(ctx, org, invoice) {
+			update[key] = value
+		}
+	}
+
+	_, err = s.db.Collection(models.BillingRun{}.TableName()).UpdateOne(ctx, bson.M{"_id": run.ID}, bson.M{"$set": update})
+	if err != nil {
+		return false, fmt.Errorf("failed to update billing run: %w", err)
+	}
+
+	log.Info().
+		Str("org_id", org.ID.Hex()).
+		Str("invoice_number", invoice.InvoiceNumber).
+		Time("period_start", periodStart).
+		Msg("Billing cycle invoiced")
+	return true, nil
+}
+
+// claim records a billing run for the period, or takes over one that failed
+// or was abandoned mid-run. It returns nil if the period is already handled.
+func (s *BillingRunService) claim(ctx context.Context, orgID primitive.ObjectID, periodStart, periodEnd, now time.Time) (*models.BillingRun, error) {
+	collection := s.db.Collection(models.BillingRun{}.TableName())
+
+	run := &models.BillingRun{
+		ID:          primitive.NewObjectID(),
+		OrgID:       orgID,
+		PeriodStart: periodStart,
+		PeriodEnd:   periodEnd,
+		Status:      models.BillingRunStatusInvoicing,
+		Attempts:    1,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	_, err := collection.InsertOne(ctx, run)
+	if err == nil {
+		return run, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, fmt.Errorf("failed to record billing run: %w", err)
+	}
+
+	var existing models.BillingRun
+	err = collection.FindOneAndUpdate(ctx,
+		bson.M{
+			"org_id":       orgID,
+			"period_start": periodStart,
+			"$or": bson.A{
+				bson.M{"status": models.BillingRunStatusFailed},
+				bson.M{"status": models.BillingRunStatusInvoicing, "updated_at": bson.M{"$lt": now.Add(-staleBillingRunClaim)}},
+			},
+		},
+		bson.M{
+			"$set": bson.M{"status": models.BillingRunStatusInvoicing, "updated_at": now},
+			"$inc": bson.M{"attempts": 1},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&existing)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim billing run: %w", err)
+	}
+	return &existing, nil
+}
+
+// fail marks a run for retry on the next billing run
+func (s *BillingRunService) fail(ctx context.Context, run *models.BillingRun, cause error) {
+	_, err := s.db.Collection(models.BillingRun{}.TableName()).UpdateOne(ctx,
+		bson.M{"_id": run.ID},
+		bson.M{"$set": bson.M{
+			"status":     models.BillingRunStatusFailed,
+			"error":      cause.Error(),
+			"updated_at": time.Now(),
+		}},
+	)
+	if err != nil {
+		log.Error().Err(err).Str("run_id", run.ID.Hex()).Msg("Failed to mark billing run failed")
+	}
+}
+
+// collectPayment charges the organization's active Razorpay subscription or,
+// failing that, pushes the invoice to its payment provider: a payment link on
+// Razorpay, an auto-charged invoice on Stripe. It returns the run fields to
+// record; failures are recorded rather than returned since dunning follows up.
+func (s *BillingRunService) collectPayment(ctx context.Context, org *models.Organization, invoice *models.Invoice) bson.M {
+	if s.paymentService == nil {
+		return bson.M{}
+	}
+
+	provider, err := s.paymentService.ProviderFor(org)
+	if err != nil {
+		log.Error().Err(err).Str("org_id", org.ID.Hex()).Msg("No payment provider for organization")
+		return bson.M{"payment_error": err.Error()}
+	}
+
+	if razorpay, ok := provider.(*RazorpayService); ok {
+		if subscription, err := razorpay.GetActiveSubscriptionByOrgID(ctx, org.ID); err == nil {
+			if err := razorpay.ChargeSubscription(ctx, subscription, invoice); err != nil {
+				log.Warn().Err(err).Str("org_id", org.ID.Hex()).Msg("Failed to charge subscription, sending payment link")
+			} else {
+				return bson.M{
+					"payment_method":  models.BillingPaymentSubscription,
+					"subscription_id": subscription.SubscriptionID,
+				}
+			}
+		}
+	}
+
+	pushed, err := s.paymentService.PushInvoice(ctx, invoice.ID, provider.Name())
+	if err != nil {
+		log.Error().Err(err).Str("org_id", org.ID.Hex()).Msg("Failed to push invoice to payment provider")
+		return bson.M{"payment_error": err.Error()}
+	}
+	return bson.M{
+		"payment_method": models.BillingPaymentLink,
+		"payment_link":   pushed.URL,
+	}
+}
+
+// runDunning sends the reminders due on unpaid invoices and suspends
+// organizations that reach the end of the dunning schedule
+func (s *BillingRunService) runDunning(ctx context.Context, now time.Time, summary *BillingRunSummary) error {
+	collection := s.db.Collection(models.BillingRun{}.TableName())
+
+	cursor, err := collection.Find(ctx, bson.M{
+		"status": models.BillingRunStatusUnpaid,
+		"due_at": bson.M{"$lt": now},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list unpaid billing runs: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var runs []models.BillingRun
+	if err := cursor.All(ctx, &runs); err != nil {
+		return fmt.Errorf("failed to decode billing runs: %w", err)
+	}
+
+	for i := range runs {
+		run := &runs[i]
+		stage := models.DunningStageDue(int(now.Sub(run.DueAt).Hours() / 24))
+		if stage <= run.DunningStage {
+			continue
+		}
+
+		// Advance the stage conditionally so concurrent runs remind once
+		result, err := collection.UpdateOne(ctx,
+			bson.M{"_id": run.ID, "status": models.BillingRunStatusUnpaid, "dunning_stage": run.DunningStage},
+			bson.M{"$set": bson.M{"dunning_stage": stage, "last_reminder_at": now, "updated_at": now}},
+		)
+		if err != nil {
+			log.Error().Err(err).Str("run_id", run.ID.Hex()).Msg("Failed to advance dunning")
+			continue
+		}
+		if result.ModifiedCount == 0 {
+			continue
+		}
+		run.DunningStage = stage
+
+		invoice, err := s.billingService.GetInvoice(ctx, *run.InvoiceID)
+		if err != nil {
+			log.Error().Err(err).Str("run_id", run.ID.Hex()).Msg("Failed to load overdue invoice")
+			continue
+		}
+
+		info := invoiceInfo(invoice)
+		info.DunningStage = stage
+		s.eventBus.PublishToOrg(ctx, run.OrgID, &models.WebhookPayload{
+			Event:   models.WebhookEventInvoicePaymentReminder,
+			Invoice: info,
+		})
+		summary.Reminded++
+
+		status := models.OrgBillingStatusPastDue
+		if stage >= len(models.DunningSchedule) {
+			status = models.OrgBillingStatusSuspended
+		}
+		suspended, err := s.setOrgBillingStatus(ctx, run.OrgID, status, now)
+		if err != nil {
+			log.Error().Err(err).Str("org_id", run.OrgID.Hex()).Msg("Failed to update organization billing status")
+			continue
+		}
+		if suspended {
+			summary.Suspended++
+			s.eventBus.PublishToOrg(ctx, run.OrgID, &models.WebhookPayload{
+				Event:   models.WebhookEventOrganizationSuspended,
+				Invoice: info,
+			})
+			log.Warn().Str("org_id", run.OrgID.Hex()).Str("invoice_number", invoice.InvoiceNumber).Msg("Organization suspended for non-payment")
+		}
+	}
+
+	return nil
+}
+
+// setOrgBillingStatus moves an organization to past_due or suspended, never
+// back from suspended. It reports whether the organization was just
+// suspended.
+func (s *BillingRunService) setOrgBillingStatus(ctx context.Context, orgID primitive.ObjectID, status string, now time.Time) (bool, error) {
+	set := bson.M{"billing_status": status, "updated_at": now}
+	if status == models.OrgBillingStatusSuspended {
+		set["suspended_at"] = now
+	}
+
+	result, err := s.db.Collection(models.Organization{}.TableName()).UpdateOne(ctx,
+		bson.M{"_id": orgID, "billing_status": bson.M{"$nin": bson.A{status, models.OrgBillingStatusSuspended}}},
+		bson.M{"$set": set},
+	)
+	if err != nil {
+		return false, err
+	}
+	return status == models.OrgBillingStatusSuspended && result.ModifiedCount > 0, nil
+}
+
+// ListRuns lists an organization's billing runs, newest period first
+func (s *BillingRunService) ListRuns(ctx context.Context, orgID primitive.ObjectID) ([]models.BillingRun, error) {
+	cursor, err := s.db.Collection(models.BillingRun{}.TableName()).Find(ctx,
+		bson.M{"org_id": orgID},
+		options.Find().SetSort(bson.D{{Key: "period_start", Value: -1}}).SetLimit(36),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list billing runs: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	runs := []models.BillingRun{}
+	if err := cursor.All(ctx, &runs); err != nil {
+		return nil, fmt.Errorf("failed to decode billing runs: %w", err)
+	}
+	return runs, nil
+}
@@ -2,75 +2,217 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"pulse-control-plane/models"
 
+	"github.com/rs/zerolog/log"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrInvalidInvoiceStatus is returned when an invoice is moved to a status it
+// cannot be set to by hand
+var ErrInvalidInvoiceStatus = errors.New("invalid invoice status")
+
 // BillingService handles billing operations
 type BillingService struct {
-	db           *mongo.Database
-	usageService *UsageService
+	db             *mongo.Database
+	usageService   *UsageService
+	pricingService *PricingService
+	creditService  *CreditService
+	taxEngine      *TaxEngine
+	exchangeRates  ExchangeRateSource
+	eventBus       *EventBus
 }
 
-// NewBillingService creates a new billing service
-func NewBillingService(db *mongo.Database, usageService *UsageService) *BillingService {
+// NewBillingService creates a new billing service. creditService may be nil,
+// in which case invoices are not drawn down against credit, taxEngine may be
+// nil, in which case invoices are not taxed, and exchangeRates may be nil, in
+// which case organizations can only be invoiced in currencies their plan has
+// prices for.
+func NewBillingService(db *mongo.Database, usageService *UsageService, pricingService *PricingService, creditService *CreditService, taxEngine *TaxEngine, exchangeRates ExchangeRateSource, eventBus *EventBus) *BillingService {
 	return &BillingService{
-		db:           db,
-		usageService: usageService,
+		db:             db,
+		usageService:   usageService,
+		pricingService: pricingService,
+		creditService:  creditService,
+		taxEngine:      taxEngine,
+		exchangeRates:  exchangeRates,
+		eventBus:       eventBus,
 	}
 }
 
-// CalculateCost calculates the cost based on usage and plan
-func (s *BillingService) CalculateCost(ctx context.Context, summary *models.UsageSummary, plan string) float64 {
-	var pricing models.PricingModel
-
-	switch plan {
-	case "Free":
-		pricing = models.FreePricing
-	case "Pro":
-		pricing = models.ProPricing
-	case "Enterprise":
-		pricing = models.EnterprisePricing
-	default:
-		pricing = models.FreePricing
+// CalculateCost prices usage on a plan version, including the base fee and
+// any minimum commit shortfall prorated over the summary's period against the
+// organization's billing cycles. The cost is in the plan's currency.
+func (s *BillingService) CalculateCost(ctx context.Context, summary *models.UsageSummary, plan *models.PricingPlan, billingDay int) float64 {
+	lineItems := usageLineItems(summary, plan)
+	if baseFee, ok := baseFeeLineItem(plan, billingDay, summary.StartDate, summary.EndDate); ok {
+		lineItems = append(lineItems, baseFee)
+	}
+	if shortfall, ok := minimumCommitLineItem(plan, sumLineItems(lineItems), billingDay, summary.StartDate, summary.EndDate); ok {
+		lineItems = append(lineItems, shortfall)
 	}
 
-	totalCost := 0.0
+	return models.FromMinorUnits(sumLineItems(lineItems), plan.Currency)
+}
 
-	// Participant minutes cost
-	totalCost += summary.ParticipantMinutes * pricing.ParticipantMinutePrice
+// invoiceCurrency returns the currency an organization is invoiced in: its
+// billing currency, or its plan's if it has none
+func invoiceCurrency(org *models.Organization, plan *models.PricingPlan) string {
+	if org.BillingCurrency != "" {
+		return strings.ToUpper(org.BillingCurrency)
+	}
+	return strings.ToUpper(plan.Currency)
+}
 
-	// Egress minutes cost
-	totalCost += summary.EgressMinutes * pricing.EgressMinutePrice
+// planLocalizer prices plans in an invoice's currency and collects the
+// exchange rates it converted at, one per plan currency
+type planLocalizer struct {
+	exchangeRates ExchangeRateSource
+	currency      string
+	rates         []models.ExchangeRateSnapshot
+}
 
-	// Storage cost
-	totalCost += summary.StorageGB * pricing.StorageGBPrice
+// localize returns plan priced in the invoice currency: its own prices for
+// that currency if it has them, otherwise its prices converted at the
+// current exchange rate
+func (l *planLocalizer) localize(ctx context.Context, plan *models.PricingPlan) (*models.PricingPlan, error) {
+	if localized, ok := plan.InCurrency(l.currency); ok {
+		return localized, nil
+	}
 
-	// Bandwidth cost
-	totalCost += summary.BandwidthGB * pricing.BandwidthGBPrice
+	rate, ok := l.rate(plan.Currency)
+	if !ok {
+		if l.exchangeRates == nil {
+			return nil, fmt.Errorf("%w: %s plan has no %s prices and no rate source is configured", ErrExchangeRateUnavailable, plan.Name, l.currency)
+		}
+		snapshot, err := l.exchangeRates.Rate(ctx, plan.Currency, l.currency)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get exchange rate: %w", err)
+		}
+		l.rates = append(l.rates, snapshot)
+		rate = snapshot.Rate
+	}
 
-	// API requests cost (per 1000)
-	totalCost += (float64(summary.APIRequests) / 1000.0) * pricing.APIRequestPrice
+	return convertPlan(plan, l.currency, rate), nil
+}
 
-	// Add monthly base price (prorated for the period)
-	if pricing.MonthlyBasePrice > 0 {
-		// Calculate days in period
-		periodDays := summary.EndDate.Sub(summary.StartDate).Hours() / 24
-		monthlyProration := periodDays / 30.0 // Assume 30 days per month
-		totalCost += pricing.MonthlyBasePrice * monthlyProration
+// rate returns the rate already used for a currency on this invoice
+func (l *planLocalizer) rate(from string) (float64, bool) {
+	for _, snapshot := range l.rates {
+		if strings.EqualFold(snapshot.From, from) {
+			return snapshot.Rate, true
+		}
 	}
+	return 0, false
+}
 
-	return totalCost
+// convertPlan returns a copy of plan with its prices multiplied by rate
+func convertPlan(plan *models.PricingPlan, currency string, rate float64) *models.PricingPlan {
+	converted := *plan
+	converted.Currency = currency
+	converted.BasePrice = plan.BasePrice * rate
+	converted.MinimumCommit = plan.MinimumCommit * rate
+	converted.Prices = nil
+
+	converted.Metrics = make([]models.MetricPricing, len(plan.Metrics))
+	for i, metric := range plan.Metrics {
+		tiers := make([]models.PricingTier, len(metric.Tiers))
+		for j, tier := range metric.Tiers {
+			tiers[j] = models.PricingTier{UpTo: tier.UpTo, UnitPrice: tier.UnitPrice * rate}
+		}
+		metric.Tiers = tiers
+		converted.Metrics[i] = metric
+	}
+	return &converted
 }
 
-// GenerateInvoice generates an invoice for a project
+// subscriptionLineItems prices the organization's plans over a period from
+// its plan history. The opening plan's base fee covers the whole period;
+// each change during the period credits the unused part of the old plan and
+// charges the new plan for the rest. It returns the plan in effect at the end
+// of the period, which prices the period's usage. Plans are priced in the
+// organization's invoice currency, converted at the rates in the localizer.
+func (s *BillingService) subscriptionLineItems(ctx context.Context, orgID primitive.ObjectID, periodStart, periodEnd time.Time) (*models.Organization, *models.PricingPlan, []models.InvoiceLineItem, *planLocalizer, error) {
+	org, current, err := s.pricingService.ResolveOrgPlan(ctx, orgID)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("failed to resolve pricing plan: %w", err)
+	}
+
+	opening, changes, err := s.pricingService.PlanTimeline(ctx, orgID, current, periodStart, periodEnd)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	localizer := &planLocalizer{exchangeRates: s.exchangeRates, currency: invoiceCurrency(org, current)}
+	if opening, err = localizer.localize(ctx, opening); err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	lineItems := []models.InvoiceLineItem{}
+	if baseFee, ok := baseFeeLineItem(opening, org.BillingDay, periodStart, periodEnd); ok {
+		lineItems = append(lineItems, baseFee)
+	}
+
+	closing := opening
+	for i := range changes {
+		change := changes[i]
+		from, err := localizer.localize(ctx, &change.FromPlan)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		to, err := localizer.localize(ctx, &change.ToPlan)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		change.FromPlan, change.ToPlan = *from, *to
+
+		lineItems = append(lineItems, planChangeLineItems(&change, org.BillingDay, periodEnd)...)
+		closing = to
+	}
+
+	return org, closing, lineItems, localizer, nil
+}
+
+// planChangeLineItems credits the old plan's base fee and charges the new
+// plan's from the change until periodEnd
+func planChangeLineItems(change *models.PlanChange, billingDay int, periodEnd time.Time) []models.InvoiceLineItem {
+	proration := CycleProration(billingDay, change.EffectiveAt, periodEnd)
+	effective := change.EffectiveAt.UTC().Format("2006-01-02")
+
+	lineItems := []models.InvoiceLineItem{}
+	if change.FromPlan.BasePrice > 0 {
+		lineItems = append(lineItems, models.InvoiceLineItem{
+			Description: fmt.Sprintf("Unused time on %s Plan from %s", change.FromPlan.Name, effective),
+			Quantity:    proration,
+			Unit:        "month",
+			UnitPrice:   -change.FromPlan.BasePrice,
+			Amount:      -models.ToMinorUnits(change.FromPlan.BasePrice*proration, change.FromPlan.Currency),
+		})
+	}
+	if change.ToPlan.BasePrice > 0 {
+		lineItems = append(lineItems, models.InvoiceLineItem{
+			Description: fmt.Sprintf("Remaining time on %s Plan from %s", change.ToPlan.Name, effective),
+			Quantity:    proration,
+			Unit:        "month",
+			UnitPrice:   change.ToPlan.BasePrice,
+			Amount:      models.ToMinorUnits(change.ToPlan.BasePrice*proration, change.ToPlan.Currency),
+		})
+	}
+	return lineItems
+}
+
+// GenerateInvoice generates a usage statement for a project, priced on the
+// organization's plan. Organizations are charged on their consolidated
+// invoice, which carries the subscription fees, minimum commit and credit, so
+// a project invoice lists only the project's usage and cannot be collected.
 func (s *BillingService) GenerateInvoice(ctx context.Context, projectID primitive.ObjectID, periodStart, periodEnd time.Time) (*models.Invoice, error) {
 	// Get project details
 	projectCollection := s.db.Collection(models.Project{}.TableName())
@@ -80,12 +222,10 @@ func (s *BillingService) GenerateInvoice(ctx context.Context, projectID primitiv
 		return nil, fmt.Errorf("failed to find project: %w", err)
 	}
 
-	// Get organization details
-	orgCollection := s.db.Collection(models.Organization{}.TableName())
-	var org models.Organization
-	err = orgCollection.FindOne(ctx, bson.M{"_id": project.OrgID}).Decode(&org)
+	// The plan in effect at the end of the period prices the usage
+	org, plan, _, localizer, err := s.subscriptionLineItems(ctx, project.OrgID, periodStart, periodEnd)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find organization: %w", err)
+		return nil, err
 	}
 
 	// Get usage summary
@@ -94,133 +234,385 @@ func (s *BillingService) GenerateInvoice(ctx context.Context, projectID primitiv
 		return nil, fmt.Errorf("failed to get usage summary: %w", err)
 	}
 
-	// Get pricing model
-	var pricing models.PricingModel
-	switch org.Plan {
-	case "Free":
-		pricing = models.FreePricing
-	case "Pro":
-		pricing = models.ProPricing
-	case "Enterprise":
-		pricing = models.EnterprisePricing
-	default:
-		pricing = models.FreePricing
+	// Create line items
+	lineItems := usageLineItems(summary, plan)
+
+	// Calculate totals
+	subtotal := sumLineItems(lineItems)
+
+	// Create invoice
+	invoice := models.Invoice{
+		ProjectID:     projectID,
+		OrgID:         project.OrgID,
+		Scope:         models.InvoiceScopeProject,
+		BillingPeriod: periodStart.Format("2006-01"),
+		PeriodStart:   periodStart,
+		PeriodEnd:     periodEnd,
+		Status:        models.InvoiceStatusDraft,
+		LineItems:     lineItems,
+		Subtotal:      subtotal,
+		Total:         subtotal,
+		Currency:      plan.Currency,
+		ExchangeRates: localizer.rates,
+		PricingPlanID: plan.ID,
+		PlanVersion:   plan.Version,
+		DueDate:       time.Now().Add(30 * 24 * time.Hour), // 30 days
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
 	}
 
-	// Create line items
+	// Add tax and insert invoice
+	s.applyTax(&invoice, org)
+	if err := s.insertInvoice(ctx, &invoice); err != nil {
+		return nil, err
+	}
+
+	s.eventBus.PublishAsync(projectID, &models.WebhookPayload{
+		Event:   models.WebhookEventInvoiceGenerated,
+		Invoice: invoiceInfo(&invoice),
+	})
+
+	return &invoice, nil
+}
+
+// usageLineItems prices each non-zero usage metric in summary. Usage covered
+// by the included allowance is listed at no charge, and graduated metrics get
+// one line per tier reached.
+func usageLineItems(summary *models.UsageSummary, plan *models.PricingPlan) []models.InvoiceLineItem {
 	lineItems := []models.InvoiceLineItem{}
 
-	// Participant minutes
-	if summary.ParticipantMinutes > 0 {
-		lineItems = append(lineItems, models.InvoiceLineItem{
-			Description: "Participant Minutes",
-			Quantity:    summary.ParticipantMinutes,
-			Unit:        "minutes",
-			UnitPrice:   pricing.ParticipantMinutePrice,
-			Amount:      summary.ParticipantMinutes * pricing.ParticipantMinutePrice,
-		})
-	}
+	for _, metric := range models.PricingMetrics() {
+		pricing, ok := plan.MetricPricing(metric)
+		quantity := models.UsageQuantity(summary, metric)
+		if !ok || quantity <= 0 {
+			continue
+		}
 
-	// Egress minutes
-	if summary.EgressMinutes > 0 {
-		lineItems = append(lineItems, models.InvoiceLineItem{
-			Description: "Egress/Streaming Minutes",
-			Quantity:    summary.EgressMinutes,
-			Unit:        "minutes",
-			UnitPrice:   pricing.EgressMinutePrice,
-			Amount:      summary.EgressMinutes * pricing.EgressMinutePrice,
-		})
+		name := models.PricingMetricName(metric)
+		included, charges := pricing.Price(pricing.BilledQuantity(quantity))
+		if included > 0 {
+			lineItems = append(lineItems, models.InvoiceLineItem{
+				Description: name + " (included)",
+				Quantity:    included,
+				Unit:        pricing.Unit,
+			})
+		}
+		for _, charge := range charges {
+			description := name
+			if len(pricing.Tiers) > 1 {
+				description = fmt.Sprintf("%s (%s)", name, tierLabel(charge))
+			}
+			lineItems = append(lineItems, models.InvoiceLineItem{
+				Description: description,
+				Quantity:    charge.Quantity,
+				Unit:        pricing.Unit,
+				UnitPrice:   charge.UnitPrice,
+				Amount:      models.ToMinorUnits(charge.Amount, plan.Currency),
+			})
+		}
 	}
 
-	// Storage
-	if summary.StorageGB > 0 {
-		lineItems = append(lineItems, models.InvoiceLineItem{
-			Description: "Storage",
-			Quantity:    summary.StorageGB,
-			Unit:        "GB",
-			UnitPrice:   pricing.StorageGBPrice,
-			Amount:      summary.StorageGB * pricing.StorageGBPrice,
-		})
+	return lineItems
+}
+
+// orgUsageLineItems prices each metric on the organization's total usage, so
+// allowances and tiers apply once, and splits the charge across projects in
+// proportion to their usage
+func orgUsageLineItems(usage *models.OrgUsageSummary, plan *models.PricingPlan) []models.InvoiceLineItem {
+	lineItems := []models.InvoiceLineItem{}
+
+	for _, metric := range models.PricingMetrics() {
+		pricing, ok := plan.MetricPricing(metric)
+		total := pricing.BilledQuantity(models.UsageQuantity(&usage.Totals, metric))
+		if !ok || total <= 0 {
+			continue
+		}
+
+		amount := pricing.Amount(total)
+		for i := range usage.Projects {
+			project := &usage.Projects[i]
+			quantity := pricing.BilledQuantity(models.UsageQuantity(&project.UsageSummary, metric))
+			if quantity <= 0 {
+				continue
+			}
+			lineItems = append(lineItems, models.InvoiceLineItem{
+				Description: fmt.Sprintf("%s - %s", project.ProjectName, models.PricingMetricName(metric)),
+				Quantity:    quantity,
+				Unit:        pricing.Unit,
+				UnitPrice:   amount / total,
+				Amount:      models.ToMinorUnits(amount*quantity/total, plan.Currency),
+				ProjectID:   project.ProjectID,
+				ProjectName: project.ProjectName,
+			})
+		}
 	}
 
-	// Bandwidth
-	if summary.BandwidthGB > 0 {
-		lineItems = append(lineItems, models.InvoiceLineItem{
-			Description: "Bandwidth",
-			Quantity:    summary.BandwidthGB,
-			Unit:        "GB",
-			UnitPrice:   pricing.BandwidthGBPrice,
-			Amount:      summary.BandwidthGB * pricing.BandwidthGBPrice,
-		})
+	return lineItems
+}
+
+// tierLabel describes the usage band a tier charge covers
+func tierLabel(charge models.TierCharge) string {
+	if charge.To == 0 {
+		return fmt.Sprintf("over %g", charge.From)
 	}
+	return fmt.Sprintf("%g-%g", charge.From, charge.To)
+}
 
-	// API requests
-	if summary.APIRequests > 0 {
-		quantity := float64(summary.APIRequests) / 1000.0
-		lineItems = append(lineItems, models.InvoiceLineItem{
-			Description: "API Requests",
-			Quantity:    quantity,
-			Unit:        "per 1000",
-			UnitPrice:   pricing.APIRequestPrice,
-			Amount:      quantity * pricing.APIRequestPrice,
-		})
+// baseFeeLineItem returns the plan's base fee prorated over the period, if any
+func baseFeeLineItem(plan *models.PricingPlan, billingDay int, periodStart, periodEnd time.Time) (models.InvoiceLineItem, bool) {
+	if plan.BasePrice <= 0 {
+		return models.InvoiceLineItem{}, false
 	}
 
-	// Monthly base price (prorated)
-	if pricing.MonthlyBasePrice > 0 {
-		periodDays := periodEnd.Sub(periodStart).Hours() / 24
-		monthlyProration := periodDays / 30.0
-		proratedAmount := pricing.MonthlyBasePrice * monthlyProration
-		lineItems = append(lineItems, models.InvoiceLineItem{
-			Description: fmt.Sprintf("Monthly Subscription (%s Plan)", org.Plan),
-			Quantity:    monthlyProration,
-			Unit:        "month",
-			UnitPrice:   pricing.MonthlyBasePrice,
-			Amount:      proratedAmount,
-		})
+	proration := CycleProration(billingDay, periodStart, periodEnd)
+	return models.InvoiceLineItem{
+		Description: fmt.Sprintf("Monthly Subscription (%s Plan)", plan.Name),
+		Quantity:    proration,
+		Unit:        "month",
+		UnitPrice:   plan.BasePrice,
+		Amount:      models.ToMinorUnits(plan.BasePrice*proration, plan.Currency),
+	}, true
+}
+
+// minimumCommitLineItem returns the amount by which subtotal, in minor units,
+// falls short of the plan's prorated minimum commit, if it does
+func minimumCommitLineItem(plan *models.PricingPlan, subtotal int64, billingDay int, periodStart, periodEnd time.Time) (models.InvoiceLineItem, bool) {
+	proration := CycleProration(billingDay, periodStart, periodEnd)
+	commit := models.ToMinorUnits(plan.MinimumCommit*proration, plan.Currency)
+	if commit <= subtotal {
+		return models.InvoiceLineItem{}, false
 	}
 
-	// Calculate totals
-	subtotal := 0.0
+	return models.InvoiceLineItem{
+		Description: fmt.Sprintf("Minimum Commit Shortfall (%s Plan)", plan.Name),
+		Quantity:    proration,
+		Unit:        "month",
+		UnitPrice:   plan.MinimumCommit,
+		Amount:      commit - subtotal,
+	}, true
+}
+
+// sumLineItems adds up line item amounts
+func sumLineItems(lineItems []models.InvoiceLineItem) int64 {
+	var total int64
 	for _, item := range lineItems {
-		subtotal += item.Amount
+		total += item.Amount
 	}
+	return total
+}
 
-	tax := 0.0 // Tax calculation can be added here
-	total := subtotal + tax
+// GenerateOrgInvoice generates one consolidated invoice for an organization.
+// Usage is itemized per project; the plan's base fee, any minimum commit
+// shortfall and the organization's credit are applied once. A period that
+// already has an invoice that was not voided returns it instead.
+func (s *BillingService) GenerateOrgInvoice(ctx context.Context, orgID primitive.ObjectID, periodStart, periodEnd time.Time) (*models.Invoice, error) {
+	var existing models.Invoice
+	err := s.db.Collection(models.Invoice{}.TableName()).FindOne(ctx, bson.M{
+		"org_id":       orgID,
+		"scope":        models.InvoiceScopeOrganization,
+		"period_start": periodStart,
+		"period_end":   periodEnd,
+		"status":       bson.M{"$ne": models.InvoiceStatusVoid},
+	}).Decode(&existing)
+	if err == nil {
+		return &existing, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("failed to find invoice: %w", err)
+	}
 
-	// Generate invoice number
-	invoiceNumber := fmt.Sprintf("INV-%s-%s", projectID.Hex()[:8], time.Now().Format("200601"))
+	usage, err := s.usageService.GetOrgUsageSummary(ctx, orgID, periodStart, periodEnd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization usage: %w", err)
+	}
 
-	// Create invoice
+	org, plan, subscription, localizer, err := s.subscriptionLineItems(ctx, orgID, periodStart, periodEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	lineItems := append(orgUsageLineItems(usage, plan), subscription...)
+	if shortfall, ok := minimumCommitLineItem(plan, sumLineItems(lineItems), org.BillingDay, periodStart, periodEnd); ok {
+		lineItems = append(lineItems, shortfall)
+	}
+
+	subtotal := sumLineItems(lineItems)
+
+	now := time.Now()
 	invoice := models.Invoice{
-		ProjectID:     projectID,
-		OrgID:         project.OrgID,
-		InvoiceNumber: invoiceNumber,
+		OrgID:         orgID,
+		Scope:         models.InvoiceScopeOrganization,
 		BillingPeriod: periodStart.Format("2006-01"),
 		PeriodStart:   periodStart,
 		PeriodEnd:     periodEnd,
 		Status:        models.InvoiceStatusDraft,
 		LineItems:     lineItems,
 		Subtotal:      subtotal,
-		Tax:           tax,
-		Total:         total,
-		Currency:      pricing.Currency,
-		DueDate:       time.Now().Add(30 * 24 * time.Hour), // 30 days
-		CreatedAt:     time.Now(),
-		UpdatedAt:     time.Now(),
+		Total:         subtotal,
+		Currency:      plan.Currency,
+		ExchangeRates: localizer.rates,
+		PricingPlanID: plan.ID,
+		PlanVersion:   plan.Version,
+		DueDate:       now.Add(30 * 24 * time.Hour),
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	s.applyTax(&invoice, org)
+	if err := s.insertInvoice(ctx, &invoice); err != nil {
+		return nil, err
+	}
+
+	return &invoice, nil
+}
+
+// applyTax charges tax on an invoice's subtotal according to the
+// organization's tax profile, snapshotting the profile onto the invoice.
+// Credit is drawn down against the tax-inclusive total afterwards.
+func (s *BillingService) applyTax(invoice *models.Invoice, org *models.Organization) {
+	if s.taxEngine == nil {
+		return
 	}
 
-	// Insert invoice
-	invoiceCollection := s.db.Collection(models.Invoice{}.TableName())
-	result, err := invoiceCollection.InsertOne(ctx, invoice)
+	result := s.taxEngine.Calculate(org.TaxProfile, invoice.Subtotal)
+	invoice.TaxLines = result.Lines
+	invoice.ReverseCharge = result.ReverseCharge
+	invoice.TaxNote = result.Note
+	invoice.Tax = result.Total
+	invoice.Total = invoice.Subtotal + invoice.Tax
+	if org.TaxProfile != nil {
+		address := org.TaxProfile.BillingAddress
+		invoice.BillingAddress = &address
+		if org.TaxProfile.TaxIDValid {
+			invoice.CustomerTaxID = org.TaxProfile.TaxID
+		}
+	}
+}
+
+// insertInvoice numbers a new invoice, applies the organization's credit to
+// organization invoices, adding one line item per grant drawn on, and stores
+// it. Credit drawn for an invoice that fails to store is returned.
+func (s *BillingService) insertInvoice(ctx context.Context, invoice *models.Invoice) error {
+	invoice.ID = primitive.NewObjectID()
+
+	number, err := s.nextInvoiceNumber(ctx, invoice.OrgID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create invoice: %w", err)
+		return err
+	}
+	invoice.InvoiceNumber = number
+
+	// Project invoices are statements; credit is only drawn by the invoice
+	// the organization pays
+	if invoice.Scope == models.InvoiceScopeOrganization {
+		credits, err := s.creditService.ApplyCredits(ctx, invoice.OrgID, invoice.ID, invoice.Currency, invoice.Total)
+		if err != nil {
+			s.creditService.ReleaseInvoiceCredits(ctx, invoice.ID)
+			return fmt.Errorf("failed to apply credit: %w", err)
+		}
+		invoice.LineItems = append(invoice.LineItems, credits...)
+		invoice.CreditsApplied = -sumLineItems(credits)
+		invoice.Total -= invoice.CreditsApplied
 	}
 
-	invoice.ID = result.InsertedID.(primitive.ObjectID)
+	if _, err := s.db.Collection(models.Invoice{}.TableName()).InsertOne(ctx, invoice); err != nil {
+		s.creditService.ReleaseInvoiceCredits(ctx, invoice.ID)
+		return fmt.Errorf("failed to create invoice: %w", err)
+	}
+	return nil
+}
 
-	return &invoice, nil
+// nextInvoiceNumber allocates the organization's next invoice number, e.g.
+// INV-1A2B3C4D-000042. The prefix is taken from the end of the organization
+// ID, which unlike its start is not shared by organizations created together.
+func (s *BillingService) nextInvoiceNumber(ctx context.Context, orgID primitive.ObjectID) (string, error) {
+	var sequence models.InvoiceSequence
+	err := s.db.Collection(models.InvoiceSequence{}.TableName()).FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": orgID},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&sequence)
+	if err != nil {
+		return "", fmt.Errorf("failed to allocate invoice number: %w", err)
+	}
+
+	return fmt.Sprintf("INV-%s-%06d", strings.ToUpper(orgID.Hex()[16:]), sequence.Seq), nil
+}
+
+// ListOrgInvoices retrieves consolidated invoices for an organization
+func (s *BillingService) ListOrgInvoices(ctx context.Context, orgID primitive.ObjectID, page, limit int) ([]models.Invoice, int64, error) {
+	collection := s.db.Collection(models.Invoice{}.TableName())
+
+	filter := bson.M{"org_id": orgID, "scope": models.InvoiceScopeOrganization}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count invoices: %w", err)
+	}
+
+	opts := options.Find().
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit)).
+		SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find invoices: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var invoices []models.Invoice
+	if err := cursor.All(ctx, &invoices); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode invoices: %w", err)
+	}
+
+	return invoices, total, nil
+}
+
+// GetOrgBillingDashboard retrieves consolidated billing data for an organization
+func (s *BillingService) GetOrgBillingDashboard(ctx context.Context, orgID primitive.ObjectID) (*models.OrgBillingDashboardResponse, error) {
+	org, plan, err := s.pricingService.ResolveOrgPlan(ctx, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve pricing plan: %w", err)
+	}
+
+	now := time.Now().UTC()
+	periodStart, periodEnd := BillingCycle(org.BillingDay, now)
+
+	usage, err := s.usageService.GetOrgUsageSummary(ctx, orgID, periodStart, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization usage: %w", err)
+	}
+
+	// CalculateCost prices the org totals, so the base fee is counted once
+	currentCharges := s.CalculateCost(ctx, &usage.Totals, plan, org.BillingDay)
+	projectedTotal := projectCharges(currentCharges, periodStart, periodEnd, now)
+
+	recentInvoices, _, _ := s.ListOrgInvoices(ctx, orgID, 1, 5)
+	if recentInvoices == nil {
+		recentInvoices = []models.Invoice{}
+	}
+
+	return &models.OrgBillingDashboardResponse{
+		OrgID:          orgID.Hex(),
+		CurrentPlan:    usage.Plan,
+		BillingPeriod:  periodStart.Format("2006-01"),
+		Usage:          *usage,
+		CurrentCharges: currentCharges,
+		ProjectedTotal: projectedTotal,
+		PricingPlan:    plan,
+		PlanLimits:     models.GetPlanLimits(usage.Plan),
+		RecentInvoices: recentInvoices,
+	}, nil
+}
+
+// projectCharges extrapolates charges so far to the end of the billing cycle
+func projectCharges(current float64, cycleStart, cycleEnd, now time.Time) float64 {
+	elapsed := now.Sub(cycleStart)
+	if elapsed <= 0 {
+		return current
+	}
+	return current * cycleEnd.Sub(cycleStart).Seconds() / elapsed.Seconds()
 }
 
 // GetInvoice retrieves an invoice by ID
@@ -271,6 +663,31 @@ func (s *BillingService) ListInvoices(ctx context.Context, projectID primitive.O
 	return invoices, total, nil
 }
 
+// SetOrgInvoiceStatus sets the status of one of an organization's invoices
+// on an operator's behalf, e.g. for a payment taken outside any provider.
+// Paid and voided invoices are settled and cannot be changed.
+func (s *BillingService) SetOrgInvoiceStatus(ctx context.Context, orgID, invoiceID primitive.ObjectID, status string) error {
+	switch status {
+	case models.InvoiceStatusIssued, models.InvoiceStatusOverdue, models.InvoiceStatusPaid, models.InvoiceStatusVoid:
+	default:
+		return fmt.Errorf("%w: %q", ErrInvalidInvoiceStatus, status)
+	}
+
+	var invoice models.Invoice
+	err := s.db.Collection(models.Invoice{}.TableName()).FindOne(ctx, bson.M{"_id": invoiceID, "org_id": orgID}).Decode(&invoice)
+	if err == mongo.ErrNoDocuments {
+		return fmt.Errorf("invoice not found")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find invoice: %w", err)
+	}
+	if invoice.Status == models.InvoiceStatusPaid || invoice.Status == models.InvoiceStatusVoid {
+		return fmt.Errorf("%w: invoice is already %s", ErrInvalidInvoiceStatus, invoice.Status)
+	}
+
+	return s.UpdateInvoiceStatus(ctx, invoiceID, status)
+}
+
 // UpdateInvoiceStatus updates the status of an invoice
 func (s *BillingService) UpdateInvoiceStatus(ctx context.Context, invoiceID primitive.ObjectID, status string) error {
 	collection := s.db.Collection(models.Invoice{}.TableName())
@@ -287,18 +704,121 @@ func (s *BillingService) UpdateInvoiceStatus(ctx context.Context, invoiceID prim
 		update["$set"].(bson.M)["paid_at"] = &now
 	}
 
-	result, err := collection.UpdateOne(ctx, bson.M{"_id": invoiceID}, update)
+	var invoice models.Invoice
+	err := collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": invoiceID},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&invoice)
 	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("invoice not found")
+		}
 		return fmt.Errorf("failed to update invoice: %w", err)
 	}
 
-	if result.MatchedCount == 0 {
-		return fmt.Errorf("invoice not found")
+	// A voided invoice gives back the credit it drew down
+	if status == models.InvoiceStatusVoid {
+		if err := s.creditService.ReleaseInvoiceCredits(ctx, invoiceID); err != nil {
+			return err
+		}
+	}
+
+	if status == models.InvoiceStatusPaid || status == models.InvoiceStatusVoid {
+		if err := s.settleBillingRun(ctx, &invoice); err != nil {
+			return err
+		}
+	}
+
+	if status == models.InvoiceStatusPaid {
+		payload := &models.WebhookPayload{
+			Event:   models.WebhookEventInvoicePaid,
+			Invoice: invoiceInfo(&invoice),
+		}
+		// Organization invoices have no project; every project's webhook hears of them
+		if invoice.Scope == models.InvoiceScopeOrganization {
+			s.eventBus.PublishToOrg(ctx, invoice.OrgID, payload)
+		} else {
+			s.eventBus.PublishAsync(invoice.ProjectID, payload)
+		}
+	}
+
+	return nil
+}
+
+// settleBillingRun closes the billing run of a paid or voided invoice and
+// reinstates its organization once no invoice is overdue any more
+func (s *BillingService) settleBillingRun(ctx context.Context, invoice *models.Invoice) error {
+	now := time.Now()
+	set := bson.M{"status": models.BillingRunStatusVoid, "updated_at": now}
+	if invoice.Status == models.InvoiceStatusPaid {
+		set = bson.M{"status": models.BillingRunStatusPaid, "paid_at": now, "updated_at": now}
+	}
+
+	runs := s.db.Collection(models.BillingRun{}.TableName())
+	result, err := runs.UpdateOne(ctx,
+		bson.M{"invoice_id": invoice.ID, "status": models.BillingRunStatusUnpaid},
+		bson.M{"$set": set},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to settle billing run: %w", err)
+	}
+	if result.ModifiedCount == 0 {
+		return nil
+	}
+
+	overdue, err := runs.CountDocuments(ctx, bson.M{
+		"org_id":        invoice.OrgID,
+		"status":        models.BillingRunStatusUnpaid,
+		"dunning_stage": bson.M{"$gt": 0},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to count overdue billing runs: %w", err)
+	}
+	if overdue > 0 {
+		return nil
+	}
+
+	var org models.Organization
+	err = s.db.Collection(models.Organization{}.TableName()).FindOneAndUpdate(ctx,
+		bson.M{"_id": invoice.OrgID, "billing_status": bson.M{"$in": bson.A{models.OrgBillingStatusPastDue, models.OrgBillingStatusSuspended}}},
+		bson.M{
+			"$set":   bson.M{"billing_status": models.OrgBillingStatusActive, "updated_at": now},
+			"$unset": bson.M{"suspended_at": ""},
+		},
+	).Decode(&org)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reinstate organization: %w", err)
 	}
 
+	if org.BillingStatus == models.OrgBillingStatusSuspended {
+		log.Info().Str("org_id", org.ID.Hex()).Msg("Organization reinstated after payment")
+		s.eventBus.PublishToOrg(ctx, org.ID, &models.WebhookPayload{
+			Event:   models.WebhookEventOrganizationReinstated,
+			Invoice: invoiceInfo(invoice),
+		})
+	}
 	return nil
 }
 
+// invoiceInfo builds the webhook representation of an invoice
+func invoiceInfo(invoice *models.Invoice) *models.InvoiceInfo {
+	return &models.InvoiceInfo{
+		ID:            invoice.ID.Hex(),
+		InvoiceNumber: invoice.InvoiceNumber,
+		BillingPeriod: invoice.BillingPeriod,
+		Status:        invoice.Status,
+		Total:         invoice.Total,
+		Currency:      invoice.Currency,
+		DueDate:       invoice.DueDate.Unix(),
+		PaymentLink:   invoice.PaymentLink,
+	}
+}
+
 // GetBillingDashboard retrieves billing dashboard data for a project
 func (s *BillingService) GetBillingDashboard(ctx context.Context, projectID primitive.ObjectID) (*models.BillingDashboardResponse, error) {
 	// Get project details
@@ -309,45 +829,29 @@ func (s *BillingService) GetBillingDashboard(ctx context.Context, projectID prim
 		return nil, fmt.Errorf("failed to find project: %w", err)
 	}
 
-	// Get organization details
-	orgCollection := s.db.Collection(models.Organization{}.TableName())
-	var org models.Organization
-	err = orgCollection.FindOne(ctx, bson.M{"_id": project.OrgID}).Decode(&org)
+	// Get organization details and its plan version
+	org, plan, err := s.pricingService.ResolveOrgPlan(ctx, project.OrgID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find organization: %w", err)
+		return nil, fmt.Errorf("failed to resolve pricing plan: %w", err)
 	}
 
-	// Get current month usage
-	now := time.Now()
-	periodStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
-	periodEnd := now
+	// Get usage for the current billing cycle
+	now := time.Now().UTC()
+	periodStart, periodEnd := BillingCycle(org.BillingDay, now)
 
-	usageSummary, err := s.usageService.GetUsageSummary(ctx, projectID, periodStart, periodEnd)
+	usageSummary, err := s.usageService.GetUsageSummary(ctx, projectID, periodStart, now)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get usage summary: %w", err)
 	}
 
 	// Calculate current charges
-	currentCharges := s.CalculateCost(ctx, usageSummary, org.Plan)
+	currentCharges := s.CalculateCost(ctx, usageSummary, plan, org.BillingDay)
 
-	// Project total for end of month
-	daysInMonth := 30.0
-	daysPassed := float64(now.Day())
-	projectionMultiplier := daysInMonth / daysPassed
-	projectedTotal := currentCharges * projectionMultiplier
+	// Project total for end of the cycle
+	projectedTotal := projectCharges(currentCharges, periodStart, periodEnd, now)
 
 	// Get plan limits
-	var planLimits models.PlanLimits
-	switch org.Plan {
-	case "Free":
-		planLimits = models.FreePlanLimits
-	case "Pro":
-		planLimits = models.ProPlanLimits
-	case "Enterprise":
-		planLimits = models.EnterprisePlanLimits
-	default:
-		planLimits = models.FreePlanLimits
-	}
+	planLimits := models.GetPlanLimits(org.Plan)
 
 	// Get alerts
 	alerts, _ := s.usageService.GetAlerts(ctx, projectID)
@@ -368,6 +872,7 @@ func (s *BillingService) GetBillingDashboard(ctx context.Context, projectID prim
 		UsageSummary:   *usageSummary,
 		CurrentCharges: currentCharges,
 		ProjectedTotal: projectedTotal,
+		PricingPlan:    plan,
 		PlanLimits:     planLimits,
 		Alerts:         alerts,
 		RecentInvoices: recentInvoices,
@@ -375,36 +880,3 @@ func (s *BillingService) GetBillingDashboard(ctx context.Context, projectID prim
 
 	return dashboard, nil
 }
-
-// IntegrateStripe is a placeholder for Stripe integration
-func (s *BillingService) IntegrateStripe(ctx context.Context, invoiceID primitive.ObjectID) error {
-	// TODO: Implement Stripe integration
-	// 1. Create Stripe invoice
-	// 2. Send to customer email
-	// 3. Update invoice with Stripe invoice ID
-	// 4. Listen for payment webhooks
-	// 5. Update invoice status when paid
-
-	return fmt.Errorf("stripe integration not implemented yet")
-}
-
-// CreateStripeCustomer is a placeholder for creating a Stripe customer
-func (s *BillingService) CreateStripeCustomer(ctx context.Context, orgID primitive.ObjectID) (string, error) {
-	// TODO: Implement Stripe customer creation
-	// 1. Get organization details
-	// 2. Create Stripe customer with email
-	// 3. Store Stripe customer ID in organization
-	// 4. Return customer ID
-
-	return "", fmt.Errorf("stripe customer creation not implemented yet")
-}
-
-// AttachPaymentMethod is a placeholder for attaching payment method
-func (s *BillingService) AttachPaymentMethod(ctx context.Context, orgID primitive.ObjectID, paymentMethodID string) error {
-	// TODO: Implement payment method attachment
-	// 1. Get organization's Stripe customer ID
-	// 2. Attach payment method to customer
-	// 3. Set as default payment method
-
-	return fmt.Errorf("payment method attachment not implemented yet")
-}
@@ -0,0 +1,538 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"pulse-control-plane/models"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrBudgetNotFound is returned when an organization or project has no budget
+var ErrBudgetNotFound = errors.New("budget not found")
+
+// forecastMetrics maps the usage events forecast for budgets to the summary
+// field they add to. Storage is a level rather than a flow, so it is held at
+// its current value.
+var forecastMetrics = []string{
+	models.EventParticipantLeft,
+	models.EventEgressEnded,
+	models.EventBandwidthUsed,
+	models.EventAPIRequest,
+}
+
+// BudgetService manages organization and project budgets and evaluates them
+// against cycle-to-date spend and its forecast to the end of the cycle
+type BudgetService struct {
+	db               *mongo.Database
+	usageService     *UsageService
+	billingService   *BillingService
+	pricingService   *PricingService
+	analyticsService *AnalyticsService
+	quotaService     *QuotaService
+	mailer           Mailer
+	eventBus         *EventBus
+}
+
+// NewBudgetService creates a new budget service. mailer may be nil, in which
+// case alerts are only delivered by webhook.
+func NewBudgetService(db *mongo.Database, usageService *UsageService, billingService *BillingService, pricingService *PricingService, analyticsService *AnalyticsService, quotaService *QuotaService, mailer Mailer, eventBus *EventBus) *BudgetService {
+	return &BudgetService{
+		db:               db,
+		usageService:     usageService,
+		billingService:   billingService,
+		pricingService:   pricingService,
+		analyticsService: analyticsService,
+		quotaService:     quotaService,
+		mailer:           mailer,
+		eventBus:         eventBus,
+	}
+}
+
+// SetBudget creates or replaces the budget of an organization, or of one of
+// its projects if projectID is set. Changing the amount re-arms its alerts
+// and lifts a reached cap until the next evaluation.
+func (s *BudgetService) SetBudget(ctx context.Context, orgID primitive.ObjectID, projectID *primitive.ObjectID, input *models.BudgetInput) (*models.Budget, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	_, plan, err := s.pricingService.ResolveOrgPlan(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	if projectID != nil {
+		count, err := s.db.Collection(models.Project{}.TableName()).CountDocuments(ctx,
+			bson.M{"_id": *projectID, "org_id": orgID, "is_deleted": false})
+		if err != nil {
+			return nil, fmt.Errorf("failed to find project: %w", err)
+		}
+		if count == 0 {
+			return nil, errors.New("project not found")
+		}
+	}
+
+	thresholds := input.Thresholds
+	if len(thresholds) == 0 {
+		thresholds = models.DefaultBudgetThresholds
+	}
+
+	now := time.Now()
+	budget, err := s.GetBudget(ctx, orgID, projectID)
+	if err != nil && !errors.Is(err, ErrBudgetNotFound) {
+		return nil, err
+	}
+	if budget == nil {
+		budget = &models.Budget{
+			ID:        primitive.NewObjectID(),
+			OrgID:     orgID,
+			ProjectID: projectID,
+			CreatedAt: now,
+		}
+	}
+	if budget.Amount != input.Amount {
+		budget.AlertedThresholds = nil
+		budget.ForecastAlerted = false
+		budget.CappedUntil = nil
+	}
+	if !input.HardCap {
+		budget.CappedUntil = nil
+	}
+	budget.Amount = input.Amount
+	budget.Currency = plan.Currency
+	budget.Thresholds = thresholds
+	budget.HardCap = input.HardCap
+	budget.NotifyEmails = input.NotifyEmails
+	budget.UpdatedAt = now
+
+	_, err = s.db.Collection(models.Budget{}.TableName()).ReplaceOne(ctx,
+		bson.M{"_id": budget.ID}, budget, options.Replace().SetUpsert(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to save budget: %w", err)
+	}
+	s.quotaService.Invalidate()
+
+	log.Info().Str("org_id", orgID.Hex()).Float64("amount", budget.Amount).Bool("hard_cap", budget.HardCap).Msg("Budget set")
+	return budget, nil
+}
+
+// GetBudget returns the budget of an organization, or of one of its projects
+// if projectID is set
+func (s *BudgetService) GetBudget(ctx context.Context, orgID primitive.ObjectID, projectID *primitive.ObjectID) (*models.Budget, error) {
+	var budget models.Budget
+	err := s.db.Collection(models.Budget{}.TableName()).FindOne(ctx, bson.M{"org_id": orgID, "project_id": projectID}).Decode(&budget)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrBudgetNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find budget: %w", err)
+	}
+	return &budget, nil
+}
+
+// ListBudgets lists an organization's budget and its projects' budgets
+func (s *BudgetService) ListBudgets(ctx context.Context, orgID primitive.ObjectID) ([]models.Budget, error) {
+	cursor, err := s.db.Collection(models.Budget{}.TableName()).Find(ctx,
+		bson.M{"org_id": orgID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find budgets: %w", err)
+	}
+	budgets := []models.Budget{}
+	if err := cursor.All(ctx, &budgets); err != nil {
+		return nil, fmt.Errorf("failed to decode budgets: %w", err)
+	}
+	return budgets, nil
+}
+
+// DeleteBudget removes a budget, lifting its cap
+func (s *BudgetService) DeleteBudget(ctx context.Context, orgID primitive.ObjectID, projectID *primitive.ObjectID) error {
+	result, err := s.db.Collection(models.Budget{}.TableName()).DeleteOne(ctx, bson.M{"org_id": orgID, "project_id": projectID})
+	if err != nil {
+		return fmt.Errorf("failed to delete budget: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrBudgetNotFound
+	}
+	s.quotaService.Invalidate()
+	return nil
+}
+
+// ListAlerts lists an organization's most recent budget alerts
+func (s *BudgetService) ListAlerts(ctx context.Context, orgID primitive.ObjectID) ([]models.BudgetAlert, error) {
+	cursor, err := s.db.Collection(models.BudgetAlert{}.TableName()).Find(ctx,
+		bson.M{"org_id": orgID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(100),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find budget alerts: %w", err)
+	}
+	alerts := []models.BudgetAlert{}
+	if err := cursor.All(ctx, &alerts); err != nil {
+		return nil, fmt.Errorf("failed to decode budget alerts: %w", err)
+	}
+	return alerts, nil
+}
+
+// EvaluateAll evaluates every budget, sending the alerts that are due and
+// applying hard caps. It returns the number of alerts sent.
+func (s *BudgetService) EvaluateAll(ctx context.Context, now time.Time) (int, error) {
+	cursor, err := s.db.Collection(models.Budget{}.TableName()).Find(ctx, bson.M{},
+		options.Find().SetSort(bson.D{{Key: "org_id", Value: 1}}))
+	if err != nil {
+		return 0, fmt.Errorf("failed to find budgets: %w", err)
+	}
+	var budgets []models.Budget
+	if err := cursor.All(ctx, &budgets); err != nil {
+		return 0, fmt.Errorf("failed to decode budgets: %w", err)
+	}
+
+	sent := 0
+	capped := false
+	var spend *orgSpend
+	for i := range budgets {
+		budget := &budgets[i]
+		if spend == nil || spend.org.ID != budget.OrgID {
+			spend, err = s.loadOrgSpend(ctx, budget.OrgID, now)
+			if err != nil {
+				log.Error().Err(err).Str("org_id", budget.OrgID.Hex()).Msg("Failed to load spend for budgets")
+				spend = nil
+				continue
+			}
+		}
+
+		alerted, newlyCapped, err := s.evaluate(ctx, budget, spend, now)
+		if err != nil {
+			log.Error().Err(err).Str("budget_id", budget.ID.Hex()).Msg("Failed to evaluate budget")
+			continue
+		}
+		sent += alerted
+		capped = capped || newlyCapped
+	}
+
+	// Caps take effect on the next quota check rather than within a minute
+	if capped {
+		s.quotaService.Invalidate()
+	}
+	return sent, nil
+}
+
+// orgSpend is an organization's cycle-to-date usage, priced on its plan,
+// with usage forecasts loaded per project on demand
+type orgSpend struct {
+	org         *models.Organization
+	plan        *models.PricingPlan
+	usage       *models.OrgUsageSummary
+	periodStart time.Time
+	periodEnd   time.Time
+	forecasts   map[primitive.ObjectID]*models.UsageSummary
+}
+
+// loadOrgSpend loads an organization's usage for its current billing cycle
+func (s *BudgetService) loadOrgSpend(ctx context.Context, orgID primitive.ObjectID, now time.Time) (*orgSpend, error) {
+	org, plan, err := s.pricingService.ResolveOrgPlan(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	periodStart, periodEnd := BillingCycle(org.BillingDay, now.UTC())
+	usage, err := s.usageService.GetOrgUsageSummary(ctx, orgID, periodStart, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage summary: %w", err)
+	}
+	return &orgSpend{
+		org:         org,
+		plan:        plan,
+		usage:       usage,
+		periodStart: periodStart,
+		periodEnd:   periodEnd,
+		forecasts:   make(map[primitive.ObjectID]*models.UsageSummary),
+	}, nil
+}
+
+// evaluate prices a budget's spend and its forecast, then sends the alerts
+// that are due and applies its cap. It returns the number of alerts sent
+// and whether the cap was just reached.
+func (s *BudgetService) evaluate(ctx context.Context, budget *models.Budget, spend *orgSpend, now time.Time) (int, bool, error) {
+	actual, forecast := s.price(ctx, budget, spend, now)
+
+	// Alerts and caps are per billing cycle
+	if !budget.PeriodStart.Equal(spend.periodStart) {
+		budget.PeriodStart = spend.periodStart
+		budget.PeriodEnd = spend.periodEnd
+		budget.AlertedThresholds = nil
+		budget.ForecastAlerted = false
+		budget.CappedUntil = nil
+	}
+	budget.Spend = actual
+	budget.ForecastSpend = forecast
+	budget.Currency = spend.plan.Currency
+	budget.EvaluatedAt = &now
+
+	newlyCapped := false
+	if budget.HardCap && actual >= budget.Amount && !budget.Capped(now) {
+		budget.CappedUntil = &spend.periodEnd
+		newlyCapped = true
+	}
+
+	var alerts []models.BudgetAlert
+	due := budget.DueThresholds(actual)
+	if len(due) > 0 || newlyCapped {
+		// One alert for the highest threshold crossed since the last evaluation
+		threshold := 100
+		if len(due) > 0 {
+			threshold = due[len(due)-1]
+		}
+		alerts = append(alerts, s.newAlert(budget, models.BudgetAlertThreshold, threshold, newlyCapped, now))
+		budget.AlertedThresholds = append(budget.AlertedThresholds, due...)
+	}
+	if !budget.ForecastAlerted && actual < budget.Amount && forecast >= budget.Amount {
+		alerts = append(alerts, s.newAlert(budget, models.BudgetAlertForecast, 100, false, now))
+		budget.ForecastAlerted = true
+	}
+
+	_, err := s.db.Collection(models.Budget{}.TableName()).UpdateOne(ctx,
+		bson.M{"_id": budget.ID},
+		bson.M{"$set": bson.M{
+			"period_start":       budget.PeriodStart,
+			"period_end":         budget.PeriodEnd,
+			"spend":              budget.Spend,
+			"forecast_spend":     budget.ForecastSpend,
+			"currency":           budget.Currency,
+			"alerted_thresholds": budget.AlertedThresholds,
+			"forecast_alerted":   budget.ForecastAlerted,
+			"capped_until":       budget.CappedUntil,
+			"evaluated_at":       budget.EvaluatedAt,
+		}},
+	)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to update budget: %w", err)
+	}
+
+	for i := range alerts {
+		s.notify(ctx, spend.org, budget, &alerts[i])
+	}
+	if newlyCapped {
+		log.Warn().Str("budget_id", budget.ID.Hex()).Str("org_id", budget.OrgID.Hex()).Float64("spend", actual).Msg("Budget hard cap reached")
+	}
+	return len(alerts), newlyCapped, nil
+}
+
+// price returns a budget's cycle-to-date spend and its forecast spend for
+// the whole cycle. Organization budgets are priced as their invoice would
+// be. Project budgets cover the project's usage only: the base fee and
+// minimum commit belong to the organization.
+func (s *BudgetService) price(ctx context.Context, budget *models.Budget, spend *orgSpend, now time.Time) (float64, float64) {
+	plan := spend.plan
+	var usage models.UsageSummary
+	var projects []primitive.ObjectID
+
+	if budget.ProjectID == nil {
+		usage = spend.usage.Totals
+		for _, project := range spend.usage.Projects {
+			id, _ := primitive.ObjectIDFromHex(project.ProjectID)
+			projects = append(projects, id)
+		}
+	} else {
+		usagePlan := *plan
+		usagePlan.BasePrice = 0
+		usagePlan.MinimumCommit = 0
+		plan = &usagePlan
+
+		usage = models.UsageSummary{StartDate: spend.periodStart, EndDate: now}
+		for _, project := range spend.usage.Projects {
+			if project.ProjectID == budget.ProjectID.Hex() {
+				usage = project.UsageSummary
+			}
+		}
+		projects = []primitive.ObjectID{*budget.ProjectID}
+	}
+
+	actual := s.billingService.CalculateCost(ctx, &usage, plan, spend.org.BillingDay)
+
+	projected := usage
+	projected.EndDate = spend.periodEnd
+	for _, projectID := range projects {
+		forecast := s.forecast(ctx, spend, projectID, now)
+		projected.ParticipantMinutes += forecast.ParticipantMinutes
+		projected.EgressMinutes += forecast.EgressMinutes
+		projected.BandwidthGB += forecast.BandwidthGB
+		projected.APIRequests += forecast.APIRequests
+	}
+	forecast := s.billingService.CalculateCost(ctx, &projected, plan, spend.org.BillingDay)
+
+	return actual, math.Max(forecast, actual)
+}
+
+// forecast returns a project's forecast usage for the rest of the cycle.
+// Metrics without enough history for AnalyticsService.ForecastUsage are
+// extrapolated at their cycle-to-date daily rate.
+func (s *BudgetService) forecast(ctx context.Context, spend *orgSpend, projectID primitive.ObjectID, now time.Time) *models.UsageSummary {
+	if forecast, ok := spend.forecasts[projectID]; ok {
+		return forecast
+	}
+
+	var current models.UsageSummary
+	for _, project := range spend.usage.Projects {
+		if project.ProjectID == projectID.Hex() {
+			current = project.UsageSummary
+		}
+	}
+
+	remaining := spend.periodEnd.Sub(now).Hours() / 24
+	elapsed := now.Sub(spend.periodStart).Hours() / 24
+	days := int(math.Ceil(remaining))
+
+	forecast := &models.UsageSummary{ProjectID: projectID.Hex(), StartDate: now, EndDate: spend.periodEnd}
+	for _, metric := range forecastMetrics {
+		var predicted float64
+		if days > 0 && s.analyticsService != nil {
+			daily, err := s.analyticsService.ForecastUsage(ctx, projectID, metric, days)
+			if err == nil {
+				for _, day := range daily {
+					predicted += day.PredictedValue
+				}
+				// The last forecast day may fall partly past the cycle end
+				predicted *= remaining / float64(days)
+			} else if elapsed > 0 {
+				predicted = forecastRunRate(current, metric) / elapsed * remaining
+			}
+		}
+
+		switch metric {
+		case models.EventParticipantLeft:
+			forecast.ParticipantMinutes = predicted
+		case models.EventEgressEnded:
+			forecast.EgressMinutes = predicted
+		case models.EventBandwidthUsed:
+			forecast.BandwidthGB = predicted
+		case models.EventAPIRequest:
+			forecast.APIRequests = int64(math.Round(predicted))
+		}
+	}
+
+	spend.forecasts[projectID] = forecast
+	return forecast
+}
+
+// forecastRunRate returns a summary's usage of a forecast metric
+func forecastRunRate(usage models.UsageSummary, metric string) float64 {
+	switch metric {
+	case models.EventParticipantLeft:
+		return usage.ParticipantMinutes
+	case models.EventEgressEnded:
+		return usage.EgressMinutes
+	case models.EventBandwidthUsed:
+		return usage.BandwidthGB
+	case models.EventAPIRequest:
+		return float64(usage.APIRequests)
+	}
+	return 0
+}
+
+// newAlert builds an alert for a budget's current evaluation
+func (s *BudgetService) newAlert(budget *models.Budget, kind string, threshold int, capReached bool, now time.Time) models.BudgetAlert {
+	return models.BudgetAlert{
+		ID:            primitive.NewObjectID(),
+		BudgetID:      budget.ID,
+		OrgID:         budget.OrgID,
+		ProjectID:     budget.ProjectID,
+		Kind:          kind,
+		Threshold:     threshold,
+		Amount:        budget.Amount,
+		Spend:         budget.Spend,
+		ForecastSpend: budget.ForecastSpend,
+		Currency:      budget.Currency,
+		CapReached:    capReached,
+		PeriodStart:   budget.PeriodStart,
+		CreatedAt:     now,
+	}
+}
+
+// notify records an alert and delivers it by webhook and email. Delivery
+// failures are logged: the alert is recorded as sent either way, so a mail
+// outage does not repeat it every evaluation.
+func (s *BudgetService) notify(ctx context.Context, org *models.Organization, budget *models.Budget, alert *models.BudgetAlert) {
+	if _, err := s.db.Collection(models.BudgetAlert{}.TableName()).InsertOne(ctx, alert); err != nil {
+		log.Error().Err(err).Str("budget_id", budget.ID.Hex()).Msg("Failed to record budget alert")
+	}
+
+	event := models.WebhookEventBudgetThresholdReached
+	if alert.Kind == models.BudgetAlertForecast {
+		event = models.WebhookEventBudgetForecastExceeded
+	}
+	payload := &models.WebhookPayload{
+		Event: event,
+		Budget: &models.BudgetInfo{
+			BudgetID:      budget.ID.Hex(),
+			Threshold:     alert.Threshold,
+			Amount:        alert.Amount,
+			Spend:         alert.Spend,
+			ForecastSpend: alert.ForecastSpend,
+			Currency:      alert.Currency,
+			HardCap:       budget.HardCap,
+			CapReached:    alert.CapReached,
+			PeriodEnd:     budget.PeriodEnd.Unix(),
+		},
+	}
+	if budget.ProjectID != nil {
+		payload.Budget.ProjectID = budget.ProjectID.Hex()
+		s.eventBus.PublishAsync(*budget.ProjectID, payload)
+	} else {
+		s.eventBus.PublishToOrg(ctx, org.ID, payload)
+	}
+
+	if s.mailer == nil {
+		return
+	}
+	recipients := budget.NotifyEmails
+	if len(recipients) == 0 && org.AdminEmail != "" {
+		recipients = []string{org.AdminEmail}
+	}
+	if len(recipients) == 0 {
+		return
+	}
+	subject, body := budgetAlertEmail(org, budget, alert)
+	if err := s.mailer.Send(ctx, recipients, subject, body); err != nil {
+		log.Error().Err(err).Str("budget_id", budget.ID.Hex()).Msg("Failed to email budget alert")
+	}
+}
+
+// budgetAlertEmail writes the subject and body of an alert email
+func budgetAlertEmail(org *models.Organization, budget *models.Budget, alert *models.BudgetAlert) (string, string) {
+	scope := org.Name
+	if budget.ProjectID != nil {
+		scope = fmt.Sprintf("project %s of %s", budget.ProjectID.Hex(), org.Name)
+	}
+	money := func(amount float64) string {
+		return models.FormatMinorUnits(models.ToMinorUnits(amount, alert.Currency), alert.Currency)
+	}
+
+	var subject string
+	var body strings.Builder
+	switch {
+	case alert.Kind == models.BudgetAlertForecast:
+		subject = fmt.Sprintf("Spend for %s is forecast to exceed its budget", scope)
+		fmt.Fprintf(&body, "Spend for %s is forecast to reach %s by %s, over its budget of %s.\n",
+			scope, money(alert.ForecastSpend), budget.PeriodEnd.Format("2 Jan 2006"), money(alert.Amount))
+	case alert.CapReached:
+		subject = fmt.Sprintf("Spend for %s has reached its hard cap", scope)
+		fmt.Fprintf(&body, "Spend for %s has reached %s, its budget of %s.\n", scope, money(alert.Spend), money(alert.Amount))
+		fmt.Fprintf(&body, "New rooms, egress and ingress are blocked until %s. Raise or remove the budget to lift the cap.\n",
+			budget.PeriodEnd.Format("2 Jan 2006"))
+	default:
+		subject = fmt.Sprintf("Spend for %s has reached %d%% of its budget", scope, alert.Threshold)
+		fmt.Fprintf(&body, "Spend for %s has reached %s, %d%% of its budget of %s.\n",
+			scope, money(alert.Spend), alert.Threshold, money(alert.Amount))
+	}
+	fmt.Fprintf(&body, "\nSpend this billing cycle: %s\nForecast for the cycle: %s\n", money(alert.Spend), money(alert.ForecastSpend))
+	return subject, body.String()
+}
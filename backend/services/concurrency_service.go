@@ -0,0 +1,347 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"pulse-control-plane/models"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ConcurrencyLimitError is returned when an action would exceed a
+// concurrency limit
+type ConcurrencyLimitError struct {
+	Code       string `json:"code"`
+	Limit      string `json:"limit"`
+	Current    int    `json:"current"`
+	Max        int    `json:"max"`
+	RoomName   string `json:"room_name,omitempty"`
+	HTTPStatus int    `json:"-"`
+}
+
+func (e *ConcurrencyLimitError) Error() string {
+	return fmt.Sprintf("%s limit reached (%d of %d)", e.Limit, e.Current, e.Max)
+}
+
+// ConcurrencyService tracks live rooms, participants, egresses and ingresses
+// per project and enforces concurrency limits. Rooms and participants come
+// from LiveKit webhooks; egress and ingress counters move on state
+// transitions. A nil *ConcurrencyService tracks and enforces nothing.
+type ConcurrencyService struct {
+	db       *mongo.Database
+	rooms    *mongo.Collection
+	counters *mongo.Collection
+}
+
+// NewConcurrencyService creates a new concurrency service
+func NewConcurrencyService(db *mongo.Database) *ConcurrencyService {
+	return &ConcurrencyService{
+		db:       db,
+		rooms:    db.Collection(models.LiveRoom{}.TableName()),
+		counters: db.Collection(models.ConcurrencyCounter{}.TableName()),
+	}
+}
+
+// CheckRoomJoin rejects a new participant if the room is full, or if the room
+// is not live yet and the project is at its concurrent room limit
+func (s *ConcurrencyService) CheckRoomJoin(ctx context.Context, project *models.Project, roomName string) error {
+	if s == nil {
+		return nil
+	}
+
+	limits, err := s.GetLimits(ctx, project)
+	if err != nil {
+		log.Error().Err(err).Str("project_id", project.ID.Hex()).Msg("Failed to get concurrency limits, allowing request")
+		return nil
+	}
+
+	var room models.LiveRoom
+	err = s.rooms.FindOne(ctx, bson.M{"project_id": project.ID, "room_name": roomName}).Decode(&room)
+	switch {
+	case err == mongo.ErrNoDocuments:
+		if limits.MaxConcurrentRooms < 0 {
+			return nil
+		}
+		active, err := s.rooms.CountDocuments(ctx, bson.M{"project_id": project.ID})
+		if err != nil {
+			return fmt.Errorf("failed to count live rooms: %w", err)
+		}
+		if int(active) >= limits.MaxConcurrentRooms {
+			return concurrencyLimitError(models.ConcurrencyLimitRooms, int(active), limits.MaxConcurrentRooms, roomName)
+		}
+	case err != nil:
+		return fmt.Errorf("failed to get live room: %w", err)
+	default:
+		if limits.MaxParticipantsPerRoom >= 0 && len(room.Participants) >= limits.MaxParticipantsPerRoom {
+			return concurrencyLimitError(models.ConcurrencyLimitParticipantsPerRoom, len(room.Participants), limits.MaxParticipantsPerRoom, roomName)
+		}
+	}
+
+	return nil
+}
+
+// CheckEgress rejects a new egress if the project is at its concurrent egress limit
+func (s *ConcurrencyService) CheckEgress(ctx context.Context, project *models.Project) error {
+	if s == nil {
+		return nil
+	}
+	return s.checkCounter(ctx, project, models.ConcurrencyLimitEgresses)
+}
+
+// CheckIngress rejects a new ingress if the project is at its active ingress limit
+func (s *ConcurrencyService) CheckIngress(ctx context.Context, project *models.Project) error {
+	if s == nil {
+		return nil
+	}
+	return s.checkCounter(ctx, project, models.ConcurrencyLimitIngresses)
+}
+
+func (s *ConcurrencyService) checkCounter(ctx context.Context, project *models.Project, limit string) error {
+	limits, err := s.GetLimits(ctx, project)
+	if err != nil {
+		log.Error().Err(err).Str("project_id", project.ID.Hex()).Msg("Failed to get concurrency limits, allowing request")
+		return nil
+	}
+
+	counter, err := s.getCounter(ctx, project.ID)
+	if err != nil {
+		return err
+	}
+
+	current, max := counter.ActiveEgresses, limits.MaxConcurrentEgresses
+	if limit == models.ConcurrencyLimitIngresses {
+		current, max = counter.ActiveIngresses, limits.MaxActiveIngresses
+	}
+	if max >= 0 && current >= max {
+		return concurrencyLimitError(limit, current, max, "")
+	}
+	return nil
+}
+
+// RoomStarted records a room as live
+func (s *ConcurrencyService) RoomStarted(ctx context.Context, projectID primitive.ObjectID, roomName string) error {
+	if s == nil {
+		return nil
+	}
+	return s.upsertRoom(ctx, projectID, roomName, bson.M{})
+}
+
+// RoomEnded removes a room and its participants from the live set
+func (s *ConcurrencyService) RoomEnded(ctx context.Context, projectID primitive.ObjectID, roomName string) error {
+	if s == nil {
+		return nil
+	}
+	if _, err := s.rooms.DeleteOne(ctx, bson.M{"project_id": projectID, "room_name": roomName}); err != nil {
+		return fmt.Errorf("failed to remove live room: %w", err)
+	}
+	return nil
+}
+
+// ParticipantJoined adds a participant to a live room, creating the room if
+// its room_started webhook has not arrived yet
+func (s *ConcurrencyService) ParticipantJoined(ctx context.Context, projectID primitive.ObjectID, roomName, participantSID string) error {
+	if s == nil {
+		return nil
+	}
+	if participantSID == "" {
+		return s.upsertRoom(ctx, projectID, roomName, bson.M{})
+	}
+	return s.upsertRoom(ctx, projectID, roomName, bson.M{"$addToSet": bson.M{"participants": participantSID}})
+}
+
+// ParticipantLeft removes a participant from a live room
+func (s *ConcurrencyService) ParticipantLeft(ctx context.Context, projectID primitive.ObjectID, roomName, participantSID string) error {
+	if s == nil || participantSID == "" {
+		return nil
+	}
+	_, err := s.rooms.UpdateOne(ctx,
+		bson.M{"project_id": projectID, "room_name": roomName},
+		bson.M{
+			"$pull": bson.M{"participants": participantSID},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update live room: %w", err)
+	}
+	return nil
+}
+
+func (s *ConcurrencyService) upsertRoom(ctx context.Context, projectID primitive.ObjectID, roomName string, update bson.M) error {
+	now := time.Now()
+	update["$set"] = bson.M{"updated_at": now}
+	update["$setOnInsert"] = bson.M{"started_at": now}
+	if _, ok := update["$addToSet"]; !ok {
+		update["$setOnInsert"].(bson.M)["participants"] = []string{}
+	}
+
+	_, err := s.rooms.UpdateOne(ctx,
+		bson.M{"project_id": projectID, "room_name": roomName},
+		update,
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to upsert live room: %w", err)
+	}
+	return nil
+}
+
+// AdjustEgresses moves the project's active egress counter. Callers must only
+// adjust on an actual state transition so redelivered webhooks do not drift it.
+func (s *ConcurrencyService) AdjustEgresses(ctx context.Context, projectID primitive.ObjectID, delta int) {
+	if s == nil {
+		return
+	}
+	s.adjustCounter(ctx, projectID, "active_egresses", delta)
+}
+
+// AdjustIngresses moves the project's active ingress counter
+func (s *ConcurrencyService) AdjustIngresses(ctx context.Context, projectID primitive.ObjectID, delta int) {
+	if s == nil {
+		return
+	}
+	s.adjustCounter(ctx, projectID, "active_ingresses", delta)
+}
+
+func (s *ConcurrencyService) adjustCounter(ctx context.Context, projectID primitive.ObjectID, field string, delta int) {
+	_, err := s.counters.UpdateOne(ctx,
+		bson.M{"_id": projectID},
+		bson.M{
+			"$inc": bson.M{field: delta},
+			"$set": bson.M{"updated_at": time.Now()},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		// Counters are advisory; log and let Reconcile repair them
+		log.Error().Err(err).Str("project_id", projectID.Hex()).Str("counter", field).Msg("Failed to adjust concurrency counter")
+	}
+}
+
+// Reconcile recomputes a project's egress and ingress counters from the
+// egress and ingress records, repairing any drift
+func (s *ConcurrencyService) Reconcile(ctx context.Context, projectID primitive.ObjectID) error {
+	activeEgresses, err := s.db.Collection("egresses").CountDocuments(ctx, bson.M{
+		"project_id": projectID,
+		"status":     bson.M{"$in": []models.EgressStatus{models.EgressStatusPending, models.EgressStatusActive}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to count active egresses: %w", err)
+	}
+
+	activeIngresses, err := s.db.Collection("ingresses").CountDocuments(ctx, bson.M{
+		"project_id": projectID,
+		"status":     models.IngressStatusActive,
+		"deleted_at": nil,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to count active ingresses: %w", err)
+	}
+
+	_, err = s.counters.UpdateOne(ctx,
+		bson.M{"_id": projectID},
+		bson.M{"$set": bson.M{
+			"active_egresses":  activeEgresses,
+			"active_ingresses": activeIngresses,
+			"updated_at":       time.Now(),
+		}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to reconcile concurrency counters: %w", err)
+	}
+	return nil
+}
+
+// GetConcurrency returns the project's current concurrency and its limits
+func (s *ConcurrencyService) GetConcurrency(ctx context.Context, project *models.Project) (*models.ConcurrencyState, error) {
+	limits, err := s.GetLimits(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+
+	counter, err := s.getCounter(ctx, project.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := s.rooms.Find(ctx, bson.M{"project_id": project.ID}, options.Find().SetSort(bson.D{{Key: "started_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find live rooms: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rooms []models.LiveRoom
+	if err := cursor.All(ctx, &rooms); err != nil {
+		return nil, fmt.Errorf("failed to decode live rooms: %w", err)
+	}
+
+	state := &models.ConcurrencyState{
+		ProjectID:       project.ID.Hex(),
+		ActiveRooms:     len(rooms),
+		ActiveEgresses:  counter.ActiveEgresses,
+		ActiveIngresses: counter.ActiveIngresses,
+		Rooms:           make([]models.RoomConcurrency, 0, len(rooms)),
+		Limits:          limits,
+	}
+	for _, room := range rooms {
+		state.Rooms = append(state.Rooms, models.RoomConcurrency{
+			RoomName:     room.RoomName,
+			Participants: len(room.Participants),
+			StartedAt:    room.StartedAt,
+		})
+	}
+
+	return state, nil
+}
+
+// GetLimits returns the project's effective concurrency limits: the org's
+// plan with the project's overrides applied
+func (s *ConcurrencyService) GetLimits(ctx context.Context, project *models.Project) (models.ConcurrencyLimits, error) {
+	var org models.Organization
+	err := s.db.Collection(models.Organization{}.TableName()).FindOne(ctx, bson.M{"_id": project.OrgID, "is_deleted": false}).Decode(&org)
+	if err == mongo.ErrNoDocuments {
+		return models.ConcurrencyLimits{}, errors.New("organization not found")
+	}
+	if err != nil {
+		return models.ConcurrencyLimits{}, fmt.Errorf("failed to get organization: %w", err)
+	}
+
+	return project.ConcurrencyOverrides.Apply(models.GetPlanLimits(org.Plan).Concurrency), nil
+}
+
+func (s *ConcurrencyService) getCounter(ctx context.Context, projectID primitive.ObjectID) (*models.ConcurrencyCounter, error) {
+	var counter models.ConcurrencyCounter
+	err := s.counters.FindOne(ctx, bson.M{"_id": projectID}).Decode(&counter)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("failed to get concurrency counter: %w", err)
+	}
+
+	// A missed transition can push a counter below zero; never report that
+	if counter.ActiveEgresses < 0 {
+		counter.ActiveEgresses = 0
+	}
+	if counter.ActiveIngresses < 0 {
+		counter.ActiveIngresses = 0
+	}
+	return &counter, nil
+}
+
+func concurrencyLimitError(limit string, current, max int, roomName string) *ConcurrencyLimitError {
+	return &ConcurrencyLimitError{
+		Code:       "concurrency_limit_reached",
+		Limit:      limit,
+		Current:    current,
+		Max:        max,
+		RoomName:   roomName,
+		HTTPStatus: http.StatusTooManyRequests,
+	}
+}
@@ -0,0 +1,450 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"pulse-control-plane/models"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreditService keeps each organization's credit ledger: grants of purchased,
+// promotional and SLA credit, and the drawdowns that apply them to invoices.
+// Grant balances are only changed with conditional updates, so concurrent
+// invoices cannot spend the same credit twice.
+type CreditService struct {
+	db             *mongo.Database
+	pricingService *PricingService
+}
+
+// NewCreditService creates a new credit service
+func NewCreditService(db *mongo.Database, pricingService *PricingService) *CreditService {
+	return &CreditService{
+		db:             db,
+		pricingService: pricingService,
+	}
+}
+
+// PurchaseCredits grants what a payment the provider has confirmed paid as
+// prepaid credit. The payment ID makes the grant idempotent.
+func (s *CreditService) PurchaseCredits(ctx context.Context, orgID primitive.ObjectID, payment *ProviderPayment) (*models.CreditEntry, error) {
+	return s.grant(ctx, &models.CreditEntry{
+		OrgID:       orgID,
+		Type:        models.CreditTypePurchase,
+		Amount:      payment.Amount,
+		Currency:    payment.Currency,
+		GrantKey:    "purchase:" + payment.ID,
+		Reference:   payment.ID,
+		Description: "Prepaid credit",
+	})
+}
+
+// RedeemPromoCode grants the code's promotional credit to an organization.
+// Each organization can redeem a code once.
+func (s *CreditService) RedeemPromoCode(ctx context.Context, orgID primitive.ObjectID, code string) (*models.CreditEntry, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	now := time.Now()
+
+	// Claim a redemption first so MaxRedemptions holds under concurrency
+	filter := bson.M{
+		"code":      code,
+		"is_active": true,
+		"$and": bson.A{
+			bson.M{"$or": bson.A{bson.M{"redeem_by": bson.M{"$exists": false}}, bson.M{"redeem_by": bson.M{"$gt": now}}}},
+			bson.M{"$or": bson.A{bson.M{"max_redemptions": 0}, bson.M{"$expr": bson.M{"$lt": bson.A{"$redemptions", "$max_redemptions"}}}}},
+		},
+	}
+	var promo models.PromoCode
+	err := s.db.Collection(models.PromoCode{}.TableName()).FindOneAndUpdate(ctx, filter,
+		bson.M{"$inc": bson.M{"redemptions": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&promo)
+	if err == mongo.ErrNoDocuments {
+		return nil, errors.New("promo code is invalid or no longer available")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeem promo code: %w", err)
+	}
+
+	entry := &models.CreditEntry{
+		OrgID:       orgID,
+		Type:        models.CreditTypePromo,
+		Amount:      promo.Amount,
+		Currency:    promo.Currency,
+		GrantKey:    "promo:" + promo.Code,
+		Reference:   promo.Code,
+		Description: fmt.Sprintf("Promotional credit (%s)", promo.Code),
+	}
+	if promo.CreditValidDays > 0 {
+		expiresAt := now.AddDate(0, 0, promo.CreditValidDays)
+		entry.ExpiresAt = &expiresAt
+	}
+
+	granted, err := s.grant(ctx, entry)
+	if err != nil {
+		// Give the redemption back if this org had already used the code
+		s.db.Collection(models.PromoCode{}.TableName()).UpdateOne(ctx, bson.M{"_id": promo.ID}, bson.M{"$inc": bson.M{"redemptions": -1}})
+		return nil, err
+	}
+	return granted, nil
+}
+
+// IssueSLACredit grants SLA credit worth creditPercent of the organization's
+// monthly base fee for a non-compliant SLA metric. It is idempotent per
+// metric and a no-op for plans without a base fee.
+func (s *CreditService) IssueSLACredit(ctx context.Context, metric *models.SLAMetric) (*models.CreditEntry, error) {
+	if metric.CreditEarned <= 0 {
+		return nil, nil
+	}
+
+	_, plan, err := s.pricingService.ResolveOrgPlan(ctx, metric.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	amount := models.ToMinorUnits(plan.BasePrice*metric.CreditEarned/100, plan.Currency)
+	if amount <= 0 {
+		return nil, nil
+	}
+
+	return s.grant(ctx, &models.CreditEntry{
+		OrgID:       metric.OrgID,
+		Type:        models.CreditTypeSLA,
+		Amount:      amount,
+		Currency:    plan.Currency,
+		GrantKey:    "sla:" + metric.ID.Hex(),
+		Reference:   metric.ID.Hex(),
+		Description: fmt.Sprintf("SLA credit (%s to %s)", metric.PeriodStart.Format("2006-01-02"), metric.PeriodEnd.Format("2006-01-02")),
+	})
+}
+
+// grant inserts a grant entry with its full amount remaining
+func (s *CreditService) grant(ctx context.Context, entry *models.CreditEntry) (*models.CreditEntry, error) {
+	entry.Remaining = entry.Amount
+	entry.CreatedAt = time.Now()
+
+	result, err := s.db.Collection(models.CreditEntry{}.TableName()).InsertOne(ctx, entry)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, errors.New("credit has already been granted")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to grant credit: %w", err)
+	}
+	entry.ID = result.InsertedID.(primitive.ObjectID)
+
+	log.Info().
+		Str("org_id", entry.OrgID.Hex()).
+		Str("type", entry.Type).
+		Int64("amount", entry.Amount).
+		Str("currency", entry.Currency).
+		Msg("Credit granted")
+	return entry, nil
+}
+
+// GetBalance returns an organization's unexpired credit, expiring what is due
+func (s *CreditService) GetBalance(ctx context.Context, orgID primitive.ObjectID) (*models.CreditBalance, error) {
+	if err := s.ExpireCredits(ctx, orgID); err != nil {
+		return nil, err
+	}
+
+	grants, err := s.openGrants(ctx, orgID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	balance := &models.CreditBalance{
+		OrgID:    orgID.Hex(),
+		Balances: make(map[string]int64),
+		Grants:   grants,
+	}
+	for _, g := range grants {
+		balance.Balances[g.Currency] += g.Remaining
+	}
+	return balance, nil
+}
+
+// ListEntries returns an organization's ledger, newest first
+func (s *CreditService) ListEntries(ctx context.Context, orgID primitive.ObjectID, page, limit int) ([]models.CreditEntry, int64, error) {
+	collection := s.db.Collection(models.CreditEntry{}.TableName())
+	filter := bson.M{"org_id": orgID}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count credit entries: %w", err)
+	}
+
+	opts := options.Find().
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit)).
+		SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find credit entries: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	entries := []models.CreditEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode credit entries: %w", err)
+	}
+	return entries, total, nil
+}
+
+// ExpireCredits writes off what is left of grants past their expiry
+func (s *CreditService) ExpireCredits(ctx context.Context, orgID primitive.ObjectID) error {
+	collection := s.db.Collection(models.CreditEntry{}.TableName())
+	now := time.Now()
+
+	cursor, err := collection.Find(ctx, bson.M{
+		"org_id":     orgID,
+		"remaining":  bson.M{"$gt": 0},
+		"expires_at": bson.M{"$lte": now},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find expired credit: %w", err)
+	}
+	var expired []models.CreditEntry
+	if err := cursor.All(ctx, &expired); err != nil {
+		return fmt.Errorf("failed to decode expired credit: %w", err)
+	}
+
+	for _, g := range expired {
+		// Only the caller that zeroes the grant records the expiry
+		result, err := collection.UpdateOne(ctx,
+			bson.M{"_id": g.ID, "remaining": g.Remaining},
+			bson.M{"$set": bson.M{"remaining": int64(0)}},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to expire credit: %w", err)
+		}
+		if result.ModifiedCount == 0 {
+			continue
+		}
+		if err := s.debit(ctx, &g, models.CreditTypeExpiry, g.Remaining, nil, "Credit expired"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyCredits draws down up to amount, in the currency's minor units, of
+// the organization's credit in currency against an invoice, in
+// CreditDrawdownOrder, and returns one negative line item per grant used
+func (s *CreditService) ApplyCredits(ctx context.Context, orgID, invoiceID primitive.ObjectID, currency string, amount int64) ([]models.InvoiceLineItem, error) {
+	if s == nil || amount <= 0 {
+		return nil, nil
+	}
+	if err := s.ExpireCredits(ctx, orgID); err != nil {
+		return nil, err
+	}
+
+	grants, err := s.openGrants(ctx, orgID, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	collection := s.db.Collection(models.CreditEntry{}.TableName())
+	lineItems := []models.InvoiceLineItem{}
+	for i := range grants {
+		if amount <= 0 {
+			break
+		}
+		g := &grants[i]
+		take := g.Remaining
+		if take > amount {
+			take = amount
+		}
+
+		// Someone else may have drawn on the grant since we read it
+		result, err := collection.UpdateOne(ctx,
+			bson.M{"_id": g.ID, "remaining": bson.M{"$gte": take}},
+			bson.M{"$inc": bson.M{"remaining": -take}},
+		)
+		if err != nil {
+			return lineItems, fmt.Errorf("failed to draw down credit: %w", err)
+		}
+		if result.ModifiedCount == 0 {
+			continue
+		}
+		if err := s.debit(ctx, g, models.CreditTypeDrawdown, take, &invoiceID, g.Description); err != nil {
+			return lineItems, err
+		}
+
+		lineItems = append(lineItems, models.InvoiceLineItem{
+			Description: g.Description,
+			Quantity:    1,
+			Unit:        "credit",
+			UnitPrice:   -models.FromMinorUnits(take, currency),
+			Amount:      -take,
+		})
+		amount -= take
+	}
+
+	return lineItems, nil
+}
+
+// ReleaseInvoiceCredits returns the credit drawn down by an invoice, e.g.
+// when it is voided
+func (s *CreditService) ReleaseInvoiceCredits(ctx context.Context, invoiceID primitive.ObjectID) error {
+	if s == nil {
+		return nil
+	}
+	collection := s.db.Collection(models.CreditEntry{}.TableName())
+
+	cursor, err := collection.Find(ctx, bson.M{"invoice_id": invoiceID, "type": bson.M{"$in": bson.A{models.CreditTypeDrawdown, models.CreditTypeRelease}}})
+	if err != nil {
+		return fmt.Errorf("failed to find invoice credit: %w", err)
+	}
+	var entries []models.CreditEntry
+	if err := cursor.All(ctx, &entries); err != nil {
+		return fmt.Errorf("failed to decode invoice credit: %w", err)
+	}
+
+	// Net drawdown per grant, so releasing twice returns nothing more
+	owed := make(map[primitive.ObjectID]int64)
+	byGrant := make(map[primitive.ObjectID]models.CreditEntry)
+	for _, e := range entries {
+		owed[*e.GrantID] -= e.Amount
+		byGrant[*e.GrantID] = e
+	}
+
+	for grantID, amount := range owed {
+		if amount <= 0 {
+			continue
+		}
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": grantID}, bson.M{"$inc": bson.M{"remaining": amount}}); err != nil {
+			return fmt.Errorf("failed to release credit: %w", err)
+		}
+		e := byGrant[grantID]
+		release := models.CreditEntry{
+			OrgID:       e.OrgID,
+			Type:        models.CreditTypeRelease,
+			Amount:      amount,
+			Currency:    e.Currency,
+			GrantID:     &grantID,
+			InvoiceID:   &invoiceID,
+			Description: "Credit returned from voided invoice",
+			CreatedAt:   time.Now(),
+		}
+		if _, err := collection.InsertOne(ctx, release); err != nil {
+			return fmt.Errorf("failed to record credit release: %w", err)
+		}
+	}
+	return nil
+}
+
+// debit records amount leaving a grant
+func (s *CreditService) debit(ctx context.Context, g *models.CreditEntry, entryType string, amount int64, invoiceID *primitive.ObjectID, description string) error {
+	entry := models.CreditEntry{
+		OrgID:       g.OrgID,
+		Type:        entryType,
+		Amount:      -amount,
+		Currency:    g.Currency,
+		GrantID:     &g.ID,
+		InvoiceID:   invoiceID,
+		Reference:   g.Reference,
+		Description: description,
+		CreatedAt:   time.Now(),
+	}
+	if _, err := s.db.Collection(models.CreditEntry{}.TableName()).InsertOne(ctx, entry); err != nil {
+		return fmt.Errorf("failed to record credit %s: %w", entryType, err)
+	}
+	return nil
+}
+
+// openGrants returns grants with credit left, in drawdown order. An empty
+// currency returns all currencies.
+func (s *CreditService) openGrants(ctx context.Context, orgID primitive.ObjectID, currency string) ([]models.CreditEntry, error) {
+	filter := bson.M{
+		"org_id":    orgID,
+		"type":      bson.M{"$in": models.CreditDrawdownOrder},
+		"remaining": bson.M{"$gt": 0},
+	}
+	if currency != "" {
+		filter["currency"] = currency
+	}
+
+	cursor, err := s.db.Collection(models.CreditEntry{}.TableName()).Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find credit: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	grants := []models.CreditEntry{}
+	if err := cursor.All(ctx, &grants); err != nil {
+		return nil, fmt.Errorf("failed to decode credit: %w", err)
+	}
+
+	SortCreditGrants(grants)
+	return grants, nil
+}
+
+// SortCreditGrants orders grants for drawdown: by CreditDrawdownOrder, then
+// soonest expiry (non-expiring last), then oldest
+func SortCreditGrants(grants []models.CreditEntry) {
+	rank := make(map[string]int, len(models.CreditDrawdownOrder))
+	for i, t := range models.CreditDrawdownOrder {
+		rank[t] = i
+	}
+
+	sort.SliceStable(grants, func(i, j int) bool {
+		a, b := grants[i], grants[j]
+		if rank[a.Type] != rank[b.Type] {
+			return rank[a.Type] < rank[b.Type]
+		}
+		switch {
+		case a.ExpiresAt != nil && b.ExpiresAt == nil:
+			return true
+		case a.ExpiresAt == nil && b.ExpiresAt != nil:
+			return false
+		case a.ExpiresAt != nil && !a.ExpiresAt.Equal(*b.ExpiresAt):
+			return a.ExpiresAt.Before(*b.ExpiresAt)
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	})
+}
+
+// CreatePromoCode stores a new promo code
+func (s *CreditService) CreatePromoCode(ctx context.Context, promo *models.PromoCode) error {
+	promo.Code = strings.ToUpper(strings.TrimSpace(promo.Code))
+	if promo.Currency == "" {
+		promo.Currency = "USD"
+	}
+	promo.Redemptions = 0
+	promo.IsActive = true
+	promo.CreatedAt = time.Now()
+
+	result, err := s.db.Collection(models.PromoCode{}.TableName()).InsertOne(ctx, promo)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("promo code %q already exists", promo.Code)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create promo code: %w", err)
+	}
+	promo.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// ListPromoCodes lists promo codes, newest first
+func (s *CreditService) ListPromoCodes(ctx context.Context) ([]models.PromoCode, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := s.db.Collection(models.PromoCode{}.TableName()).Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find promo codes: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	promos := []models.PromoCode{}
+	if err := cursor.All(ctx, &promos); err != nil {
+		return nil, fmt.Errorf("failed to decode promo codes: %w", err)
+	}
+	return promos, nil
+}
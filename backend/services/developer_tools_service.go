@@ -3,11 +3,9 @@ package services
 import (
 	"archive/zip"
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"io"
 	"os/exec"
-	"path/filepath"
 
 	"github.com/rs/zerolog/log"
 )
@@ -194,7 +192,6 @@ func (s *DeveloperToolsService) generateGoSDK() ([]byte, error) {
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -2,143 +2,451 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"pulse-control-plane/database"
 	"pulse-control-plane/models"
 
+	"github.com/rs/zerolog/log"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrInvalidEgressRequest is returned for an egress request LiveKit cannot
+// run, e.g. a track egress without a track
+var ErrInvalidEgressRequest = errors.New("invalid egress request")
+
+// ErrAlreadyRecording is returned when a recording rule has already started
+// an egress for a room or track
+var ErrAlreadyRecording = errors.New("already recording")
+
 // EgressService handles egress operations
 type EgressService struct {
 	collection *mongo.Collection
 	cdnService *CDNService
+	quotaService *QuotaService
+	concurrencyService *ConcurrencyService
+	usageService *UsageService
+	egressClients *LiveKitEgressClients
+	encodingPresets *EncodingPresetService
 }
 
-// NewEgressService creates a new egress service
-func NewEgressService() *EgressService {
+// NewEgressService creates a new egress service. quotaService,
+// egressClients and encodingPresets may be nil for callers that never start
+// egresses, and usageService may be nil for callers that never end them.
+func NewEgressService(quotaService *QuotaService, concurrencyService *ConcurrencyService, usageService *UsageService, egressClients *LiveKitEgressClients, encodingPresets *EncodingPresetService) *EgressService {
 	return &EgressService{
 		collection: database.GetCollection("egresses"),
 		cdnService: NewCDNService(),
+		quotaService: quotaService,
+		concurrencyService: concurrencyService,
+		usageService: usageService,
+		egressClients: egressClients,
+		encodingPresets: encodingPresets,
 	}
 }
 
-// StartEgress starts a new egress session
+// StartEgress starts a new egress session on the LiveKit server of the
+// project's region. The egress stays pending until LiveKit reports it active,
+// in the start response or by webhook.
 func (s *EgressService) StartEgress(ctx context.Context, projectID primitive.ObjectID, project *models.Project, req *models.EgressRequest) (*models.Egress, error) {
+	return s.startEgress(ctx, projectID, project, req, nil, "")
+}
+
+// StartRuleEgress starts an egress for a recording rule. dedupKey names what
+// is being recorded; if the rule already has an egress for it,
+// ErrAlreadyRecording is returned.
+func (s *EgressService) StartRuleEgress(ctx context.Context, project *models.Project, rule *models.RecordingRule, req *models.EgressRequest, dedupKey string) (*models.Egress, error) {
+	return s.startEgress(ctx, project.ID, project, req, &rule.ID, dedupKey)
+}
+
+// startEgress starts an egress, started by a recording rule if ruleID is set
+func (s *EgressService) startEgress(ctx context.Context, projectID primitive.ObjectID, project *models.Project, req *models.EgressRequest, ruleID *primitive.ObjectID, dedupKey string) (*models.Egress, error) {
+	if err := validateEgressRequest(req); err != nil {
+		return nil, err
+	}
+	encoding, err := s.encodingPresets.ResolveEncoding(ctx, project, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.quotaService.Enforce(ctx, project, QuotaActionEgress); err != nil {
+		return nil, err
+	}
+	if err := s.concurrencyService.CheckEgress(ctx, project); err != nil {
+		return nil, err
+	}
+	client, err := s.egressClients.ForProject(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+
 	now := time.Now()
 	
+	// Build the LiveKit outputs, tracking each destination
+	outputs, infos := s.buildOutputs(project, req)
+	
 	// Create egress record
 	egress := &models.Egress{
 		ID: primitive.NewObjectID(),
 		ProjectID: projectID,
 		RoomName: req.RoomName,
 		EgressType: req.EgressType,
-		OutputType: req.OutputType,
+		SourceURL: req.URL,
+		OutputType: infos[0].Type,
+		OutputURL: infos[0].URL,
 		LayoutType: req.LayoutType,
+		Preset: req.Preset,
+		Encoding: encoding,
+		TemplateURL: req.TemplateURL,
 		Status: models.EgressStatusPending,
 		StorageBucket: project.StorageConfig.Bucket,
 		StorageRegion: project.StorageConfig.Region,
 		StorageAccessKey: project.StorageConfig.AccessKeyID,
 		StorageSecretKey: project.StorageConfig.SecretAccessKey,
+		Outputs: infos,
+		RuleID: ruleID,
+		DedupKey: dedupKey,
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
+	for _, info := range infos {
+		if egress.CDNPlaybackURL == "" {
+			egress.CDNPlaybackURL = info.CDNPlaybackURL
+		}
+		if egress.RTMPURL == "" && info.Type == models.OutputTypeRTMP {
+			egress.RTMPURL = info.URL
+		}
+	}
+	
+	// Save the pending egress first so its slot is held while LiveKit starts it
+	// A unique index on dedup_key lets one rule egress win per room or track
+	_, err = s.collection.InsertOne(ctx, egress)
+	if mongo.IsDuplicateKeyError(err) && dedupKey != "" {
+		return nil, ErrAlreadyRecording
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create egress: %w", err)
+	}
+	s.concurrencyService.AdjustEgresses(ctx, projectID, 1)
 	
-	// Generate output URL based on output type
-	var outputURL string
-	var err error
+	info, err := s.startLiveKitEgress(ctx, client, req, encoding, outputs)
+	if err != nil {
+		if _, updateErr := s.applyStatus(ctx, bson.M{"_id": egress.ID}, models.EgressStatusFailed, bson.M{"error": err.Error(), "ended_at": time.Now()}); updateErr != nil {
+			log.Error().Err(updateErr).Str("egress_id", egress.ID.Hex()).Msg("Failed to mark egress failed")
+		}
+		// Free the dedup key so a later event can retry the recording
+		if dedupKey != "" {
+			if _, updateErr := s.collection.UpdateOne(ctx, bson.M{"_id": egress.ID}, bson.M{"$unset": bson.M{"dedup_key": ""}}); updateErr != nil {
+				log.Error().Err(updateErr).Str("egress_id", egress.ID.Hex()).Msg("Failed to release egress dedup key")
+			}
+		}
+		return nil, err
+	}
 	
-	switch req.OutputType {
-	case models.OutputTypeHLS:
-		// Generate HLS output path
-		filename := req.Filename
-		if filename == "" {
-			filename = fmt.Sprintf("%s_%d", req.RoomName, time.Now().Unix())
+	status := liveKitEgressStatus(info.Status)
+	applyStreamResults(infos, info.StreamResults)
+	set := bson.M{"livekit_egress_id": info.EgressID, "outputs": infos}
+	if info.Error != "" {
+		set["error"] = info.Error
+	}
+	if status == models.EgressStatusActive {
+		startedAt := info.StartedAt.Time()
+		if startedAt == nil {
+			startedAt = &now
 		}
-		outputURL = fmt.Sprintf("s3://%s/hls/%s/%s.m3u8", 
-			egress.StorageBucket, 
-			egress.ProjectID.Hex(), 
-			filename)
-		
-		// Generate CDN playback URL
-		egress.CDNPlaybackURL = s.cdnService.GenerateHLSPlaybackURL(egress.ProjectID.Hex(), filename)
-		
-	case models.OutputTypeRTMP:
-		if req.RTMPURL == "" {
-			return nil, fmt.Errorf("rtmp_url is required for RTMP output")
+		set["started_at"] = *startedAt
+	}
+	if _, err := s.applyStatus(ctx, bson.M{"_id": egress.ID}, status, set); err != nil {
+		return nil, err
+	}
+	
+	return s.GetEgress(ctx, egress.ID)
+}
+
+// buildOutputs converts a request's outputs to LiveKit's, with the
+// destinations to track. Each RTMP URL is tracked on its own.
+func (s *EgressService) buildOutputs(project *models.Project, req *models.EgressRequest) (EgressOutputs, []models.EgressOutputInfo) {
+	var outputs EgressOutputs
+	var infos []models.EgressOutputInfo
+	projectID := project.ID.Hex()
+	
+	for _, output := range req.OutputList() {
+		bucket := project.StorageConfig.Bucket
+		upload := &S3Upload{
+			AccessKey: project.StorageConfig.AccessKeyID,
+			Secret: project.StorageConfig.SecretAccessKey,
+			Region: project.StorageConfig.Region,
+			Endpoint: project.StorageConfig.Endpoint,
+			Bucket: project.StorageConfig.Bucket,
+		}
+		if output.Storage != nil {
+			bucket = output.Storage.Bucket
+			upload = &S3Upload{
+				AccessKey: output.Storage.AccessKeyID,
+				Secret: output.Storage.SecretAccessKey,
+				Region: output.Storage.Region,
+				Endpoint: output.Storage.Endpoint,
+				Bucket: output.Storage.Bucket,
+			}
 		}
-		outputURL = req.RTMPURL
-		egress.RTMPURL = req.RTMPURL
+		// The CDN only fronts the project's own storage
+		useCDN := output.Storage == nil
 		
-	case models.OutputTypeFile:
-		// Generate file output path
-		filename := req.Filename
+		info := models.EgressOutputInfo{Type: output.Type, StorageBucket: bucket, Status: models.EgressStatusPending}
+		filename := output.Filename
 		if filename == "" {
-			filename = fmt.Sprintf("%s_%d.mp4", req.RoomName, time.Now().Unix())
+			filename = fmt.Sprintf("%s_%d", egressName(req), time.Now().Unix())
 		}
-		outputURL = fmt.Sprintf("s3://%s/recordings/%s/%s", 
-			egress.StorageBucket, 
-			egress.ProjectID.Hex(), 
-			filename)
 		
-		// Generate CDN URL for file
-		egress.CDNPlaybackURL = s.cdnService.GenerateFileURL(egress.ProjectID.Hex(), filename)
+		switch output.Type {
+		case models.OutputTypeHLS:
+			info.URL = fmt.Sprintf("s3://%s/hls/%s/%s.m3u8", bucket, projectID, filename)
+			if useCDN {
+				info.CDNPlaybackURL = s.cdnService.GenerateHLSPlaybackURL(projectID, filename)
+			}
+			outputs.SegmentOutputs = append(outputs.SegmentOutputs, &SegmentedFileOutput{
+				Protocol: "HLS_PROTOCOL",
+				FilenamePrefix: fmt.Sprintf("hls/%s/%s", projectID, filename),
+				PlaylistName: fmt.Sprintf("hls/%s/%s.m3u8", projectID, filename),
+				S3: upload,
+			})
+			
+		case models.OutputTypeRTMP:
+			outputs.StreamOutputs = append(outputs.StreamOutputs, &StreamOutput{Protocol: "RTMP", URLs: output.URLs})
+			for _, url := range output.URLs {
+				infos = append(infos, models.EgressOutputInfo{Type: models.OutputTypeRTMP, URL: url, Status: models.EgressStatusPending})
+			}
+			continue
+			
+		case models.OutputTypeFile:
+			if output.Filename == "" {
+				filename += ".mp4"
+			}
+			info.URL = fmt.Sprintf("s3://%s/recordings/%s/%s", bucket, projectID, filename)
+			if useCDN {
+				info.CDNPlaybackURL = s.cdnService.GenerateFileURL(projectID, filename)
+			}
+			outputs.FileOutputs = append(outputs.FileOutputs, &EncodedFileOutput{
+				FileType: "MP4",
+				Filepath: fmt.Sprintf("recordings/%s/%s", projectID, filename),
+				S3: upload,
+			})
+			
+		case models.OutputTypeImages:
+			interval := output.CaptureInterval
+			if interval <= 0 {
+				interval = defaultImageCaptureInterval
+			}
+			info.URL = fmt.Sprintf("s3://%s/images/%s/%s", bucket, projectID, filename)
+			outputs.ImageOutputs = append(outputs.ImageOutputs, &ImageOutput{
+				CaptureInterval: uint32(interval),
+				Width: int32(output.Width),
+				Height: int32(output.Height),
+				FilenamePrefix: fmt.Sprintf("images/%s/%s", projectID, filename),
+				S3: upload,
+			})
+		}
+		infos = append(infos, info)
 	}
 	
-	egress.OutputURL = outputURL
-	
-	// In a real implementation, this would call LiveKit Egress API
-	// For now, we'll simulate the egress creation
-	egress.LiveKitEgressID = fmt.Sprintf("EG_%s", primitive.NewObjectID().Hex())
-	egress.Status = models.EgressStatusActive
-	startTime := time.Now()
-	egress.StartedAt = &startTime
+	return outputs, infos
+}
+
+// defaultImageCaptureInterval is how often, in seconds, an images output
+// takes a snapshot unless the request says otherwise
+const defaultImageCaptureInterval = 10
+
+// startLiveKitEgress starts the LiveKit egress matching a request
+func (s *EgressService) startLiveKitEgress(ctx context.Context, client LiveKitEgressClient, req *models.EgressRequest, encoding *models.EncodingOptions, outputs EgressOutputs) (*LiveKitEgressInfo, error) {
+	audioOnly := encoding != nil && encoding.AudioOnly
 	
-	// Save to database
-	_, err = s.collection.InsertOne(ctx, egress)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create egress: %w", err)
+	switch req.EgressType {
+	case models.EgressTypeTrackComposite:
+		return client.StartTrackCompositeEgress(ctx, &TrackCompositeEgressRequest{
+			RoomName: req.RoomName,
+			AudioTrackID: req.AudioTrackID,
+			VideoTrackID: req.VideoTrackID,
+			Advanced: liveKitEncoding(encoding),
+			EgressOutputs: outputs,
+		})
+	case models.EgressTypeTrack:
+		file := outputs.FileOutputs[0]
+		return client.StartTrackEgress(ctx, &TrackEgressRequest{
+			RoomName: req.RoomName,
+			TrackID: req.TrackID,
+			File: &DirectFileOutput{Filepath: file.Filepath, S3: file.S3},
+		})
+	case models.EgressTypeWeb:
+		return client.StartWebEgress(ctx, &WebEgressRequest{
+			URL: req.URL,
+			AudioOnly: audioOnly,
+			Advanced: liveKitEncoding(encoding),
+			EgressOutputs: outputs,
+		})
+	default:
+		return client.StartRoomCompositeEgress(ctx, &RoomCompositeEgressRequest{
+			RoomName: req.RoomName,
+			Layout: liveKitLayout(req.LayoutType),
+			CustomBaseURL: req.TemplateURL,
+			AudioOnly: audioOnly,
+			Advanced: liveKitEncoding(encoding),
+			EgressOutputs: outputs,
+		})
+	}
+}
+
+// validateEgressRequest checks a request has the sources its egress type
+// needs and outputs LiveKit can run together
+func validateEgressRequest(req *models.EgressRequest) error {
+	outputs := req.OutputList()
+	if len(outputs) == 0 {
+		return fmt.Errorf("%w: output_type or outputs is required", ErrInvalidEgressRequest)
+	}
+	seen := make(map[models.OutputType]bool)
+	for _, output := range outputs {
+		switch output.Type {
+		case models.OutputTypeHLS, models.OutputTypeFile, models.OutputTypeImages:
+		case models.OutputTypeRTMP:
+			if len(output.URLs) == 0 {
+				return fmt.Errorf("%w: rtmp output needs at least one url", ErrInvalidEgressRequest)
+			}
+			if err := validateStreamURLs(output.URLs); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w: unknown output type %q", ErrInvalidEgressRequest, output.Type)
+		}
+		// LiveKit runs one output of each kind; RTMP destinations share one
+		if seen[output.Type] {
+			return fmt.Errorf("%w: only one %s output is allowed", ErrInvalidEgressRequest, output.Type)
+		}
+		seen[output.Type] = true
 	}
 	
-	return egress, nil
+	switch req.EgressType {
+	case models.EgressTypeWeb:
+		if req.URL == "" {
+			return fmt.Errorf("%w: url is required for web egress", ErrInvalidEgressRequest)
+		}
+		return nil
+	case models.EgressTypeTrack:
+		if req.TrackID == "" {
+			return fmt.Errorf("%w: track_id is required for track egress", ErrInvalidEgressRequest)
+		}
+		if len(outputs) != 1 || outputs[0].Type != models.OutputTypeFile {
+			return fmt.Errorf("%w: track egress only supports a single file output", ErrInvalidEgressRequest)
+		}
+	case models.EgressTypeTrackComposite:
+		if req.AudioTrackID == "" && req.VideoTrackID == "" {
+			return fmt.Errorf("%w: audio_track_id or video_track_id is required for track composite egress", ErrInvalidEgressRequest)
+		}
+	}
+	if req.RoomName == "" {
+		return fmt.Errorf("%w: room_name is required", ErrInvalidEgressRequest)
+	}
+	return nil
+}
+
+// validateStreamURLs checks each URL is an RTMP destination
+func validateStreamURLs(urls []string) error {
+	for _, url := range urls {
+		if !strings.HasPrefix(url, "rtmp://") && !strings.HasPrefix(url, "rtmps://") {
+			return fmt.Errorf("%w: %q is not an rtmp:// or rtmps:// url", ErrInvalidEgressRequest, url)
+		}
+	}
+	return nil
+}
+
+// egressName names an egress's output files after its room, or "web"
+func egressName(req *models.EgressRequest) string {
+	if req.RoomName == "" {
+		return "web"
+	}
+	return req.RoomName
+}
+
+// liveKitLayout maps a layout type to a LiveKit room composite layout
+func liveKitLayout(layout models.LayoutType) string {
+	switch layout {
+	case models.LayoutTypeGrid:
+		return "grid"
+	case models.LayoutTypeSingle:
+		return "single-speaker"
+	case models.LayoutTypeSpeaker:
+		return "speaker"
+	}
+	return ""
+}
+
+// liveKitEgressStatus maps a LiveKit egress status to ours. An ending
+// egress is still live until LiveKit finishes uploading its output.
+func liveKitEgressStatus(status string) models.EgressStatus {
+	switch status {
+	case LiveKitEgressActive, LiveKitEgressEnding:
+		return models.EgressStatusActive
+	case LiveKitEgressComplete:
+		return models.EgressStatusEnded
+	case LiveKitEgressFailed, LiveKitEgressAborted, LiveKitEgressLimitReached:
+		return models.EgressStatusFailed
+	}
+	return models.EgressStatusPending
 }
 
-// StopEgress stops an active egress session
-func (s *EgressService) StopEgress(ctx context.Context, egressID primitive.ObjectID) (*models.Egress, error) {
+// StopEgress asks LiveKit to stop a live egress of a project. It ends once
+// LiveKit has finished its output, which it reports in the stop response or
+// by webhook; an egress LiveKit no longer knows is ended straight away.
+func (s *EgressService) StopEgress(ctx context.Context, project *models.Project, egressID primitive.ObjectID) (*models.Egress, error) {
 	// Get egress
 	egress, err := s.GetEgress(ctx, egressID)
 	if err != nil {
 		return nil, err
 	}
+	if egress.ProjectID != project.ID {
+		return nil, fmt.Errorf("egress not found")
+	}
 	
-	if egress.Status != models.EgressStatusActive {
+	if !isLiveEgress(egress.Status) {
 		return nil, fmt.Errorf("egress is not active")
 	}
 	
-	// In a real implementation, this would call LiveKit Egress Stop API
-	// For now, we'll simulate stopping
+	status := models.EgressStatusEnded
+	var errorMsg string
+	if egress.LiveKitEgressID != "" {
+		client, err := s.egressClients.ForProject(ctx, project)
+		if err != nil {
+			return nil, err
+		}
+		info, err := client.StopEgress(ctx, egress.LiveKitEgressID)
+		var liveKitErr *LiveKitError
+		switch {
+		case errors.As(err, &liveKitErr) && (liveKitErr.Code == "not_found" || liveKitErr.Code == "failed_precondition"):
+			// Already gone on LiveKit's side
+		case err != nil:
+			return nil, err
+		default:
+			status = liveKitEgressStatus(info.Status)
+			errorMsg = info.Error
+		}
+	}
+	if isLiveEgress(status) {
+		return s.GetEgress(ctx, egressID)
+	}
 	
 	endTime := time.Now()
-	update := bson.M{
-		"$set": bson.M{
-			"status": models.EgressStatusEnded,
-			"ended_at": endTime,
-			"updated_at": time.Now(),
-		},
+	set := bson.M{"ended_at": endTime}
+	if errorMsg != "" {
+		set["error"] = errorMsg
 	}
-	
 	if egress.StartedAt != nil {
 		duration := endTime.Sub(*egress.StartedAt).Seconds()
-		update["$set"].(bson.M)["duration_seconds"] = int64(duration)
+		set["duration_seconds"] = int64(duration)
 	}
-	
-	_, err = s.collection.UpdateOne(ctx, bson.M{"_id": egressID}, update)
-	if err != nil {
+	if _, err := s.applyStatus(ctx, bson.M{"_id": egressID}, status, set); err != nil {
 		return nil, fmt.Errorf("failed to stop egress: %w", err)
 	}
 	
@@ -146,6 +454,238 @@ func (s *EgressService) StopEgress(ctx context.Context, egressID primitive.Objec
 	return s.GetEgress(ctx, egressID)
 }
 
+// UpdateLayout changes the layout of a live room composite egress
+func (s *EgressService) UpdateLayout(ctx context.Context, project *models.Project, egressID primitive.ObjectID, layout models.LayoutType) (*models.Egress, error) {
+	egress, err := s.GetEgress(ctx, egressID)
+	if err != nil {
+		return nil, err
+	}
+	if egress.ProjectID != project.ID {
+		return nil, fmt.Errorf("egress not found")
+	}
+	if egress.EgressType != models.EgressTypeRoomComposite {
+		return nil, fmt.Errorf("%w: only room composite egress has a layout", ErrInvalidEgressRequest)
+	}
+	if liveKitLayout(layout) == "" {
+		return nil, fmt.Errorf("%w: unknown layout %q", ErrInvalidEgressRequest, layout)
+	}
+	if !isLiveEgress(egress.Status) || egress.LiveKitEgressID == "" {
+		return nil, fmt.Errorf("egress is not active")
+	}
+	
+	client, err := s.egressClients.ForProject(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := client.UpdateLayout(ctx, egress.LiveKitEgressID, liveKitLayout(layout)); err != nil {
+		return nil, err
+	}
+	
+	_, err = s.collection.UpdateOne(ctx, bson.M{"_id": egressID}, bson.M{"$set": bson.M{"layout_type": layout, "updated_at": time.Now()}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update egress: %w", err)
+	}
+	return s.GetEgress(ctx, egressID)
+}
+
+// StopRuleEgresses stops the live egresses recording rules started in a
+// room, and frees their dedup keys so the room is recorded again if it
+// restarts. It returns the number of egresses stopped.
+func (s *EgressService) StopRuleEgresses(ctx context.Context, project *models.Project, roomName string) (int, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{
+		"project_id": project.ID,
+		"room_name": roomName,
+		"rule_id": bson.M{"$exists": true},
+		"status": bson.M{"$in": []models.EgressStatus{models.EgressStatusPending, models.EgressStatusActive}},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to find rule egresses: %w", err)
+	}
+	var egresses []models.Egress
+	if err := cursor.All(ctx, &egresses); err != nil {
+		return 0, fmt.Errorf("failed to decode rule egresses: %w", err)
+	}
+	
+	stopped := 0
+	for _, egress := range egresses {
+		if _, err := s.StopEgress(ctx, project, egress.ID); err != nil {
+			log.Error().Err(err).Str("egress_id", egress.ID.Hex()).Msg("Failed to stop rule egress")
+			continue
+		}
+		stopped++
+	}
+	
+	_, err = s.collection.UpdateMany(ctx,
+		bson.M{"project_id": project.ID, "room_name": roomName, "dedup_key": bson.M{"$exists": true}},
+		bson.M{"$unset": bson.M{"dedup_key": ""}})
+	if err != nil {
+		return stopped, fmt.Errorf("failed to release egress dedup keys: %w", err)
+	}
+	return stopped, nil
+}
+
+// AddParticipant records a participant that joined a room on the room's
+// live egresses, for the recordings they produce
+func (s *EgressService) AddParticipant(ctx context.Context, projectID primitive.ObjectID, roomName, identity string) error {
+	if identity == "" {
+		return nil
+	}
+	_, err := s.collection.UpdateMany(ctx,
+		bson.M{
+			"project_id": projectID,
+			"room_name": roomName,
+			"status": bson.M{"$in": []models.EgressStatus{models.EgressStatusPending, models.EgressStatusActive}},
+		},
+		bson.M{"$addToSet": bson.M{"participants": identity}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add egress participant: %w", err)
+	}
+	return nil
+}
+
+// AddStreamURLs starts streaming a live egress to more RTMP destinations
+func (s *EgressService) AddStreamURLs(ctx context.Context, project *models.Project, egressID primitive.ObjectID, urls []string) (*models.Egress, error) {
+	if err := validateStreamURLs(urls); err != nil {
+		return nil, err
+	}
+	return s.updateStream(ctx, project, egressID, urls, nil)
+}
+
+// RemoveStreamURLs stops streaming a live egress to some of its RTMP
+// destinations. The removed destinations stay listed as ended.
+func (s *EgressService) RemoveStreamURLs(ctx context.Context, project *models.Project, egressID primitive.ObjectID, urls []string) (*models.Egress, error) {
+	return s.updateStream(ctx, project, egressID, nil, urls)
+}
+
+// updateStream changes the RTMP destinations of a live egress's stream output
+func (s *EgressService) updateStream(ctx context.Context, project *models.Project, egressID primitive.ObjectID, add, remove []string) (*models.Egress, error) {
+	egress, err := s.GetEgress(ctx, egressID)
+	if err != nil {
+		return nil, err
+	}
+	if egress.ProjectID != project.ID {
+		return nil, fmt.Errorf("egress not found")
+	}
+	
+	outputs := egress.Outputs
+	if len(outputs) == 0 {
+		// Egresses started before outputs were tracked have a single output
+		outputs = []models.EgressOutputInfo{{Type: egress.OutputType, URL: egress.OutputURL, Status: egress.Status}}
+	}
+	
+	streaming := make(map[string]bool)
+	hasStream := false
+	for _, output := range outputs {
+		if output.Type == models.OutputTypeRTMP {
+			hasStream = true
+			streaming[output.URL] = streaming[output.URL] || isLiveEgress(output.Status)
+		}
+	}
+	if !hasStream {
+		return nil, fmt.Errorf("%w: egress has no rtmp output", ErrInvalidEgressRequest)
+	}
+	if !isLiveEgress(egress.Status) || egress.LiveKitEgressID == "" {
+		return nil, fmt.Errorf("egress is not active")
+	}
+	for _, url := range add {
+		if streaming[url] {
+			return nil, fmt.Errorf("%w: already streaming to %s", ErrInvalidEgressRequest, url)
+		}
+	}
+	for _, url := range remove {
+		if !streaming[url] {
+			return nil, fmt.Errorf("stream url not found")
+		}
+	}
+	
+	client, err := s.egressClients.ForProject(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	info, err := client.UpdateStream(ctx, egress.LiveKitEgressID, add, remove)
+	if err != nil {
+		return nil, err
+	}
+	
+	for _, url := range add {
+		outputs = append(outputs, models.EgressOutputInfo{Type: models.OutputTypeRTMP, URL: url, Status: models.EgressStatusPending})
+	}
+	applyStreamResults(outputs, info.StreamResults)
+	removed := make(map[string]bool)
+	for _, url := range remove {
+		removed[url] = true
+	}
+	for i := range outputs {
+		if outputs[i].Type == models.OutputTypeRTMP && isLiveEgress(outputs[i].Status) && removed[outputs[i].URL] {
+			outputs[i].Status = models.EgressStatusEnded
+		}
+	}
+	
+	_, err = s.collection.UpdateOne(ctx, bson.M{"_id": egressID}, bson.M{"$set": bson.M{"outputs": outputs, "updated_at": time.Now()}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update egress: %w", err)
+	}
+	return s.GetEgress(ctx, egressID)
+}
+
+// applyStreamResults sets the status of live RTMP destinations from LiveKit's
+// stream results. LiveKit redacts stream keys, so a result whose URL matches
+// no destination exactly goes to the first with the same URL up to the key.
+func applyStreamResults(outputs []models.EgressOutputInfo, results []LiveKitEgressStreamInfo) {
+	matched := make([]bool, len(outputs))
+	for _, result := range results {
+		match := -1
+		for i, output := range outputs {
+			if matched[i] || output.Type != models.OutputTypeRTMP || !isLiveEgress(output.Status) {
+				continue
+			}
+			if output.URL == result.URL {
+				match = i
+				break
+			}
+			if match < 0 && streamURLBase(output.URL) == streamURLBase(result.URL) {
+				match = i
+			}
+		}
+		if match < 0 {
+			continue
+		}
+		matched[match] = true
+		outputs[match].Status = liveKitStreamStatus(result.Status)
+		outputs[match].Error = result.Error
+	}
+}
+
+// liveKitStreamStatus maps a LiveKit stream result status to ours
+func liveKitStreamStatus(status string) models.EgressStatus {
+	switch status {
+	case "ACTIVE":
+		return models.EgressStatusActive
+	case "FINISHED":
+		return models.EgressStatusEnded
+	case "FAILED":
+		return models.EgressStatusFailed
+	}
+	return models.EgressStatusPending
+}
+
+// streamURLBase strips the stream key from an RTMP URL
+func streamURLBase(url string) string {
+	if i := strings.LastIndex(url, "/"); i > len("rtmps://") {
+		return url[:i]
+	}
+	return url
+}
+
+// redactStreamURL hides the stream key of an RTMP URL
+func redactStreamURL(url string) string {
+	if base := streamURLBase(url); base != url {
+		return base + "/{redacted}"
+	}
+	return url
+}
+
 // GetEgress retrieves an egress by ID
 func (s *EgressService) GetEgress(ctx context.Context, egressID primitive.ObjectID) (*models.Egress, error) {
 	var egress models.Egress
@@ -191,32 +731,143 @@ func (s *EgressService) ListEgresses(ctx context.Context, projectID primitive.Ob
 
 // UpdateEgressStatus updates the status of an egress (called by webhooks)
 func (s *EgressService) UpdateEgressStatus(ctx context.Context, liveKitEgressID string, status models.EgressStatus, errorMsg string) error {
-	update := bson.M{
-		"$set": bson.M{
-			"status": status,
-			"updated_at": time.Now(),
-		},
+	set := bson.M{}
+	if errorMsg != "" {
+		set["error"] = errorMsg
 	}
 	
-	if errorMsg != "" {
-		update["$set"].(bson.M)["error"] = errorMsg
+	switch status {
+	case models.EgressStatusActive:
+		// Record when LiveKit first confirmed it, keeping that on redelivery
+		_, err := s.collection.UpdateOne(ctx,
+			bson.M{
+				"livekit_egress_id": liveKitEgressID,
+				"started_at":        bson.M{"$exists": false},
+				"status":            bson.M{"$nin": bson.A{models.EgressStatusEnded, models.EgressStatusFailed}},
+			},
+			bson.M{"$set": bson.M{"started_at": time.Now()}})
+		if err != nil {
+			return fmt.Errorf("failed to update egress status: %w", err)
+		}
+	case models.EgressStatusEnded, models.EgressStatusFailed:
+		set["ended_at"] = time.Now()
 	}
 	
-	if status == models.EgressStatusEnded {
-		endTime := time.Now()
-		update["$set"].(bson.M)["ended_at"] = endTime
+	_, err := s.applyStatus(ctx, bson.M{"livekit_egress_id": liveKitEgressID}, status, set)
+	return err
+}
+
+// applyStatus sets an egress's status with other fields and moves the live
+// egress counter on a real transition, so redelivered updates are no-ops. An
+// egress that has ended or failed is never moved back to a live status, so a
+// late "active" update is a no-op too. It returns the egress as it was, or
+// nil if none matched.
+func (s *EgressService) applyStatus(ctx context.Context, filter bson.M, status models.EgressStatus, set bson.M) (*models.Egress, error) {
+	if !isTerminalEgress(status) {
+		filter["status"] = bson.M{"$nin": bson.A{models.EgressStatusEnded, models.EgressStatusFailed}}
 	}
+	set["status"] = status
+	set["updated_at"] = time.Now()
 	
-	_, err := s.collection.UpdateOne(ctx, bson.M{"livekit_egress_id": liveKitEgressID}, update)
+	var previous models.Egress
+	err := s.collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": set}).Decode(&previous)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
 	if err != nil {
-		return fmt.Errorf("failed to update egress status: %w", err)
+		return nil, fmt.Errorf("failed to update egress status: %w", err)
 	}
 	
+	errorMsg, _ := set["error"].(string)
+	if err := s.settleOutputs(ctx, previous.ID, status, errorMsg); err != nil {
+		return nil, err
+	}
+	
+	wasLive, isLive := isLiveEgress(previous.Status), isLiveEgress(status)
+	if wasLive && !isLive {
+		s.concurrencyService.AdjustEgresses(ctx, previous.ProjectID, -1)
+		endedAt, _ := set["ended_at"].(time.Time)
+		s.meterEgress(ctx, &previous, endedAt)
+	} else if !wasLive && isLive {
+		s.concurrencyService.AdjustEgresses(ctx, previous.ProjectID, 1)
+	}
+	
+	return &previous, nil
+}
+
+// meterEgress records the minutes an egress ran, from when LiveKit started it
+// until it ended. The egress ID is the idempotency key, so an end reported by
+// both the stop response and a webhook is counted once.
+func (s *EgressService) meterEgress(ctx context.Context, egress *models.Egress, endedAt time.Time) {
+	if s.usageService == nil || egress.StartedAt == nil {
+		return
+	}
+	if endedAt.IsZero() {
+		endedAt = time.Now()
+	}
+	minutes := endedAt.Sub(*egress.StartedAt).Minutes()
+	if minutes <= 0 {
+		return
+	}
+	
+	if err := s.usageService.TrackEgressMinutes(ctx, egress.ProjectID, egress.ID.Hex(), egress.RoomName, minutes); err != nil {
+		log.Error().Err(err).Str("egress_id", egress.ID.Hex()).Msg("Failed to track egress minutes")
+	}
+}
+
+// settleOutputs moves the outputs of an egress that have no status of their
+// own yet along with the egress: to active when it starts, and to its final
+// status when it ends
+func (s *EgressService) settleOutputs(ctx context.Context, egressID primitive.ObjectID, status models.EgressStatus, errorMsg string) error {
+	var from []models.EgressStatus
+	switch status {
+	case models.EgressStatusActive:
+		from = []models.EgressStatus{models.EgressStatusPending}
+	case models.EgressStatusEnded, models.EgressStatusFailed:
+		from = []models.EgressStatus{models.EgressStatusPending, models.EgressStatusActive}
+	default:
+		return nil
+	}
+	
+	set := bson.M{"outputs.$[live].status": status}
+	if status == models.EgressStatusFailed && errorMsg != "" {
+		set["outputs.$[live].error"] = errorMsg
+	}
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"live.status": bson.M{"$in": from}}},
+	})
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": egressID, "outputs.status": bson.M{"$in": from}}, bson.M{"$set": set}, opts)
+	if err != nil {
+		return fmt.Errorf("failed to update egress outputs: %w", err)
+	}
 	return nil
 }
 
+// isTerminalEgress reports whether an egress in this status has finished
+func isTerminalEgress(status models.EgressStatus) bool {
+	return status == models.EgressStatusEnded || status == models.EgressStatusFailed
+}
+
+// isLiveEgress reports whether an egress in this status holds a concurrency slot
+func isLiveEgress(status models.EgressStatus) bool {
+	return status == models.EgressStatusPending || status == models.EgressStatusActive
+}
+
 // ToResponse converts Egress to EgressResponse (safe for API)
 func (s *EgressService) ToResponse(egress *models.Egress) *models.EgressResponse {
+	var ruleID string
+	if egress.RuleID != nil {
+		ruleID = egress.RuleID.Hex()
+	}
+	
+	outputs := make([]models.EgressOutputInfo, len(egress.Outputs))
+	for i, output := range egress.Outputs {
+		if output.Type == models.OutputTypeRTMP {
+			output.URL = redactStreamURL(output.URL)
+		}
+		outputs[i] = output
+	}
+	
 	return &models.EgressResponse{
 		ID: egress.ID.Hex(),
 		ProjectID: egress.ProjectID.Hex(),
@@ -224,9 +875,14 @@ func (s *EgressService) ToResponse(egress *models.Egress) *models.EgressResponse
 		EgressType: egress.EgressType,
 		OutputType: egress.OutputType,
 		LayoutType: egress.LayoutType,
+		RuleID: ruleID,
+		Preset: egress.Preset,
+		Encoding: egress.Encoding,
+		TemplateURL: egress.TemplateURL,
 		Status: egress.Status,
 		Error: egress.Error,
 		CDNPlaybackURL: egress.CDNPlaybackURL,
+		Outputs: outputs,
 		DurationSeconds: egress.DurationSeconds,
 		FileSizeBytes: egress.FileSizeBytes,
 		StartedAt: egress.StartedAt,
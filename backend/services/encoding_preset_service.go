@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+
+	"pulse-control-plane/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrEncodingPresetNotFound is returned for a preset name that is neither
+	// built in nor one of the project's
+	ErrEncodingPresetNotFound = errors.New("encoding preset not found")
+
+	// ErrEncodingNotAllowed is returned for an encoding or layout template
+	// the organization's plan does not include
+	ErrEncodingNotAllowed = errors.New("plan restriction")
+)
+
+// EncodingPresetService manages per-project encoding presets and resolves
+// the encoding of egress requests against the organization's plan
+type EncodingPresetService struct {
+	db *mongo.Database
+}
+
+// NewEncodingPresetService creates a new encoding preset service
+func NewEncodingPresetService(db *mongo.Database) *EncodingPresetService {
+	return &EncodingPresetService{db: db}
+}
+
+// ListPresets lists the built-in presets followed by the project's own
+func (s *EncodingPresetService) ListPresets(ctx context.Context, projectID primitive.ObjectID) ([]*models.EncodingPreset, error) {
+	names := make([]string, 0, len(models.BuiltinEncodingPresets))
+	for name := range models.BuiltinEncodingPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	presets := make([]*models.EncodingPreset, 0, len(names))
+	for _, name := range names {
+		presets = append(presets, builtinPreset(name))
+	}
+
+	cursor, err := s.db.Collection(models.EncodingPreset{}.TableName()).Find(ctx,
+		bson.M{"project_id": projectID},
+		options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find encoding presets: %w", err)
+	}
+	var custom []*models.EncodingPreset
+	if err := cursor.All(ctx, &custom); err != nil {
+		return nil, fmt.Errorf("failed to decode encoding presets: %w", err)
+	}
+	return append(presets, custom...), nil
+}
+
+// GetPreset returns a built-in preset or one of the project's
+func (s *EncodingPresetService) GetPreset(ctx context.Context, projectID primitive.ObjectID, name string) (*models.EncodingPreset, error) {
+	if _, ok := models.BuiltinEncodingPresets[name]; ok {
+		return builtinPreset(name), nil
+	}
+
+	var preset models.EncodingPreset
+	err := s.db.Collection(models.EncodingPreset{}.TableName()).FindOne(ctx, bson.M{"project_id": projectID, "name": name}).Decode(&preset)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrEncodingPresetNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find encoding preset: %w", err)
+	}
+	return &preset, nil
+}
+
+// SavePreset creates or replaces a project preset. Its options must be
+// within the organization's plan.
+func (s *EncodingPresetService) SavePreset(ctx context.Context, project *models.Project, input *models.EncodingPresetInput) (*models.EncodingPreset, error) {
+	if err := input.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidEgressRequest, err)
+	}
+	limits, err := s.planLimits(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	if err := limits.Encoding.Allows(&input.Options); err != nil {
+		return nil, fmt.Errorf("%w: %s are not included in the %s plan", ErrEncodingNotAllowed, err, limits.PlanName)
+	}
+
+	now := time.Now()
+	var preset models.EncodingPreset
+	err = s.db.Collection(models.EncodingPreset{}.TableName()).FindOneAndUpdate(ctx,
+		bson.M{"project_id": project.ID, "name": input.Name},
+		bson.M{
+			"$set": bson.M{
+				"description": input.Description,
+				"options":     input.Options,
+				"updated_at":  now,
+			},
+			"$setOnInsert": bson.M{"created_at": now},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&preset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save encoding preset: %w", err)
+	}
+	return &preset, nil
+}
+
+// DeletePreset deletes a project preset. Egresses already using it keep
+// their encoding.
+func (s *EncodingPresetService) DeletePreset(ctx context.Context, projectID primitive.ObjectID, name string) error {
+	if _, ok := models.BuiltinEncodingPresets[name]; ok {
+		return fmt.Errorf("%w: built-in presets cannot be deleted", ErrInvalidEgressRequest)
+	}
+	result, err := s.db.Collection(models.EncodingPreset{}.TableName()).DeleteOne(ctx, bson.M{"project_id": projectID, "name": name})
+	if err != nil {
+		return fmt.Errorf("failed to delete encoding preset: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrEncodingPresetNotFound
+	}
+	return nil
+}
+
+// ResolveEncoding returns the encoding options of an egress request, from
+// its preset or custom options, or nil for LiveKit's defaults. The options
+// and any layout template must be included in the organization's plan.
+func (s *EncodingPresetService) ResolveEncoding(ctx context.Context, project *models.Project, req *models.EgressRequest) (*models.EncodingOptions, error) {
+	if req.Preset == "" && req.Encoding == nil && req.TemplateURL == "" {
+		return nil, nil
+	}
+	if s == nil {
+		return nil, errors.New("encoding presets are not available")
+	}
+
+	if req.Preset != "" && req.Encoding != nil {
+		return nil, fmt.Errorf("%w: set preset or encoding, not both", ErrInvalidEgressRequest)
+	}
+	if req.TemplateURL != "" {
+		if req.EgressType != models.EgressTypeRoomComposite {
+			return nil, fmt.Errorf("%w: layout templates are for room composite egress", ErrInvalidEgressRequest)
+		}
+		if u, err := url.Parse(req.TemplateURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return nil, fmt.Errorf("%w: template_url must be an http or https url", ErrInvalidEgressRequest)
+		}
+	}
+
+	var encoding *models.EncodingOptions
+	switch {
+	case req.Preset != "":
+		preset, err := s.GetPreset(ctx, project.ID, req.Preset)
+		if err != nil {
+			return nil, err
+		}
+		encoding = &preset.Options
+	case req.Encoding != nil:
+		if err := req.Encoding.Validate(); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidEgressRequest, err)
+		}
+		encoding = req.Encoding
+	}
+	if encoding != nil && req.EgressType == models.EgressTypeTrack {
+		return nil, fmt.Errorf("%w: track egress is not transcoded", ErrInvalidEgressRequest)
+	}
+
+	limits, err := s.planLimits(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	if encoding != nil {
+		if err := limits.Encoding.Allows(encoding); err != nil {
+			return nil, fmt.Errorf("%w: %s are not included in the %s plan", ErrEncodingNotAllowed, err, limits.PlanName)
+		}
+	}
+	if req.TemplateURL != "" && !limits.Encoding.CustomTemplates {
+		return nil, fmt.Errorf("%w: custom layout templates are not included in the %s plan", ErrEncodingNotAllowed, limits.PlanName)
+	}
+	return encoding, nil
+}
+
+// planLimits returns the limits of the project's organization's plan
+func (s *EncodingPresetService) planLimits(ctx context.Context, project *models.Project) (models.PlanLimits, error) {
+	var org models.Organization
+	err := s.db.Collection(models.Organization{}.TableName()).FindOne(ctx, bson.M{"_id": project.OrgID, "is_deleted": false}).Decode(&org)
+	if err == mongo.ErrNoDocuments {
+		return models.PlanLimits{}, errors.New("organization not found")
+	}
+	if err != nil {
+		return models.PlanLimits{}, fmt.Errorf("failed to get organization: %w", err)
+	}
+	return org.LimitOverrides.Apply(models.GetPlanLimits(org.Plan)), nil
+}
+
+// builtinPreset returns a built-in preset by name
+func builtinPreset(name string) *models.EncodingPreset {
+	return &models.EncodingPreset{
+		Name:    name,
+		Options: models.BuiltinEncodingPresets[name],
+		Builtin: true,
+	}
+}
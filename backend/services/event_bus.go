@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"pulse-control-plane/models"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// EventHandler is called for every event published on the bus
+type EventHandler func(ctx context.Context, project *models.Project, payload *models.WebhookPayload)
+
+// EventBus routes control-plane and media events to in-process subscribers
+// and to the project's customer webhook via the WebhookService pipeline
+type EventBus struct {
+	db             *mongo.Database
+	webhookService *WebhookService
+
+	mu          sync.RWMutex
+	subscribers map[models.WebhookEventType][]EventHandler
+}
+
+// NewEventBus creates a new event bus
+func NewEventBus(db *mongo.Database, webhookService *WebhookService) *EventBus {
+	return &EventBus{
+		db:             db,
+		webhookService: webhookService,
+		subscribers:    make(map[models.WebhookEventType][]EventHandler),
+	}
+}
+
+// Subscribe registers a handler for an event type
+func (b *EventBus) Subscribe(eventType models.WebhookEventType, handler EventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscribers[eventType] = append(b.subscribers[eventType], handler)
+}
+
+// Publish delivers an event for a project to subscribers and the customer webhook.
+// A nil bus is a no-op so services can be constructed without one.
+func (b *EventBus) Publish(ctx context.Context, projectID primitive.ObjectID, payload *models.WebhookPayload) error {
+	if b == nil {
+		return nil
+	}
+
+	var project models.Project
+	err := b.db.Collection(models.Project{}.TableName()).FindOne(ctx, bson.M{
+		"_id":        projectID,
+		"is_deleted": false,
+	}).Decode(&project)
+	if err != nil {
+		return fmt.Errorf("failed to find project for event: %w", err)
+	}
+
+	payload.ProjectID = projectID.Hex()
+	if payload.Timestamp == 0 {
+		payload.Timestamp = time.Now().Unix()
+	}
+
+	b.mu.RLock()
+	handlers := b.subscribers[payload.Event]
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(ctx, &project, payload)
+	}
+
+	if err := b.webhookService.SendWebhook(ctx, &project, payload); err != nil {
+		return fmt.Errorf("failed to send webhook: %w", err)
+	}
+
+	return nil
+}
+
+// PublishAsync publishes an event without blocking the caller.
+// Failures are logged since there is no caller left to handle them.
+func (b *EventBus) PublishAsync(projectID primitive.ObjectID, payload *models.WebhookPayload) {
+	if b == nil {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := b.Publish(ctx, projectID, payload); err != nil {
+			log.Error().Err(err).
+				Str("project_id", projectID.Hex()).
+				Str("event", string(payload.Event)).
+				Msg("Failed to publish event")
+		}
+	}()
+}
+
+// PublishToOrg publishes an organization-level event to each of the
+// organization's projects without blocking the caller
+func (b *EventBus) PublishToOrg(ctx context.Context, orgID primitive.ObjectID, payload *models.WebhookPayload) {
+	if b == nil {
+		return
+	}
+
+	cursor, err := b.db.Collection(models.Project{}.TableName()).Find(ctx, bson.M{
+		"org_id":     orgID,
+		"is_deleted": false,
+	})
+	if err != nil {
+		log.Error().Err(err).Str("org_id", orgID.Hex()).Msg("Failed to list projects for event")
+		return
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var project models.Project
+		if err := cursor.Decode(&project); err != nil {
+			continue
+		}
+		// Each project gets its own copy since Publish stamps the project ID
+		projectPayload := *payload
+		b.PublishAsync(project.ID, &projectPayload)
+	}
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"pulse-control-plane/models"
+)
+
+// ErrExchangeRateUnavailable is returned when a rate source has no rate for
+// a currency pair
+var ErrExchangeRateUnavailable = errors.New("exchange rate unavailable")
+
+// ExchangeRateSource supplies the exchange rates invoices are converted at
+type ExchangeRateSource interface {
+	// Rate returns the units of to per unit of from
+	Rate(ctx context.Context, from, to string) (models.ExchangeRateSnapshot, error)
+}
+
+// exchangeRateTable is a set of rates against one base currency, in the
+// format of rate files and of openexchangerates.org-style endpoints:
+//
+//	{"base": "USD", "as_of": "2025-01-31T00:00:00Z", "rates": {"INR": 83.1, "EUR": 0.92}}
+type exchangeRateTable struct {
+	Base      string             `json:"base"`
+	AsOf      time.Time          `json:"as_of"`
+	Timestamp int64              `json:"timestamp"` // unix seconds, used if as_of is absent
+	Rates     map[string]float64 `json:"rates"`
+}
+
+// parseExchangeRateTable decodes and normalizes a rate table
+func parseExchangeRateTable(data []byte) (*exchangeRateTable, error) {
+	var table exchangeRateTable
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("failed to parse exchange rates: %w", err)
+	}
+	if table.Base == "" {
+		return nil, errors.New("exchange rates have no base currency")
+	}
+
+	table.Base = strings.ToUpper(table.Base)
+	rates := make(map[string]float64, len(table.Rates)+1)
+	for currency, rate := range table.Rates {
+		if rate <= 0 {
+			return nil, fmt.Errorf("exchange rate for %s must be positive", currency)
+		}
+		rates[strings.ToUpper(currency)] = rate
+	}
+	rates[table.Base] = 1
+	table.Rates = rates
+
+	if table.AsOf.IsZero() && table.Timestamp > 0 {
+		table.AsOf = time.Unix(table.Timestamp, 0).UTC()
+	}
+	return &table, nil
+}
+
+// rate returns the cross rate between two currencies of the table
+func (t *exchangeRateTable) rate(from, to, source string) (models.ExchangeRateSnapshot, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	fromRate, ok := t.Rates[from]
+	if !ok {
+		return models.ExchangeRateSnapshot{}, fmt.Errorf("%w: %s", ErrExchangeRateUnavailable, from)
+	}
+	toRate, ok := t.Rates[to]
+	if !ok {
+		return models.ExchangeRateSnapshot{}, fmt.Errorf("%w: %s", ErrExchangeRateUnavailable, to)
+	}
+
+	return models.ExchangeRateSnapshot{
+		From:   from,
+		To:     to,
+		Rate:   toRate / fromRate,
+		Source: source,
+		AsOf:   t.AsOf,
+	}, nil
+}
+
+// NewExchangeRateSource returns the configured rate source: a rate file if
+// path is set, otherwise an HTTP endpoint if url is set, otherwise nil
+func NewExchangeRateSource(path, url string, ttl time.Duration) (ExchangeRateSource, error) {
+	if path != "" {
+		return NewStaticRateSource(path)
+	}
+	if url != "" {
+		return NewHTTPRateSource(url, ttl), nil
+	}
+	return nil, nil
+}
+
+// StaticRateSource serves rates from a JSON file loaded once, for tests and
+// deployments that publish their own rates
+type StaticRateSource struct {
+	path  string
+	table *exchangeRateTable
+}
+
+// NewStaticRateSource loads a rate file
+func NewStaticRateSource(path string) (*StaticRateSource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exchange rates: %w", err)
+	}
+	table, err := parseExchangeRateTable(data)
+	if err != nil {
+		return nil, err
+	}
+	return &StaticRateSource{path: path, table: table}, nil
+}
+
+// Rate returns the rate between two currencies in the file
+func (s *StaticRateSource) Rate(ctx context.Context, from, to string) (models.ExchangeRateSnapshot, error) {
+	return s.table.rate(from, to, "file:"+s.path)
+}
+
+// HTTPRateSource fetches rates from an HTTP endpoint and caches them for ttl
+type HTTPRateSource struct {
+	url        string
+	ttl        time.Duration
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	table     *exchangeRateTable
+	fetchedAt time.Time
+}
+
+// NewHTTPRateSource creates a rate source for an endpoint returning a rate
+// table. ttl defaults to an hour.
+func NewHTTPRateSource(url string, ttl time.Duration) *HTTPRateSource {
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	return &HTTPRateSource{
+		url:        url,
+		ttl:        ttl,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Rate returns the rate between two currencies, refreshing the cached table
+// once it is older than the ttl. A failed refresh falls back to the cached
+// table, whose as_of date is recorded on the invoice.
+func (s *HTTPRateSource) Rate(ctx context.Context, from, to string) (models.ExchangeRateSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.table == nil || time.Since(s.fetchedAt) > s.ttl {
+		table, err := s.fetch(ctx)
+		if err != nil && s.table == nil {
+			return models.ExchangeRateSnapshot{}, err
+		}
+		if err == nil {
+			s.table = table
+			s.fetchedAt = time.Now()
+		}
+	}
+
+	return s.table.rate(from, to, s.url)
+}
+
+// fetch downloads the rate table
+func (s *HTTPRateSource) fetch(ctx context.Context) (*exchangeRateTable, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create exchange rate request: %w", err)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch exchange rates: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch exchange rates: status %d", resp.StatusCode)
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("failed to decode exchange rates: %w", err)
+	}
+	return parseExchangeRateTable(raw)
+}
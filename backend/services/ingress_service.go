@@ -18,17 +18,29 @@ import (
 // IngressService handles ingress operations
 type IngressService struct {
 	collection *mongo.Collection
+	quotaService *QuotaService
+	concurrencyService *ConcurrencyService
 }
 
-// NewIngressService creates a new ingress service
-func NewIngressService() *IngressService {
+// NewIngressService creates a new ingress service. quotaService may be nil
+// for callers that never create ingresses.
+func NewIngressService(quotaService *QuotaService, concurrencyService *ConcurrencyService) *IngressService {
 	return &IngressService{
 		collection: database.GetCollection("ingresses"),
+		quotaService: quotaService,
+		concurrencyService: concurrencyService,
 	}
 }
 
 // CreateIngress creates a new ingress endpoint
 func (s *IngressService) CreateIngress(ctx context.Context, projectID primitive.ObjectID, project *models.Project, req *models.IngressRequest) (*models.Ingress, error) {
+	if err := s.quotaService.Enforce(ctx, project, QuotaActionIngress); err != nil {
+		return nil, err
+	}
+	if err := s.concurrencyService.CheckIngress(ctx, project); err != nil {
+		return nil, err
+	}
+
 	now := time.Now()
 	
 	// Create ingress record
@@ -73,6 +85,7 @@ func (s *IngressService) CreateIngress(ctx context.Context, projectID primitive.
 	if err != nil {
 		return nil, fmt.Errorf("failed to create ingress: %w", err)
 	}
+	s.concurrencyService.AdjustIngresses(ctx, projectID, 1)
 	
 	return ingress, nil
 }
@@ -143,10 +156,17 @@ func (s *IngressService) DeleteIngress(ctx context.Context, ingressID primitive.
 		},
 	}
 	
-	_, err = s.collection.UpdateOne(ctx, bson.M{"_id": ingressID}, update)
+	var previous models.Ingress
+	err = s.collection.FindOneAndUpdate(ctx, bson.M{"_id": ingressID, "deleted_at": nil}, update).Decode(&previous)
+	if err == mongo.ErrNoDocuments {
+		return fmt.Errorf("ingress not found")
+	}
 	if err != nil {
 		return fmt.Errorf("failed to delete ingress: %w", err)
 	}
+	if previous.Status == models.IngressStatusActive {
+		s.concurrencyService.AdjustIngresses(ctx, previous.ProjectID, -1)
+	}
 	
 	return nil
 }
@@ -164,11 +184,24 @@ func (s *IngressService) UpdateIngressStatus(ctx context.Context, liveKitIngress
 		update["$set"].(bson.M)["error"] = errorMsg
 	}
 	
-	_, err := s.collection.UpdateOne(ctx, bson.M{"livekit_ingress_id": liveKitIngressID}, update)
+	// Deleted ingresses have already released their slot
+	var previous models.Ingress
+	err := s.collection.FindOneAndUpdate(ctx, bson.M{"livekit_ingress_id": liveKitIngressID, "deleted_at": nil}, update).Decode(&previous)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update ingress status: %w", err)
 	}
 	
+	// Move the live counter only on a real transition so redelivered webhooks are no-ops
+	wasActive, isActive := previous.Status == models.IngressStatusActive, status == models.IngressStatusActive
+	if wasActive && !isActive {
+		s.concurrencyService.AdjustIngresses(ctx, previous.ProjectID, -1)
+	} else if !wasActive && isActive {
+		s.concurrencyService.AdjustIngresses(ctx, previous.ProjectID, 1)
+	}
+	
 	return nil
 }
 
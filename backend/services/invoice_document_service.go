@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"pulse-control-plane/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// InvoiceDocumentService renders invoices as PDF documents and stores them
+type InvoiceDocumentService struct {
+	db             *mongo.Database
+	billingService *BillingService
+	storage        *ObjectStorage
+	branding       InvoiceBranding
+}
+
+// NewInvoiceDocumentService creates a new invoice document service
+func NewInvoiceDocumentService(db *mongo.Database, billingService *BillingService, storage *ObjectStorage, branding InvoiceBranding) *InvoiceDocumentService {
+	return &InvoiceDocumentService{
+		db:             db,
+		billingService: billingService,
+		storage:        storage,
+		branding:       branding,
+	}
+}
+
+// RenderPDF renders an invoice with its organization's billing details
+func (s *InvoiceDocumentService) RenderPDF(ctx context.Context, invoiceID primitive.ObjectID) (*models.Invoice, []byte, error) {
+	invoice, err := s.billingService.GetInvoice(ctx, invoiceID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var org models.Organization
+	err = s.db.Collection(models.Organization{}.TableName()).FindOne(ctx, bson.M{"_id": invoice.OrgID}).Decode(&org)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find organization: %w", err)
+	}
+
+	return invoice, RenderInvoicePDF(invoice, &org, s.branding), nil
+}
+
+// StorePDF uploads a rendered invoice to its project's storage bucket and
+// records the document's URL on the invoice. Organization invoices have no
+// project bucket and cannot be stored.
+func (s *InvoiceDocumentService) StorePDF(ctx context.Context, invoice *models.Invoice, pdf []byte) (string, error) {
+	if invoice.ProjectID.IsZero() {
+		return "", fmt.Errorf("%w: organization invoices have no project bucket", ErrStorageNotConfigured)
+	}
+
+	var project models.Project
+	err := s.db.Collection(models.Project{}.TableName()).FindOne(ctx, bson.M{"_id": invoice.ProjectID}).Decode(&project)
+	if err != nil {
+		return "", fmt.Errorf("failed to find project: %w", err)
+	}
+
+	key := fmt.Sprintf("invoices/%s.pdf", invoice.InvoiceNumber)
+	url, err := s.storage.PutObject(ctx, project.StorageConfig, key, pdf, "application/pdf")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = s.db.Collection(models.Invoice{}.TableName()).UpdateOne(ctx,
+		bson.M{"_id": invoice.ID},
+		bson.M{"$set": bson.M{"pdf_url": url, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to record invoice document: %w", err)
+	}
+
+	return url, nil
+}
@@ -0,0 +1,345 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"pulse-control-plane/models"
+	"pulse-control-plane/utils"
+)
+
+// InvoiceBranding is the seller identity printed on invoice documents
+type InvoiceBranding struct {
+	CompanyName  string
+	Address      []string
+	TaxID        string
+	SupportEmail string
+	AccentColor  string // hex, e.g. "#4F46E5"
+}
+
+// invoice page layout, in points
+const (
+	invoiceMargin       = 40.0
+	invoiceBottomMargin = 60.0
+	invoiceRowHeight    = 13.0
+)
+
+// invoice table columns: description on the left, the rest right-aligned at
+// their x positions
+var invoiceColumns = []struct {
+	title string
+	x     float64
+}{
+	{"Qty", 350},
+	{"Unit", 400},
+	{"Unit Price", 475},
+	{"Amount", utils.PDFPageWidthA4 - invoiceMargin},
+}
+
+// invoiceStatusColors color the payment status on the invoice
+var invoiceStatusColors = map[string][3]float64{
+	models.InvoiceStatusPaid:    {0.09, 0.55, 0.27},
+	models.InvoiceStatusOverdue: {0.80, 0.15, 0.15},
+	models.InvoiceStatusVoid:    {0.45, 0.45, 0.45},
+}
+
+// RenderInvoicePDF renders an invoice as an A4 PDF document: the seller's
+// branding, the customer's billing details, line items (including credits
+// drawn down), taxes, totals and payment status
+func RenderInvoicePDF(invoice *models.Invoice, org *models.Organization, branding InvoiceBranding) []byte {
+	doc := utils.NewPDFDocument(utils.PDFPageWidthA4, utils.PDFPageHeightA4)
+	r := &invoiceRenderer{doc: doc, invoice: invoice, accent: hexColor(branding.AccentColor)}
+	right := utils.PDFPageWidthA4 - invoiceMargin
+
+	r.newPage()
+
+	// Header band with the seller's name and the document title
+	top := utils.PDFPageHeightA4
+	doc.SetFillColor(r.accent[0], r.accent[1], r.accent[2])
+	doc.Rect(0, top-70, utils.PDFPageWidthA4, 70)
+	doc.SetFillColor(1, 1, 1)
+	doc.Text(invoiceMargin, top-45, 22, true, branding.CompanyName)
+	title := "INVOICE"
+	if invoice.Status == models.InvoiceStatusDraft {
+		title = "DRAFT INVOICE"
+	}
+	doc.TextRight(right, top-45, 16, true, title)
+	doc.SetFillColor(0, 0, 0)
+
+	// Seller on the left, invoice details on the right
+	y := top - 100
+	seller := append([]string{}, branding.Address...)
+	if branding.TaxID != "" {
+		seller = append(seller, "Tax ID: "+branding.TaxID)
+	}
+	if branding.SupportEmail != "" {
+		seller = append(seller, branding.SupportEmail)
+	}
+	doc.Text(invoiceMargin, y, 10, true, branding.CompanyName)
+	for i, line := range seller {
+		doc.Text(invoiceMargin, y-float64(i+1)*invoiceRowHeight, 9, false, line)
+	}
+
+	details := [][2]string{
+		{"Invoice number", invoice.InvoiceNumber},
+		{"Issue date", invoice.CreatedAt.UTC().Format("02 Jan 2006")},
+		{"Due date", invoice.DueDate.UTC().Format("02 Jan 2006")},
+		{"Billing period", fmt.Sprintf("%s - %s", invoice.PeriodStart.UTC().Format("02 Jan 2006"), invoice.PeriodEnd.UTC().Format("02 Jan 2006"))},
+	}
+	if invoice.PlanVersion > 0 {
+		details = append(details, [2]string{"Plan version", strconv.Itoa(invoice.PlanVersion)})
+	}
+	for i, detail := range details {
+		rowY := y - float64(i)*invoiceRowHeight
+		doc.TextRight(right-150, rowY, 9, true, detail[0])
+		doc.TextRight(right, rowY, 9, false, detail[1])
+	}
+	statusY := y - float64(len(details))*invoiceRowHeight
+	status := strings.ToUpper(invoice.Status)
+	if invoice.Status == models.InvoiceStatusPaid && invoice.PaidAt != nil {
+		status += " " + invoice.PaidAt.UTC().Format("02 Jan 2006")
+	}
+	doc.TextRight(right-150, statusY, 9, true, "Status")
+	color, ok := invoiceStatusColors[invoice.Status]
+	if !ok {
+		color = r.accent
+	}
+	doc.SetFillColor(color[0], color[1], color[2])
+	doc.TextRight(right, statusY, 9, true, status)
+	doc.SetFillColor(0, 0, 0)
+
+	// Customer
+	y -= float64(maxInt(len(seller), len(details))+2) * invoiceRowHeight
+	doc.Text(invoiceMargin, y, 9, true, "BILL TO")
+	y -= invoiceRowHeight
+	doc.Text(invoiceMargin, y, 10, true, org.Name)
+	for _, line := range billToLines(invoice, org) {
+		y -= invoiceRowHeight
+		doc.Text(invoiceMargin, y, 9, false, line)
+	}
+
+	// Line items
+	r.y = y - 2*invoiceRowHeight
+	r.tableHeader()
+	for _, item := range invoice.LineItems {
+		r.lineItem(item)
+	}
+
+	// Totals
+	r.y -= invoiceRowHeight / 2
+	r.ensureSpace(float64(len(invoice.TaxLines)+6) * invoiceRowHeight)
+	doc.Line(340, r.y+invoiceRowHeight-3, right, r.y+invoiceRowHeight-3, 0.5)
+	r.total("Subtotal", invoice.Subtotal, false)
+	for _, line := range invoice.TaxLines {
+		r.total(fmt.Sprintf("%s %s%% (%s)", line.Name, formatRate(line.Rate), line.Jurisdiction), line.Amount, false)
+	}
+	if len(invoice.TaxLines) == 0 || invoice.Tax != 0 {
+		r.total("Tax", invoice.Tax, false)
+	}
+	if invoice.CreditsApplied > 0 {
+		r.total("Credits applied", -invoice.CreditsApplied, false)
+	}
+	r.total("Total", invoice.Total, true)
+	amountDue := invoice.Total
+	if invoice.Status == models.InvoiceStatusPaid || invoice.Status == models.InvoiceStatusVoid {
+		amountDue = 0
+	}
+	r.total("Amount due", amountDue, true)
+
+	// Notes
+	notes := []string{}
+	if invoice.ReverseCharge {
+		notes = append(notes, "Reverse charge applies.")
+	}
+	if invoice.TaxNote != "" {
+		notes = append(notes, invoice.TaxNote)
+	}
+	if branding.SupportEmail != "" {
+		notes = append(notes, "Questions about this invoice? Contact "+branding.SupportEmail+".")
+	}
+	r.y -= invoiceRowHeight
+	for _, note := range notes {
+		for _, line := range utils.PDFWrapText(note, 8, false, right-invoiceMargin) {
+			r.ensureSpace(invoiceRowHeight)
+			doc.Text(invoiceMargin, r.y, 8, false, line)
+			r.y -= invoiceRowHeight - 2
+		}
+	}
+
+	// Footers, now that the page count is known
+	pages := doc.PageCount()
+	for page := 1; page <= pages; page++ {
+		doc.SetPage(page)
+		doc.SetFillColor(0.45, 0.45, 0.45)
+		doc.Text(invoiceMargin, 30, 8, false, fmt.Sprintf("%s  |  %s", branding.CompanyName, invoice.InvoiceNumber))
+		doc.TextRight(right, 30, 8, false, fmt.Sprintf("Page %d of %d", page, pages))
+	}
+
+	return doc.Bytes()
+}
+
+// invoiceRenderer tracks the write position while laying out an invoice
+// across pages
+type invoiceRenderer struct {
+	doc     *utils.PDFDocument
+	invoice *models.Invoice
+	accent  [3]float64
+	y       float64
+}
+
+// newPage starts a page, continuing the line item table on later pages
+func (r *invoiceRenderer) newPage() {
+	r.doc.AddPage()
+	r.y = utils.PDFPageHeightA4 - invoiceMargin
+	if r.doc.PageCount() > 1 {
+		r.doc.SetFillColor(0.45, 0.45, 0.45)
+		r.doc.Text(invoiceMargin, r.y, 8, false, fmt.Sprintf("Invoice %s (continued)", r.invoice.InvoiceNumber))
+		r.doc.SetFillColor(0, 0, 0)
+		r.y -= 2 * invoiceRowHeight
+	}
+}
+
+// ensureSpace starts a new page if height does not fit above the footer
+func (r *invoiceRenderer) ensureSpace(height float64) bool {
+	if r.y-height >= invoiceBottomMargin {
+		return false
+	}
+	r.newPage()
+	return true
+}
+
+// tableHeader draws the line item column titles
+func (r *invoiceRenderer) tableHeader() {
+	right := utils.PDFPageWidthA4 - invoiceMargin
+	r.doc.SetFillColor(r.accent[0], r.accent[1], r.accent[2])
+	r.doc.Rect(invoiceMargin, r.y-4, right-invoiceMargin, invoiceRowHeight+4)
+	r.doc.SetFillColor(1, 1, 1)
+	r.doc.Text(invoiceMargin+4, r.y, 9, true, "Description")
+	for _, column := range invoiceColumns {
+		r.doc.TextRight(column.x-4, r.y, 9, true, column.title)
+	}
+	r.doc.SetFillColor(0, 0, 0)
+	r.y -= invoiceRowHeight + 4
+}
+
+// lineItem draws one line item, wrapping long descriptions
+func (r *invoiceRenderer) lineItem(item models.InvoiceLineItem) {
+	description := item.Description
+	if item.ProjectName != "" {
+		description = item.ProjectName + ": " + description
+	}
+	lines := utils.PDFWrapText(description, 9, false, 250)
+	if r.ensureSpace(float64(len(lines)) * invoiceRowHeight) {
+		r.tableHeader()
+	}
+
+	values := []string{
+		formatQuantity(item.Quantity),
+		item.Unit,
+		formatAmount(item.UnitPrice, models.CurrencyExponent(r.invoice.Currency)),
+		formatAmount(models.FromMinorUnits(item.Amount, r.invoice.Currency), models.CurrencyExponent(r.invoice.Currency)),
+	}
+	for i, column := range invoiceColumns {
+		r.doc.TextRight(column.x-4, r.y, 9, false, values[i])
+	}
+	for _, line := range lines {
+		r.doc.Text(invoiceMargin+4, r.y, 9, false, line)
+		r.y -= invoiceRowHeight
+	}
+	r.doc.SetStrokeColor(0.85, 0.85, 0.85)
+	r.doc.Line(invoiceMargin, r.y+invoiceRowHeight-4, utils.PDFPageWidthA4-invoiceMargin, r.y+invoiceRowHeight-4, 0.3)
+	r.doc.SetStrokeColor(0, 0, 0)
+}
+
+// total draws a labelled amount in the totals block
+func (r *invoiceRenderer) total(label string, amount int64, bold bool) {
+	right := utils.PDFPageWidthA4 - invoiceMargin
+	r.doc.TextRight(right-110, r.y, 9, bold, label)
+	r.doc.TextRight(right-4, r.y, 9, bold, formatMoney(amount, r.invoice.Currency))
+	r.y -= invoiceRowHeight
+}
+
+// billToLines returns the customer's contact, address and tax ID lines,
+// preferring the address snapshotted on the invoice
+func billToLines(invoice *models.Invoice, org *models.Organization) []string {
+	lines := []string{}
+	if org.AdminEmail != "" {
+		lines = append(lines, org.AdminEmail)
+	}
+	address := invoice.BillingAddress
+	if address == nil && org.TaxProfile != nil {
+		address = &org.TaxProfile.BillingAddress
+	}
+	if address != nil {
+		for _, line := range []string{address.Line1, address.Line2} {
+			if line != "" {
+				lines = append(lines, line)
+			}
+		}
+		city := strings.TrimSpace(strings.Join([]string{address.City, address.State, address.PostalCode}, " "))
+		if city != "" {
+			lines = append(lines, city)
+		}
+		lines = append(lines, address.Country)
+	}
+	if invoice.CustomerTaxID != "" {
+		lines = append(lines, "Tax ID: "+invoice.CustomerTaxID)
+	}
+	return lines
+}
+
+// formatMoney formats an amount in minor units with the currency's decimals
+// and thousands separators, prefixed by the currency code
+func formatMoney(amount int64, currency string) string {
+	decimal := formatAmount(models.FromMinorUnits(amount, currency), models.CurrencyExponent(currency))
+	return strings.ToUpper(currency) + " " + decimal
+}
+
+// formatAmount formats a decimal amount with thousands separators
+func formatAmount(amount float64, decimals int) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	whole, fraction, _ := strings.Cut(strconv.FormatFloat(amount, 'f', decimals, 64), ".")
+	for i := len(whole) - 3; i > 0; i -= 3 {
+		whole = whole[:i] + "," + whole[i:]
+	}
+	if fraction == "" {
+		return sign + whole
+	}
+	return sign + whole + "." + fraction
+}
+
+// formatQuantity formats a quantity without trailing zeros
+func formatQuantity(quantity float64) string {
+	return strconv.FormatFloat(math.Round(quantity*10000)/10000, 'f', -1, 64)
+}
+
+// formatRate formats a tax rate without trailing zeros
+func formatRate(rate float64) string {
+	return strconv.FormatFloat(rate, 'f', -1, 64)
+}
+
+// hexColor parses an "#RRGGBB" color, defaulting to indigo
+func hexColor(hex string) [3]float64 {
+	value, err := strconv.ParseUint(strings.TrimPrefix(hex, "#"), 16, 32)
+	if err != nil || len(strings.TrimPrefix(hex, "#")) != 6 {
+		value = 0x4F46E5
+	}
+	return [3]float64{
+		float64(value>>16&0xFF) / 255,
+		float64(value>>8&0xFF) / 255,
+		float64(value&0xFF) / 255,
+	}
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
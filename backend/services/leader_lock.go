@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"pulse-control-plane/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LeaderLock is a Mongo-backed lease so only one replica runs a job.
+// The holder must renew before the TTL expires or another replica takes over.
+type LeaderLock struct {
+	collection *mongo.Collection
+	name       string
+	owner      string
+	ttl        time.Duration
+}
+
+// NewLeaderLock creates a lock identified by name for this process
+func NewLeaderLock(db *mongo.Database, name string, ttl time.Duration) *LeaderLock {
+	hostname, _ := os.Hostname()
+	return &LeaderLock{
+		collection: db.Collection(models.WorkerLock{}.TableName()),
+		name:       name,
+		owner:      fmt.Sprintf("%s-%s", hostname, primitive.NewObjectID().Hex()),
+		ttl:        ttl,
+	}
+}
+
+// TryAcquire acquires or renews the lease. It returns false when another
+// replica holds an unexpired lease.
+func (l *LeaderLock) TryAcquire(ctx context.Context) (bool, error) {
+	now := time.Now()
+
+	_, err := l.collection.UpdateOne(ctx,
+		bson.M{
+			"_id": l.name,
+			"$or": bson.A{
+				bson.M{"owner": l.owner},
+				bson.M{"expires_at": bson.M{"$lt": now}},
+			},
+		},
+		bson.M{
+			"$set": bson.M{
+				"owner":       l.owner,
+				"expires_at":  now.Add(l.ttl),
+				"acquired_at": now,
+			},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err == nil {
+		return true, nil
+	}
+
+	// The upsert collides with the live lease held by someone else
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to acquire lock %s: %w", l.name, err)
+}
+
+// Release gives up the lease if this process holds it
+func (l *LeaderLock) Release(ctx context.Context) error {
+	_, err := l.collection.DeleteOne(ctx, bson.M{"_id": l.name, "owner": l.owner})
+	if err != nil {
+		return fmt.Errorf("failed to release lock %s: %w", l.name, err)
+	}
+	return nil
+}
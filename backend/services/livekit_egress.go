@@ -0,0 +1,432 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"pulse-control-plane/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrLiveKitNotConfigured is returned when a project's region has no LiveKit
+// server or API credentials
+var ErrLiveKitNotConfigured = errors.New("livekit is not configured for this region")
+
+// LiveKit egress statuses, as reported in EgressInfo
+const (
+	LiveKitEgressStarting     = "EGRESS_STARTING"
+	LiveKitEgressActive       = "EGRESS_ACTIVE"
+	LiveKitEgressEnding       = "EGRESS_ENDING"
+	LiveKitEgressComplete     = "EGRESS_COMPLETE"
+	LiveKitEgressFailed       = "EGRESS_FAILED"
+	LiveKitEgressAborted      = "EGRESS_ABORTED"
+	LiveKitEgressLimitReached = "EGRESS_LIMIT_REACHED"
+)
+
+// LiveKitEgressClient starts and controls egresses on a LiveKit server
+// through its Egress service
+type LiveKitEgressClient interface {
+	StartRoomCompositeEgress(ctx context.Context, req *RoomCompositeEgressRequest) (*LiveKitEgressInfo, error)
+	StartTrackCompositeEgress(ctx context.Context, req *TrackCompositeEgressRequest) (*LiveKitEgressInfo, error)
+	StartTrackEgress(ctx context.Context, req *TrackEgressRequest) (*LiveKitEgressInfo, error)
+	StartWebEgress(ctx context.Context, req *WebEgressRequest) (*LiveKitEgressInfo, error)
+	UpdateLayout(ctx context.Context, egressID, layout string) (*LiveKitEgressInfo, error)
+	UpdateStream(ctx context.Context, egressID string, addURLs, removeURLs []string) (*LiveKitEgressInfo, error)
+	StopEgress(ctx context.Context, egressID string) (*LiveKitEgressInfo, error)
+}
+
+// RoomCompositeEgressRequest records a room's composited audio and video
+type RoomCompositeEgressRequest struct {
+	RoomName      string                  `json:"room_name"`
+	Layout        string                  `json:"layout,omitempty"`
+	CustomBaseURL string                  `json:"custom_base_url,omitempty"` // custom layout template page
+	AudioOnly     bool                    `json:"audio_only,omitempty"`
+	VideoOnly     bool                    `json:"video_only,omitempty"`
+	Advanced      *LiveKitEncodingOptions `json:"advanced,omitempty"`
+	EgressOutputs
+}
+
+// TrackCompositeEgressRequest records one audio and one video track together
+type TrackCompositeEgressRequest struct {
+	RoomName     string                  `json:"room_name"`
+	AudioTrackID string                  `json:"audio_track_id,omitempty"`
+	VideoTrackID string                  `json:"video_track_id,omitempty"`
+	Advanced     *LiveKitEncodingOptions `json:"advanced,omitempty"`
+	EgressOutputs
+}
+
+// TrackEgressRequest exports a single track without transcoding
+type TrackEgressRequest struct {
+	RoomName     string            `json:"room_name"`
+	TrackID      string            `json:"track_id"`
+	File         *DirectFileOutput `json:"file,omitempty"`
+	WebsocketURL string            `json:"websocket_url,omitempty"`
+}
+
+// WebEgressRequest records a web page
+type WebEgressRequest struct {
+	URL       string                  `json:"url"`
+	AudioOnly bool                    `json:"audio_only,omitempty"`
+	VideoOnly bool                    `json:"video_only,omitempty"`
+	Advanced  *LiveKitEncodingOptions `json:"advanced,omitempty"`
+	EgressOutputs
+}
+
+// LiveKitEncodingOptions are LiveKit's advanced encoding options. Codecs
+// are protobuf enum names, e.g. H264_MAIN and OPUS.
+type LiveKitEncodingOptions struct {
+	Width            int32   `json:"width,omitempty"`
+	Height           int32   `json:"height,omitempty"`
+	Framerate        int32   `json:"framerate,omitempty"`
+	VideoCodec       string  `json:"video_codec,omitempty"`
+	VideoBitrate     int32   `json:"video_bitrate,omitempty"` // kbps
+	KeyFrameInterval float64 `json:"key_frame_interval,omitempty"`
+	AudioCodec       string  `json:"audio_codec,omitempty"`
+	AudioBitrate     int32   `json:"audio_bitrate,omitempty"` // kbps
+	AudioFrequency   int32   `json:"audio_frequency,omitempty"`
+}
+
+// liveKitEncoding converts encoding options to LiveKit's, or nil for its defaults
+func liveKitEncoding(options *models.EncodingOptions) *LiveKitEncodingOptions {
+	if options == nil {
+		return nil
+	}
+	return &LiveKitEncodingOptions{
+		Width:            int32(options.Width),
+		Height:           int32(options.Height),
+		Framerate:        int32(options.Framerate),
+		VideoCodec:       strings.ToUpper(options.VideoCodec),
+		VideoBitrate:     int32(options.VideoBitrate),
+		KeyFrameInterval: options.KeyFrameInterval,
+		AudioCodec:       strings.ToUpper(options.AudioCodec),
+		AudioBitrate:     int32(options.AudioBitrate),
+		AudioFrequency:   int32(options.AudioFrequency),
+	}
+}
+
+// EgressOutputs are the destinations of a composite or web egress. LiveKit
+// runs at most one output of each kind; a stream output can have several URLs.
+type EgressOutputs struct {
+	FileOutputs    []*EncodedFileOutput   `json:"file_outputs,omitempty"`
+	StreamOutputs  []*StreamOutput        `json:"stream_outputs,omitempty"`
+	SegmentOutputs []*SegmentedFileOutput `json:"segment_outputs,omitempty"`
+	ImageOutputs   []*ImageOutput         `json:"image_outputs,omitempty"`
+}
+
+// EncodedFileOutput writes a single transcoded file
+type EncodedFileOutput struct {
+	FileType string    `json:"file_type,omitempty"` // MP4 or OGG
+	Filepath string    `json:"filepath"`
+	S3       *S3Upload `json:"s3,omitempty"`
+}
+
+// SegmentedFileOutput writes an HLS playlist and its segments
+type SegmentedFileOutput struct {
+	Protocol        string    `json:"protocol,omitempty"` // HLS_PROTOCOL
+	FilenamePrefix  string    `json:"filename_prefix"`
+	PlaylistName    string    `json:"playlist_name"`
+	SegmentDuration uint32    `json:"segment_duration,omitempty"` // seconds
+	S3              *S3Upload `json:"s3,omitempty"`
+}
+
+// DirectFileOutput writes a track as-is
+type DirectFileOutput struct {
+	Filepath string    `json:"filepath"`
+	S3       *S3Upload `json:"s3,omitempty"`
+}
+
+// StreamOutput pushes to RTMP endpoints
+type StreamOutput struct {
+	Protocol string   `json:"protocol,omitempty"` // RTMP
+	URLs     []string `json:"urls"`
+}
+
+// ImageOutput captures snapshots at a fixed interval
+type ImageOutput struct {
+	CaptureInterval uint32    `json:"capture_interval"` // seconds
+	Width           int32     `json:"width,omitempty"`
+	Height          int32     `json:"height,omitempty"`
+	FilenamePrefix  string    `json:"filename_prefix"`
+	S3              *S3Upload `json:"s3,omitempty"`
+}
+
+// S3Upload is the bucket egress output is uploaded to
+type S3Upload struct {
+	AccessKey      string `json:"access_key"`
+	Secret         string `json:"secret"`
+	Region         string `json:"region,omitempty"`
+	Endpoint       string `json:"endpoint,omitempty"`
+	Bucket         string `json:"bucket"`
+	ForcePathStyle bool   `json:"force_path_style,omitempty"`
+}
+
+// LiveKitEgressInfo is LiveKit's view of an egress
+type LiveKitEgressInfo struct {
+	EgressID       string                     `json:"egress_id"`
+	RoomID         string                     `json:"room_id"`
+	RoomName       string                     `json:"room_name"`
+	Status         string                     `json:"status"`
+	StartedAt      twirpInt64                 `json:"started_at"` // unix nanoseconds
+	EndedAt        twirpInt64                 `json:"ended_at"`   // unix nanoseconds
+	Error          string                     `json:"error"`
+	StreamResults  []LiveKitEgressStreamInfo  `json:"stream_results"`
+	FileResults    []LiveKitEgressFileInfo    `json:"file_results"`
+	SegmentResults []LiveKitEgressSegmentInfo `json:"segment_results"`
+	ImageResults   []LiveKitEgressImageInfo   `json:"image_results"`
+}
+
+// LiveKitEgressStreamInfo is the state of one stream output
+type LiveKitEgressStreamInfo struct {
+	URL    string `json:"url"`
+	Status string `json:"status"` // ACTIVE, FINISHED or FAILED
+	Error  string `json:"error"`
+}
+
+// LiveKitEgressFileInfo is a file written by an egress
+type LiveKitEgressFileInfo struct {
+	Filename string     `json:"filename"`
+	Location string     `json:"location"`
+	Size     twirpInt64 `json:"size"`
+	Duration twirpInt64 `json:"duration"` // nanoseconds
+}
+
+// LiveKitEgressSegmentInfo is an HLS playlist written by an egress
+type LiveKitEgressSegmentInfo struct {
+	PlaylistName     string     `json:"playlist_name"`
+	PlaylistLocation string     `json:"playlist_location"`
+	Size             twirpInt64 `json:"size"`
+	SegmentCount     twirpInt64 `json:"segment_count"`
+}
+
+// LiveKitEgressImageInfo is a series of snapshots written by an egress
+type LiveKitEgressImageInfo struct {
+	FilenamePrefix string     `json:"filename_prefix"`
+	ImageCount     twirpInt64 `json:"image_count"`
+}
+
+// twirpInt64 decodes an int64, which protobuf JSON writes as a string
+type twirpInt64 int64
+
+// UnmarshalJSON accepts quoted and bare integers
+func (n *twirpInt64) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "" || s == "null" {
+		*n = 0
+		return nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid int64 %s: %w", data, err)
+	}
+	*n = twirpInt64(v)
+	return nil
+}
+
+// Time returns a nanosecond timestamp as a time, or nil if unset
+func (n twirpInt64) Time() *time.Time {
+	if n == 0 {
+		return nil
+	}
+	t := time.Unix(0, int64(n))
+	return &t
+}
+
+// LiveKitError is an error returned by a LiveKit Twirp API
+type LiveKitError struct {
+	Code       string `json:"code"` // Twirp error code, e.g. not_found
+	Message    string `json:"msg"`
+	StatusCode int    `json:"-"`
+}
+
+func (e *LiveKitError) Error() string {
+	return fmt.Sprintf("livekit %s: %s", e.Code, e.Message)
+}
+
+// TwirpEgressClient calls a LiveKit server's Egress service over Twirp,
+// authenticating each call with a short-lived token signed by the API secret
+type TwirpEgressClient struct {
+	baseURL    string
+	apiKey     string
+	apiSecret  string
+	httpClient *http.Client
+}
+
+// NewLiveKitEgressClient creates an Egress client for a LiveKit server. The
+// server URL may use the ws(s) scheme clients connect with.
+func NewLiveKitEgressClient(serverURL, apiKey, apiSecret string) *TwirpEgressClient {
+	baseURL := strings.TrimRight(serverURL, "/")
+	if strings.HasPrefix(baseURL, "wss://") {
+		baseURL = "https://" + strings.TrimPrefix(baseURL, "wss://")
+	} else if strings.HasPrefix(baseURL, "ws://") {
+		baseURL = "http://" + strings.TrimPrefix(baseURL, "ws://")
+	}
+	return &TwirpEgressClient{
+		baseURL:    baseURL,
+		apiKey:     apiKey,
+		apiSecret:  apiSecret,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// StartRoomCompositeEgress starts recording a room
+func (c *TwirpEgressClient) StartRoomCompositeEgress(ctx context.Context, req *RoomCompositeEgressRequest) (*LiveKitEgressInfo, error) {
+	return c.call(ctx, "StartRoomCompositeEgress", req, req.RoomName)
+}
+
+// StartTrackCompositeEgress starts recording an audio and a video track
+func (c *TwirpEgressClient) StartTrackCompositeEgress(ctx context.Context, req *TrackCompositeEgressRequest) (*LiveKitEgressInfo, error) {
+	return c.call(ctx, "StartTrackCompositeEgress", req, req.RoomName)
+}
+
+// StartTrackEgress starts exporting a track
+func (c *TwirpEgressClient) StartTrackEgress(ctx context.Context, req *TrackEgressRequest) (*LiveKitEgressInfo, error) {
+	return c.call(ctx, "StartTrackEgress", req, req.RoomName)
+}
+
+// StartWebEgress starts recording a web page
+func (c *TwirpEgressClient) StartWebEgress(ctx context.Context, req *WebEgressRequest) (*LiveKitEgressInfo, error) {
+	return c.call(ctx, "StartWebEgress", req, "")
+}
+
+// UpdateLayout changes a room composite egress's layout
+func (c *TwirpEgressClient) UpdateLayout(ctx context.Context, egressID, layout string) (*LiveKitEgressInfo, error) {
+	return c.call(ctx, "UpdateLayout", map[string]string{"egress_id": egressID, "layout": layout}, "")
+}
+
+// UpdateStream adds and removes an egress's RTMP outputs
+func (c *TwirpEgressClient) UpdateStream(ctx context.Context, egressID string, addURLs, removeURLs []string) (*LiveKitEgressInfo, error) {
+	body := map[string]interface{}{
+		"egress_id":          egressID,
+		"add_output_urls":    addURLs,
+		"remove_output_urls": removeURLs,
+	}
+	return c.call(ctx, "UpdateStream", body, "")
+}
+
+// StopEgress stops an egress. LiveKit finishes uploading its output before
+// reporting it complete.
+func (c *TwirpEgressClient) StopEgress(ctx context.Context, egressID string) (*LiveKitEgressInfo, error) {
+	return c.call(ctx, "StopEgress", map[string]string{"egress_id": egressID}, "")
+}
+
+// call invokes an Egress method with a JSON body
+func (c *TwirpEgressClient) call(ctx context.Context, method string, in interface{}, roomName string) (*LiveKitEgressInfo, error) {
+	token, err := c.token(roomName)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s request: %w", method, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/twirp/livekit.Egress/"+method, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s request: %w", method, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("livekit %s failed: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s response: %w", method, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		liveKitErr := &LiveKitError{StatusCode: resp.StatusCode}
+		if err := json.Unmarshal(data, liveKitErr); err != nil || liveKitErr.Code == "" {
+			liveKitErr.Code = "unknown"
+			liveKitErr.Message = strings.TrimSpace(string(data))
+		}
+		log.Debug().Str("method", method).Str("code", liveKitErr.Code).Msg("LiveKit egress call failed")
+		return nil, liveKitErr
+	}
+
+	var info LiveKitEgressInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("failed to decode %s response: %w", method, err)
+	}
+	return &info, nil
+}
+
+// token signs an access token allowed to record rooms
+func (c *TwirpEgressClient) token(roomName string) (string, error) {
+	now := time.Now()
+	claims := TokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    c.apiKey,
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+		Video: &VideoGrant{RoomRecord: true, RoomName: roomName},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(c.apiSecret))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign livekit token: %w", err)
+	}
+	return token, nil
+}
+
+// LiveKitEgressClients resolves the Egress client of a project's region. A
+// region without its own API credentials uses the default ones, and a
+// project whose region is unknown uses the default server.
+type LiveKitEgressClients struct {
+	regionService *RegionService
+	defaultURL    string
+	defaultKey    string
+	defaultSecret string
+}
+
+// NewLiveKitEgressClients creates an Egress client resolver
+func NewLiveKitEgressClients(regionService *RegionService, defaultURL, apiKey, apiSecret string) *LiveKitEgressClients {
+	return &LiveKitEgressClients{
+		regionService: regionService,
+		defaultURL:    defaultURL,
+		defaultKey:    apiKey,
+		defaultSecret: apiSecret,
+	}
+}
+
+// ForProject returns the Egress client of a project's region
+func (r *LiveKitEgressClients) ForProject(ctx context.Context, project *models.Project) (LiveKitEgressClient, error) {
+	if r == nil {
+		return nil, ErrLiveKitNotConfigured
+	}
+
+	serverURL, apiKey, apiSecret := r.defaultURL, r.defaultKey, r.defaultSecret
+	if project.LiveKitURL != "" {
+		serverURL = project.LiveKitURL
+	}
+	if project.Region != "" && r.regionService != nil {
+		region, err := r.regionService.GetRegionByCode(ctx, project.Region)
+		if err != nil {
+			log.Warn().Err(err).Str("region", project.Region).Msg("Failed to load project region, using the default LiveKit server")
+		} else {
+			serverURL = region.LiveKitURL
+			if region.APIKey != "" {
+				apiKey, apiSecret = region.APIKey, region.APISecret
+			}
+		}
+	}
+
+	if serverURL == "" || apiKey == "" || apiSecret == "" {
+		return nil, ErrLiveKitNotConfigured
+	}
+	return NewLiveKitEgressClient(serverURL, apiKey, apiSecret), nil
+}
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pulse-control-plane/models"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MeteringConfig controls buffering and batching of usage events
+type MeteringConfig struct {
+	BufferSize    int           // events held in memory before new ones are dropped
+	BatchSize     int           // max events per InsertMany
+	FlushInterval time.Duration // max time an event waits in the buffer
+	MaxRetries    int           // insert attempts per batch before it is dropped
+}
+
+// DefaultMeteringConfig returns sensible defaults for the metering pipeline
+func DefaultMeteringConfig() MeteringConfig {
+	return MeteringConfig{
+		BufferSize:    10000,
+		BatchSize:     500,
+		FlushInterval: 2 * time.Second,
+		MaxRetries:    3,
+	}
+}
+
+// MeteringStats reports pipeline throughput and loss
+type MeteringStats struct {
+	Enqueued   int64 `json:"enqueued"`
+	Inserted   int64 `json:"inserted"`
+	Duplicates int64 `json:"duplicates"`
+	Dropped    int64 `json:"dropped"` // rejected because the buffer was full
+	Failed     int64 `json:"failed"`  // lost after exhausting insert retries
+	Buffered   int   `json:"buffered"`
+	Capacity   int   `json:"capacity"`
+}
+
+// MeteringPipeline buffers usage events in memory and writes them to
+// Mongo in batches. Events carry idempotency keys so retried batches and
+// replayed events never double count.
+type MeteringPipeline struct {
+	collection *mongo.Collection
+	config     MeteringConfig
+	events     chan models.UsageMetric
+
+	enqueued   int64
+	inserted   int64
+	duplicates int64
+	dropped    int64
+	failed     int64
+
+	mu      sync.RWMutex
+	stopped bool
+	done    chan struct{}
+}
+
+// NewMeteringPipeline creates a new metering pipeline
+func NewMeteringPipeline(db *mongo.Database, config MeteringConfig) *MeteringPipeline {
+	defaults := DefaultMeteringConfig()
+	if config.BufferSize <= 0 {
+		config.BufferSize = defaults.BufferSize
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaults.FlushInterval
+	}
+	if config.MaxRetries <= 0 {
+		config.MaxRetries = defaults.MaxRetries
+	}
+
+	return &MeteringPipeline{
+		collection: db.Collection(models.UsageMetric{}.TableName()),
+		config:     config,
+		events:     make(chan models.UsageMetric, config.BufferSize),
+		done:       make(chan struct{}),
+	}
+}
+
+// Start begins flushing buffered events in the background
+func (p *MeteringPipeline) Start() {
+	go p.run()
+	log.Info().
+		Int("buffer_size", p.config.BufferSize).
+		Int("batch_size", p.config.BatchSize).
+		Dur("flush_interval", p.config.FlushInterval).
+		Msg("Metering pipeline started")
+}
+
+// Stop stops accepting events and flushes everything still buffered
+func (p *MeteringPipeline) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		return nil
+	}
+	p.stopped = true
+	close(p.events)
+	p.mu.Unlock()
+
+	select {
+	case <-p.done:
+		stats := p.Stats()
+		log.Info().
+			Int64("inserted", stats.Inserted).
+			Int64("dropped", stats.Dropped).
+			Int64("failed", stats.Failed).
+			Msg("Metering pipeline stopped")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("metering pipeline did not drain before shutdown: %w", ctx.Err())
+	}
+}
+
+// Enqueue adds an event to the buffer without blocking. It returns false
+// when the event was dropped because the buffer is full or the pipeline
+// has stopped.
+func (p *MeteringPipeline) Enqueue(metric models.UsageMetric) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.stopped {
+		atomic.AddInt64(&p.dropped, 1)
+		return false
+	}
+
+	select {
+	case p.events <- metric:
+		atomic.AddInt64(&p.enqueued, 1)
+		return true
+	default:
+		// Mongo is not keeping up; shed load instead of blocking requests
+		if atomic.AddInt64(&p.dropped, 1)%1000 == 1 {
+			log.Warn().Int64("dropped", atomic.LoadInt64(&p.dropped)).Msg("Metering buffer full, dropping usage events")
+		}
+		return false
+	}
+}
+
+// Stats returns a snapshot of pipeline counters
+func (p *MeteringPipeline) Stats() MeteringStats {
+	return MeteringStats{
+		Enqueued:   atomic.LoadInt64(&p.enqueued),
+		Inserted:   atomic.LoadInt64(&p.inserted),
+		Duplicates: atomic.LoadInt64(&p.duplicates),
+		Dropped:    atomic.LoadInt64(&p.dropped),
+		Failed:     atomic.LoadInt64(&p.failed),
+		Buffered:   len(p.events),
+		Capacity:   cap(p.events),
+	}
+}
+
+// run collects events into batches and flushes on size or interval
+func (p *MeteringPipeline) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.UsageMetric, 0, p.config.BatchSize)
+	for {
+		select {
+		case metric, ok := <-p.events:
+			if !ok {
+				p.flush(batch)
+				return
+			}
+			batch = append(batch, metric)
+			if len(batch) >= p.config.BatchSize {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+// flush writes a batch, retrying transient failures with backoff
+func (p *MeteringPipeline) flush(batch []models.UsageMetric) {
+	if len(batch) == 0 {
+		return
+	}
+
+	docs := make([]interface{}, len(batch))
+	backoff := 100 * time.Millisecond
+	for attempt := 1; attempt <= p.config.MaxRetries; attempt++ {
+		// Stamp each attempt so the aggregator sees when events actually landed
+		recordedAt := time.Now()
+		for i := range batch {
+			batch[i].RecordedAt = recordedAt
+			docs[i] = batch[i]
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		inserted, duplicates, err := insertUsageMetrics(ctx, p.collection, docs)
+		cancel()
+
+		atomic.AddInt64(&p.inserted, inserted)
+		atomic.AddInt64(&p.duplicates, duplicates)
+		if err == nil {
+			return
+		}
+
+		log.Error().Err(err).Int("attempt", attempt).Int("batch_size", len(docs)).Msg("Failed to flush usage events")
+		if attempt < p.config.MaxRetries {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	// Retries are safe because of idempotency keys, but we have to give up eventually
+	atomic.AddInt64(&p.failed, int64(len(docs)))
+}
+
+// insertUsageMetrics inserts usage metrics unordered so one duplicate does not
+// block the rest of the batch. Duplicate idempotency keys are not errors.
+func insertUsageMetrics(ctx context.Context, collection *mongo.Collection, docs []interface{}) (int64, int64, error) {
+	_, err := collection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if err == nil {
+		return int64(len(docs)), 0, nil
+	}
+
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) {
+		return 0, 0, err
+	}
+
+	duplicates := int64(0)
+	for _, writeErr := range bulkErr.WriteErrors {
+		if mongo.IsDuplicateKeyError(writeErr) {
+			duplicates++
+		}
+	}
+	inserted := int64(len(docs) - len(bulkErr.WriteErrors))
+
+	if duplicates < int64(len(bulkErr.WriteErrors)) || bulkErr.WriteConcernError != nil {
+		return inserted, duplicates, err
+	}
+	return inserted, duplicates, nil
+}
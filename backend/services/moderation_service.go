@@ -2,7 +2,6 @@ package services
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"regexp"
@@ -23,10 +22,11 @@ type ModerationService struct {
 	geminiAPIKey   string
 	geminiEnabled  bool
 	profanityWords []string
+	eventBus       *EventBus
 }
 
 // NewModerationService creates a new moderation service
-func NewModerationService(db *mongo.Database, geminiAPIKey string) *ModerationService {
+func NewModerationService(db *mongo.Database, geminiAPIKey string, eventBus *EventBus) *ModerationService {
 	// Default profanity list (can be extended)
 	profanityWords := []string{
 		"badword1", "badword2", "spam", "scam", // Add more as needed
@@ -37,6 +37,7 @@ func NewModerationService(db *mongo.Database, geminiAPIKey string) *ModerationSe
 		geminiAPIKey:   geminiAPIKey,
 		geminiEnabled:  geminiAPIKey != "" && geminiAPIKey != "mock-gemini-key-for-testing",
 		profanityWords: profanityWords,
+		eventBus:       eventBus,
 	}
 }
 
@@ -326,6 +327,22 @@ func (s *ModerationService) saveAnalysis(ctx context.Context, analysis *models.C
 	}
 
 	analysis.ID = result.InsertedID.(primitive.ObjectID)
+
+	if analysis.IsFlagged {
+		s.eventBus.PublishAsync(analysis.ProjectID, &models.WebhookPayload{
+			Event: models.WebhookEventModerationFlagged,
+			Moderation: &models.ModerationInfo{
+				AnalysisID:  analysis.ID.Hex(),
+				ContentID:   analysis.ContentID,
+				ContentType: string(analysis.ContentType),
+				UserID:      analysis.UserID,
+				Severity:    string(analysis.Severity),
+				Action:      string(analysis.RecommendedAction),
+				Reason:      analysis.Reason,
+			},
+		})
+	}
+
 	return analysis, nil
 }
 
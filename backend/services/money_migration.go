@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"pulse-control-plane/models"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// legacyAmount matches amounts stored as decimal doubles, from before
+// invoices and credit were kept in minor units. Converted amounts are
+// integers, so the filter also makes each conversion run once when replicas
+// start together.
+var legacyAmount = bson.M{"$type": "double"}
+
+// legacyInvoice is the part of an invoice with decimal amounts
+type legacyInvoice struct {
+	ID             primitive.ObjectID `bson:"_id"`
+	Currency       string             `bson:"currency"`
+	Subtotal       float64            `bson:"subtotal"`
+	Tax            float64            `bson:"tax"`
+	CreditsApplied float64            `bson:"credits_applied"`
+	Total          float64            `bson:"total"`
+	LineItems      []struct {
+		Amount float64 `bson:"amount"`
+	} `bson:"line_items"`
+	TaxLines []struct {
+		TaxableAmount float64 `bson:"taxable_amount"`
+		Amount        float64 `bson:"amount"`
+	} `bson:"tax_lines"`
+}
+
+// legacyCredit is the part of a credit entry or promo code with decimal
+// amounts
+type legacyCredit struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	Currency  string             `bson:"currency"`
+	Amount    float64            `bson:"amount"`
+	Remaining *float64           `bson:"remaining"` // credit grants only
+}
+
+// MigrateMinorUnits converts the amounts of invoices, credit entries and
+// promo codes written before they were stored in minor units
+func MigrateMinorUnits(ctx context.Context, db *mongo.Database) error {
+	if err := migrateInvoiceAmounts(ctx, db.Collection(models.Invoice{}.TableName())); err != nil {
+		return err
+	}
+	if err := migrateCreditAmounts(ctx, db.Collection(models.CreditEntry{}.TableName())); err != nil {
+		return err
+	}
+	return migrateCreditAmounts(ctx, db.Collection(models.PromoCode{}.TableName()))
+}
+
+// migrateInvoiceAmounts converts invoice totals, line items and tax lines
+func migrateInvoiceAmounts(ctx context.Context, collection *mongo.Collection) error {
+	cursor, err := collection.Find(ctx, bson.M{"total": legacyAmount})
+	if err != nil {
+		return fmt.Errorf("failed to find legacy invoices: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	converted := 0
+	for cursor.Next(ctx) {
+		var invoice legacyInvoice
+		if err := cursor.Decode(&invoice); err != nil {
+			return fmt.Errorf("failed to decode legacy invoice: %w", err)
+		}
+		minor := func(amount float64) int64 {
+			return models.ToMinorUnits(amount, invoice.Currency)
+		}
+
+		set := bson.M{
+			"subtotal":        minor(invoice.Subtotal),
+			"tax":             minor(invoice.Tax),
+			"credits_applied": minor(invoice.CreditsApplied),
+			"total":           minor(invoice.Total),
+		}
+		for i, item := range invoice.LineItems {
+			set[fmt.Sprintf("line_items.%d.amount", i)] = minor(item.Amount)
+		}
+		for i, line := range invoice.TaxLines {
+			set[fmt.Sprintf("tax_lines.%d.taxable_amount", i)] = minor(line.TaxableAmount)
+			set[fmt.Sprintf("tax_lines.%d.amount", i)] = minor(line.Amount)
+		}
+
+		result, err := collection.UpdateOne(ctx, bson.M{"_id": invoice.ID, "total": legacyAmount}, bson.M{"$set": set})
+		if err != nil {
+			return fmt.Errorf("failed to convert invoice %s: %w", invoice.ID.Hex(), err)
+		}
+		converted += int(result.ModifiedCount)
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to read legacy invoices: %w", err)
+	}
+
+	if converted > 0 {
+		log.Info().Int("invoices", converted).Msg("Converted invoice amounts to minor units")
+	}
+	return nil
+}
+
+// migrateCreditAmounts converts the amount, and what remains of grants, of
+// credit entries or promo codes
+func migrateCreditAmounts(ctx context.Context, collection *mongo.Collection) error {
+	cursor, err := collection.Find(ctx, bson.M{"amount": legacyAmount})
+	if err != nil {
+		return fmt.Errorf("failed to find legacy %s: %w", collection.Name(), err)
+	}
+	defer cursor.Close(ctx)
+
+	converted := 0
+	for cursor.Next(ctx) {
+		var credit legacyCredit
+		if err := cursor.Decode(&credit); err != nil {
+			return fmt.Errorf("failed to decode legacy %s: %w", collection.Name(), err)
+		}
+
+		set := bson.M{"amount": models.ToMinorUnits(credit.Amount, credit.Currency)}
+		if credit.Remaining != nil {
+			set["remaining"] = models.ToMinorUnits(*credit.Remaining, credit.Currency)
+		}
+
+		result, err := collection.UpdateOne(ctx, bson.M{"_id": credit.ID, "amount": legacyAmount}, bson.M{"$set": set})
+		if err != nil {
+			return fmt.Errorf("failed to convert %s %s: %w", collection.Name(), credit.ID.Hex(), err)
+		}
+		converted += int(result.ModifiedCount)
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to read legacy %s: %w", collection.Name(), err)
+	}
+
+	if converted > 0 {
+		log.Info().Str("collection", collection.Name()).Int("documents", converted).Msg("Converted credit amounts to minor units")
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"pulse-control-plane/models"
+)
+
+// ErrStorageNotConfigured is returned for projects without bucket credentials
+var ErrStorageNotConfigured = errors.New("storage bucket is not configured")
+
+// ErrObjectNotFound is returned for a key the bucket does not hold
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectStorage writes objects to a project's S3-compatible bucket (S3, R2 or
+// GCS through its XML API with HMAC keys), signing requests with AWS
+// Signature Version 4
+type ObjectStorage struct {
+	client *http.Client
+}
+
+// NewObjectStorage creates a new object storage client
+func NewObjectStorage() *ObjectStorage {
+	return &ObjectStorage{
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// PutObject uploads body to key in the configured bucket and returns the
+// object's URL
+func (s *ObjectStorage) PutObject(ctx context.Context, cfg models.StorageConfig, key string, body []byte, contentType string) (string, error) {
+	location, region, err := objectURL(cfg, key)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, location, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create storage request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	signV4(req, body, cfg.AccessKeyID, cfg.SecretAccessKey, region, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload object: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("storage upload failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return location, nil
+}
+
+// ObjectInfo is the metadata of a stored object
+type ObjectInfo struct {
+	Size int64
+	ETag string // the MD5 of the content unless it was uploaded in parts
+}
+
+// HeadObject returns the metadata of key in the configured bucket
+func (s *ObjectStorage) HeadObject(ctx context.Context, cfg models.StorageConfig, key string) (*ObjectInfo, error) {
+	resp, err := s.do(ctx, http.MethodHead, cfg, key, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrObjectNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("storage head failed with status %d", resp.StatusCode)
+	}
+	return &ObjectInfo{
+		Size: resp.ContentLength,
+		ETag: strings.Trim(resp.Header.Get("ETag"), `"`),
+	}, nil
+}
+
+// DeleteObject deletes key from the configured bucket. Deleting an object
+// that does not exist succeeds.
+func (s *ObjectStorage) DeleteObject(ctx context.Context, cfg models.StorageConfig, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, cfg, key, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("storage delete failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// ListObjects returns the keys in the configured bucket that start with
+// prefix
+func (s *ObjectStorage) ListObjects(ctx context.Context, cfg models.StorageConfig, prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		// Signature Version 4 wants spaces as %20 in the canonical query
+		resp, err := s.do(ctx, http.MethodGet, cfg, "", strings.ReplaceAll(query.Encode(), "+", "%20"))
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			resp.Body.Close()
+			return nil, fmt.Errorf("storage list failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode storage listing: %w", err)
+		}
+
+		for _, object := range result.Contents {
+			keys = append(keys, object.Key)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// do sends a signed request without a body for key, or for the bucket if
+// key is empty
+func (s *ObjectStorage) do(ctx context.Context, method string, cfg models.StorageConfig, key, rawQuery string) (*http.Response, error) {
+	location, region, err := objectURL(cfg, key)
+	if err != nil {
+		return nil, err
+	}
+	if rawQuery != "" {
+		location += "?" + rawQuery
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, location, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage request: %w", err)
+	}
+	signV4(req, nil, cfg.AccessKeyID, cfg.SecretAccessKey, region, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("storage request failed: %w", err)
+	}
+	return resp, nil
+}
+
+// ParseStorageLocation splits an s3://bucket/key location into its bucket
+// and key
+func ParseStorageLocation(location string) (string, string, bool) {
+	rest := strings.TrimPrefix(location, "s3://")
+	if rest == location {
+		return "", "", false
+	}
+	bucket, key, ok := strings.Cut(rest, "/")
+	if !ok || bucket == "" || key == "" {
+		return "", "", false
+	}
+	return bucket, key, true
+}
+
+// objectURL resolves the URL and signing region of key in the bucket. A
+// custom endpoint is addressed path-style; S3 buckets are virtual-hosted.
+func objectURL(cfg models.StorageConfig, key string) (string, string, error) {
+	if cfg.Bucket == "" || cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return "", "", ErrStorageNotConfigured
+	}
+
+	region := cfg.Region
+	path := "/" + strings.TrimPrefix(key, "/")
+	switch {
+	case cfg.Endpoint != "":
+		if region == "" {
+			region = "auto"
+		}
+		return strings.TrimSuffix(cfg.Endpoint, "/") + "/" + cfg.Bucket + path, region, nil
+	case cfg.Provider == "gcs":
+		return "https://storage.googleapis.com/" + cfg.Bucket + path, "auto", nil
+	case cfg.Provider == "r2":
+		return "", "", fmt.Errorf("%w: r2 storage requires an endpoint", ErrStorageNotConfigured)
+	default:
+		if region == "" {
+			region = "us-east-1"
+		}
+		return fmt.Sprintf("https://%s.s3.%s.amazonaws.com%s", cfg.Bucket, region, path), region, nil
+	}
+}
+
+// signV4 signs an S3 request with AWS Signature Version 4
+func signV4(req *http.Request, body []byte, accessKey, secretKey, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// Content-Type is only signed when set, as HEAD and DELETE send none
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := fmt.Sprintf("host:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n", req.URL.Host, payloadHash, amzDate)
+	if contentType := req.Header.Get("Content-Type"); contentType != "" {
+		signedHeaders = "content-type;" + signedHeaders
+		canonicalHeaders = "content-type:" + contentType + "\n" + canonicalHeaders
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		(&url.URL{Path: req.URL.Path}).EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -3,6 +3,8 @@ package services
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"pulse-control-plane/database"
@@ -15,6 +17,11 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrPlanChangeNotAllowed is returned when an organization update changes the
+// plan. Plan changes go through SubscriptionService so they are charged,
+// prorated and synced with the payment provider.
+var ErrPlanChangeNotAllowed = errors.New("plan cannot be changed here; use the subscription upgrade or downgrade endpoints")
+
 type OrganizationService struct {
 	collection *mongo.Collection
 }
@@ -44,6 +51,7 @@ func (s *OrganizationService) CreateOrganization(ctx context.Context, input *mod
 		Name:       input.Name,
 		AdminEmail: input.AdminEmail,
 		Plan:       input.Plan,
+		BillingDay: time.Now().UTC().Day(),
 		CreatedAt:  time.Now(),
 		UpdatedAt:  time.Now(),
 		IsDeleted:  false,
@@ -136,7 +144,15 @@ func (s *OrganizationService) UpdateOrganization(ctx context.Context, id primiti
 		update["$set"].(bson.M)["name"] = input.Name
 	}
 	if input.Plan != "" {
-		update["$set"].(bson.M)["plan"] = input.Plan
+		// Re-sending the current plan is allowed so clients can send the
+		// whole organization back; anything else is a plan change
+		err := s.collection.FindOne(ctx, bson.M{"_id": id, "plan": input.Plan}).Err()
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrPlanChangeNotAllowed
+		}
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Update the organization
@@ -159,6 +175,43 @@ func (s *OrganizationService) UpdateOrganization(ctx context.Context, id primiti
 	return &org, nil
 }
 
+// UpdateTaxProfile sets an organization's billing address and tax ID. The tax
+// ID is normalized and must be a valid GSTIN or EU VAT ID for the billing
+// country; customers without one are taxed at their country's rate.
+func (s *OrganizationService) UpdateTaxProfile(ctx context.Context, id primitive.ObjectID, profile *models.TaxProfile) (*models.Organization, error) {
+	profile.BillingAddress.Country = strings.ToUpper(profile.BillingAddress.Country)
+	profile.BillingAddress.State = strings.ToUpper(profile.BillingAddress.State)
+	profile.TaxID = NormalizeTaxID(profile.TaxID)
+	profile.TaxIDType = ""
+	profile.TaxIDValid = false
+	if profile.TaxID != "" {
+		idType, ok := ValidateTaxID(profile.BillingAddress.Country, profile.TaxID)
+		if !ok {
+			return nil, fmt.Errorf("invalid tax ID for country %s", profile.BillingAddress.Country)
+		}
+		profile.TaxIDType = idType
+		profile.TaxIDValid = true
+	}
+
+	result := s.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": id, "is_deleted": false},
+		bson.M{"$set": bson.M{"tax_profile": profile, "updated_at": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+
+	var org models.Organization
+	if err := result.Decode(&org); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.New("organization not found")
+		}
+		return nil, err
+	}
+
+	log.Info().Str("org_id", org.ID.Hex()).Str("country", profile.BillingAddress.Country).Msg("Organization tax profile updated")
+	return &org, nil
+}
+
 // DeleteOrganization soft deletes an organization
 func (s *OrganizationService) DeleteOrganization(ctx context.Context, id primitive.ObjectID) error {
 	// Soft delete by setting is_deleted flag
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"pulse-control-plane/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrPaymentProviderNotConfigured is returned when an organization's
+	// provider has no credentials configured
+	ErrPaymentProviderNotConfigured = errors.New("payment provider not configured")
+
+	// ErrPaymentOperationUnsupported is returned for operations a provider
+	// has no equivalent for
+	ErrPaymentOperationUnsupported = errors.New("operation not supported by payment provider")
+
+	// ErrInvalidWebhookSignature is returned when a provider webhook fails
+	// signature verification
+	ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+
+	// ErrPaymentNotConfirmed is returned when a payment has not succeeded or
+	// was not made by the organization claiming it
+	ErrPaymentNotConfirmed = errors.New("payment not confirmed")
+)
+
+// PaymentProvider is a payment gateway organizations are billed through.
+// Amounts passed to providers are in the currency's minor units.
+type PaymentProvider interface {
+	// Name returns the provider's identifier, e.g. models.PaymentProviderStripe
+	Name() string
+
+	// RegisterCustomer creates the organization as a customer and returns its
+	// provider customer ID
+	RegisterCustomer(ctx context.Context, org *models.Organization) (string, error)
+
+	// AttachPaymentMethod attaches a payment method to a customer and makes it
+	// the default for invoices
+	AttachPaymentMethod(ctx context.Context, customerID, paymentMethodID string) error
+
+	// PushInvoice creates the invoice with the provider and starts collection
+	PushInvoice(ctx context.Context, customerID string, invoice *models.Invoice) (*ProviderInvoice, error)
+
+	// CreatePaymentIntent starts a client-side payment of the invoice total
+	CreatePaymentIntent(ctx context.Context, customerID string, invoice *models.Invoice) (*PaymentIntent, error)
+
+	// GetPayment fetches a payment as the provider reports it, so what it
+	// paid for is only granted once the provider confirms it
+	GetPayment(ctx context.Context, paymentID string) (*ProviderPayment, error)
+
+	// RefundPayment refunds amount of a payment, or all of it if amount is 0,
+	// and returns the refund ID
+	RefundPayment(ctx context.Context, paymentID string, amount int64) (string, error)
+
+	// VerifyWebhook checks a webhook's signature and translates it into a
+	// PaymentEvent
+	VerifyWebhook(payload []byte, header http.Header) (*PaymentEvent, error)
+
+	// ParseWebhook translates an already verified webhook payload, e.g. one
+	// being reprocessed from the event store
+	ParseWebhook(payload []byte) (*PaymentEvent, error)
+}
+
+// SubscriptionProvider is a PaymentProvider that runs recurring
+// subscriptions. Changes scheduled for the end of a billing cycle are applied
+// by SubscriptionService when the cycle ends, so providers only make
+// immediate changes.
+type SubscriptionProvider interface {
+	PaymentProvider
+
+	// StartSubscription subscribes a customer to a provider plan
+	StartSubscription(ctx context.Context, orgID primitive.ObjectID, customerID, planID string) (*ProviderSubscription, error)
+
+	// ChangeSubscriptionPlan moves a subscription to another provider plan,
+	// prorating the current period if prorate is set
+	ChangeSubscriptionPlan(ctx context.Context, subscriptionID, planID string, prorate bool) error
+
+	// CancelSubscription ends a subscription now
+	CancelSubscription(ctx context.Context, subscriptionID string) error
+
+	// PauseSubscription stops charging a subscription until it is resumed
+	PauseSubscription(ctx context.Context, subscriptionID string) error
+
+	// ResumeSubscription resumes charging a paused subscription
+	ResumeSubscription(ctx context.Context, subscriptionID string) error
+}
+
+// SubscriptionStatusListener is told when a provider reports a subscription
+// changing state outside our API, e.g. cancelled from the provider's
+// dashboard. status is a models.SubscriptionStatus value.
+type SubscriptionStatusListener func(ctx context.Context, provider, subscriptionID, status string) error
+
+// ProviderSubscription is a subscription as created with a payment provider
+type ProviderSubscription struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+// ProviderInvoice is an invoice as created with a payment provider
+type ProviderInvoice struct {
+	ID     string `json:"id,omitempty"` // empty for providers without invoices, e.g. Razorpay payment links
+	URL    string `json:"url"`          // hosted page the customer pays on
+	Status string `json:"status,omitempty"`
+}
+
+// PaymentIntent is a payment the customer completes client-side
+type PaymentIntent struct {
+	ID           string `json:"id"`
+	ClientSecret string `json:"client_secret,omitempty"` // Stripe.js confirmation secret
+	Amount       int64  `json:"amount"`
+	Currency     string `json:"currency"`
+	Status       string `json:"status"`
+}
+
+// ProviderPayment is a payment as reported by its provider
+type ProviderPayment struct {
+	ID         string `json:"id"`
+	CustomerID string `json:"customer_id"`
+	Amount     int64  `json:"amount"` // received, in minor units
+	Currency   string `json:"currency"`
+	Succeeded  bool   `json:"succeeded"`
+}
+
+// Payment event outcomes
+const (
+	PaymentOutcomePaid   = "paid"
+	PaymentOutcomeFailed = "failed"
+	PaymentOutcomeVoid   = "void"
+)
+
+// PaymentEvent is a verified provider webhook reduced to what billing acts on
+type PaymentEvent struct {
+	ID                string
+	Type              string             // provider event type
+	Outcome           string             // paid, failed or void; empty if no action is needed
+	InvoiceID         primitive.ObjectID // zero if the event does not reference one of our invoices
+	ProviderInvoiceID string
+	PaymentID         string
+	Message           string // failure reason
+
+	SubscriptionID     string
+	SubscriptionStatus string // models.SubscriptionStatus the subscription moved to; empty if unchanged
+}
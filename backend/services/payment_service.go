@@ -0,0 +1,443 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"pulse-control-plane/models"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInvoiceNotCollectable is returned when payment is requested for an
+// invoice that cannot be paid
+var ErrInvoiceNotCollectable = errors.New("invoice cannot be collected")
+
+// PaymentService routes an organization's payments to the provider it chose
+type PaymentService struct {
+	db             *mongo.Database
+	billingService *BillingService
+	events         *ProviderEventStore
+	providers      map[string]PaymentProvider
+
+	// subscriptionListener is told about subscription state changes reported
+	// in webhooks
+	subscriptionListener SubscriptionStatusListener
+}
+
+// NewPaymentService creates a new payment service with the configured
+// providers. Organizations that have not chosen a provider use Razorpay.
+// Webhook handlers are registered with the event store for every provider
+// but Razorpay, whose service registers its own.
+func NewPaymentService(db *mongo.Database, billingService *BillingService, events *ProviderEventStore, providers ...PaymentProvider) *PaymentService {
+	s := &PaymentService{
+		db:             db,
+		billingService: billingService,
+		events:         events,
+		providers:      make(map[string]PaymentProvider, len(providers)),
+	}
+	for _, provider := range providers {
+		s.providers[provider.Name()] = provider
+		if provider.Name() != models.PaymentProviderRazorpay {
+			events.RegisterHandler(provider.Name(), s.applyWebhook(provider))
+		}
+	}
+	return s
+}
+
+// Provider returns a configured provider by name
+func (s *PaymentService) Provider(name string) (PaymentProvider, error) {
+	provider, ok := s.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrPaymentProviderNotConfigured, name)
+	}
+	return provider, nil
+}
+
+// OnSubscriptionStatus registers the listener told when a provider reports a
+// subscription paused, resumed or cancelled on its side, for every provider
+func (s *PaymentService) OnSubscriptionStatus(listener SubscriptionStatusListener) {
+	s.subscriptionListener = listener
+	for _, provider := range s.providers {
+		// Providers that apply their own webhooks notify the listener directly
+		if notifier, ok := provider.(interface {
+			OnSubscriptionStatus(SubscriptionStatusListener)
+		}); ok {
+			notifier.OnSubscriptionStatus(listener)
+		}
+	}
+}
+
+// ProviderFor returns the provider an organization pays through
+func (s *PaymentService) ProviderFor(org *models.Organization) (PaymentProvider, error) {
+	return s.Provider(paymentSettings(org).Provider)
+}
+
+// PaymentSettings is how an organization pays
+type PaymentSettings struct {
+	Provider  string            `json:"provider"`
+	Currency  string            `json:"currency,omitempty"` // the pricing plan's if empty
+	Customers map[string]string `json:"customers,omitempty"`
+}
+
+// GetPaymentSettings returns the provider and currency an organization pays
+// with
+func (s *PaymentService) GetPaymentSettings(ctx context.Context, orgID primitive.ObjectID) (*PaymentSettings, error) {
+	org, err := s.getOrganization(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	return paymentSettings(org), nil
+}
+
+// paymentSettings returns an organization's payment settings with defaults
+// applied
+func paymentSettings(org *models.Organization) *PaymentSettings {
+	provider := org.PaymentProvider
+	if provider == "" {
+		provider = models.PaymentProviderRazorpay
+	}
+	return &PaymentSettings{
+		Provider:  provider,
+		Currency:  org.BillingCurrency,
+		Customers: org.PaymentCustomers,
+	}
+}
+
+// UpdatePaymentSettings sets the provider and currency an organization pays
+// with
+func (s *PaymentService) UpdatePaymentSettings(ctx context.Context, orgID primitive.ObjectID, settings *models.PaymentSettingsUpdate) (*PaymentSettings, error) {
+	if _, err := s.Provider(settings.Provider); err != nil {
+		return nil, err
+	}
+
+	update := bson.M{
+		"payment_provider": settings.Provider,
+		"updated_at":       time.Now(),
+	}
+	if settings.Currency != "" {
+		update["billing_currency"] = strings.ToUpper(settings.Currency)
+	}
+
+	var org models.Organization
+	err := s.db.Collection(models.Organization{}.TableName()).FindOneAndUpdate(ctx,
+		bson.M{"_id": orgID, "is_deleted": false},
+		bson.M{"$set": update},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&org)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.New("organization not found")
+		}
+		return nil, fmt.Errorf("failed to update payment settings: %w", err)
+	}
+	return paymentSettings(&org), nil
+}
+
+// CreateCustomer registers the organization with a provider, or with its own
+// provider if providerName is empty, and returns the customer ID
+func (s *PaymentService) CreateCustomer(ctx context.Context, orgID primitive.ObjectID, providerName string) (string, error) {
+	org, err := s.getOrganization(ctx, orgID)
+	if err != nil {
+		return "", err
+	}
+	provider, err := s.resolve(org, providerName)
+	if err != nil {
+		return "", err
+	}
+	return s.ensureCustomer(ctx, org, provider)
+}
+
+// AttachPaymentMethod attaches a payment method to the organization's
+// customer, registering the customer first if needed
+func (s *PaymentService) AttachPaymentMethod(ctx context.Context, orgID primitive.ObjectID, providerName, paymentMethodID string) error {
+	org, err := s.getOrganization(ctx, orgID)
+	if err != nil {
+		return err
+	}
+	provider, err := s.resolve(org, providerName)
+	if err != nil {
+		return err
+	}
+	customerID, err := s.ensureCustomer(ctx, org, provider)
+	if err != nil {
+		return err
+	}
+	return provider.AttachPaymentMethod(ctx, customerID, paymentMethodID)
+}
+
+// PushInvoice creates an invoice with a provider, or the organization's own if
+// providerName is empty, and records the provider invoice and payment page
+func (s *PaymentService) PushInvoice(ctx context.Context, invoiceID primitive.ObjectID, providerName string) (*ProviderInvoice, error) {
+	invoice, org, err := s.getInvoice(ctx, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCollectable(invoice, org); err != nil {
+		return nil, err
+	}
+	provider, err := s.resolve(org, providerName)
+	if err != nil {
+		return nil, err
+	}
+	customerID, err := s.ensureCustomer(ctx, org, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	pushed, err := provider.PushInvoice(ctx, customerID, invoice)
+	if err != nil {
+		return nil, err
+	}
+
+	update := bson.M{
+		"payment_provider": provider.Name(),
+		"payment_link":     pushed.URL,
+		"updated_at":       time.Now(),
+	}
+	if provider.Name() == models.PaymentProviderStripe {
+		update["stripe_invoice_id"] = pushed.ID
+	}
+	if invoice.Status == models.InvoiceStatusDraft {
+		update["status"] = models.InvoiceStatusIssued
+	}
+	_, err = s.db.Collection(models.Invoice{}.TableName()).UpdateOne(ctx, bson.M{"_id": invoice.ID}, bson.M{"$set": update})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update invoice: %w", err)
+	}
+
+	return pushed, nil
+}
+
+// CreatePaymentIntent starts a client-side payment of an invoice through the
+// organization's provider
+func (s *PaymentService) CreatePaymentIntent(ctx context.Context, invoiceID primitive.ObjectID) (*PaymentIntent, error) {
+	invoice, org, err := s.getInvoice(ctx, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCollectable(invoice, org); err != nil {
+		return nil, err
+	}
+	provider, err := s.ProviderFor(org)
+	if err != nil {
+		return nil, err
+	}
+	customerID, err := s.ensureCustomer(ctx, org, provider)
+	if err != nil {
+		return nil, err
+	}
+	return provider.CreatePaymentIntent(ctx, customerID, invoice)
+}
+
+// VerifyPayment confirms with the provider that a payment succeeded and was
+// made by the organization's customer, so it can be credited
+func (s *PaymentService) VerifyPayment(ctx context.Context, orgID primitive.ObjectID, providerName, paymentID string) (*ProviderPayment, error) {
+	org, err := s.getOrganization(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := s.resolve(org, providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	payment, err := provider.GetPayment(ctx, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if !payment.Succeeded {
+		return nil, fmt.Errorf("%w: payment %s has not succeeded", ErrPaymentNotConfirmed, paymentID)
+	}
+	customerID := org.PaymentCustomers[provider.Name()]
+	if customerID == "" || payment.CustomerID != customerID {
+		return nil, fmt.Errorf("%w: payment %s was not made by this organization", ErrPaymentNotConfirmed, paymentID)
+	}
+	return payment, nil
+}
+
+// RefundInvoicePayment refunds amount, in the invoice currency's minor units,
+// of a payment made against an invoice, or all of it if amount is 0, through
+// the provider the invoice was paid with
+func (s *PaymentService) RefundInvoicePayment(ctx context.Context, invoiceID primitive.ObjectID, paymentID string, amount int64) (string, error) {
+	invoice, org, err := s.getInvoice(ctx, invoiceID)
+	if err != nil {
+		return "", err
+	}
+	provider, err := s.resolve(org, invoice.PaymentProvider)
+	if err != nil {
+		return "", err
+	}
+	return provider.RefundPayment(ctx, paymentID, amount)
+}
+
+// HandleWebhook verifies a provider webhook and hands it to the event store,
+// which applies it once however often the provider delivers it
+func (s *PaymentService) HandleWebhook(ctx context.Context, providerName string, payload []byte, header http.Header) (*models.ProviderEvent, error) {
+	provider, err := s.Provider(providerName)
+	if err != nil {
+		return nil, err
+	}
+	event, err := provider.VerifyWebhook(payload, header)
+	if err != nil {
+		return nil, err
+	}
+	return s.events.Receive(ctx, providerName, event.ID, event.Type, payload)
+}
+
+// applyWebhook applies a stored provider event to the invoice it references:
+// paid and void update the invoice status, failures are recorded on the
+// invoice's billing run for dunning. Subscription state changes go to the
+// subscription listener.
+func (s *PaymentService) applyWebhook(provider PaymentProvider) ProviderEventHandler {
+	return func(ctx context.Context, payload []byte) error {
+		event, err := provider.ParseWebhook(payload)
+		if err != nil {
+			return err
+		}
+		if event.SubscriptionStatus != "" && s.subscriptionListener != nil {
+			return s.subscriptionListener(ctx, provider.Name(), event.SubscriptionID, event.SubscriptionStatus)
+		}
+		if event.Outcome == "" {
+			return nil
+		}
+
+		invoice, err := s.findEventInvoice(ctx, provider, event)
+		if err != nil {
+			return err
+		}
+		if invoice == nil {
+			log.Debug().Str("provider", provider.Name()).Str("event", event.Type).Msg("Payment event does not reference an invoice, ignoring")
+			return nil
+		}
+
+		switch event.Outcome {
+		case PaymentOutcomePaid, PaymentOutcomeVoid:
+			// Reprocessed events must not settle the invoice twice
+			if invoice.Status == event.Outcome {
+				return nil
+			}
+			return s.billingService.UpdateInvoiceStatus(ctx, invoice.ID, event.Outcome)
+
+		case PaymentOutcomeFailed:
+			_, err := s.db.Collection(models.BillingRun{}.TableName()).UpdateOne(ctx,
+				bson.M{"invoice_id": invoice.ID},
+				bson.M{"$set": bson.M{"payment_error": event.Message, "updated_at": time.Now()}},
+			)
+			if err != nil {
+				return fmt.Errorf("failed to record payment failure: %w", err)
+			}
+		}
+		return nil
+	}
+}
+
+// checkCollectable returns an error if an invoice cannot be paid: it is a
+// project statement, settled, or in a different currency than the
+// organization pays in
+func checkCollectable(invoice *models.Invoice, org *models.Organization) error {
+	if invoice.Scope == models.InvoiceScopeProject {
+		return fmt.Errorf("%w: project invoices are statements; pay the organization invoice", ErrInvoiceNotCollectable)
+	}
+	if invoice.Status == models.InvoiceStatusPaid || invoice.Status == models.InvoiceStatusVoid {
+		return fmt.Errorf("%w: invoice is %s", ErrInvoiceNotCollectable, invoice.Status)
+	}
+	if org.BillingCurrency != "" && !strings.EqualFold(invoice.Currency, org.BillingCurrency) {
+		return fmt.Errorf("%w: invoice is in %s but the organization pays in %s", ErrInvoiceNotCollectable, invoice.Currency, org.BillingCurrency)
+	}
+	return nil
+}
+
+// findEventInvoice returns the invoice an event references, by our ID in the
+// provider metadata or else by the provider's invoice ID
+func (s *PaymentService) findEventInvoice(ctx context.Context, provider PaymentProvider, event *PaymentEvent) (*models.Invoice, error) {
+	filter := bson.M{"_id": event.InvoiceID}
+	if event.InvoiceID.IsZero() {
+		if event.ProviderInvoiceID == "" || provider.Name() != models.PaymentProviderStripe {
+			return nil, nil
+		}
+		filter = bson.M{"stripe_invoice_id": event.ProviderInvoiceID}
+	}
+
+	var invoice models.Invoice
+	err := s.db.Collection(models.Invoice{}.TableName()).FindOne(ctx, filter).Decode(&invoice)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find invoice: %w", err)
+	}
+	return &invoice, nil
+}
+
+// resolve returns the named provider, or the organization's own if name is
+// empty
+func (s *PaymentService) resolve(org *models.Organization, name string) (PaymentProvider, error) {
+	if name == "" {
+		return s.ProviderFor(org)
+	}
+	return s.Provider(name)
+}
+
+// ensureCustomer returns the organization's customer ID with a provider,
+// registering it on first use
+func (s *PaymentService) ensureCustomer(ctx context.Context, org *models.Organization, provider PaymentProvider) (string, error) {
+	if customerID := org.PaymentCustomers[provider.Name()]; customerID != "" {
+		return customerID, nil
+	}
+
+	customerID, err := provider.RegisterCustomer(ctx, org)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = s.db.Collection(models.Organization{}.TableName()).UpdateOne(ctx,
+		bson.M{"_id": org.ID},
+		bson.M{"$set": bson.M{
+			"payment_customers." + provider.Name(): customerID,
+			"updated_at":                           time.Now(),
+		}},
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to store customer ID: %w", err)
+	}
+	if org.PaymentCustomers == nil {
+		org.PaymentCustomers = make(map[string]string)
+	}
+	org.PaymentCustomers[provider.Name()] = customerID
+	return customerID, nil
+}
+
+// getOrganization retrieves an organization by ID
+func (s *PaymentService) getOrganization(ctx context.Context, orgID primitive.ObjectID) (*models.Organization, error) {
+	var org models.Organization
+	err := s.db.Collection(models.Organization{}.TableName()).FindOne(ctx, bson.M{"_id": orgID, "is_deleted": false}).Decode(&org)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.New("organization not found")
+		}
+		return nil, fmt.Errorf("failed to find organization: %w", err)
+	}
+	return &org, nil
+}
+
+// getInvoice retrieves an invoice and the organization it bills
+func (s *PaymentService) getInvoice(ctx context.Context, invoiceID primitive.ObjectID) (*models.Invoice, *models.Organization, error) {
+	invoice, err := s.billingService.GetInvoice(ctx, invoiceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	org, err := s.getOrganization(ctx, invoice.OrgID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return invoice, org, nil
+}
@@ -0,0 +1,374 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"pulse-control-plane/models"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrPricingPlanNotFound is returned when a plan version or code does not exist
+var ErrPricingPlanNotFound = errors.New("pricing plan not found")
+
+// PricingService manages versioned pricing plans and which version each
+// organization is billed on. Organizations that were never pinned to a
+// version follow the latest version of their built-in plan's code until that
+// plan changes, at which point they are pinned to the version they had.
+type PricingService struct {
+	db *mongo.Database
+}
+
+// NewPricingService creates a new pricing service
+func NewPricingService(db *mongo.Database) *PricingService {
+	return &PricingService{db: db}
+}
+
+// InitializeDefaultPlans stores version 1 of the built-in plans if their codes
+// do not exist yet
+func (s *PricingService) InitializeDefaultPlans(ctx context.Context) error {
+	collection := s.db.Collection(models.PricingPlan{}.TableName())
+
+	for _, name := range []string{"Free", "Pro", "Enterprise"} {
+		plan := models.DefaultPricingPlan(name)
+		plan.CreatedAt = time.Now()
+		_, err := collection.UpdateOne(ctx,
+			bson.M{"code": plan.Code},
+			bson.M{"$setOnInsert": plan},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to initialize %s pricing plan: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// CreatePlan stores version 1 of a new plan code
+func (s *PricingService) CreatePlan(ctx context.Context, plan *models.PricingPlan) error {
+	if plan.Code == "" {
+		return errors.New("code is required")
+	}
+	if err := plan.Validate(); err != nil {
+		return err
+	}
+
+	if _, err := s.GetLatestPlan(ctx, plan.Code); err == nil {
+		return fmt.Errorf("pricing plan %q already exists", plan.Code)
+	}
+
+	plan.ID = primitive.NilObjectID
+	plan.Version = 1
+	plan.Status = models.PricingPlanStatusActive
+	plan.SupersededAt = nil
+	plan.CreatedAt = time.Now()
+
+	result, err := s.db.Collection(models.PricingPlan{}.TableName()).InsertOne(ctx, plan)
+	if err != nil {
+		return fmt.Errorf("failed to create pricing plan: %w", err)
+	}
+	plan.ID = result.InsertedID.(primitive.ObjectID)
+
+	log.Info().Str("code", plan.Code).Msg("Pricing plan created")
+	return nil
+}
+
+// PublishVersion stores plan as the next version of code. Organizations
+// following the current version implicitly are pinned to it first, so only
+// new subscribers get the new prices.
+func (s *PricingService) PublishVersion(ctx context.Context, code string, plan *models.PricingPlan) error {
+	if err := plan.Validate(); err != nil {
+		return err
+	}
+
+	current, err := s.GetLatestPlan(ctx, code)
+	if err != nil {
+		return err
+	}
+
+	// Grandfather subscribers on the built-in plan with this code
+	orgs := s.db.Collection(models.Organization{}.TableName())
+	pinned, err := orgs.UpdateMany(ctx,
+		bson.M{
+			"pricing_plan_id": bson.M{"$exists": false},
+			"plan":            bson.M{"$regex": "^" + regexp.QuoteMeta(code) + "$", "$options": "i"},
+		},
+		bson.M{"$set": bson.M{"pricing_plan_id": current.ID, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to pin subscribers: %w", err)
+	}
+
+	now := time.Now()
+	plan.ID = primitive.NilObjectID
+	plan.Code = current.Code
+	plan.Version = current.Version + 1
+	plan.Status = models.PricingPlanStatusActive
+	plan.SupersededAt = nil
+	plan.CreatedAt = now
+
+	collection := s.db.Collection(models.PricingPlan{}.TableName())
+	result, err := collection.InsertOne(ctx, plan)
+	if err != nil {
+		return fmt.Errorf("failed to publish pricing plan: %w", err)
+	}
+	plan.ID = result.InsertedID.(primitive.ObjectID)
+
+	_, err = collection.UpdateMany(ctx,
+		bson.M{"code": plan.Code, "version": bson.M{"$lt": plan.Version}, "status": models.PricingPlanStatusActive},
+		bson.M{"$set": bson.M{"status": models.PricingPlanStatusSuperseded, "superseded_at": now}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to supersede previous versions: %w", err)
+	}
+
+	log.Info().
+		Str("code", plan.Code).
+		Int("version", plan.Version).
+		Int64("grandfathered_orgs", pinned.ModifiedCount).
+		Msg("Pricing plan version published")
+	return nil
+}
+
+// GetPlan retrieves a plan version by ID
+func (s *PricingService) GetPlan(ctx context.Context, planID primitive.ObjectID) (*models.PricingPlan, error) {
+	var plan models.PricingPlan
+	err := s.db.Collection(models.PricingPlan{}.TableName()).FindOne(ctx, bson.M{"_id": planID}).Decode(&plan)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrPricingPlanNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pricing plan: %w", err)
+	}
+	return &plan, nil
+}
+
+// GetLatestPlan retrieves the newest version of a plan code
+func (s *PricingService) GetLatestPlan(ctx context.Context, code string) (*models.PricingPlan, error) {
+	var plan models.PricingPlan
+	err := s.db.Collection(models.PricingPlan{}.TableName()).FindOne(ctx,
+		bson.M{"code": code},
+		options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}}),
+	).Decode(&plan)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrPricingPlanNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pricing plan: %w", err)
+	}
+	return &plan, nil
+}
+
+// ListPlans lists plan versions. With an empty code only the active version
+// of each plan is returned; custom plans are included only if requested.
+func (s *PricingService) ListPlans(ctx context.Context, code string, includeCustom bool) ([]models.PricingPlan, error) {
+	filter := bson.M{"status": models.PricingPlanStatusActive}
+	if code != "" {
+		filter = bson.M{"code": code}
+	}
+	if !includeCustom {
+		filter["is_custom"] = false
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "code", Value: 1}, {Key: "version", Value: -1}})
+	cursor, err := s.db.Collection(models.PricingPlan{}.TableName()).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find pricing plans: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	plans := []models.PricingPlan{}
+	if err := cursor.All(ctx, &plans); err != nil {
+		return nil, fmt.Errorf("failed to decode pricing plans: %w", err)
+	}
+	return plans, nil
+}
+
+// AssignPlan moves an organization onto a plan version and records the
+// change in its plan history, so the next invoice prorates both plans. The
+// organization's limits follow the plan's LimitsPlan. Assigning the version
+// the organization is already on is a no-op and returns nil.
+func (s *PricingService) AssignPlan(ctx context.Context, orgID primitive.ObjectID, plan *models.PricingPlan, changedBy string) (*models.PlanChange, error) {
+	return s.AssignPlanAt(ctx, orgID, plan, changedBy, time.Now())
+}
+
+// AssignPlanAt is AssignPlan for a change that took effect at effectiveAt,
+// e.g. a downgrade scheduled for the end of a billing cycle and applied
+// shortly after it
+func (s *PricingService) AssignPlanAt(ctx context.Context, orgID primitive.ObjectID, plan *models.PricingPlan, changedBy string, effectiveAt time.Time) (*models.PlanChange, error) {
+	org, current, err := s.ResolveOrgPlan(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	if samePlanVersion(current, plan) {
+		return nil, nil
+	}
+
+	now := time.Now()
+	update := bson.M{"$set": bson.M{"plan": plan.LimitsPlan, "updated_at": now}}
+	if plan.ID.IsZero() {
+		// Built-in defaults that were never stored follow the plan name
+		update["$unset"] = bson.M{"pricing_plan_id": ""}
+	} else {
+		update["$set"].(bson.M)["pricing_plan_id"] = plan.ID
+	}
+
+	result, err := s.db.Collection(models.Organization{}.TableName()).UpdateOne(ctx,
+		bson.M{"_id": org.ID, "is_deleted": false}, update)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assign pricing plan: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return nil, errors.New("organization not found")
+	}
+
+	change := models.PlanChange{
+		OrgID:       org.ID,
+		FromPlan:    *current,
+		ToPlan:      *plan,
+		EffectiveAt: effectiveAt,
+		ChangedBy:   changedBy,
+		CreatedAt:   now,
+	}
+	inserted, err := s.db.Collection(models.PlanChange{}.TableName()).InsertOne(ctx, change)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record plan change: %w", err)
+	}
+	change.ID = inserted.InsertedID.(primitive.ObjectID)
+
+	log.Info().
+		Str("org_id", orgID.Hex()).
+		Str("from", fmt.Sprintf("%s v%d", current.Code, current.Version)).
+		Str("to", fmt.Sprintf("%s v%d", plan.Code, plan.Version)).
+		Msg("Organization pricing plan changed")
+	return &change, nil
+}
+
+// samePlanVersion reports whether two plans are the same stored version, or
+// the same built-in default
+func samePlanVersion(a, b *models.PricingPlan) bool {
+	if !a.ID.IsZero() || !b.ID.IsZero() {
+		return a.ID == b.ID
+	}
+	return a.Code == b.Code && a.Version == b.Version
+}
+
+// ListPlanChanges returns an organization's plan history, newest first
+func (s *PricingService) ListPlanChanges(ctx context.Context, orgID primitive.ObjectID) ([]models.PlanChange, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "effective_at", Value: -1}})
+	cursor, err := s.db.Collection(models.PlanChange{}.TableName()).Find(ctx, bson.M{"org_id": orgID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find plan changes: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	changes := []models.PlanChange{}
+	if err := cursor.All(ctx, &changes); err != nil {
+		return nil, fmt.Errorf("failed to decode plan changes: %w", err)
+	}
+	return changes, nil
+}
+
+// PlanTimeline returns the plan an organization was on at periodStart and the
+// changes that took effect during [periodStart, periodEnd), oldest first. It
+// reads only the plan history, so past periods price the same every time;
+// current is the opening plan of organizations that never changed plans.
+func (s *PricingService) PlanTimeline(ctx context.Context, orgID primitive.ObjectID, current *models.PricingPlan, periodStart, periodEnd time.Time) (*models.PricingPlan, []models.PlanChange, error) {
+	collection := s.db.Collection(models.PlanChange{}.TableName())
+
+	// The last change before the period decides the opening plan
+	var before models.PlanChange
+	err := collection.FindOne(ctx,
+		bson.M{"org_id": orgID, "effective_at": bson.M{"$lt": periodStart}},
+		options.FindOne().SetSort(bson.D{{Key: "effective_at", Value: -1}}),
+	).Decode(&before)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, nil, fmt.Errorf("failed to find plan history: %w", err)
+	}
+	hasBefore := err == nil
+
+	cursor, err := collection.Find(ctx,
+		bson.M{"org_id": orgID, "effective_at": bson.M{"$gte": periodStart}},
+		options.Find().SetSort(bson.D{{Key: "effective_at", Value: 1}}),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find plan history: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var later []models.PlanChange
+	if err := cursor.All(ctx, &later); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode plan history: %w", err)
+	}
+
+	var opening *models.PricingPlan
+	switch {
+	case hasBefore:
+		opening = &before.ToPlan
+	case len(later) > 0:
+		opening = &later[0].FromPlan
+	default:
+		opening = current
+	}
+
+	changes := []models.PlanChange{}
+	for _, change := range later {
+		if change.EffectiveAt.Before(periodEnd) {
+			changes = append(changes, change)
+		}
+	}
+
+	return opening, changes, nil
+}
+
+// ResolvePlan returns the plan version an organization is billed on: its
+// pinned version, else the latest version of its built-in plan, else the
+// built-in default
+func (s *PricingService) ResolvePlan(ctx context.Context, org *models.Organization) (*models.PricingPlan, error) {
+	if org.PricingPlanID != nil {
+		return s.GetPlan(ctx, *org.PricingPlanID)
+	}
+	return s.LatestPlanFor(ctx, org.Plan)
+}
+
+// LatestPlanFor returns the latest version of a built-in plan, or its default
+// if none is stored
+func (s *PricingService) LatestPlanFor(ctx context.Context, planName string) (*models.PricingPlan, error) {
+	plan, err := s.GetLatestPlan(ctx, models.PlanCode(planName))
+	if err == nil {
+		return plan, nil
+	}
+	if !errors.Is(err, ErrPricingPlanNotFound) {
+		return nil, err
+	}
+
+	fallback := models.DefaultPricingPlan(planName)
+	return &fallback, nil
+}
+
+// ResolveOrgPlan loads an organization and resolves its plan version
+func (s *PricingService) ResolveOrgPlan(ctx context.Context, orgID primitive.ObjectID) (*models.Organization, *models.PricingPlan, error) {
+	var org models.Organization
+	err := s.db.Collection(models.Organization{}.TableName()).FindOne(ctx, bson.M{"_id": orgID}).Decode(&org)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil, errors.New("organization not found")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find organization: %w", err)
+	}
+
+	plan, err := s.ResolvePlan(ctx, &org)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &org, plan, nil
+}
@@ -18,16 +18,22 @@ import (
 
 type ProjectService struct {
 	collection *mongo.Collection
+	eventBus   *EventBus
 }
 
-func NewProjectService() *ProjectService {
+func NewProjectService(eventBus *EventBus) *ProjectService {
 	return &ProjectService{
 		collection: database.GetCollection("projects"),
+		eventBus:   eventBus,
 	}
 }
 
 // CreateProject creates a new project with API keys
 func (s *ProjectService) CreateProject(ctx context.Context, orgID primitive.ObjectID, input *models.ProjectCreate) (*models.Project, string, error) {
+	if err := ValidateWebhookRules(input.WebhookFilter, input.WebhookTemplate); err != nil {
+		return nil, "", err
+	}
+
 	// Generate API key and secret
 	apiKey, err := utils.GenerateAPIKey()
 	if err != nil {
@@ -53,6 +59,8 @@ func (s *ProjectService) CreateProject(ctx context.Context, orgID primitive.Obje
 		PulseAPIKey:         apiKey,
 		PulseAPISecret:      hashedSecret,
 		WebhookURL:          input.WebhookURL,
+		WebhookFilter:       input.WebhookFilter,
+		WebhookTemplate:     input.WebhookTemplate,
 		StorageConfig:       input.Storage,
 		Region:              input.Region,
 		LiveKitURL:          "", // Will be set based on region
@@ -160,6 +168,18 @@ func (s *ProjectService) UpdateProject(ctx context.Context, id primitive.ObjectI
 	if input.WebhookURL != "" {
 		update["$set"].(bson.M)["webhook_url"] = input.WebhookURL
 	}
+	if input.WebhookFilter != nil {
+		if err := ValidateWebhookRules(*input.WebhookFilter, ""); err != nil {
+			return nil, err
+		}
+		update["$set"].(bson.M)["webhook_filter"] = *input.WebhookFilter
+	}
+	if input.WebhookTemplate != nil {
+		if err := ValidateWebhookRules("", *input.WebhookTemplate); err != nil {
+			return nil, err
+		}
+		update["$set"].(bson.M)["webhook_template"] = *input.WebhookTemplate
+	}
 
 	// Update storage config if provided
 	if input.Storage.Provider != "" {
@@ -186,6 +206,34 @@ func (s *ProjectService) UpdateProject(ctx context.Context, id primitive.ObjectI
 	return &project, nil
 }
 
+// SetConcurrencyOverrides replaces a project's concurrency limit overrides.
+// nil clears them, so the project follows its organization's plan.
+func (s *ProjectService) SetConcurrencyOverrides(ctx context.Context, id primitive.ObjectID, overrides *models.ConcurrencyLimitOverrides) (*models.Project, error) {
+	update := bson.M{
+		"$set":   bson.M{"updated_at": time.Now()},
+		"$unset": bson.M{"concurrency_overrides": ""},
+	}
+	if overrides != nil {
+		update = bson.M{"$set": bson.M{"concurrency_overrides": overrides, "updated_at": time.Now()}}
+	}
+
+	var project models.Project
+	err := s.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "is_deleted": false},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&project)
+	if err == mongo.ErrNoDocuments {
+		return nil, errors.New("project not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Str("project_id", project.ID.Hex()).Bool("cleared", overrides == nil).Msg("Project concurrency overrides updated")
+	return &project, nil
+}
+
 // DeleteProject soft deletes a project
 func (s *ProjectService) DeleteProject(ctx context.Context, id primitive.ObjectID) error {
 	// Soft delete by setting is_deleted flag
@@ -258,6 +306,14 @@ func (s *ProjectService) RegenerateAPIKeys(ctx context.Context, id primitive.Obj
 
 	log.Info().Str("project_id", id.Hex()).Msg("API keys regenerated")
 
+	// Never include the secret in the event
+	s.eventBus.PublishAsync(id, &models.WebhookPayload{
+		Event: models.WebhookEventProjectKeyRotated,
+		Metadata: map[string]interface{}{
+			"api_key": apiKey,
+		},
+	})
+
 	// Return new keys (only time secret is returned)
 	return apiKey, apiSecret, nil
 }
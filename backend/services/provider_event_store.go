@@ -0,0 +1,283 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"pulse-control-plane/models"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// MaxProviderEventAttempts is how many times a failing event is processed
+	// before it is left for an operator to reprocess
+	MaxProviderEventAttempts = 10
+
+	// staleProviderEventClaim is how long a processing claim is honoured
+	// before the event may be taken over, e.g. after a crash mid-handler
+	staleProviderEventClaim = 10 * time.Minute
+)
+
+// ProviderEventHandler applies a verified provider event's payload
+type ProviderEventHandler func(ctx context.Context, payload []byte) error
+
+// ProviderEventStore persists payment provider webhook events and applies
+// each one exactly once through the handler registered for its provider
+type ProviderEventStore struct {
+	db       *mongo.Database
+	handlers map[string]ProviderEventHandler
+}
+
+// NewProviderEventStore creates a new provider event store
+func NewProviderEventStore(db *mongo.Database) *ProviderEventStore {
+	return &ProviderEventStore{
+		db:       db,
+		handlers: make(map[string]ProviderEventHandler),
+	}
+}
+
+// RegisterHandler sets the handler that applies a provider's events. Handlers
+// are registered at startup, before events are received.
+func (s *ProviderEventStore) RegisterHandler(provider string, handler ProviderEventHandler) {
+	s.handlers[provider] = handler
+}
+
+// ProviderEventRetryDelay returns how long to wait before processing an event
+// again after its nth failed attempt: one minute, doubling up to six hours
+func ProviderEventRetryDelay(attempts int) time.Duration {
+	delay := time.Minute
+	for i := 1; i < attempts && delay < 6*time.Hour; i++ {
+		delay *= 2
+	}
+	if delay > 6*time.Hour {
+		delay = 6 * time.Hour
+	}
+	return delay
+}
+
+// Receive stores a verified event and processes it. A redelivered event is not
+// processed again unless its earlier attempt failed. Handler failures are
+// recorded on the event for retry rather than returned.
+func (s *ProviderEventStore) Receive(ctx context.Context, provider, eventID, eventType string, payload []byte) (*models.ProviderEvent, error) {
+	collection := s.db.Collection(models.ProviderEvent{}.TableName())
+	now := time.Now()
+
+	event := &models.ProviderEvent{
+		ID:         primitive.NewObjectID(),
+		Provider:   provider,
+		EventID:    eventID,
+		Type:       eventType,
+		Payload:    string(payload),
+		Status:     models.ProviderEventStatusReceived,
+		Deliveries: 1,
+		ReceivedAt: now,
+		UpdatedAt:  now,
+	}
+	_, err := collection.InsertOne(ctx, event)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return nil, fmt.Errorf("failed to store provider event: %w", err)
+	}
+
+	if err != nil {
+		err = collection.FindOneAndUpdate(ctx,
+			bson.M{"provider": provider, "event_id": eventID},
+			bson.M{"$inc": bson.M{"deliveries": 1}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(event)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find provider event: %w", err)
+		}
+		log.Debug().Str("provider", provider).Str("event_id", eventID).Str("status", event.Status).Msg("Provider event redelivered")
+	}
+
+	return s.process(ctx, event.ID, models.ProviderEventStatusReceived, models.ProviderEventStatusFailed)
+}
+
+// Reprocess applies a stored event again, whatever its outcome so far
+func (s *ProviderEventStore) Reprocess(ctx context.Context, id primitive.ObjectID) (*models.ProviderEvent, error) {
+	event, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if event.Status == models.ProviderEventStatusProcessing && time.Since(event.UpdatedAt) < staleProviderEventClaim {
+		return nil, errors.New("provider event is being processed")
+	}
+	return s.process(ctx, id,
+		models.ProviderEventStatusReceived,
+		models.ProviderEventStatusFailed,
+		models.ProviderEventStatusDead,
+		models.ProviderEventStatusProcessed,
+	)
+}
+
+// RetryDue processes failed events whose retry is due, up to limit, and
+// returns how many were processed successfully
+func (s *ProviderEventStore) RetryDue(ctx context.Context, now time.Time, limit int) (int, error) {
+	cursor, err := s.db.Collection(models.ProviderEvent{}.TableName()).Find(ctx,
+		bson.M{
+			"$or": bson.A{
+				bson.M{"status": models.ProviderEventStatusFailed, "next_attempt_at": bson.M{"$lte": now}},
+				// Abandoned mid-handler, or stored but never processed
+				bson.M{"status": bson.M{"$in": bson.A{models.ProviderEventStatusProcessing, models.ProviderEventStatusReceived}}, "updated_at": bson.M{"$lt": now.Add(-staleProviderEventClaim)}},
+			},
+		},
+		options.Find().SetSort(bson.D{{Key: "received_at", Value: 1}}).SetLimit(int64(limit)).SetProjection(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list due provider events: %w", err)
+	}
+	var due []models.ProviderEvent
+	if err := cursor.All(ctx, &due); err != nil {
+		return 0, fmt.Errorf("failed to decode provider events: %w", err)
+	}
+
+	processed := 0
+	for _, event := range due {
+		result, err := s.process(ctx, event.ID, models.ProviderEventStatusFailed, models.ProviderEventStatusReceived)
+		if err != nil {
+			return processed, err
+		}
+		if result.Status == models.ProviderEventStatusProcessed {
+			processed++
+		}
+	}
+	return processed, nil
+}
+
+// process claims the event if it is in one of the given statuses (or its
+// processing claim is stale), runs its provider's handler and records the
+// outcome. If another caller holds the event it is returned unchanged.
+func (s *ProviderEventStore) process(ctx context.Context, id primitive.ObjectID, statuses ...string) (*models.ProviderEvent, error) {
+	collection := s.db.Collection(models.ProviderEvent{}.TableName())
+	now := time.Now()
+
+	var event models.ProviderEvent
+	err := collection.FindOneAndUpdate(ctx,
+		bson.M{
+			"_id": id,
+			"$or": bson.A{
+				bson.M{"status": bson.M{"$in": statuses}},
+				bson.M{"status": models.ProviderEventStatusProcessing, "updated_at": bson.M{"$lt": now.Add(-staleProviderEventClaim)}},
+			},
+		},
+		bson.M{
+			"$set": bson.M{"status": models.ProviderEventStatusProcessing, "updated_at": now},
+			"$inc": bson.M{"attempts": 1},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&event)
+	if err == mongo.ErrNoDocuments {
+		return s.Get(ctx, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim provider event: %w", err)
+	}
+
+	handlerErr := errors.New("no handler registered for provider " + event.Provider)
+	if handler, ok := s.handlers[event.Provider]; ok {
+		handlerErr = handler(ctx, []byte(event.Payload))
+	}
+
+	now = time.Now()
+	update := bson.M{"updated_at": now}
+	unset := bson.M{}
+	if handlerErr == nil {
+		update["status"] = models.ProviderEventStatusProcessed
+		update["processed_at"] = now
+		unset["error"] = ""
+		unset["next_attempt_at"] = ""
+	} else if event.Attempts >= MaxProviderEventAttempts {
+		update["status"] = models.ProviderEventStatusDead
+		update["error"] = handlerErr.Error()
+		unset["next_attempt_at"] = ""
+	} else {
+		update["status"] = models.ProviderEventStatusFailed
+		update["error"] = handlerErr.Error()
+		update["next_attempt_at"] = now.Add(ProviderEventRetryDelay(event.Attempts))
+	}
+
+	// Record the outcome even if the request that delivered the event has
+	// been cancelled
+	changes := bson.M{"$set": update}
+	if len(unset) > 0 {
+		changes["$unset"] = unset
+	}
+	recordCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = collection.FindOneAndUpdate(recordCtx,
+		bson.M{"_id": id},
+		changes,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record provider event outcome: %w", err)
+	}
+
+	if handlerErr != nil {
+		log.Warn().Err(handlerErr).
+			Str("provider", event.Provider).
+			Str("event_id", event.EventID).
+			Str("type", event.Type).
+			Int("attempts", event.Attempts).
+			Msg("Provider event handler failed")
+	}
+	return &event, nil
+}
+
+// Get retrieves a stored event
+func (s *ProviderEventStore) Get(ctx context.Context, id primitive.ObjectID) (*models.ProviderEvent, error) {
+	var event models.ProviderEvent
+	err := s.db.Collection(models.ProviderEvent{}.TableName()).FindOne(ctx, bson.M{"_id": id}).Decode(&event)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.New("provider event not found")
+		}
+		return nil, fmt.Errorf("failed to get provider event: %w", err)
+	}
+	return &event, nil
+}
+
+// List retrieves stored events, newest first, optionally filtered by
+// provider, status and type
+func (s *ProviderEventStore) List(ctx context.Context, provider, status, eventType string, page, limit int) ([]models.ProviderEvent, int64, error) {
+	collection := s.db.Collection(models.ProviderEvent{}.TableName())
+
+	filter := bson.M{}
+	if provider != "" {
+		filter["provider"] = provider
+	}
+	if status != "" {
+		filter["status"] = status
+	}
+	if eventType != "" {
+		filter["type"] = eventType
+	}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count provider events: %w", err)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "received_at", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list provider events: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	events := []models.ProviderEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode provider events: %w", err)
+	}
+	return events, total, nil
+}
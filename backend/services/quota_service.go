@@ -0,0 +1,333 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"pulse-control-plane/models"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Quota-checked actions
+const (
+	QuotaActionToken   = "token"
+	QuotaActionEgress  = "egress"
+	QuotaActionIngress = "ingress"
+)
+
+// quotaCacheTTL bounds how stale a cached quota state can be. Usage lands
+// through the metering pipeline with a few seconds of delay anyway.
+const quotaCacheTTL = time.Minute
+
+// quotaActionMetrics lists the metrics that gate each action. The API request
+// allowance gates everything and is reported as 429 rather than 402.
+var quotaActionMetrics = map[string][]string{
+	QuotaActionToken:   {models.QuotaMetricAPIRequests, models.QuotaMetricParticipantMinutes, models.QuotaMetricBandwidthGB},
+	QuotaActionEgress:  {models.QuotaMetricAPIRequests, models.QuotaMetricEgressMinutes, models.QuotaMetricStorageGB, models.QuotaMetricBandwidthGB},
+	QuotaActionIngress: {models.QuotaMetricAPIRequests, models.QuotaMetricParticipantMinutes, models.QuotaMetricBandwidthGB},
+}
+
+// QuotaExceededError is returned when an action would exceed a hard limit
+// or a budget's spend cap
+type QuotaExceededError struct {
+	Code       string    `json:"code"`
+	Metric     string    `json:"metric"`
+	Plan       string    `json:"plan"`
+	Usage      float64   `json:"usage"`
+	Limit      float64   `json:"limit"`
+	ResetsAt   time.Time `json:"resets_at"`
+	HTTPStatus int       `json:"-"`
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s quota exceeded on %s plan (%.2f of %.2f)", e.Metric, e.Plan, e.Usage, e.Limit)
+}
+
+type cachedQuotaState struct {
+	state     *models.QuotaState
+	expiresAt time.Time
+}
+
+// QuotaService enforces plan limits for the current billing month. Limits
+// belong to the organization's plan, so usage is summed across all of its
+// projects. A nil *QuotaService allows everything, so callers without quotas
+// can pass nil.
+type QuotaService struct {
+	db           *mongo.Database
+	usageService *UsageService
+
+	mu        sync.RWMutex
+	cache     map[primitive.ObjectID]cachedQuotaState
+	lastSweep time.Time // when expired cache entries were last evicted
+}
+
+// NewQuotaService creates a new quota service
+func NewQuotaService(db *mongo.Database, usageService *UsageService) *QuotaService {
+	return &QuotaService{
+		db:           db,
+		usageService: usageService,
+		cache:        make(map[primitive.ObjectID]cachedQuotaState),
+	}
+}
+
+// Enforce returns a *QuotaExceededError if the project is over a hard limit
+// for the action, or a spend cap on it or its organization has been reached.
+// Usage inside the grace band is allowed with a warning. If
+// the quota state cannot be computed the action is allowed: a metering outage
+// should not take customers' calls down with it.
+func (s *QuotaService) Enforce(ctx context.Context, project *models.Project, action string) error {
+	if s == nil || project == nil {
+		return nil
+	}
+
+	state, err := s.GetQuotaState(ctx, project.OrgID)
+	if err != nil {
+		log.Error().Err(err).Str("project_id", project.ID.Hex()).Msg("Failed to compute quota state, allowing request")
+		return nil
+	}
+
+	for _, spendCap := range state.SpendCaps {
+		if spendCap.Applies(project.ID) {
+			return &QuotaExceededError{
+				Code:       "spend_cap_reached",
+				Metric:     "spend",
+				Plan:       state.Plan,
+				Usage:      spendCap.Spend,
+				Limit:      spendCap.Amount,
+				ResetsAt:   spendCap.Until,
+				HTTPStatus: http.StatusPaymentRequired,
+			}
+		}
+	}
+
+	for _, metric := range quotaActionMetrics[action] {
+		m, ok := state.Metrics[metric]
+		if !ok {
+			continue
+		}
+
+		switch m.Status {
+		case models.QuotaStatusExceeded:
+			status := http.StatusPaymentRequired
+			if metric == models.QuotaMetricAPIRequests {
+				status = http.StatusTooManyRequests
+			}
+			return &QuotaExceededError{
+				Code:       "quota_exceeded",
+				Metric:     metric,
+				Plan:       state.Plan,
+				Usage:      m.Usage,
+				Limit:      m.Limit,
+				ResetsAt:   state.PeriodEnd,
+				HTTPStatus: status,
+			}
+		case models.QuotaStatusGrace:
+			log.Warn().
+				Str("project_id", project.ID.Hex()).
+				Str("metric", metric).
+				Float64("usage", m.Usage).
+				Float64("limit", m.Limit).
+				Msg("Project over quota, within grace")
+		}
+	}
+
+	return nil
+}
+
+// GetQuotaState returns the organization's quota position for the current
+// month, served from cache when fresh
+func (s *QuotaService) GetQuotaState(ctx context.Context, orgID primitive.ObjectID) (*models.QuotaState, error) {
+	s.mu.RLock()
+	cached, ok := s.cache[orgID]
+	s.mu.RUnlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.state, nil
+	}
+
+	state, err := s.computeQuotaState(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	s.cache[orgID] = cachedQuotaState{state: state, expiresAt: now.Add(quotaCacheTTL)}
+	// Evict organizations that stopped making requests, at most once per
+	// TTL, so the cache only holds recently active organizations
+	if now.Sub(s.lastSweep) >= quotaCacheTTL {
+		for id, entry := range s.cache {
+			if !now.Before(entry.expiresAt) {
+				delete(s.cache, id)
+			}
+		}
+		s.lastSweep = now
+	}
+	s.mu.Unlock()
+
+	return state, nil
+}
+
+// Invalidate drops all cached quota states, e.g. after a plan or limit change
+func (s *QuotaService) Invalidate() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.cache = make(map[primitive.ObjectID]cachedQuotaState)
+	s.mu.Unlock()
+}
+
+// GetLimitOverrides returns the organization's limit overrides, or nil if none
+func (s *QuotaService) GetLimitOverrides(ctx context.Context, orgID primitive.ObjectID) (*models.PlanLimitOverrides, error) {
+	org, err := s.getOrganization(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	return org.LimitOverrides, nil
+}
+
+// SetLimitOverrides replaces the organization's limit overrides. Passing nil
+// clears them so the plan limits apply again.
+func (s *QuotaService) SetLimitOverrides(ctx context.Context, orgID primitive.ObjectID, overrides *models.PlanLimitOverrides) error {
+	collection := s.db.Collection(models.Organization{}.TableName())
+
+	update := bson.M{"$unset": bson.M{"limit_overrides": ""}, "$set": bson.M{"updated_at": time.Now()}}
+	if overrides != nil {
+		overrides.UpdatedAt = time.Now()
+		update = bson.M{"$set": bson.M{"limit_overrides": overrides, "updated_at": time.Now()}}
+	}
+
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": orgID, "is_deleted": false}, update)
+	if err != nil {
+		return fmt.Errorf("failed to update limit overrides: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("organization not found")
+	}
+
+	s.Invalidate()
+
+	log.Info().Str("org_id", orgID.Hex()).Bool("cleared", overrides == nil).Msg("Organization limit overrides updated")
+	return nil
+}
+
+// computeQuotaState compares the org's month-to-date usage with its effective limits
+func (s *QuotaService) computeQuotaState(ctx context.Context, orgID primitive.ObjectID) (*models.QuotaState, error) {
+	org, err := s.getOrganization(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := org.LimitOverrides.Apply(models.GetPlanLimits(org.Plan))
+
+	now := time.Now()
+	periodStart, periodEnd := PeriodBounds(models.PeriodMonthly, now)
+	orgUsage, err := s.usageService.GetOrgUsageSummary(ctx, orgID, periodStart, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage summary: %w", err)
+	}
+	summary := orgUsage.Totals
+
+	grace := limits.GracePercentage
+	state := &models.QuotaState{
+		OrgID:       org.ID.Hex(),
+		Plan:        org.Plan,
+		PeriodStart: periodStart,
+		PeriodEnd:   periodEnd,
+		Metrics: map[string]models.QuotaMetricState{
+			models.QuotaMetricParticipantMinutes: quotaMetric(models.QuotaMetricParticipantMinutes, summary.ParticipantMinutes, limits.MaxParticipantMinutes, grace),
+			models.QuotaMetricEgressMinutes:      quotaMetric(models.QuotaMetricEgressMinutes, summary.EgressMinutes, limits.MaxEgressMinutes, grace),
+			models.QuotaMetricStorageGB:          quotaMetric(models.QuotaMetricStorageGB, summary.StorageGB, limits.MaxStorageGB, grace),
+			models.QuotaMetricBandwidthGB:        quotaMetric(models.QuotaMetricBandwidthGB, summary.BandwidthGB, limits.MaxBandwidthGB, grace),
+			models.QuotaMetricAPIRequests:        quotaMetric(models.QuotaMetricAPIRequests, float64(summary.APIRequests), float64(limits.MaxAPIRequests), grace),
+		},
+		ComputedAt: now,
+	}
+
+	state.SpendCaps, err = s.spendCaps(ctx, orgID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// spendCaps returns the organization's budget caps in force
+func (s *QuotaService) spendCaps(ctx context.Context, orgID primitive.ObjectID, now time.Time) ([]models.SpendCap, error) {
+	cursor, err := s.db.Collection(models.Budget{}.TableName()).Find(ctx, bson.M{
+		"org_id":       orgID,
+		"hard_cap":     true,
+		"capped_until": bson.M{"$gt": now},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find capped budgets: %w", err)
+	}
+	var budgets []models.Budget
+	if err := cursor.All(ctx, &budgets); err != nil {
+		return nil, fmt.Errorf("failed to decode budgets: %w", err)
+	}
+
+	caps := make([]models.SpendCap, 0, len(budgets))
+	for _, budget := range budgets {
+		spendCap := models.SpendCap{
+			BudgetID: budget.ID.Hex(),
+			Amount:   budget.Amount,
+			Spend:    budget.Spend,
+			Currency: budget.Currency,
+			Until:    *budget.CappedUntil,
+		}
+		if budget.ProjectID != nil {
+			spendCap.ProjectID = budget.ProjectID.Hex()
+		}
+		caps = append(caps, spendCap)
+	}
+	return caps, nil
+}
+
+// quotaMetric classifies usage against a limit; negative limits are unlimited
+func quotaMetric(metric string, usage, limit float64, gracePercentage int) models.QuotaMetricState {
+	m := models.QuotaMetricState{
+		Metric:    metric,
+		Usage:     usage,
+		Limit:     limit,
+		HardLimit: -1,
+		Status:    models.QuotaStatusOK,
+	}
+	if limit < 0 {
+		return m
+	}
+
+	m.HardLimit = limit * (1 + float64(gracePercentage)/100)
+	if limit > 0 {
+		m.Percentage = math.Round(usage/limit*10000) / 100
+	}
+
+	switch {
+	case usage >= m.HardLimit:
+		m.Status = models.QuotaStatusExceeded
+	case usage >= limit:
+		m.Status = models.QuotaStatusGrace
+	}
+	return m
+}
+
+func (s *QuotaService) getOrganization(ctx context.Context, orgID primitive.ObjectID) (*models.Organization, error) {
+	var org models.Organization
+	err := s.db.Collection(models.Organization{}.TableName()).FindOne(ctx, bson.M{"_id": orgID, "is_deleted": false}).Decode(&org)
+	if err == mongo.ErrNoDocuments {
+		return nil, errors.New("organization not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization: %w", err)
+	}
+	return &org, nil
+}
@@ -5,7 +5,11 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"math"
+	"net/http"
+	"strings"
 	"time"
 
 	"pulse-control-plane/models"
@@ -24,20 +28,29 @@ type RazorpayService struct {
 	keySecret      string
 	webhookSecret  string
 	billingService *BillingService
+	events         *ProviderEventStore
+
+	// subscriptionListener is told about subscriptions paused, resumed or
+	// cancelled from Razorpay's side
+	subscriptionListener SubscriptionStatusListener
 }
 
-// NewRazorpayService creates a new Razorpay service
-func NewRazorpayService(db *mongo.Database, keyID, keySecret, webhookSecret string, billingService *BillingService) *RazorpayService {
+// NewRazorpayService creates a new Razorpay service and registers its webhook
+// handler with the event store
+func NewRazorpayService(db *mongo.Database, keyID, keySecret, webhookSecret string, billingService *BillingService, events *ProviderEventStore) *RazorpayService {
 	client := razorpay.NewClient(keyID, keySecret)
 	
-	return &RazorpayService{
+	s := &RazorpayService{
 		db:             db,
 		client:         client,
 		keyID:          keyID,
 		keySecret:      keySecret,
 		webhookSecret:  webhookSecret,
 		billingService: billingService,
+		events:         events,
 	}
+	events.RegisterHandler(models.PaymentProviderRazorpay, s.HandleEvent)
+	return s
 }
 
 // RazorpayCustomer represents a Razorpay customer
@@ -87,7 +100,7 @@ type RazorpayPayment struct {
 	PaymentID      string             `bson:"payment_id" json:"payment_id"`
 	OrderID        string             `bson:"order_id" json:"order_id"`
 	InvoiceID      primitive.ObjectID `bson:"invoice_id,omitempty" json:"invoice_id,omitempty"`
-	Amount         float64            `bson:"amount" json:"amount"`
+	Amount         int64              `bson:"amount" json:"amount"` // minor units
 	Currency       string             `bson:"currency" json:"currency"`
 	Status         string             `bson:"status" json:"status"` // created, authorized, captured, refunded, failed
 	Method         string             `bson:"method" json:"method"` // card, netbanking, wallet, upi
@@ -216,10 +229,21 @@ func (s *RazorpayService) GeneratePaymentLink(ctx context.Context, invoiceID pri
 		return "", fmt.Errorf("failed to find organization: %w", err)
 	}
 
-	// Create payment link
+	// Create payment link for the tax-inclusive total
+	notes := map[string]interface{}{
+		"invoice_id": invoiceID.Hex(),
+		"tax":        models.FormatMinorUnits(invoice.Tax, invoice.Currency),
+	}
+	for _, line := range invoice.TaxLines {
+		notes[strings.ToLower(line.Name)] = models.FormatMinorUnits(line.Amount, invoice.Currency)
+	}
+	if invoice.CustomerTaxID != "" {
+		notes["customer_tax_id"] = invoice.CustomerTaxID
+	}
+
 	data := map[string]interface{}{
-		"amount":      int(invoice.Total * 100), // Convert to paise
-		"currency":    "INR",
+		"amount":      invoice.Total, // in minor units, e.g. paise
+		"currency":    invoice.Currency,
 		"description": fmt.Sprintf("Invoice %s", invoice.InvoiceNumber),
 		"customer": map[string]interface{}{
 			"name":  org.Name,
@@ -232,6 +256,7 @@ func (s *RazorpayService) GeneratePaymentLink(ctx context.Context, invoiceID pri
 		"reminder_enable": true,
 		"callback_url":    fmt.Sprintf("https://pulse.io/billing/payment/callback?invoice_id=%s", invoiceID.Hex()),
 		"callback_method": "get",
+		"notes":           notes,
 	}
 
 	body, err := s.client.PaymentLink.Create(data, nil)
@@ -287,16 +312,47 @@ func (s *RazorpayService) VerifyPayment(ctx context.Context, paymentID, orderID,
 	return true, nil
 }
 
-// ProcessWebhook processes Razorpay webhook events
-func (s *RazorpayService) ProcessWebhook(ctx context.Context, payload []byte, signature string) error {
+// ProcessWebhook verifies a Razorpay webhook and hands it to the event store,
+// which applies it once however often Razorpay delivers it. eventID is the
+// X-Razorpay-Event-Id header. Handler failures are recorded on the stored
+// event and retried from there, so only signature and storage errors are
+// returned.
+func (s *RazorpayService) ProcessWebhook(ctx context.Context, payload []byte, signature, eventID string) (*models.ProviderEvent, error) {
 	// Verify webhook signature
 	if !s.verifyWebhookSignature(payload, signature) {
-		return fmt.Errorf("invalid webhook signature")
+		return nil, ErrInvalidWebhookSignature
 	}
 
 	// Parse webhook payload
+	var webhookData struct {
+		Event string `json:"event"`
+	}
+	if err := json.Unmarshal(payload, &webhookData); err != nil {
+		return nil, fmt.Errorf("failed to parse webhook payload: %w", err)
+	}
+	if webhookData.Event == "" {
+		return nil, fmt.Errorf("invalid webhook event")
+	}
+
+	return s.events.Receive(ctx, models.PaymentProviderRazorpay, RazorpayEventID(eventID, payload), webhookData.Event, payload)
+}
+
+// RazorpayEventID returns the ID a Razorpay webhook is stored under: the
+// X-Razorpay-Event-Id header, or a hash of the payload, which Razorpay
+// redelivers unchanged, if the header is missing
+func RazorpayEventID(header string, payload []byte) string {
+	if header != "" {
+		return header
+	}
+	sum := sha256.Sum256(payload)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// HandleEvent applies a verified Razorpay webhook payload. It is registered
+// with the event store, which calls it once per event and again on retry.
+func (s *RazorpayService) HandleEvent(ctx context.Context, payload []byte) error {
 	var webhookData map[string]interface{}
-	if err := bson.UnmarshalExtJSON(payload, false, &webhookData); err != nil {
+	if err := json.Unmarshal(payload, &webhookData); err != nil {
 		return fmt.Errorf("failed to parse webhook payload: %w", err)
 	}
 
@@ -311,6 +367,8 @@ func (s *RazorpayService) ProcessWebhook(ctx context.Context, payload []byte, si
 		return s.handlePaymentCaptured(ctx, webhookData)
 	case "payment.failed":
 		return s.handlePaymentFailed(ctx, webhookData)
+	case "payment_link.paid":
+		return s.handlePaymentLinkPaid(ctx, webhookData)
 	case "subscription.charged":
 		return s.handleSubscriptionCharged(ctx, webhookData)
 	case "subscription.cancelled":
@@ -348,14 +406,15 @@ func (s *RazorpayService) handlePaymentCaptured(ctx context.Context, data map[st
 	paymentID, _ := payment["id"].(string)
 	orderID, _ := payment["order_id"].(string)
 	amount, _ := payment["amount"].(float64)
+	currency, _ := payment["currency"].(string)
 
 	// Store payment record
 	paymentRecord := &RazorpayPayment{
 		ID:        primitive.NewObjectID(),
 		PaymentID: paymentID,
 		OrderID:   orderID,
-		Amount:    amount / 100, // Convert from paise
-		Currency:  "INR",
+		Amount:    int64(amount), // minor units, e.g. paise
+		Currency:  currency,
 		Status:    "captured",
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
@@ -370,12 +429,80 @@ func (s *RazorpayService) handlePaymentCaptured(ctx context.Context, data map[st
 	return nil
 }
 
-// handlePaymentFailed handles payment failed events
+// handlePaymentFailed records a failed invoice payment on its billing run.
+// The invoice stays unpaid, so dunning follows up.
 func (s *RazorpayService) handlePaymentFailed(ctx context.Context, data map[string]interface{}) error {
-	// Similar implementation to handlePaymentCaptured but mark as failed
+	payload, ok := data["payload"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid payload")
+	}
+
+	payment, _ := payload["payment"].(map[string]interface{})
+	entity, ok := payment["entity"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid payment data")
+	}
+
+	notes, _ := entity["notes"].(map[string]interface{})
+	invoiceIDStr, _ := notes["invoice_id"].(string)
+	if invoiceIDStr == "" {
+		// Payment not made for an invoice
+		return nil
+	}
+
+	invoiceID, err := primitive.ObjectIDFromHex(invoiceIDStr)
+	if err != nil {
+		return fmt.Errorf("invalid invoice ID in payment notes: %w", err)
+	}
+
+	reason, _ := entity["error_description"].(string)
+	if reason == "" {
+		reason = "payment failed"
+	}
+
+	_, err = s.db.Collection(models.BillingRun{}.TableName()).UpdateOne(ctx,
+		bson.M{"invoice_id": invoiceID},
+		bson.M{"$set": bson.M{"payment_error": reason, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record payment failure: %w", err)
+	}
+
 	return nil
 }
 
+// handlePaymentLinkPaid marks the invoice behind a paid payment link as paid
+func (s *RazorpayService) handlePaymentLinkPaid(ctx context.Context, data map[string]interface{}) error {
+	payload, ok := data["payload"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid payload")
+	}
+
+	paymentLink, ok := payload["payment_link"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid payment link data")
+	}
+
+	entity, ok := paymentLink["entity"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid payment link entity")
+	}
+
+	notes, _ := entity["notes"].(map[string]interface{})
+	invoiceIDStr, _ := notes["invoice_id"].(string)
+	if invoiceIDStr == "" {
+		// Payment link not created for an invoice
+		return nil
+	}
+
+	invoiceID, err := primitive.ObjectIDFromHex(invoiceIDStr)
+	if err != nil {
+		return fmt.Errorf("invalid invoice ID in payment link notes: %w", err)
+	}
+
+	return s.billingService.UpdateInvoiceStatus(ctx, invoiceID, models.InvoiceStatusPaid)
+}
+
 // handleSubscriptionCharged handles subscription charged events
 func (s *RazorpayService) handleSubscriptionCharged(ctx context.Context, data map[string]interface{}) error {
 	payload, ok := data["payload"].(map[string]interface{})
@@ -409,11 +536,58 @@ func (s *RazorpayService) handleSubscriptionCharged(ctx context.Context, data ma
 		return fmt.Errorf("failed to update subscription: %w", err)
 	}
 
+	// Invoices added to the subscription were collected with this charge
+	return s.settleSubscriptionInvoices(ctx, subscriptionID)
+}
+
+// settleSubscriptionInvoices marks the unpaid invoices charged on a
+// subscription as paid
+func (s *RazorpayService) settleSubscriptionInvoices(ctx context.Context, subscriptionID string) error {
+	cursor, err := s.db.Collection(models.BillingRun{}.TableName()).Find(ctx, bson.M{
+		"subscription_id": subscriptionID,
+		"payment_method":  models.BillingPaymentSubscription,
+		"status":          models.BillingRunStatusUnpaid,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find subscription invoices: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var runs []models.BillingRun
+	if err := cursor.All(ctx, &runs); err != nil {
+		return fmt.Errorf("failed to decode billing runs: %w", err)
+	}
+
+	for _, run := range runs {
+		if run.InvoiceID == nil {
+			continue
+		}
+		if err := s.billingService.UpdateInvoiceStatus(ctx, *run.InvoiceID, models.InvoiceStatusPaid); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 // handleSubscriptionCancelled handles subscription cancelled events
 func (s *RazorpayService) handleSubscriptionCancelled(ctx context.Context, data map[string]interface{}) error {
+	return s.handleSubscriptionStatus(ctx, data, "cancelled", models.SubscriptionStatusCancelled)
+}
+
+// handleSubscriptionPaused handles subscription paused events
+func (s *RazorpayService) handleSubscriptionPaused(ctx context.Context, data map[string]interface{}) error {
+	return s.handleSubscriptionStatus(ctx, data, "paused", models.SubscriptionStatusPaused)
+}
+
+// handleSubscriptionResumed handles subscription resumed events
+func (s *RazorpayService) handleSubscriptionResumed(ctx context.Context, data map[string]interface{}) error {
+	return s.handleSubscriptionStatus(ctx, data, "active", models.SubscriptionStatusActive)
+}
+
+// handleSubscriptionStatus records a subscription's new Razorpay status and
+// tells the subscription listener, which keeps the organization's plan in
+// step
+func (s *RazorpayService) handleSubscriptionStatus(ctx context.Context, data map[string]interface{}, razorpayStatus, status string) error {
 	payload, ok := data["payload"].(map[string]interface{})
 	if !ok {
 		return fmt.Errorf("invalid payload")
@@ -423,49 +597,272 @@ func (s *RazorpayService) handleSubscriptionCancelled(ctx context.Context, data
 	if !ok {
 		return fmt.Errorf("invalid subscription data")
 	}
+	entity, ok := subscription["entity"].(map[string]interface{})
+	if !ok {
+		entity = subscription
+	}
 
-	subscriptionID, _ := subscription["id"].(string)
+	subscriptionID, _ := entity["id"].(string)
+	if err := s.setSubscriptionStatus(ctx, subscriptionID, razorpayStatus); err != nil {
+		return err
+	}
 
-	// Update subscription status
+	if s.subscriptionListener == nil {
+		return nil
+	}
+	return s.subscriptionListener(ctx, models.PaymentProviderRazorpay, subscriptionID, status)
+}
+
+// setSubscriptionStatus updates the stored status of a subscription
+func (s *RazorpayService) setSubscriptionStatus(ctx context.Context, subscriptionID, status string) error {
 	collection := s.db.Collection(RazorpaySubscription{}.TableName())
 	_, err := collection.UpdateOne(
 		ctx,
 		bson.M{"subscription_id": subscriptionID},
 		bson.M{"$set": bson.M{
-			"status":     "cancelled",
+			"status":     status,
 			"updated_at": time.Now(),
 		}},
 	)
 	if err != nil {
 		return fmt.Errorf("failed to update subscription: %w", err)
 	}
-
 	return nil
 }
 
-// handleSubscriptionPaused handles subscription paused events
-func (s *RazorpayService) handleSubscriptionPaused(ctx context.Context, data map[string]interface{}) error {
-	// Similar to handleSubscriptionCancelled
+// GetInvoices retrieves Razorpay invoices for a project
+func (s *RazorpayService) GetInvoices(ctx context.Context, projectID primitive.ObjectID, page, limit int) ([]models.Invoice, int64, error) {
+	return s.billingService.ListInvoices(ctx, projectID, page, limit)
+}
+
+// ProcessRefund processes a refund for a payment
+func (s *RazorpayService) ProcessRefund(ctx context.Context, paymentID string, amount float64) (string, error) {
+	return s.RefundPayment(ctx, paymentID, int64(math.Round(amount*100))) // Convert to paise
+}
+
+// GetCustomerByOrgID retrieves a customer by organization ID
+func (s *RazorpayService) GetCustomerByOrgID(ctx context.Context, orgID primitive.ObjectID) (*RazorpayCustomer, error) {
+	collection := s.db.Collection(RazorpayCustomer{}.TableName())
+	var customer RazorpayCustomer
+	err := collection.FindOne(ctx, bson.M{"org_id": orgID}).Decode(&customer)
+	if err != nil {
+		return nil, err
+	}
+	return &customer, nil
+}
+
+// GetActiveSubscriptionByOrgID retrieves an organization's active subscription
+func (s *RazorpayService) GetActiveSubscriptionByOrgID(ctx context.Context, orgID primitive.ObjectID) (*RazorpaySubscription, error) {
+	collection := s.db.Collection(RazorpaySubscription{}.TableName())
+	var subscription RazorpaySubscription
+	err := collection.FindOne(ctx, bson.M{"org_id": orgID, "status": "active"}).Decode(&subscription)
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// ChargeSubscription adds an invoice's tax-inclusive total to a subscription
+// as an add-on, collected with the subscription's next charge
+func (s *RazorpayService) ChargeSubscription(ctx context.Context, subscription *RazorpaySubscription, invoice *models.Invoice) error {
+	data := map[string]interface{}{
+		"item": map[string]interface{}{
+			"name":        fmt.Sprintf("Invoice %s", invoice.InvoiceNumber),
+			"amount":      invoice.Total,
+			"currency":    invoice.Currency,
+			"description": fmt.Sprintf("Usage for %s", invoice.BillingPeriod),
+		},
+		"quantity": 1,
+	}
+
+	if _, err := s.client.Subscription.CreateAddon(subscription.SubscriptionID, data, nil); err != nil {
+		return fmt.Errorf("failed to add invoice to subscription: %w", err)
+	}
 	return nil
 }
 
-// handleSubscriptionResumed handles subscription resumed events
-func (s *RazorpayService) handleSubscriptionResumed(ctx context.Context, data map[string]interface{}) error {
-	// Similar to handleSubscriptionCharged
+// GetSubscriptionByProjectID retrieves a subscription by project ID
+func (s *RazorpayService) GetSubscriptionByProjectID(ctx context.Context, projectID primitive.ObjectID) (*RazorpaySubscription, error) {
+	collection := s.db.Collection(RazorpaySubscription{}.TableName())
+	var subscription RazorpaySubscription
+	err := collection.FindOne(ctx, bson.M{"project_id": projectID}).Decode(&subscription)
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// razorpaySubscriptionCycles is the number of monthly charges a
+// self-service subscription is created for; Razorpay requires a limit
+const razorpaySubscriptionCycles = 120
+
+// OnSubscriptionStatus registers the listener told about subscriptions
+// paused, resumed or cancelled from Razorpay's side
+func (s *RazorpayService) OnSubscriptionStatus(listener SubscriptionStatusListener) {
+	s.subscriptionListener = listener
+}
+
+// StartSubscription subscribes an organization's customer to a Razorpay plan
+func (s *RazorpayService) StartSubscription(ctx context.Context, orgID primitive.ObjectID, customerID, planID string) (*ProviderSubscription, error) {
+	subscription, err := s.CreateSubscription(ctx, primitive.NilObjectID, orgID, planID, customerID, razorpaySubscriptionCycles)
+	if err != nil {
+		return nil, err
+	}
+	return &ProviderSubscription{ID: subscription.SubscriptionID, Status: subscription.Status}, nil
+}
+
+// ChangeSubscriptionPlan moves a subscription to another Razorpay plan now.
+// Razorpay does not prorate; the organization's invoice does.
+func (s *RazorpayService) ChangeSubscriptionPlan(ctx context.Context, subscriptionID, planID string, prorate bool) error {
+	data := map[string]interface{}{
+		"plan_id":            planID,
+		"schedule_change_at": "now",
+	}
+	if _, err := s.client.Subscription.Update(subscriptionID, data, nil); err != nil {
+		return fmt.Errorf("failed to change subscription plan: %w", err)
+	}
+
+	_, err := s.db.Collection(RazorpaySubscription{}.TableName()).UpdateOne(ctx,
+		bson.M{"subscription_id": subscriptionID},
+		bson.M{"$set": bson.M{"plan_id": planID, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update subscription: %w", err)
+	}
 	return nil
 }
 
-// GetInvoices retrieves Razorpay invoices for a project
-func (s *RazorpayService) GetInvoices(ctx context.Context, projectID primitive.ObjectID, page, limit int) ([]models.Invoice, int64, error) {
-	return s.billingService.ListInvoices(ctx, projectID, page, limit)
+// CancelSubscription cancels a subscription now
+func (s *RazorpayService) CancelSubscription(ctx context.Context, subscriptionID string) error {
+	if _, err := s.client.Subscription.Cancel(subscriptionID, map[string]interface{}{"cancel_at_cycle_end": 0}, nil); err != nil {
+		return fmt.Errorf("failed to cancel subscription: %w", err)
+	}
+	return s.setSubscriptionStatus(ctx, subscriptionID, "cancelled")
 }
 
-// ProcessRefund processes a refund for a payment
-func (s *RazorpayService) ProcessRefund(ctx context.Context, paymentID string, amount float64) (string, error) {
-	// Create refund in Razorpay
-	amountInPaise := int(amount * 100) // Convert to paise
+// PauseSubscription pauses a subscription now
+func (s *RazorpayService) PauseSubscription(ctx context.Context, subscriptionID string) error {
+	if _, err := s.client.Subscription.Pause(subscriptionID, map[string]interface{}{"pause_at": "now"}, nil); err != nil {
+		return fmt.Errorf("failed to pause subscription: %w", err)
+	}
+	return s.setSubscriptionStatus(ctx, subscriptionID, "paused")
+}
+
+// ResumeSubscription resumes a paused subscription now
+func (s *RazorpayService) ResumeSubscription(ctx context.Context, subscriptionID string) error {
+	if _, err := s.client.Subscription.Resume(subscriptionID, map[string]interface{}{"resume_at": "now"}, nil); err != nil {
+		return fmt.Errorf("failed to resume subscription: %w", err)
+	}
+	return s.setSubscriptionStatus(ctx, subscriptionID, "active")
+}
+
+// Name returns the provider's identifier
+func (s *RazorpayService) Name() string {
+	return models.PaymentProviderRazorpay
+}
+
+// RegisterCustomer returns the organization's Razorpay customer, creating it
+// with the organization's GSTIN if it has none
+func (s *RazorpayService) RegisterCustomer(ctx context.Context, org *models.Organization) (string, error) {
+	if customer, err := s.GetCustomerByOrgID(ctx, org.ID); err == nil {
+		return customer.CustomerID, nil
+	}
+
+	gstNumber := ""
+	if org.TaxProfile != nil && org.TaxProfile.TaxIDType == models.TaxIDTypeGSTIN && org.TaxProfile.TaxIDValid {
+		gstNumber = org.TaxProfile.TaxID
+	}
 
-	body, err := s.client.Payment.Refund(paymentID, amountInPaise, map[string]interface{}{}, nil)
+	customer, err := s.CreateCustomer(ctx, org.ID, org.Name, org.AdminEmail, "", gstNumber)
+	if err != nil {
+		return "", err
+	}
+	return customer.CustomerID, nil
+}
+
+// AttachPaymentMethod is not supported: Razorpay collects payment methods at
+// checkout and through subscription mandates
+func (s *RazorpayService) AttachPaymentMethod(ctx context.Context, customerID, paymentMethodID string) error {
+	return fmt.Errorf("%w: razorpay collects payment methods at checkout", ErrPaymentOperationUnsupported)
+}
+
+// PushInvoice sends the invoice as a payment link
+func (s *RazorpayService) PushInvoice(ctx context.Context, customerID string, invoice *models.Invoice) (*ProviderInvoice, error) {
+	link, err := s.GeneratePaymentLink(ctx, invoice.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &ProviderInvoice{URL: link, Status: "created"}, nil
+}
+
+// CreatePaymentIntent creates an order for the invoice total, paid through
+// Razorpay Checkout and confirmed with VerifyPayment
+func (s *RazorpayService) CreatePaymentIntent(ctx context.Context, customerID string, invoice *models.Invoice) (*PaymentIntent, error) {
+	data := map[string]interface{}{
+		"amount":   invoice.Total,
+		"currency": invoice.Currency,
+		"receipt":  invoice.InvoiceNumber,
+		"notes": map[string]interface{}{
+			"invoice_id": invoice.ID.Hex(),
+		},
+	}
+
+	body, err := s.client.Order.Create(data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create order: %w", err)
+	}
+
+	orderID, ok := body["id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid order response from Razorpay")
+	}
+	status, _ := body["status"].(string)
+
+	return &PaymentIntent{
+		ID:       orderID,
+		Amount:   invoice.Total,
+		Currency: invoice.Currency,
+		Status:   status,
+	}, nil
+}
+
+// GetPayment fetches a payment. Authorized payments can still lapse, so only
+// captured payments are settled.
+func (s *RazorpayService) GetPayment(ctx context.Context, paymentID string) (*ProviderPayment, error) {
+	body, err := s.client.Payment.Fetch(paymentID, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch payment: %w", err)
+	}
+
+	id, _ := body["id"].(string)
+	customerID, _ := body["customer_id"].(string)
+	amount, _ := body["amount"].(float64)
+	currency, _ := body["currency"].(string)
+	status, _ := body["status"].(string)
+
+	return &ProviderPayment{
+		ID:         id,
+		CustomerID: customerID,
+		Amount:     int64(amount),
+		Currency:   strings.ToUpper(currency),
+		Succeeded:  status == "captured",
+	}, nil
+}
+
+// RefundPayment refunds amount paise of a payment, or what remains of it if
+// amount is 0
+func (s *RazorpayService) RefundPayment(ctx context.Context, paymentID string, amount int64) (string, error) {
+	if amount == 0 {
+		payment, err := s.client.Payment.Fetch(paymentID, nil, nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to fetch payment: %w", err)
+		}
+		paid, _ := payment["amount"].(float64)
+		refunded, _ := payment["amount_refunded"].(float64)
+		amount = int64(paid - refunded)
+	}
+
+	body, err := s.client.Payment.Refund(paymentID, int(amount), map[string]interface{}{}, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to create refund: %w", err)
 	}
@@ -492,24 +889,71 @@ func (s *RazorpayService) ProcessRefund(ctx context.Context, paymentID string, a
 	return refundID, nil
 }
 
-// GetCustomerByOrgID retrieves a customer by organization ID
-func (s *RazorpayService) GetCustomerByOrgID(ctx context.Context, orgID primitive.ObjectID) (*RazorpayCustomer, error) {
-	collection := s.db.Collection(RazorpayCustomer{}.TableName())
-	var customer RazorpayCustomer
-	err := collection.FindOne(ctx, bson.M{"org_id": orgID}).Decode(&customer)
+// VerifyWebhook checks the X-Razorpay-Signature header and translates
+// invoice payment events. Subscription events are handled by ProcessWebhook.
+func (s *RazorpayService) VerifyWebhook(payload []byte, header http.Header) (*PaymentEvent, error) {
+	if !s.verifyWebhookSignature(payload, header.Get("X-Razorpay-Signature")) {
+		return nil, ErrInvalidWebhookSignature
+	}
+	event, err := s.ParseWebhook(payload)
 	if err != nil {
 		return nil, err
 	}
-	return &customer, nil
+	event.ID = RazorpayEventID(header.Get("X-Razorpay-Event-Id"), payload)
+	return event, nil
 }
 
-// GetSubscriptionByProjectID retrieves a subscription by project ID
-func (s *RazorpayService) GetSubscriptionByProjectID(ctx context.Context, projectID primitive.ObjectID) (*RazorpaySubscription, error) {
-	collection := s.db.Collection(RazorpaySubscription{}.TableName())
-	var subscription RazorpaySubscription
-	err := collection.FindOne(ctx, bson.M{"project_id": projectID}).Decode(&subscription)
-	if err != nil {
-		return nil, err
+// ParseWebhook translates a verified Razorpay invoice payment event. Razorpay
+// sends the event ID in a header, so it is left empty.
+func (s *RazorpayService) ParseWebhook(payload []byte) (*PaymentEvent, error) {
+	var webhook struct {
+		ID      string `json:"id"`
+		Event   string `json:"event"`
+		Payload struct {
+			Payment struct {
+				Entity struct {
+					ID               string          `json:"id"`
+					Notes            json.RawMessage `json:"notes"`
+					ErrorDescription string          `json:"error_description"`
+				} `json:"entity"`
+			} `json:"payment"`
+			PaymentLink struct {
+				Entity struct {
+					ID    string          `json:"id"`
+					Notes json.RawMessage `json:"notes"`
+				} `json:"entity"`
+			} `json:"payment_link"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(payload, &webhook); err != nil {
+		return nil, fmt.Errorf("failed to parse webhook payload: %w", err)
+	}
+
+	payment := webhook.Payload.Payment.Entity
+	event := &PaymentEvent{Type: webhook.Event, PaymentID: payment.ID}
+	notes := payment.Notes
+
+	switch webhook.Event {
+	case "payment_link.paid":
+		event.Outcome = PaymentOutcomePaid
+		event.ProviderInvoiceID = webhook.Payload.PaymentLink.Entity.ID
+		notes = webhook.Payload.PaymentLink.Entity.Notes
+	case "payment.captured":
+		event.Outcome = PaymentOutcomePaid
+	case "payment.failed":
+		event.Outcome = PaymentOutcomeFailed
+		event.Message = payment.ErrorDescription
+		if event.Message == "" {
+			event.Message = "payment failed"
+		}
 	}
-	return &subscription, nil
+
+	// Notes are an object, or an empty array when none were set
+	var noteValues map[string]interface{}
+	json.Unmarshal(notes, &noteValues)
+	invoiceIDStr, _ := noteValues["invoice_id"].(string)
+	if id, err := primitive.ObjectIDFromHex(invoiceIDStr); err == nil {
+		event.InvoiceID = id
+	}
+	return event, nil
 }
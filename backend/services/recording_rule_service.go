@@ -0,0 +1,314 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"pulse-control-plane/models"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrRecordingRuleNotFound is returned when a project has no such recording rule
+var ErrRecordingRuleNotFound = errors.New("recording rule not found")
+
+// RecordingRuleService manages per-project recording rules and starts and
+// stops their egresses as LiveKit reports rooms and tracks
+type RecordingRuleService struct {
+	db             *mongo.Database
+	egressService  *EgressService
+	projectService *ProjectService
+}
+
+// NewRecordingRuleService creates a new recording rule service
+func NewRecordingRuleService(db *mongo.Database, egressService *EgressService, projectService *ProjectService) *RecordingRuleService {
+	return &RecordingRuleService{
+		db:             db,
+		egressService:  egressService,
+		projectService: projectService,
+	}
+}
+
+// CreateRule creates a recording rule for a project
+func (s *RecordingRuleService) CreateRule(ctx context.Context, projectID primitive.ObjectID, input *models.RecordingRuleInput) (*models.RecordingRule, error) {
+	now := time.Now()
+	rule := &models.RecordingRule{
+		ID:        primitive.NewObjectID(),
+		ProjectID: projectID,
+		CreatedAt: now,
+	}
+	if err := applyRuleInput(rule, input, now); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.db.Collection(models.RecordingRule{}.TableName()).InsertOne(ctx, rule); err != nil {
+		return nil, fmt.Errorf("failed to create recording rule: %w", err)
+	}
+
+	log.Info().Str("project_id", projectID.Hex()).Str("rule_id", rule.ID.Hex()).Str("trigger", rule.Trigger).Msg("Recording rule created")
+	return redactRule(rule), nil
+}
+
+// UpdateRule replaces a recording rule
+func (s *RecordingRuleService) UpdateRule(ctx context.Context, projectID, ruleID primitive.ObjectID, input *models.RecordingRuleInput) (*models.RecordingRule, error) {
+	rule, err := s.getRule(ctx, projectID, ruleID)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyRuleInput(rule, input, time.Now()); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.db.Collection(models.RecordingRule{}.TableName()).ReplaceOne(ctx, bson.M{"_id": rule.ID}, rule); err != nil {
+		return nil, fmt.Errorf("failed to update recording rule: %w", err)
+	}
+	return redactRule(rule), nil
+}
+
+// SetEnabled switches a recording rule on or off. Recordings it already
+// started carry on until their rooms end.
+func (s *RecordingRuleService) SetEnabled(ctx context.Context, projectID, ruleID primitive.ObjectID, enabled bool) (*models.RecordingRule, error) {
+	var rule models.RecordingRule
+	err := s.db.Collection(models.RecordingRule{}.TableName()).FindOneAndUpdate(ctx,
+		bson.M{"_id": ruleID, "project_id": projectID},
+		bson.M{"$set": bson.M{"enabled": enabled, "updated_at": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&rule)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrRecordingRuleNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update recording rule: %w", err)
+	}
+	return redactRule(&rule), nil
+}
+
+// GetRule returns a recording rule of a project
+func (s *RecordingRuleService) GetRule(ctx context.Context, projectID, ruleID primitive.ObjectID) (*models.RecordingRule, error) {
+	rule, err := s.getRule(ctx, projectID, ruleID)
+	if err != nil {
+		return nil, err
+	}
+	return redactRule(rule), nil
+}
+
+// ListRules lists a project's recording rules
+func (s *RecordingRuleService) ListRules(ctx context.Context, projectID primitive.ObjectID) ([]*models.RecordingRule, error) {
+	rules, err := s.findRules(ctx, bson.M{"project_id": projectID})
+	if err != nil {
+		return nil, err
+	}
+	for i, rule := range rules {
+		rules[i] = redactRule(rule)
+	}
+	return rules, nil
+}
+
+// DeleteRule deletes a recording rule. Recordings it already started carry
+// on until their rooms end.
+func (s *RecordingRuleService) DeleteRule(ctx context.Context, projectID, ruleID primitive.ObjectID) error {
+	result, err := s.db.Collection(models.RecordingRule{}.TableName()).DeleteOne(ctx, bson.M{"_id": ruleID, "project_id": projectID})
+	if err != nil {
+		return fmt.Errorf("failed to delete recording rule: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrRecordingRuleNotFound
+	}
+	return nil
+}
+
+// RoomStarted starts the recordings of the enabled room rules matching a
+// room. It returns the number of egresses started.
+func (s *RecordingRuleService) RoomStarted(ctx context.Context, projectID primitive.ObjectID, roomName string) (int, error) {
+	return s.trigger(ctx, projectID, models.RecordingTriggerRoomStarted, roomName, func(rule *models.RecordingRule) bool {
+		return rule.MatchesRoom(roomName)
+	}, func(rule *models.RecordingRule) (*models.EgressRequest, string) {
+		return ruleEgressRequest(rule, roomName, "", ""), ruleDedupKey(rule, roomName, "")
+	})
+}
+
+// TrackPublished starts the recordings of the enabled track rules matching
+// a published track. It returns the number of egresses started.
+func (s *RecordingRuleService) TrackPublished(ctx context.Context, projectID primitive.ObjectID, roomName, trackSID, trackKind string) (int, error) {
+	return s.trigger(ctx, projectID, models.RecordingTriggerTrackPublished, roomName, func(rule *models.RecordingRule) bool {
+		return rule.MatchesRoom(roomName) && rule.MatchesTrack(trackKind)
+	}, func(rule *models.RecordingRule) (*models.EgressRequest, string) {
+		return ruleEgressRequest(rule, roomName, trackSID, trackKind), ruleDedupKey(rule, roomName, trackSID)
+	})
+}
+
+// RoomEnded stops the rule recordings of a room. It returns the number of
+// egresses stopped.
+func (s *RecordingRuleService) RoomEnded(ctx context.Context, projectID primitive.ObjectID, roomName string) (int, error) {
+	project, err := s.projectService.GetProject(ctx, projectID)
+	if err != nil {
+		return 0, err
+	}
+	return s.egressService.StopRuleEgresses(ctx, project, roomName)
+}
+
+// trigger starts an egress for each enabled rule of a trigger that matches
+func (s *RecordingRuleService) trigger(ctx context.Context, projectID primitive.ObjectID, trigger, roomName string, matches func(*models.RecordingRule) bool, request func(*models.RecordingRule) (*models.EgressRequest, string)) (int, error) {
+	rules, err := s.findRules(ctx, bson.M{"project_id": projectID, "trigger": trigger, "enabled": true})
+	if err != nil {
+		return 0, err
+	}
+	var matched []*models.RecordingRule
+	for _, rule := range rules {
+		if matches(rule) {
+			matched = append(matched, rule)
+		}
+	}
+	if len(matched) == 0 {
+		return 0, nil
+	}
+
+	project, err := s.projectService.GetProject(ctx, projectID)
+	if err != nil {
+		return 0, err
+	}
+
+	started := 0
+	for _, rule := range matched {
+		req, dedupKey := request(rule)
+		egress, err := s.egressService.StartRuleEgress(ctx, project, rule, req, dedupKey)
+		if errors.Is(err, ErrAlreadyRecording) {
+			log.Debug().Str("rule_id", rule.ID.Hex()).Str("room", roomName).Msg("Rule is already recording, skipping")
+			continue
+		}
+		if err != nil {
+			// One failing rule must not keep the others from recording
+			log.Error().Err(err).Str("rule_id", rule.ID.Hex()).Str("room", roomName).Msg("Failed to start rule recording")
+			continue
+		}
+		log.Info().Str("rule_id", rule.ID.Hex()).Str("egress_id", egress.ID.Hex()).Str("room", roomName).Msg("Rule recording started")
+		started++
+	}
+	return started, nil
+}
+
+// getRule returns a recording rule of a project with its secrets
+func (s *RecordingRuleService) getRule(ctx context.Context, projectID, ruleID primitive.ObjectID) (*models.RecordingRule, error) {
+	var rule models.RecordingRule
+	err := s.db.Collection(models.RecordingRule{}.TableName()).FindOne(ctx, bson.M{"_id": ruleID, "project_id": projectID}).Decode(&rule)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrRecordingRuleNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find recording rule: %w", err)
+	}
+	return &rule, nil
+}
+
+// findRules returns the recording rules matching a filter, oldest first
+func (s *RecordingRuleService) findRules(ctx context.Context, filter bson.M) ([]*models.RecordingRule, error) {
+	cursor, err := s.db.Collection(models.RecordingRule{}.TableName()).Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find recording rules: %w", err)
+	}
+	rules := []*models.RecordingRule{}
+	if err := cursor.All(ctx, &rules); err != nil {
+		return nil, fmt.Errorf("failed to decode recording rules: %w", err)
+	}
+	return rules, nil
+}
+
+// applyRuleInput sets a rule from its input, checking the egress it starts
+// is one LiveKit can run
+func applyRuleInput(rule *models.RecordingRule, input *models.RecordingRuleInput, now time.Time) error {
+	if err := input.Validate(); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidEgressRequest, err)
+	}
+
+	rule.Name = input.Name
+	rule.Enabled = input.Enabled == nil || *input.Enabled
+	rule.Trigger = input.Trigger
+	rule.RoomPattern = input.RoomPattern
+	rule.TrackKind = input.TrackKind
+	rule.EgressType = input.EgressType
+	rule.LayoutType = input.LayoutType
+	rule.Preset = input.Preset
+	rule.TemplateURL = input.TemplateURL
+	rule.Outputs = input.Outputs
+	rule.UpdatedAt = now
+
+	return validateEgressRequest(ruleEgressRequest(rule, "room", "TR_example", input.TrackKind))
+}
+
+// ruleEgressRequest builds the egress a rule starts for a room, or for a
+// track in it. A rule's filenames are prefixes, completed with the room,
+// the track and the time so each recording gets its own files.
+func ruleEgressRequest(rule *models.RecordingRule, roomName, trackSID, trackKind string) *models.EgressRequest {
+	req := &models.EgressRequest{
+		RoomName:    roomName,
+		EgressType:  rule.EgressType,
+		LayoutType:  rule.LayoutType,
+		Preset:      rule.Preset,
+		TemplateURL: rule.TemplateURL,
+	}
+	switch rule.EgressType {
+	case models.EgressTypeTrack:
+		req.TrackID = trackSID
+	case models.EgressTypeTrackComposite:
+		if strings.EqualFold(trackKind, "video") {
+			req.VideoTrackID = trackSID
+		} else {
+			req.AudioTrackID = trackSID
+		}
+	}
+
+	name := roomName
+	if trackSID != "" {
+		name += "_" + trackSID
+	}
+	name = fmt.Sprintf("%s_%d", name, time.Now().Unix())
+	for _, output := range rule.Outputs {
+		if output.Type != models.OutputTypeRTMP {
+			output.Filename += name
+			if output.Type == models.OutputTypeFile {
+				output.Filename += ".mp4"
+			}
+		}
+		req.Outputs = append(req.Outputs, output)
+	}
+	return req
+}
+
+// ruleDedupKey names what a rule records, so it is recorded once
+func ruleDedupKey(rule *models.RecordingRule, roomName, trackSID string) string {
+	key := rule.ID.Hex() + ":" + roomName
+	if trackSID != "" {
+		key += ":" + trackSID
+	}
+	return key
+}
+
+// redactRule returns a copy of a rule without its storage secrets and stream keys
+func redactRule(rule *models.RecordingRule) *models.RecordingRule {
+	redacted := *rule
+	redacted.Outputs = make([]models.EgressOutput, len(rule.Outputs))
+	for i, output := range rule.Outputs {
+		if output.Storage != nil {
+			storage := *output.Storage
+			storage.SecretAccessKey = ""
+			output.Storage = &storage
+		}
+		if len(output.URLs) > 0 {
+			urls := make([]string, len(output.URLs))
+			for j, url := range output.URLs {
+				urls[j] = redactStreamURL(url)
+			}
+			output.URLs = urls
+		}
+		redacted.Outputs[i] = output
+	}
+	return &redacted
+}
@@ -0,0 +1,620 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"pulse-control-plane/models"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrRecordingNotFound is returned when a project has no such recording
+	ErrRecordingNotFound = errors.New("recording not found")
+
+	// ErrRetentionPolicyNotFound is returned when a project has no such
+	// retention policy
+	ErrRetentionPolicyNotFound = errors.New("retention policy not found")
+
+	// ErrInvalidRecordingRequest is returned for invalid tags or retention
+	// policies
+	ErrInvalidRecordingRequest = errors.New("invalid recording request")
+)
+
+const (
+	// maxRecordingTags bounds the tags of one recording
+	maxRecordingTags = 20
+
+	// retentionBatchSize is how many expired recordings are read at a time
+	// when enforcing a policy
+	retentionBatchSize = 500
+)
+
+// RecordingService keeps the library of recordings egresses wrote to
+// storage, deletes them with their objects and enforces retention policies
+type RecordingService struct {
+	db             *mongo.Database
+	storage        *ObjectStorage
+	usageService   *UsageService
+	projectService *ProjectService
+}
+
+// NewRecordingService creates a new recording service. usageService may be
+// nil, in which case storage usage is not reported.
+func NewRecordingService(db *mongo.Database, storage *ObjectStorage, usageService *UsageService, projectService *ProjectService) *RecordingService {
+	return &RecordingService{
+		db:             db,
+		storage:        storage,
+		usageService:   usageService,
+		projectService: projectService,
+	}
+}
+
+// RecordingFile is a file or playlist LiveKit reports an egress wrote
+type RecordingFile struct {
+	Key       string // storage key, or a location ending in it
+	SizeBytes int64
+	Duration  time.Duration
+	Checksum  string
+}
+
+// RecordingFiles returns the files and playlists in LiveKit's egress info
+func RecordingFiles(info *LiveKitEgressInfo) []RecordingFile {
+	if info == nil {
+		return nil
+	}
+	var files []RecordingFile
+	for _, file := range info.FileResults {
+		key := file.Filename
+		if key == "" {
+			key = file.Location
+		}
+		files = append(files, RecordingFile{Key: key, SizeBytes: int64(file.Size), Duration: time.Duration(file.Duration)})
+	}
+	for _, segment := range info.SegmentResults {
+		key := segment.PlaylistName
+		if key == "" {
+			key = segment.PlaylistLocation
+		}
+		files = append(files, RecordingFile{Key: key, SizeBytes: int64(segment.Size)})
+	}
+	return files
+}
+
+// RecordEgress adds the file and HLS outputs of an egress to the library.
+// With files, only the outputs LiveKit reported are added, with their size
+// and duration; without, every output of an ended egress is. Redelivered
+// events update the recordings rather than adding them again. It returns
+// the number of recordings added or updated.
+func (s *RecordingService) RecordEgress(ctx context.Context, liveKitEgressID string, files []RecordingFile) (int, error) {
+	var egress models.Egress
+	err := s.db.Collection("egresses").FindOne(ctx, bson.M{"livekit_egress_id": liveKitEgressID}).Decode(&egress)
+	if err == mongo.ErrNoDocuments {
+		return 0, fmt.Errorf("egress not found")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get egress: %w", err)
+	}
+	if len(files) == 0 && egress.Status != models.EgressStatusEnded {
+		return 0, nil
+	}
+
+	project, err := s.projectService.GetProject(ctx, egress.ProjectID)
+	if err != nil {
+		return 0, err
+	}
+
+	duration := egress.DurationSeconds
+	if egress.StartedAt != nil && egress.EndedAt != nil {
+		duration = int64(egress.EndedAt.Sub(*egress.StartedAt).Seconds())
+	}
+	recordedAt := egress.CreatedAt
+	if egress.StartedAt != nil {
+		recordedAt = *egress.StartedAt
+	}
+
+	outputs := egress.Outputs
+	if len(outputs) == 0 {
+		// Egresses from before multiple outputs
+		outputs = []models.EgressOutputInfo{{
+			Type:           egress.OutputType,
+			URL:            egress.OutputURL,
+			CDNPlaybackURL: egress.CDNPlaybackURL,
+			StorageBucket:  egress.StorageBucket,
+			Status:         egress.Status,
+		}}
+	}
+
+	recorded := 0
+	for _, output := range outputs {
+		if output.Type != models.OutputTypeFile && output.Type != models.OutputTypeHLS {
+			continue
+		}
+		bucket, key, ok := ParseStorageLocation(output.URL)
+		if !ok {
+			continue
+		}
+
+		file, reported := matchRecordingFile(files, key)
+		if len(files) > 0 && !reported {
+			continue
+		}
+		if !reported && output.Status == models.EgressStatusFailed {
+			continue
+		}
+
+		recording := &models.Recording{
+			ID:              primitive.NewObjectID(),
+			ProjectID:       egress.ProjectID,
+			EgressID:        egress.ID,
+			RoomName:        egress.RoomName,
+			Participants:    egress.Participants,
+			DurationSeconds: duration,
+			SizeBytes:       file.SizeBytes,
+			Format:          models.RecordingFormat(output.Type, key),
+			Checksum:        file.Checksum,
+			StorageBucket:   bucket,
+			StorageKey:      key,
+			External:        bucket != egress.StorageBucket,
+			CDNURL:          output.CDNPlaybackURL,
+			Tags:            []string{},
+			RecordedAt:      recordedAt,
+		}
+		if file.Duration > 0 {
+			recording.DurationSeconds = int64(file.Duration.Seconds())
+		}
+		s.describeObject(ctx, project, recording)
+
+		if err := s.upsertRecording(ctx, recording); err != nil {
+			return recorded, err
+		}
+		recorded++
+	}
+
+	if recorded > 0 {
+		log.Info().Str("egress_id", egress.ID.Hex()).Int("recordings", recorded).Msg("Recordings added to library")
+		s.reportStorage(ctx, egress.ProjectID)
+	}
+	return recorded, nil
+}
+
+// matchRecordingFile finds the reported file stored at key
+func matchRecordingFile(files []RecordingFile, key string) (RecordingFile, bool) {
+	for _, file := range files {
+		if file.Key == key || strings.HasSuffix(file.Key, "/"+key) {
+			return file, true
+		}
+	}
+	return RecordingFile{}, false
+}
+
+// describeObject fills in the size and checksum of a file recording in the
+// project's bucket from storage. Recordings are kept without them if
+// storage cannot be reached.
+func (s *RecordingService) describeObject(ctx context.Context, project *models.Project, recording *models.Recording) {
+	if recording.External || recording.Format == "hls" || (recording.SizeBytes > 0 && recording.Checksum != "") {
+		return
+	}
+	info, err := s.storage.HeadObject(ctx, project.StorageConfig, recording.StorageKey)
+	if err != nil {
+		log.Warn().Err(err).Str("key", recording.StorageKey).Msg("Failed to read recording metadata from storage")
+		return
+	}
+	if recording.SizeBytes == 0 {
+		recording.SizeBytes = info.Size
+	}
+	if recording.Checksum == "" && info.ETag != "" && !strings.Contains(info.ETag, "-") {
+		// Multipart ETags are not a digest of the content
+		recording.Checksum = "md5:" + info.ETag
+	}
+}
+
+// upsertRecording adds a recording, or updates the one for the same egress
+// and key without clearing what an earlier event reported or the tags
+func (s *RecordingService) upsertRecording(ctx context.Context, recording *models.Recording) error {
+	now := time.Now()
+	set := bson.M{
+		"duration_seconds": recording.DurationSeconds,
+		"updated_at":       now,
+	}
+	setOnInsert := bson.M{
+		"_id":            recording.ID,
+		"project_id":     recording.ProjectID,
+		"room_name":      recording.RoomName,
+		"format":         recording.Format,
+		"storage_bucket": recording.StorageBucket,
+		"external":       recording.External,
+		"cdn_url":        recording.CDNURL,
+		"tags":           recording.Tags,
+		"recorded_at":    recording.RecordedAt,
+		"created_at":     now,
+	}
+	if recording.SizeBytes > 0 {
+		set["size_bytes"] = recording.SizeBytes
+	} else {
+		setOnInsert["size_bytes"] = int64(0)
+	}
+	if recording.Checksum != "" {
+		set["checksum"] = recording.Checksum
+	}
+	if len(recording.Participants) > 0 {
+		set["participants"] = recording.Participants
+	}
+
+	_, err := s.db.Collection(models.Recording{}.TableName()).UpdateOne(ctx,
+		bson.M{"egress_id": recording.EgressID, "storage_key": recording.StorageKey},
+		bson.M{"$set": set, "$setOnInsert": setOnInsert},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save recording: %w", err)
+	}
+	return nil
+}
+
+// ListRecordings searches a project's recordings, newest first
+func (s *RecordingService) ListRecordings(ctx context.Context, projectID primitive.ObjectID, filter models.RecordingFilter) ([]models.Recording, int64, error) {
+	query := bson.M{"project_id": projectID}
+	if filter.RoomName != "" {
+		query["room_name"] = bson.M{"$regex": "^" + regexp.QuoteMeta(filter.RoomName)}
+	}
+	if filter.Participant != "" {
+		query["participants"] = filter.Participant
+	}
+	if filter.Tag != "" {
+		query["tags"] = filter.Tag
+	}
+	if filter.Format != "" {
+		query["format"] = strings.ToLower(filter.Format)
+	}
+	if !filter.StartDate.IsZero() || !filter.EndDate.IsZero() {
+		recordedAt := bson.M{}
+		if !filter.StartDate.IsZero() {
+			recordedAt["$gte"] = filter.StartDate
+		}
+		if !filter.EndDate.IsZero() {
+			recordedAt["$lte"] = filter.EndDate
+		}
+		query["recorded_at"] = recordedAt
+	}
+
+	page := filter.Page
+	if page < 1 {
+		page = 1
+	}
+	limit := filter.Limit
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	collection := s.db.Collection(models.Recording{}.TableName())
+	total, err := collection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count recordings: %w", err)
+	}
+
+	cursor, err := collection.Find(ctx, query, options.Find().
+		SetSkip(int64((page-1)*limit)).
+		SetLimit(int64(limit)).
+		SetSort(bson.D{{Key: "recorded_at", Value: -1}}))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list recordings: %w", err)
+	}
+	recordings := []models.Recording{}
+	if err := cursor.All(ctx, &recordings); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode recordings: %w", err)
+	}
+	return recordings, total, nil
+}
+
+// GetRecording returns a recording of a project
+func (s *RecordingService) GetRecording(ctx context.Context, projectID, recordingID primitive.ObjectID) (*models.Recording, error) {
+	var recording models.Recording
+	err := s.db.Collection(models.Recording{}.TableName()).FindOne(ctx, bson.M{"_id": recordingID, "project_id": projectID}).Decode(&recording)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrRecordingNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recording: %w", err)
+	}
+	return &recording, nil
+}
+
+// SetTags replaces the tags of a recording
+func (s *RecordingService) SetTags(ctx context.Context, projectID, recordingID primitive.ObjectID, tags []string) (*models.Recording, error) {
+	normalized, err := normalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	var recording models.Recording
+	err = s.db.Collection(models.Recording{}.TableName()).FindOneAndUpdate(ctx,
+		bson.M{"_id": recordingID, "project_id": projectID},
+		bson.M{"$set": bson.M{"tags": normalized, "updated_at": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&recording)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrRecordingNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update recording: %w", err)
+	}
+	return &recording, nil
+}
+
+// normalizeTags trims tags and drops duplicates
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > 64 {
+			return nil, fmt.Errorf("%w: tags are at most 64 characters", ErrInvalidRecordingRequest)
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxRecordingTags {
+		return nil, fmt.Errorf("%w: a recording has at most %d tags", ErrInvalidRecordingRequest, maxRecordingTags)
+	}
+	return normalized, nil
+}
+
+// DeleteRecording deletes a recording and its objects from the project's
+// storage
+func (s *RecordingService) DeleteRecording(ctx context.Context, project *models.Project, recordingID primitive.ObjectID) error {
+	recording, err := s.GetRecording(ctx, project.ID, recordingID)
+	if err != nil {
+		return err
+	}
+	if err := s.deleteRecording(ctx, project, recording); err != nil {
+		return err
+	}
+	s.reportStorage(ctx, project.ID)
+	return nil
+}
+
+// deleteRecording deletes a recording's objects, then the recording. The
+// recording is kept if storage fails so the deletion can be retried.
+func (s *RecordingService) deleteRecording(ctx context.Context, project *models.Project, recording *models.Recording) error {
+	if !recording.External {
+		keys := []string{recording.StorageKey}
+		if recording.Format == "hls" {
+			// LiveKit names segments after the playlist: name_00001.ts
+			segments, err := s.storage.ListObjects(ctx, project.StorageConfig, strings.TrimSuffix(recording.StorageKey, ".m3u8")+"_")
+			if err != nil {
+				return fmt.Errorf("failed to list recording segments: %w", err)
+			}
+			keys = append(keys, segments...)
+		}
+		for _, key := range keys {
+			if err := s.storage.DeleteObject(ctx, project.StorageConfig, key); err != nil {
+				return fmt.Errorf("failed to delete recording from storage: %w", err)
+			}
+		}
+	}
+
+	result, err := s.db.Collection(models.Recording{}.TableName()).DeleteOne(ctx, bson.M{"_id": recording.ID})
+	if err != nil {
+		return fmt.Errorf("failed to delete recording: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrRecordingNotFound
+	}
+
+	log.Info().Str("project_id", project.ID.Hex()).Str("recording_id", recording.ID.Hex()).Str("key", recording.StorageKey).Msg("Recording deleted")
+	return nil
+}
+
+// CreatePolicy creates a retention policy for a project
+func (s *RecordingService) CreatePolicy(ctx context.Context, projectID primitive.ObjectID, input *models.RetentionPolicyInput) (*models.RetentionPolicy, error) {
+	if err := input.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRecordingRequest, err)
+	}
+
+	now := time.Now()
+	policy := &models.RetentionPolicy{
+		ID:            primitive.NewObjectID(),
+		ProjectID:     projectID,
+		Name:          input.Name,
+		RetentionDays: input.RetentionDays,
+		RoomPattern:   input.RoomPattern,
+		Tag:           strings.TrimSpace(input.Tag),
+		Enabled:       input.Enabled == nil || *input.Enabled,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if _, err := s.db.Collection(models.RetentionPolicy{}.TableName()).InsertOne(ctx, policy); err != nil {
+		return nil, fmt.Errorf("failed to create retention policy: %w", err)
+	}
+
+	log.Info().Str("project_id", projectID.Hex()).Str("policy_id", policy.ID.Hex()).Int("retention_days", policy.RetentionDays).Msg("Retention policy created")
+	return policy, nil
+}
+
+// ListPolicies lists a project's retention policies
+func (s *RecordingService) ListPolicies(ctx context.Context, projectID primitive.ObjectID) ([]models.RetentionPolicy, error) {
+	cursor, err := s.db.Collection(models.RetentionPolicy{}.TableName()).Find(ctx,
+		bson.M{"project_id": projectID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list retention policies: %w", err)
+	}
+	policies := []models.RetentionPolicy{}
+	if err := cursor.All(ctx, &policies); err != nil {
+		return nil, fmt.Errorf("failed to decode retention policies: %w", err)
+	}
+	return policies, nil
+}
+
+// DeletePolicy deletes a retention policy
+func (s *RecordingService) DeletePolicy(ctx context.Context, projectID, policyID primitive.ObjectID) error {
+	result, err := s.db.Collection(models.RetentionPolicy{}.TableName()).DeleteOne(ctx, bson.M{"_id": policyID, "project_id": projectID})
+	if err != nil {
+		return fmt.Errorf("failed to delete retention policy: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrRetentionPolicyNotFound
+	}
+	return nil
+}
+
+// EnforceRetention deletes the recordings enabled retention policies have
+// expired. A recording that fails to delete is retried on the next pass.
+// It returns the number of recordings deleted.
+func (s *RecordingService) EnforceRetention(ctx context.Context, now time.Time) (int, error) {
+	cursor, err := s.db.Collection(models.RetentionPolicy{}.TableName()).Find(ctx, bson.M{"enabled": true})
+	if err != nil {
+		return 0, fmt.Errorf("failed to find retention policies: %w", err)
+	}
+	var policies []models.RetentionPolicy
+	if err := cursor.All(ctx, &policies); err != nil {
+		return 0, fmt.Errorf("failed to decode retention policies: %w", err)
+	}
+
+	deleted := 0
+	touched := make(map[primitive.ObjectID]bool)
+	for i := range policies {
+		if ctx.Err() != nil {
+			break
+		}
+		policy := &policies[i]
+		n, err := s.enforcePolicy(ctx, policy, now)
+		if err != nil {
+			log.Error().Err(err).Str("policy_id", policy.ID.Hex()).Msg("Failed to enforce retention policy")
+		}
+		if n > 0 {
+			deleted += n
+			touched[policy.ProjectID] = true
+		}
+	}
+
+	for projectID := range touched {
+		s.reportStorage(ctx, projectID)
+	}
+	return deleted, ctx.Err()
+}
+
+// enforcePolicy deletes the recordings a policy has expired, oldest first.
+// Each batch is read after the last recording of the one before, so
+// recordings that fail to delete do not hold back the rest.
+func (s *RecordingService) enforcePolicy(ctx context.Context, policy *models.RetentionPolicy, now time.Time) (int, error) {
+	query := bson.M{
+		"project_id":  policy.ProjectID,
+		"recorded_at": bson.M{"$lt": policy.ExpiresBefore(now)},
+	}
+	if policy.RoomPattern != "" {
+		query["room_name"] = bson.M{"$regex": policy.RoomRegex()}
+	}
+	if policy.Tag != "" {
+		query["tags"] = policy.Tag
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "recorded_at", Value: 1}, {Key: "_id", Value: 1}}).
+		SetLimit(retentionBatchSize)
+
+	var project *models.Project
+	deleted := 0
+	for ctx.Err() == nil {
+		cursor, err := s.db.Collection(models.Recording{}.TableName()).Find(ctx, query, opts)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to find expired recordings: %w", err)
+		}
+		var recordings []models.Recording
+		if err := cursor.All(ctx, &recordings); err != nil {
+			return deleted, fmt.Errorf("failed to decode expired recordings: %w", err)
+		}
+		if len(recordings) == 0 {
+			break
+		}
+
+		if project == nil {
+			if project, err = s.projectService.GetProject(ctx, policy.ProjectID); err != nil {
+				return deleted, err
+			}
+		}
+
+		for i := range recordings {
+			recording := &recordings[i]
+			err := s.deleteRecording(ctx, project, recording)
+			if errors.Is(err, ErrRecordingNotFound) {
+				// Deleted meanwhile, by hand or by another policy
+				continue
+			}
+			if err != nil {
+				log.Error().Err(err).Str("recording_id", recording.ID.Hex()).Msg("Failed to delete expired recording")
+				continue
+			}
+			deleted++
+		}
+		if len(recordings) < retentionBatchSize {
+			break
+		}
+
+		last := recordings[len(recordings)-1]
+		query["$or"] = bson.A{
+			bson.M{"recorded_at": bson.M{"$gt": last.RecordedAt}},
+			bson.M{"recorded_at": last.RecordedAt, "_id": bson.M{"$gt": last.ID}},
+		}
+	}
+	return deleted, nil
+}
+
+// ReportStorageUsage reports the storage level of every project with
+// recordings, so storage is averaged over regular samples
+func (s *RecordingService) ReportStorageUsage(ctx context.Context) error {
+	projectIDs, err := s.db.Collection(models.Recording{}.TableName()).Distinct(ctx, "project_id", bson.M{})
+	if err != nil {
+		return fmt.Errorf("failed to find projects with recordings: %w", err)
+	}
+	for _, id := range projectIDs {
+		if projectID, ok := id.(primitive.ObjectID); ok {
+			s.reportStorage(ctx, projectID)
+		}
+	}
+	return nil
+}
+
+// reportStorage reports the total size of a project's recordings in its
+// own bucket as its storage usage
+func (s *RecordingService) reportStorage(ctx context.Context, projectID primitive.ObjectID) {
+	if s.usageService == nil {
+		return
+	}
+
+	cursor, err := s.db.Collection(models.Recording{}.TableName()).Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"project_id": projectID, "external": bson.M{"$ne": true}}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "bytes": bson.M{"$sum": "$size_bytes"}}}},
+	})
+	if err != nil {
+		log.Error().Err(err).Str("project_id", projectID.Hex()).Msg("Failed to total recording storage")
+		return
+	}
+	var totals []struct {
+		Bytes int64 `bson:"bytes"`
+	}
+	if err := cursor.All(ctx, &totals); err != nil {
+		log.Error().Err(err).Str("project_id", projectID.Hex()).Msg("Failed to total recording storage")
+		return
+	}
+
+	var bytes int64
+	if len(totals) > 0 {
+		bytes = totals[0].Bytes
+	}
+	if err := s.usageService.TrackStorageUsage(ctx, projectID, float64(bytes)/(1<<30)); err != nil {
+		log.Error().Err(err).Str("project_id", projectID.Hex()).Msg("Failed to track storage usage")
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"pulse-control-plane/models"
 
+	"github.com/rs/zerolog/log"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -15,12 +16,17 @@ import (
 
 // SLAService handles SLA operations
 type SLAService struct {
-	db *mongo.Database
+	db            *mongo.Database
+	creditService *CreditService
 }
 
-// NewSLAService creates a new SLA service
-func NewSLAService(db *mongo.Database) *SLAService {
-	return &SLAService{db: db}
+// NewSLAService creates a new SLA service. creditService issues the credit
+// earned by non-compliant SLA metrics.
+func NewSLAService(db *mongo.Database, creditService *CreditService) *SLAService {
+	return &SLAService{
+		db:            db,
+		creditService: creditService,
+	}
 }
 
 // CreateSLATemplate creates a new SLA template
@@ -138,6 +144,12 @@ func (s *SLAService) TrackSLAMetrics(ctx context.Context, metric *models.SLAMetr
 	}
 	
 	metric.ID = result.InsertedID.(primitive.ObjectID)
+
+	// Breaches are compensated with credit on the next invoice
+	if _, err := s.creditService.IssueSLACredit(ctx, metric); err != nil {
+		log.Error().Err(err).Str("org_id", metric.OrgID.Hex()).Msg("Failed to issue SLA credit")
+	}
+
 	return nil
 }
 
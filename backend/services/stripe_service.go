@@ -0,0 +1,552 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"pulse-control-plane/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DefaultStripeAPIBase is Stripe's API endpoint
+const DefaultStripeAPIBase = "https://api.stripe.com"
+
+// stripeSignatureTolerance is how old a signed webhook may be before it is
+// rejected as a possible replay
+const stripeSignatureTolerance = 5 * time.Minute
+
+// StripeService bills organizations through Stripe's REST API
+type StripeService struct {
+	secretKey     string
+	webhookSecret string
+	baseURL       string
+	httpClient    *http.Client
+}
+
+// NewStripeService creates a new Stripe service. baseURL defaults to
+// DefaultStripeAPIBase and is overridden to point at a fake in tests.
+func NewStripeService(secretKey, webhookSecret, baseURL string) *StripeService {
+	if baseURL == "" {
+		baseURL = DefaultStripeAPIBase
+	}
+	return &StripeService{
+		secretKey:     secretKey,
+		webhookSecret: webhookSecret,
+		baseURL:       strings.TrimRight(baseURL, "/"),
+		httpClient:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// StripeError is an error response from the Stripe API
+type StripeError struct {
+	StatusCode int
+	Type       string // e.g. card_error, invalid_request_error
+	Code       string
+	Message    string
+}
+
+func (e *StripeError) Error() string {
+	return fmt.Sprintf("stripe: %s (%s, status %d)", e.Message, e.Type, e.StatusCode)
+}
+
+// Name returns the provider's identifier
+func (s *StripeService) Name() string {
+	return models.PaymentProviderStripe
+}
+
+// stripeTaxIDTypes maps tax ID types to Stripe's customer tax ID types
+var stripeTaxIDTypes = map[string]string{
+	models.TaxIDTypeGSTIN: "in_gst",
+	models.TaxIDTypeEUVAT: "eu_vat",
+}
+
+// RegisterCustomer creates the organization as a Stripe customer
+func (s *StripeService) RegisterCustomer(ctx context.Context, org *models.Organization) (string, error) {
+	form := url.Values{}
+	form.Set("name", org.Name)
+	form.Set("email", org.AdminEmail)
+	form.Set("metadata[org_id]", org.ID.Hex())
+
+	if profile := org.TaxProfile; profile != nil {
+		address := profile.BillingAddress
+		form.Set("address[line1]", address.Line1)
+		form.Set("address[line2]", address.Line2)
+		form.Set("address[city]", address.City)
+		form.Set("address[state]", address.State)
+		form.Set("address[postal_code]", address.PostalCode)
+		form.Set("address[country]", address.Country)
+
+		if taxIDType, ok := stripeTaxIDTypes[profile.TaxIDType]; ok && profile.TaxIDValid {
+			form.Set("tax_id_data[0][type]", taxIDType)
+			form.Set("tax_id_data[0][value]", profile.TaxID)
+		}
+	}
+
+	var customer struct {
+		ID string `json:"id"`
+	}
+	if err := s.post(ctx, "/v1/customers", form, "customer-"+org.ID.Hex(), &customer); err != nil {
+		return "", fmt.Errorf("failed to create customer: %w", err)
+	}
+	return customer.ID, nil
+}
+
+// AttachPaymentMethod attaches a payment method to a customer and makes it
+// the default for invoices
+func (s *StripeService) AttachPaymentMethod(ctx context.Context, customerID, paymentMethodID string) error {
+	form := url.Values{}
+	form.Set("customer", customerID)
+	if err := s.post(ctx, "/v1/payment_methods/"+url.PathEscape(paymentMethodID)+"/attach", form, "", nil); err != nil {
+		return fmt.Errorf("failed to attach payment method: %w", err)
+	}
+
+	form = url.Values{}
+	form.Set("invoice_settings[default_payment_method]", paymentMethodID)
+	if err := s.post(ctx, "/v1/customers/"+url.PathEscape(customerID), form, "", nil); err != nil {
+		return fmt.Errorf("failed to set default payment method: %w", err)
+	}
+	return nil
+}
+
+// PushInvoice creates the invoice in Stripe with one item per line and tax
+// line, finalizes it and lets Stripe charge the default payment method. The
+// invoice ID is used in idempotency keys so a retried push does not bill twice.
+func (s *StripeService) PushInvoice(ctx context.Context, customerID string, invoice *models.Invoice) (*ProviderInvoice, error) {
+	currency := strings.ToLower(invoice.Currency)
+	key := "invoice-" + invoice.ID.Hex()
+
+	form := url.Values{}
+	form.Set("customer", customerID)
+	form.Set("currency", currency)
+	form.Set("collection_method", "charge_automatically")
+	form.Set("auto_advance", "true")
+	form.Set("pending_invoice_items_behavior", "exclude")
+	form.Set("description", fmt.Sprintf("Pulse usage for %s", invoice.BillingPeriod))
+	form.Set("metadata[invoice_id]", invoice.ID.Hex())
+	form.Set("metadata[invoice_number]", invoice.InvoiceNumber)
+
+	var created stripeInvoice
+	if err := s.post(ctx, "/v1/invoices", form, key, &created); err != nil {
+		return nil, fmt.Errorf("failed to create invoice: %w", err)
+	}
+
+	type item struct {
+		description string
+		amount      int64
+	}
+	var items []item
+	for _, line := range invoice.LineItems {
+		items = append(items, item{line.Description, line.Amount})
+	}
+	for _, line := range invoice.TaxLines {
+		items = append(items, item{fmt.Sprintf("%s (%.2f%%)", line.Name, line.Rate), line.Amount})
+	}
+
+	for i, it := range items {
+		form := url.Values{}
+		form.Set("customer", customerID)
+		form.Set("invoice", created.ID)
+		form.Set("currency", currency)
+		form.Set("amount", strconv.FormatInt(it.amount, 10))
+		form.Set("description", it.description)
+		if err := s.post(ctx, "/v1/invoiceitems", form, fmt.Sprintf("%s-item-%d", key, i), nil); err != nil {
+			return nil, fmt.Errorf("failed to add invoice item: %w", err)
+		}
+	}
+
+	var finalized stripeInvoice
+	if err := s.post(ctx, "/v1/invoices/"+url.PathEscape(created.ID)+"/finalize", url.Values{}, key+"-finalize", &finalized); err != nil {
+		return nil, fmt.Errorf("failed to finalize invoice: %w", err)
+	}
+
+	return &ProviderInvoice{
+		ID:     finalized.ID,
+		URL:    finalized.HostedInvoiceURL,
+		Status: finalized.Status,
+	}, nil
+}
+
+// CreatePaymentIntent starts a payment of the invoice total, confirmed
+// client-side with the returned secret
+func (s *StripeService) CreatePaymentIntent(ctx context.Context, customerID string, invoice *models.Invoice) (*PaymentIntent, error) {
+	form := url.Values{}
+	form.Set("amount", strconv.FormatInt(invoice.Total, 10))
+	form.Set("currency", strings.ToLower(invoice.Currency))
+	form.Set("customer", customerID)
+	form.Set("description", fmt.Sprintf("Invoice %s", invoice.InvoiceNumber))
+	form.Set("automatic_payment_methods[enabled]", "true")
+	form.Set("metadata[invoice_id]", invoice.ID.Hex())
+
+	var intent struct {
+		ID           string `json:"id"`
+		ClientSecret string `json:"client_secret"`
+		Amount       int64  `json:"amount"`
+		Currency     string `json:"currency"`
+		Status       string `json:"status"`
+	}
+	key := fmt.Sprintf("payment-intent-%s-%d", invoice.ID.Hex(), invoice.Total)
+	if err := s.post(ctx, "/v1/payment_intents", form, key, &intent); err != nil {
+		return nil, fmt.Errorf("failed to create payment intent: %w", err)
+	}
+
+	return &PaymentIntent{
+		ID:           intent.ID,
+		ClientSecret: intent.ClientSecret,
+		Amount:       intent.Amount,
+		Currency:     strings.ToUpper(intent.Currency),
+		Status:       intent.Status,
+	}, nil
+}
+
+// GetPayment fetches a payment intent. Only succeeded intents are settled.
+func (s *StripeService) GetPayment(ctx context.Context, paymentID string) (*ProviderPayment, error) {
+	var intent struct {
+		ID             string `json:"id"`
+		Customer       string `json:"customer"`
+		AmountReceived int64  `json:"amount_received"`
+		Currency       string `json:"currency"`
+		Status         string `json:"status"`
+	}
+	if err := s.do(ctx, http.MethodGet, "/v1/payment_intents/"+url.PathEscape(paymentID), nil, "", &intent); err != nil {
+		return nil, fmt.Errorf("failed to fetch payment intent: %w", err)
+	}
+
+	return &ProviderPayment{
+		ID:         intent.ID,
+		CustomerID: intent.Customer,
+		Amount:     intent.AmountReceived,
+		Currency:   strings.ToUpper(intent.Currency),
+		Succeeded:  intent.Status == "succeeded",
+	}, nil
+}
+
+// RefundPayment refunds a payment intent or charge
+func (s *StripeService) RefundPayment(ctx context.Context, paymentID string, amount int64) (string, error) {
+	form := url.Values{}
+	if strings.HasPrefix(paymentID, "pi_") {
+		form.Set("payment_intent", paymentID)
+	} else {
+		form.Set("charge", paymentID)
+	}
+	if amount > 0 {
+		form.Set("amount", strconv.FormatInt(amount, 10))
+	}
+
+	var refund struct {
+		ID string `json:"id"`
+	}
+	if err := s.post(ctx, "/v1/refunds", form, "", &refund); err != nil {
+		return "", fmt.Errorf("failed to create refund: %w", err)
+	}
+	return refund.ID, nil
+}
+
+// stripeSubscription is the part of a Stripe subscription object billing
+// reads
+type stripeSubscription struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Items  struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	} `json:"items"`
+	PauseCollection *struct {
+		Behavior string `json:"behavior"`
+	} `json:"pause_collection"`
+}
+
+// StartSubscription subscribes a customer to a Stripe price, charged to the
+// customer's default payment method
+func (s *StripeService) StartSubscription(ctx context.Context, orgID primitive.ObjectID, customerID, planID string) (*ProviderSubscription, error) {
+	form := url.Values{}
+	form.Set("customer", customerID)
+	form.Set("items[0][price]", planID)
+	form.Set("collection_method", "charge_automatically")
+	form.Set("metadata[org_id]", orgID.Hex())
+
+	var subscription stripeSubscription
+	if err := s.post(ctx, "/v1/subscriptions", form, "", &subscription); err != nil {
+		return nil, fmt.Errorf("failed to create subscription: %w", err)
+	}
+	return &ProviderSubscription{ID: subscription.ID, Status: subscription.Status}, nil
+}
+
+// ChangeSubscriptionPlan swaps the subscription's price. Without proration
+// the new price is charged from the next renewal.
+func (s *StripeService) ChangeSubscriptionPlan(ctx context.Context, subscriptionID, planID string, prorate bool) error {
+	var subscription stripeSubscription
+	if err := s.do(ctx, http.MethodGet, "/v1/subscriptions/"+url.PathEscape(subscriptionID), nil, "", &subscription); err != nil {
+		return fmt.Errorf("failed to fetch subscription: %w", err)
+	}
+	if len(subscription.Items.Data) == 0 {
+		return fmt.Errorf("subscription %s has no items", subscriptionID)
+	}
+
+	form := url.Values{}
+	form.Set("items[0][id]", subscription.Items.Data[0].ID)
+	form.Set("items[0][price]", planID)
+	form.Set("proration_behavior", "none")
+	if prorate {
+		form.Set("proration_behavior", "create_prorations")
+	}
+	if err := s.post(ctx, "/v1/subscriptions/"+url.PathEscape(subscriptionID), form, "", nil); err != nil {
+		return fmt.Errorf("failed to change subscription plan: %w", err)
+	}
+	return nil
+}
+
+// CancelSubscription cancels the subscription now
+func (s *StripeService) CancelSubscription(ctx context.Context, subscriptionID string) error {
+	if err := s.do(ctx, http.MethodDelete, "/v1/subscriptions/"+url.PathEscape(subscriptionID), nil, "", nil); err != nil {
+		return fmt.Errorf("failed to cancel subscription: %w", err)
+	}
+	return nil
+}
+
+// PauseSubscription pauses collection, voiding invoices raised while paused
+func (s *StripeService) PauseSubscription(ctx context.Context, subscriptionID string) error {
+	form := url.Values{}
+	form.Set("pause_collection[behavior]", "void")
+	if err := s.post(ctx, "/v1/subscriptions/"+url.PathEscape(subscriptionID), form, "", nil); err != nil {
+		return fmt.Errorf("failed to pause subscription: %w", err)
+	}
+	return nil
+}
+
+// ResumeSubscription clears the subscription's paused collection
+func (s *StripeService) ResumeSubscription(ctx context.Context, subscriptionID string) error {
+	form := url.Values{}
+	form.Set("pause_collection", "")
+	if err := s.post(ctx, "/v1/subscriptions/"+url.PathEscape(subscriptionID), form, "", nil); err != nil {
+		return fmt.Errorf("failed to resume subscription: %w", err)
+	}
+	return nil
+}
+
+// stripeInvoice is the part of a Stripe invoice object billing reads
+type stripeInvoice struct {
+	ID               string            `json:"id"`
+	Status           string            `json:"status"`
+	HostedInvoiceURL string            `json:"hosted_invoice_url"`
+	PaymentIntent    string            `json:"payment_intent"`
+	Metadata         map[string]string `json:"metadata"`
+}
+
+// VerifyWebhook checks the Stripe-Signature header and translates invoice,
+// payment intent and subscription events
+func (s *StripeService) VerifyWebhook(payload []byte, header http.Header) (*PaymentEvent, error) {
+	if err := VerifyStripeSignature(payload, header.Get("Stripe-Signature"), s.webhookSecret, time.Now()); err != nil {
+		return nil, err
+	}
+	return s.ParseWebhook(payload)
+}
+
+// ParseWebhook translates a verified Stripe event
+func (s *StripeService) ParseWebhook(payload []byte) (*PaymentEvent, error) {
+	var event struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		Data struct {
+			Object json.RawMessage `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to parse webhook payload: %w", err)
+	}
+
+	result := &PaymentEvent{ID: event.ID, Type: event.Type}
+	var metadata map[string]string
+
+	switch {
+	case strings.HasPrefix(event.Type, "invoice."):
+		var invoice stripeInvoice
+		if err := json.Unmarshal(event.Data.Object, &invoice); err != nil {
+			return nil, fmt.Errorf("failed to parse invoice: %w", err)
+		}
+		result.ProviderInvoiceID = invoice.ID
+		result.PaymentID = invoice.PaymentIntent
+		metadata = invoice.Metadata
+
+		switch event.Type {
+		case "invoice.paid":
+			result.Outcome = PaymentOutcomePaid
+		case "invoice.payment_failed":
+			result.Outcome = PaymentOutcomeFailed
+			result.Message = "invoice payment failed"
+		case "invoice.voided":
+			result.Outcome = PaymentOutcomeVoid
+		}
+
+	case strings.HasPrefix(event.Type, "payment_intent."):
+		var intent struct {
+			ID               string            `json:"id"`
+			Metadata         map[string]string `json:"metadata"`
+			LastPaymentError *struct {
+				Message string `json:"message"`
+			} `json:"last_payment_error"`
+		}
+		if err := json.Unmarshal(event.Data.Object, &intent); err != nil {
+			return nil, fmt.Errorf("failed to parse payment intent: %w", err)
+		}
+		result.PaymentID = intent.ID
+		metadata = intent.Metadata
+
+		switch event.Type {
+		case "payment_intent.succeeded":
+			result.Outcome = PaymentOutcomePaid
+		case "payment_intent.payment_failed":
+			result.Outcome = PaymentOutcomeFailed
+			result.Message = "payment failed"
+			if intent.LastPaymentError != nil && intent.LastPaymentError.Message != "" {
+				result.Message = intent.LastPaymentError.Message
+			}
+		}
+
+	case strings.HasPrefix(event.Type, "customer.subscription."):
+		var subscription stripeSubscription
+		if err := json.Unmarshal(event.Data.Object, &subscription); err != nil {
+			return nil, fmt.Errorf("failed to parse subscription: %w", err)
+		}
+		result.SubscriptionID = subscription.ID
+
+		switch event.Type {
+		case "customer.subscription.deleted":
+			result.SubscriptionStatus = models.SubscriptionStatusCancelled
+		case "customer.subscription.paused":
+			result.SubscriptionStatus = models.SubscriptionStatusPaused
+		case "customer.subscription.resumed":
+			result.SubscriptionStatus = models.SubscriptionStatusActive
+		case "customer.subscription.updated":
+			// Collection paused or resumed from the dashboard
+			if subscription.PauseCollection != nil {
+				result.SubscriptionStatus = models.SubscriptionStatusPaused
+			} else if subscription.Status == "active" {
+				result.SubscriptionStatus = models.SubscriptionStatusActive
+			}
+		}
+	}
+
+	if id, err := primitive.ObjectIDFromHex(metadata["invoice_id"]); err == nil {
+		result.InvoiceID = id
+	}
+	return result, nil
+}
+
+// VerifyStripeSignature checks a Stripe-Signature header ("t=<unix>,v1=<hex>")
+// against the payload: v1 is the HMAC-SHA256 of "<t>.<payload>" keyed with the
+// endpoint secret. Signatures older than the tolerance are rejected.
+func VerifyStripeSignature(payload []byte, header, secret string, now time.Time) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return ErrInvalidWebhookSignature
+	}
+
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidWebhookSignature
+	}
+	if age := now.Sub(time.Unix(signedAt, 0)); age > stripeSignatureTolerance || age < -stripeSignatureTolerance {
+		return fmt.Errorf("%w: timestamp outside tolerance", ErrInvalidWebhookSignature)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+
+	for _, signature := range signatures {
+		decoded, err := hex.DecodeString(signature)
+		if err == nil && hmac.Equal(decoded, expected) {
+			return nil
+		}
+	}
+	return ErrInvalidWebhookSignature
+}
+
+// post sends a form-encoded request to the Stripe API and decodes the
+// response into out if it is not nil
+func (s *StripeService) post(ctx context.Context, path string, form url.Values, idempotencyKey string, out interface{}) error {
+	return s.do(ctx, http.MethodPost, path, form, idempotencyKey, out)
+}
+
+// do sends a request to the Stripe API with form as its body, if any, and
+// decodes the response into out if it is not nil
+func (s *StripeService) do(ctx context.Context, method, path string, form url.Values, idempotencyKey string, out interface{}) error {
+	var reqBody io.Reader
+	if form != nil {
+		reqBody = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.secretKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error struct {
+				Type    string `json:"type"`
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.Unmarshal(body, &apiErr)
+		if apiErr.Error.Message == "" {
+			apiErr.Error.Message = http.StatusText(resp.StatusCode)
+		}
+		return &StripeError{
+			StatusCode: resp.StatusCode,
+			Type:       apiErr.Error.Type,
+			Code:       apiErr.Error.Code,
+			Message:    apiErr.Error.Message,
+		}
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,558 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"pulse-control-plane/models"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrInvalidPlanChange is returned for an upgrade to a lower plan or a
+	// downgrade to a higher one
+	ErrInvalidPlanChange = errors.New("invalid plan change")
+
+	// ErrSubscriptionState is returned for a transition the subscription's
+	// status does not allow, e.g. resuming an active subscription
+	ErrSubscriptionState = errors.New("subscription cannot make this change")
+)
+
+// SubscriptionService drives organizations' self-service plan changes and
+// keeps their plan, and so their limits, in step with the subscription at
+// their payment provider. Upgrades take effect immediately and are prorated
+// on the next invoice; downgrades and cancellations can wait for the end of
+// the billing cycle.
+type SubscriptionService struct {
+	db             *mongo.Database
+	pricingService *PricingService
+	paymentService *PaymentService
+	quotaService   *QuotaService
+}
+
+// NewSubscriptionService creates a new subscription service and registers it
+// for subscription changes reported by providers. quotaService may be nil, in
+// which case cached limits expire on their own after a plan change.
+func NewSubscriptionService(db *mongo.Database, pricingService *PricingService, paymentService *PaymentService, quotaService *QuotaService) *SubscriptionService {
+	s := &SubscriptionService{
+		db:             db,
+		pricingService: pricingService,
+		paymentService: paymentService,
+		quotaService:   quotaService,
+	}
+	paymentService.OnSubscriptionStatus(s.SyncProviderStatus)
+	return s
+}
+
+// SubscriptionDetails is an organization's subscription with the plan it is
+// on and its current billing cycle
+type SubscriptionDetails struct {
+	Subscription *models.Subscription `json:"subscription"`
+	Plan         *models.PricingPlan  `json:"plan"`
+	PeriodStart  time.Time            `json:"period_start"`
+	PeriodEnd    time.Time            `json:"period_end"`
+}
+
+// GetSubscription returns an organization's subscription. Organizations that
+// never changed their subscription are active on their current plan.
+func (s *SubscriptionService) GetSubscription(ctx context.Context, orgID primitive.ObjectID) (*SubscriptionDetails, error) {
+	org, plan, err := s.pricingService.ResolveOrgPlan(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := s.load(ctx, org)
+	if err != nil {
+		return nil, err
+	}
+	return s.details(org, sub, plan), nil
+}
+
+// Upgrade moves an organization onto a higher plan now. The provider
+// subscription is changed with proration, or started if the organization had
+// none, and any scheduled downgrade or cancellation is dropped.
+func (s *SubscriptionService) Upgrade(ctx context.Context, orgID primitive.ObjectID, target *models.PricingPlan, changedBy string) (*SubscriptionDetails, error) {
+	org, current, err := s.pricingService.ResolveOrgPlan(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := s.load(ctx, org)
+	if err != nil {
+		return nil, err
+	}
+	if sub.Status == models.SubscriptionStatusPaused {
+		return nil, fmt.Errorf("%w: resume the subscription before upgrading", ErrSubscriptionState)
+	}
+	if !IsPlanUpgrade(current, target) {
+		return nil, fmt.Errorf("%w: %s is not an upgrade from %s", ErrInvalidPlanChange, target.Name, current.Name)
+	}
+
+	if err := s.syncProviderPlan(ctx, org, sub, target, true); err != nil {
+		return nil, err
+	}
+	if _, err := s.pricingService.AssignPlan(ctx, org.ID, target, changedBy); err != nil {
+		return nil, err
+	}
+
+	sub.Status = models.SubscriptionStatusActive
+	sub.ScheduledChange = nil
+	sub.CancelledAt = nil
+	if err := s.save(ctx, sub); err != nil {
+		return nil, err
+	}
+	s.quotaService.Invalidate()
+
+	log.Info().Str("org_id", org.ID.Hex()).Str("plan", target.Code).Msg("Subscription upgraded")
+	return s.details(org, sub, target), nil
+}
+
+// Downgrade schedules a move onto a lower plan at the end of the current
+// billing cycle, replacing any change already scheduled
+func (s *SubscriptionService) Downgrade(ctx context.Context, orgID primitive.ObjectID, target *models.PricingPlan, changedBy string) (*SubscriptionDetails, error) {
+	org, current, err := s.pricingService.ResolveOrgPlan(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := s.load(ctx, org)
+	if err != nil {
+		return nil, err
+	}
+	if sub.Status != models.SubscriptionStatusActive {
+		return nil, fmt.Errorf("%w: subscription is %s", ErrSubscriptionState, sub.Status)
+	}
+	if !IsPlanUpgrade(target, current) {
+		return nil, fmt.Errorf("%w: %s is not a downgrade from %s", ErrInvalidPlanChange, target.Name, current.Name)
+	}
+
+	s.schedule(org, sub, models.ScheduledChangeDowngrade, target, changedBy)
+	if err := s.save(ctx, sub); err != nil {
+		return nil, err
+	}
+	return s.details(org, sub, current), nil
+}
+
+// Cancel moves an organization onto the Free plan and ends its provider
+// subscription, now or at the end of the current billing cycle
+func (s *SubscriptionService) Cancel(ctx context.Context, orgID primitive.ObjectID, input *models.SubscriptionCancel, changedBy string) (*SubscriptionDetails, error) {
+	org, current, err := s.pricingService.ResolveOrgPlan(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := s.load(ctx, org)
+	if err != nil {
+		return nil, err
+	}
+	if sub.Status == models.SubscriptionStatusCancelled {
+		return nil, fmt.Errorf("%w: subscription is already cancelled", ErrSubscriptionState)
+	}
+	free, err := s.pricingService.LatestPlanFor(ctx, "Free")
+	if err != nil {
+		return nil, err
+	}
+
+	if input.AtPeriodEnd {
+		s.schedule(org, sub, models.ScheduledChangeCancel, free, changedBy)
+		if err := s.save(ctx, sub); err != nil {
+			return nil, err
+		}
+		return s.details(org, sub, current), nil
+	}
+
+	if err := s.cancel(ctx, org, sub, free, changedBy, time.Now(), true); err != nil {
+		return nil, err
+	}
+	return s.details(org, sub, free), nil
+}
+
+// Pause stops the provider subscription and moves the organization onto Free
+// limits until it resumes. Resuming restores the plan it was on.
+func (s *SubscriptionService) Pause(ctx context.Context, orgID primitive.ObjectID, changedBy string) (*SubscriptionDetails, error) {
+	org, current, err := s.pricingService.ResolveOrgPlan(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := s.load(ctx, org)
+	if err != nil {
+		return nil, err
+	}
+	if sub.Status != models.SubscriptionStatusActive {
+		return nil, fmt.Errorf("%w: subscription is %s", ErrSubscriptionState, sub.Status)
+	}
+
+	if sub.ProviderSubscriptionID != "" {
+		provider, err := s.subscriptionProvider(org, sub)
+		if err != nil {
+			return nil, err
+		}
+		if provider != nil {
+			if err := provider.PauseSubscription(ctx, sub.ProviderSubscriptionID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	free, err := s.pause(ctx, org, sub, current, changedBy)
+	if err != nil {
+		return nil, err
+	}
+	return s.details(org, sub, free), nil
+}
+
+// Resume restarts a paused provider subscription and restores the plan the
+// organization was on when it paused
+func (s *SubscriptionService) Resume(ctx context.Context, orgID primitive.ObjectID, changedBy string) (*SubscriptionDetails, error) {
+	org, _, err := s.pricingService.ResolveOrgPlan(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := s.load(ctx, org)
+	if err != nil {
+		return nil, err
+	}
+	if sub.Status != models.SubscriptionStatusPaused {
+		return nil, fmt.Errorf("%w: subscription is %s", ErrSubscriptionState, sub.Status)
+	}
+
+	if sub.ProviderSubscriptionID != "" {
+		provider, err := s.subscriptionProvider(org, sub)
+		if err != nil {
+			return nil, err
+		}
+		if provider != nil {
+			if err := provider.ResumeSubscription(ctx, sub.ProviderSubscriptionID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	plan, err := s.resume(ctx, org, sub, changedBy)
+	if err != nil {
+		return nil, err
+	}
+	return s.details(org, sub, plan), nil
+}
+
+// ApplyScheduledChanges applies the downgrades and cancellations whose
+// billing cycle has ended. Each change takes effect at the cycle boundary,
+// so the closed cycle is billed on the old plan without proration. It
+// returns the number of changes applied.
+func (s *SubscriptionService) ApplyScheduledChanges(ctx context.Context, now time.Time) (int, error) {
+	cursor, err := s.db.Collection(models.Subscription{}.TableName()).Find(ctx,
+		bson.M{"scheduled_change.effective_at": bson.M{"$lte": now}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to find scheduled plan changes: %w", err)
+	}
+	var subs []models.Subscription
+	if err := cursor.All(ctx, &subs); err != nil {
+		return 0, fmt.Errorf("failed to decode subscriptions: %w", err)
+	}
+
+	applied := 0
+	for i := range subs {
+		if err := s.applyScheduledChange(ctx, &subs[i]); err != nil {
+			log.Error().Err(err).Str("org_id", subs[i].OrgID.Hex()).Msg("Failed to apply scheduled plan change")
+			continue
+		}
+		applied++
+	}
+	if applied > 0 {
+		s.quotaService.Invalidate()
+	}
+	return applied, nil
+}
+
+// applyScheduledChange applies one subscription's scheduled change
+func (s *SubscriptionService) applyScheduledChange(ctx context.Context, sub *models.Subscription) error {
+	change := sub.ScheduledChange
+	var org models.Organization
+	err := s.db.Collection(models.Organization{}.TableName()).FindOne(ctx, bson.M{"_id": sub.OrgID}).Decode(&org)
+	if err != nil {
+		return fmt.Errorf("failed to find organization: %w", err)
+	}
+
+	switch {
+	case change.Action == models.ScheduledChangeCancel:
+		return s.cancel(ctx, &org, sub, &change.Plan, change.RequestedBy, change.EffectiveAt, true)
+
+	case sub.Status == models.SubscriptionStatusPaused:
+		// The downgraded plan is what resuming restores
+		if err := s.syncProviderPlan(ctx, &org, sub, &change.Plan, false); err != nil {
+			return err
+		}
+		sub.PausedPlan = &change.Plan
+
+	default:
+		if err := s.syncProviderPlan(ctx, &org, sub, &change.Plan, false); err != nil {
+			return err
+		}
+		if _, err := s.pricingService.AssignPlanAt(ctx, org.ID, &change.Plan, change.RequestedBy, change.EffectiveAt); err != nil {
+			return err
+		}
+	}
+
+	sub.ScheduledChange = nil
+	log.Info().Str("org_id", org.ID.Hex()).Str("plan", change.Plan.Code).Msg("Scheduled downgrade applied")
+	return s.save(ctx, sub)
+}
+
+// SyncProviderStatus applies a subscription state change made on the
+// provider's side, e.g. a cancellation from its dashboard, so the
+// organization's plan follows. Subscriptions we did not start are ignored.
+func (s *SubscriptionService) SyncProviderStatus(ctx context.Context, provider, subscriptionID, status string) error {
+	var sub models.Subscription
+	err := s.db.Collection(models.Subscription{}.TableName()).FindOne(ctx,
+		bson.M{"provider": provider, "provider_subscription_id": subscriptionID}).Decode(&sub)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find subscription: %w", err)
+	}
+	if sub.Status == status {
+		return nil
+	}
+
+	org, current, err := s.pricingService.ResolveOrgPlan(ctx, sub.OrgID)
+	if err != nil {
+		return err
+	}
+	changedBy := provider
+
+	switch status {
+	case models.SubscriptionStatusPaused:
+		if sub.Status != models.SubscriptionStatusActive {
+			return nil
+		}
+		_, err = s.pause(ctx, org, &sub, current, changedBy)
+	case models.SubscriptionStatusActive:
+		if sub.Status != models.SubscriptionStatusPaused {
+			return nil
+		}
+		_, err = s.resume(ctx, org, &sub, changedBy)
+	case models.SubscriptionStatusCancelled:
+		var free *models.PricingPlan
+		if free, err = s.pricingService.LatestPlanFor(ctx, "Free"); err == nil {
+			err = s.cancel(ctx, org, &sub, free, changedBy, time.Now(), false)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Info().Str("org_id", org.ID.Hex()).Str("provider", provider).Str("status", status).Msg("Subscription changed by provider")
+	return nil
+}
+
+// pause moves a subscription to paused on Free limits, remembering its plan
+func (s *SubscriptionService) pause(ctx context.Context, org *models.Organization, sub *models.Subscription, current *models.PricingPlan, changedBy string) (*models.PricingPlan, error) {
+	free, err := s.pricingService.LatestPlanFor(ctx, "Free")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.pricingService.AssignPlan(ctx, org.ID, free, changedBy); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	sub.Status = models.SubscriptionStatusPaused
+	sub.PausedPlan = current
+	sub.PausedAt = &now
+	if err := s.save(ctx, sub); err != nil {
+		return nil, err
+	}
+	s.quotaService.Invalidate()
+	return free, nil
+}
+
+// resume restores a paused subscription's plan
+func (s *SubscriptionService) resume(ctx context.Context, org *models.Organization, sub *models.Subscription, changedBy string) (*models.PricingPlan, error) {
+	plan := sub.PausedPlan
+	if plan == nil {
+		var err error
+		if plan, err = s.pricingService.LatestPlanFor(ctx, org.Plan); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := s.pricingService.AssignPlan(ctx, org.ID, plan, changedBy); err != nil {
+		return nil, err
+	}
+
+	sub.Status = models.SubscriptionStatusActive
+	sub.PausedPlan = nil
+	sub.PausedAt = nil
+	if err := s.save(ctx, sub); err != nil {
+		return nil, err
+	}
+	s.quotaService.Invalidate()
+	return plan, nil
+}
+
+// cancel ends the provider subscription, if callProvider is set, and moves
+// the organization onto the Free plan from effectiveAt
+func (s *SubscriptionService) cancel(ctx context.Context, org *models.Organization, sub *models.Subscription, free *models.PricingPlan, changedBy string, effectiveAt time.Time, callProvider bool) error {
+	if callProvider && sub.ProviderSubscriptionID != "" {
+		provider, err := s.subscriptionProvider(org, sub)
+		if err != nil {
+			return err
+		}
+		if provider != nil {
+			if err := provider.CancelSubscription(ctx, sub.ProviderSubscriptionID); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := s.pricingService.AssignPlanAt(ctx, org.ID, free, changedBy, effectiveAt); err != nil {
+		return err
+	}
+
+	sub.Status = models.SubscriptionStatusCancelled
+	sub.ProviderSubscriptionID = ""
+	sub.ScheduledChange = nil
+	sub.PausedPlan = nil
+	sub.PausedAt = nil
+	sub.CancelledAt = &effectiveAt
+	if err := s.save(ctx, sub); err != nil {
+		return err
+	}
+	s.quotaService.Invalidate()
+
+	log.Info().Str("org_id", org.ID.Hex()).Msg("Subscription cancelled")
+	return nil
+}
+
+// syncProviderPlan makes the provider subscription match a plan: it is
+// changed to the plan's provider plan, started if there is none yet, or
+// cancelled if the plan has no provider plan. Providers without
+// subscriptions are left alone.
+func (s *SubscriptionService) syncProviderPlan(ctx context.Context, org *models.Organization, sub *models.Subscription, plan *models.PricingPlan, prorate bool) error {
+	provider, err := s.subscriptionProvider(org, sub)
+	if err != nil || provider == nil {
+		return err
+	}
+	planID := plan.ProviderPlans[provider.Name()]
+
+	switch {
+	case planID == "" && sub.ProviderSubscriptionID == "":
+		return nil
+
+	case planID == "":
+		if err := provider.CancelSubscription(ctx, sub.ProviderSubscriptionID); err != nil {
+			return err
+		}
+		sub.ProviderSubscriptionID = ""
+
+	case sub.ProviderSubscriptionID == "":
+		customerID, err := s.paymentService.ensureCustomer(ctx, org, provider)
+		if err != nil {
+			return err
+		}
+		started, err := provider.StartSubscription(ctx, org.ID, customerID, planID)
+		if err != nil {
+			return err
+		}
+		sub.Provider = provider.Name()
+		sub.ProviderSubscriptionID = started.ID
+
+	default:
+		if err := provider.ChangeSubscriptionPlan(ctx, sub.ProviderSubscriptionID, planID, prorate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subscriptionProvider returns the provider running a subscription: the one
+// it was started with, else the organization's. It returns nil if that
+// provider has no subscriptions.
+func (s *SubscriptionService) subscriptionProvider(org *models.Organization, sub *models.Subscription) (SubscriptionProvider, error) {
+	var provider PaymentProvider
+	var err error
+	if sub.Provider != "" && sub.ProviderSubscriptionID != "" {
+		provider, err = s.paymentService.Provider(sub.Provider)
+	} else {
+		provider, err = s.paymentService.ProviderFor(org)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions, ok := provider.(SubscriptionProvider)
+	if !ok {
+		return nil, nil
+	}
+	return subscriptions, nil
+}
+
+// schedule sets a subscription's change for the end of the current cycle
+func (s *SubscriptionService) schedule(org *models.Organization, sub *models.Subscription, action string, plan *models.PricingPlan, changedBy string) {
+	now := time.Now()
+	_, periodEnd := BillingCycle(org.BillingDay, now.UTC())
+	sub.ScheduledChange = &models.ScheduledPlanChange{
+		Action:      action,
+		Plan:        *plan,
+		EffectiveAt: periodEnd,
+		RequestedBy: changedBy,
+		RequestedAt: now,
+	}
+}
+
+// load returns an organization's stored subscription, or a new active one
+func (s *SubscriptionService) load(ctx context.Context, org *models.Organization) (*models.Subscription, error) {
+	var sub models.Subscription
+	err := s.db.Collection(models.Subscription{}.TableName()).FindOne(ctx, bson.M{"org_id": org.ID}).Decode(&sub)
+	if err == mongo.ErrNoDocuments {
+		return &models.Subscription{
+			OrgID:     org.ID,
+			Status:    models.SubscriptionStatusActive,
+			CreatedAt: time.Now(),
+		}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find subscription: %w", err)
+	}
+	return &sub, nil
+}
+
+// save stores a subscription, creating it on first change
+func (s *SubscriptionService) save(ctx context.Context, sub *models.Subscription) error {
+	if sub.ID.IsZero() {
+		sub.ID = primitive.NewObjectID()
+	}
+	sub.UpdatedAt = time.Now()
+
+	_, err := s.db.Collection(models.Subscription{}.TableName()).ReplaceOne(ctx,
+		bson.M{"org_id": sub.OrgID}, sub, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save subscription: %w", err)
+	}
+	return nil
+}
+
+// details builds the subscription's response for its current cycle
+func (s *SubscriptionService) details(org *models.Organization, sub *models.Subscription, plan *models.PricingPlan) *SubscriptionDetails {
+	periodStart, periodEnd := BillingCycle(org.BillingDay, time.Now().UTC())
+	return &SubscriptionDetails{
+		Subscription: sub,
+		Plan:         plan,
+		PeriodStart:  periodStart,
+		PeriodEnd:    periodEnd,
+	}
+}
+
+// planTiers orders the built-in plans whose limits a pricing plan grants
+var planTiers = map[string]int{"Free": 0, "Pro": 1, "Enterprise": 2}
+
+// IsPlanUpgrade reports whether moving from one plan to another is an
+// upgrade: to higher limits, or to a higher base price on the same limits
+func IsPlanUpgrade(from, to *models.PricingPlan) bool {
+	if planTiers[from.LimitsPlan] != planTiers[to.LimitsPlan] {
+		return planTiers[to.LimitsPlan] > planTiers[from.LimitsPlan]
+	}
+	return to.BasePrice > from.BasePrice
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"pulse-control-plane/models"
+)
+
+// GSTRate is the Indian GST rate in percent on cloud services (SAC 9983)
+const GSTRate = 18.0
+
+// VATRates are the EU member states' standard VAT rates in percent
+var VATRates = map[string]float64{
+	"AT": 20, "BE": 21, "BG": 20, "CY": 19, "CZ": 21, "DE": 19, "DK": 25,
+	"EE": 22, "ES": 21, "FI": 25.5, "FR": 20, "GR": 24, "HR": 25, "HU": 27,
+	"IE": 23, "IT": 22, "LT": 21, "LU": 17, "LV": 21, "MT": 18, "NL": 21,
+	"PL": 23, "PT": 23, "RO": 19, "SE": 25, "SI": 22, "SK": 23,
+}
+
+// GSTStateCodes maps the two-digit state code that starts a GSTIN to the
+// state's ISO 3166-2 subdivision code
+var GSTStateCodes = map[string]string{
+	"01": "JK", "02": "HP", "03": "PB", "04": "CH", "05": "UT", "06": "HR",
+	"07": "DL", "08": "RJ", "09": "UP", "10": "BR", "11": "SK", "12": "AR",
+	"13": "NL", "14": "MN", "15": "MZ", "16": "TR", "17": "ML", "18": "AS",
+	"19": "WB", "20": "JH", "21": "OR", "22": "CT", "23": "MP", "24": "GJ",
+	"26": "DH", "27": "MH", "29": "KA", "30": "GA", "31": "LD", "32": "KL",
+	"33": "TN", "34": "PY", "35": "AN", "36": "TG", "37": "AP", "38": "LA",
+}
+
+// taxIDFormats are the accepted tax ID formats by country. EU VAT IDs carry
+// their country prefix; Greece uses "EL".
+var taxIDFormats = map[string]*regexp.Regexp{
+	"IN": regexp.MustCompile(`^\d{2}[A-Z]{5}\d{4}[A-Z][1-9A-Z]Z[0-9A-Z]$`),
+	"AT": regexp.MustCompile(`^ATU\d{8}$`),
+	"BE": regexp.MustCompile(`^BE[01]\d{9}$`),
+	"BG": regexp.MustCompile(`^BG\d{9,10}$`),
+	"CY": regexp.MustCompile(`^CY\d{8}[A-Z]$`),
+	"CZ": regexp.MustCompile(`^CZ\d{8,10}$`),
+	"DE": regexp.MustCompile(`^DE\d{9}$`),
+	"DK": regexp.MustCompile(`^DK\d{8}$`),
+	"EE": regexp.MustCompile(`^EE\d{9}$`),
+	"ES": regexp.MustCompile(`^ES[0-9A-Z]\d{7}[0-9A-Z]$`),
+	"FI": regexp.MustCompile(`^FI\d{8}$`),
+	"FR": regexp.MustCompile(`^FR[0-9A-Z]{2}\d{9}$`),
+	"GR": regexp.MustCompile(`^EL\d{9}$`),
+	"HR": regexp.MustCompile(`^HR\d{11}$`),
+	"HU": regexp.MustCompile(`^HU\d{8}$`),
+	"IE": regexp.MustCompile(`^IE\d[0-9A-Z+*]\d{5}[A-Z]{1,2}$`),
+	"IT": regexp.MustCompile(`^IT\d{11}$`),
+	"LT": regexp.MustCompile(`^LT(\d{9}|\d{12})$`),
+	"LU": regexp.MustCompile(`^LU\d{8}$`),
+	"LV": regexp.MustCompile(`^LV\d{11}$`),
+	"MT": regexp.MustCompile(`^MT\d{8}$`),
+	"NL": regexp.MustCompile(`^NL\d{9}B\d{2}$`),
+	"PL": regexp.MustCompile(`^PL\d{10}$`),
+	"PT": regexp.MustCompile(`^PT\d{9}$`),
+	"RO": regexp.MustCompile(`^RO\d{2,10}$`),
+	"SE": regexp.MustCompile(`^SE\d{12}$`),
+	"SI": regexp.MustCompile(`^SI\d{8}$`),
+	"SK": regexp.MustCompile(`^SK\d{10}$`),
+}
+
+// NormalizeTaxID uppercases a tax ID and strips spaces, dots and dashes
+func NormalizeTaxID(taxID string) string {
+	return strings.NewReplacer(" ", "", ".", "", "-", "").Replace(strings.ToUpper(strings.TrimSpace(taxID)))
+}
+
+// ValidateTaxID checks a normalized tax ID against the country's format and
+// returns its type. Only Indian GSTINs and EU VAT IDs are recognized.
+func ValidateTaxID(country, taxID string) (string, bool) {
+	country = strings.ToUpper(country)
+	format, ok := taxIDFormats[country]
+	if !ok || !format.MatchString(taxID) {
+		return "", false
+	}
+	if country == "IN" {
+		if _, ok := GSTStateCodes[taxID[:2]]; !ok {
+			return "", false
+		}
+		return models.TaxIDTypeGSTIN, true
+	}
+	return models.TaxIDTypeEUVAT, true
+}
+
+// TaxEngine calculates the tax on invoices from the seller's registration and
+// the customer's tax profile. Rates come from GSTRate and VATRates.
+type TaxEngine struct {
+	sellerCountry string
+	sellerState   string
+}
+
+// NewTaxEngine creates a tax engine for a seller registered in country
+// (ISO 3166-1 alpha-2) and, in India, state (ISO 3166-2 subdivision code)
+func NewTaxEngine(sellerCountry, sellerState string) *TaxEngine {
+	return &TaxEngine{
+		sellerCountry: strings.ToUpper(sellerCountry),
+		sellerState:   strings.ToUpper(sellerState),
+	}
+}
+
+// Calculate returns the tax due on taxable, in minor units, for a customer. Customers without
+// a tax profile are taxed as if they were in the seller's country.
+//
+// In India, supplies within the seller's state are charged CGST and SGST at
+// half the GST rate each, and supplies to other states IGST. In the EU,
+// customers with a valid VAT ID in another member state are reverse charged;
+// everyone else pays VAT at their country's rate. Exports elsewhere are not
+// taxed.
+func (e *TaxEngine) Calculate(profile *models.TaxProfile, taxable int64) models.TaxResult {
+	country := e.sellerCountry
+	state := e.sellerState
+	taxIDValid := false
+	if profile != nil {
+		country = strings.ToUpper(profile.BillingAddress.Country)
+		state = strings.ToUpper(profile.BillingAddress.State)
+		taxIDValid = profile.TaxIDValid
+		// A GSTIN's state code is the place of supply
+		if profile.TaxIDValid && profile.TaxIDType == models.TaxIDTypeGSTIN {
+			state = GSTStateCodes[profile.TaxID[:2]]
+		}
+	}
+
+	result := models.TaxResult{Lines: []models.TaxLine{}}
+	if taxable <= 0 {
+		return result
+	}
+
+	vatRate, inEU := VATRates[country]
+	switch {
+	case country == "IN" && e.sellerCountry == "IN":
+		if state == e.sellerState {
+			half := GSTRate / 2
+			result.Lines = append(result.Lines,
+				taxLine("CGST", "IN", half, taxable),
+				taxLine("SGST", "IN-"+state, half, taxable),
+			)
+		} else {
+			result.Lines = append(result.Lines, taxLine("IGST", "IN", GSTRate, taxable))
+		}
+	case inEU && taxIDValid && country != e.sellerCountry:
+		result.ReverseCharge = true
+		result.Lines = append(result.Lines, taxLine("VAT", country, 0, taxable))
+		result.Note = "Reverse charge: VAT to be accounted for by the recipient (Article 196, Council Directive 2006/112/EC)"
+	case inEU:
+		result.Lines = append(result.Lines, taxLine("VAT", country, vatRate, taxable))
+	default:
+		result.Note = fmt.Sprintf("Export of services to %s; no tax charged", country)
+	}
+
+	for _, line := range result.Lines {
+		result.Total += line.Amount
+	}
+	return result
+}
+
+// taxLine charges rate percent on taxable, rounded to the minor unit
+func taxLine(name, jurisdiction string, rate float64, taxable int64) models.TaxLine {
+	return models.TaxLine{
+		Name:          name,
+		Jurisdiction:  jurisdiction,
+		Rate:          rate,
+		TaxableAmount: taxable,
+		Amount:        int64(math.Round(float64(taxable) * rate / 100)),
+	}
+}
@@ -29,6 +29,7 @@ type VideoGrant struct {
 	RoomCreate   bool   `json:"roomCreate,omitempty"`
 	RoomList     bool   `json:"roomList,omitempty"`
 	RoomAdmin    bool   `json:"roomAdmin,omitempty"`
+	RoomRecord   bool   `json:"roomRecord,omitempty"`
 	RoomName     string `json:"roomName,omitempty"`
 	CanPublish   bool   `json:"canPublish,omitempty"`
 	CanSubscribe bool   `json:"canSubscribe,omitempty"`
@@ -61,13 +62,17 @@ type TokenService struct {
 	config          *config.Config
 	projectService  *ProjectService
 	regionService   *RegionService
+	quotaService    *QuotaService
+	concurrencyService *ConcurrencyService
 }
 
-func NewTokenService(cfg *config.Config) *TokenService {
+func NewTokenService(cfg *config.Config, quotaService *QuotaService, concurrencyService *ConcurrencyService) *TokenService {
 	return &TokenService{
 		config:         cfg,
-		projectService: NewProjectService(),
+		projectService: NewProjectService(nil),
 		regionService:  NewRegionService(),
+		quotaService:   quotaService,
+		concurrencyService: concurrencyService,
 	}
 }
 
@@ -84,6 +89,14 @@ func (s *TokenService) CreateToken(ctx context.Context, projectID primitive.Obje
 		return nil, errors.New("video/audio features are not enabled for this project")
 	}
 
+	// Refuse new participants once the plan's hard limits are reached
+	if err := s.quotaService.Enforce(ctx, project, QuotaActionToken); err != nil {
+		return nil, err
+	}
+	if err := s.concurrencyService.CheckRoomJoin(ctx, project, req.RoomName); err != nil {
+		return nil, err
+	}
+
 	// Determine best region for this connection
 	selectedRegion := project.Region // Default to project's region
 	var fallbackURLs []string
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"pulse-control-plane/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// tagKeyPattern restricts tag keys to names that are safe in a Mongo field path
+var tagKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// dimensionEventTypes are the usage events that can be attributed to a room,
+// participant or tag
+var dimensionEventTypes = []string{models.EventParticipantLeft, models.EventEgressEnded, models.EventBandwidthUsed}
+
+// ValidateBreakdownDimension checks a group_by value: room, participant or tag:<key>
+func ValidateBreakdownDimension(groupBy string) error {
+	switch {
+	case groupBy == models.DimensionRoom, groupBy == models.DimensionParticipant:
+		return nil
+	case strings.HasPrefix(groupBy, models.DimensionTagPrefix):
+		if !tagKeyPattern.MatchString(strings.TrimPrefix(groupBy, models.DimensionTagPrefix)) {
+			return errors.New("tag key must be 1-64 letters, digits, '_' or '-'")
+		}
+		return nil
+	default:
+		return errors.New("group_by must be room, participant or tag:<key>")
+	}
+}
+
+// GetUsageBreakdown returns usage in [startDate, endDate) grouped by a
+// dimension, sorted by participant minutes. Complete days that have been
+// aggregated are read from usage_dimension_aggregates; the rest is scanned
+// raw. A limit of 0 returns every row.
+func (s *UsageService) GetUsageBreakdown(ctx context.Context, projectID primitive.ObjectID, groupBy string, startDate, endDate time.Time, page, limit int) (*models.UsageBreakdown, error) {
+	if err := ValidateBreakdownDimension(groupBy); err != nil {
+		return nil, err
+	}
+
+	// Days fully inside the range and already aggregated come from rollups
+	aggStart, _ := PeriodBounds(models.PeriodDaily, startDate.Add(-time.Nanosecond))
+	aggStart = aggStart.AddDate(0, 0, 1)
+	aggEnd, _ := PeriodBounds(models.PeriodDaily, endDate)
+
+	watermark, err := s.dailyWatermark(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if watermark.Before(aggEnd) {
+		aggEnd = watermark
+	}
+
+	rows := make(map[string]*models.UsageBreakdownRow)
+	rawRanges := []timeRange{{Start: startDate, End: endDate}}
+
+	if aggStart.Before(aggEnd) {
+		if err := s.sumDimensionAggregates(ctx, projectID, groupBy, aggStart, aggEnd, rows); err != nil {
+			return nil, err
+		}
+		rawRanges = nil
+		if startDate.Before(aggStart) {
+			rawRanges = append(rawRanges, timeRange{Start: startDate, End: aggStart})
+		}
+		if aggEnd.Before(endDate) {
+			rawRanges = append(rawRanges, timeRange{Start: aggEnd, End: endDate})
+		}
+	}
+
+	if len(rawRanges) > 0 {
+		if err := s.sumRawDimension(ctx, projectID, groupBy, rawRanges, rows); err != nil {
+			return nil, err
+		}
+	}
+
+	sorted := make([]models.UsageBreakdownRow, 0, len(rows))
+	for _, row := range rows {
+		sorted = append(sorted, *row)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].ParticipantMinutes != sorted[j].ParticipantMinutes {
+			return sorted[i].ParticipantMinutes > sorted[j].ParticipantMinutes
+		}
+		return sorted[i].Key < sorted[j].Key
+	})
+
+	breakdown := &models.UsageBreakdown{
+		ProjectID: projectID.Hex(),
+		GroupBy:   groupBy,
+		StartDate: startDate,
+		EndDate:   endDate,
+		Rows:      sorted,
+		Total:     len(sorted),
+		Page:      page,
+		Limit:     limit,
+	}
+
+	if limit > 0 {
+		from := (page - 1) * limit
+		if from > len(sorted) {
+			from = len(sorted)
+		}
+		to := from + limit
+		if to > len(sorted) {
+			to = len(sorted)
+		}
+		breakdown.Rows = sorted[from:to]
+	}
+
+	return breakdown, nil
+}
+
+// UsageBreakdownCSV renders breakdown rows as CSV
+func UsageBreakdownCSV(breakdown *models.UsageBreakdown) (string, error) {
+	var builder strings.Builder
+	writer := csv.NewWriter(&builder)
+
+	header := []string{breakdown.GroupBy, "Participant Minutes", "Sessions", "Egress Minutes", "Bandwidth GB"}
+	if err := writer.Write(header); err != nil {
+		return "", fmt.Errorf("failed to write CSV header: %w", err)
+	}
+
+	for _, row := range breakdown.Rows {
+		record := []string{
+			row.Key,
+			strconv.FormatFloat(row.ParticipantMinutes, 'f', 2, 64),
+			strconv.FormatInt(row.Sessions, 10),
+			strconv.FormatFloat(row.EgressMinutes, 'f', 2, 64),
+			strconv.FormatFloat(row.BandwidthGB, 'f', 4, 64),
+		}
+		if err := writer.Write(record); err != nil {
+			return "", fmt.Errorf("failed to write CSV row: %w", err)
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return "", fmt.Errorf("CSV writer error: %w", err)
+	}
+
+	return builder.String(), nil
+}
+
+// sumDimensionAggregates adds daily dimension rollups in [start, end) to rows
+func (s *UsageService) sumDimensionAggregates(ctx context.Context, projectID primitive.ObjectID, dimension string, start, end time.Time, rows map[string]*models.UsageBreakdownRow) error {
+	collection := s.db.Collection(models.UsageDimensionAggregate{}.TableName())
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"project_id":   projectID,
+			"dimension":    dimension,
+			"period_start": bson.M{"$gte": start, "$lt": end},
+		}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$key"},
+			{Key: "participant_minutes", Value: bson.D{{Key: "$sum", Value: "$participant_minutes"}}},
+			{Key: "egress_minutes", Value: bson.D{{Key: "$sum", Value: "$egress_minutes"}}},
+			{Key: "bandwidth_gb", Value: bson.D{{Key: "$sum", Value: "$bandwidth_gb"}}},
+			{Key: "sessions", Value: bson.D{{Key: "$sum", Value: "$sessions"}}},
+		}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return fmt.Errorf("failed to aggregate dimension rollups: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Key                string  `bson:"_id"`
+		ParticipantMinutes float64 `bson:"participant_minutes"`
+		EgressMinutes      float64 `bson:"egress_minutes"`
+		BandwidthGB        float64 `bson:"bandwidth_gb"`
+		Sessions           int64   `bson:"sessions"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return fmt.Errorf("failed to decode dimension rollups: %w", err)
+	}
+
+	for _, r := range results {
+		addBreakdownRow(rows, r.Key, r.ParticipantMinutes, r.EgressMinutes, r.BandwidthGB, r.Sessions)
+	}
+	return nil
+}
+
+// sumRawDimension scans raw metrics in the given ranges and adds them to rows
+func (s *UsageService) sumRawDimension(ctx context.Context, projectID primitive.ObjectID, dimension string, ranges []timeRange, rows map[string]*models.UsageBreakdownRow) error {
+	rangeFilters := make(bson.A, 0, len(ranges))
+	for _, r := range ranges {
+		rangeFilters = append(rangeFilters, bson.M{"timestamp": bson.M{"$gte": r.Start, "$lt": r.End}})
+	}
+
+	match := bson.M{
+		"project_id": projectID,
+		"event_type": bson.M{"$in": dimensionEventTypes},
+		"$or":        rangeFilters,
+	}
+
+	collection := s.db.Collection(models.UsageMetric{}.TableName())
+	cursor, err := collection.Aggregate(ctx, dimensionUsagePipeline(match, dimension))
+	if err != nil {
+		return fmt.Errorf("failed to aggregate usage breakdown: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var results []dimensionUsageRow
+	if err := cursor.All(ctx, &results); err != nil {
+		return fmt.Errorf("failed to decode usage breakdown: %w", err)
+	}
+
+	for _, r := range results {
+		addBreakdownRow(rows, r.ID.Key, r.ParticipantMinutes, r.EgressMinutes, r.BandwidthGB, r.Sessions)
+	}
+	return nil
+}
+
+func (s *UsageService) dailyWatermark(ctx context.Context) (time.Time, error) {
+	var watermark models.AggregationWatermark
+	err := s.db.Collection(models.AggregationWatermark{}.TableName()).FindOne(ctx, bson.M{"_id": models.PeriodDaily}).Decode(&watermark)
+	if err == mongo.ErrNoDocuments {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get aggregation watermark: %w", err)
+	}
+	return watermark.AggregatedUntil.UTC(), nil
+}
+
+func addBreakdownRow(rows map[string]*models.UsageBreakdownRow, key string, participantMinutes, egressMinutes, bandwidthGB float64, sessions int64) {
+	row, ok := rows[key]
+	if !ok {
+		row = &models.UsageBreakdownRow{Key: key}
+		rows[key] = row
+	}
+	row.ParticipantMinutes += participantMinutes
+	row.EgressMinutes += egressMinutes
+	row.BandwidthGB += bandwidthGB
+	row.Sessions += sessions
+}
+
+// dimensionUsageRow is one group produced by dimensionUsagePipeline
+type dimensionUsageRow struct {
+	ID struct {
+		ProjectID primitive.ObjectID `bson:"project_id"`
+		Dimension string             `bson:"dimension"`
+		Key       string             `bson:"key"`
+	} `bson:"_id"`
+	ParticipantMinutes float64 `bson:"participant_minutes"`
+	EgressMinutes      float64 `bson:"egress_minutes"`
+	BandwidthGB        float64 `bson:"bandwidth_gb"`
+	Sessions           int64   `bson:"sessions"`
+}
+
+// dimensionUsagePipeline groups raw metrics matching match by project and
+// dimension value. A bare DimensionTagPrefix expands every tag key, which is
+// what the aggregator uses to roll up all tags in one pass.
+func dimensionUsagePipeline(match bson.M, dimension string) mongo.Pipeline {
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: match}}}
+
+	var dimensionExpr, keyExpr interface{}
+	switch {
+	case dimension == models.DimensionRoom:
+		dimensionExpr, keyExpr = dimension, "$metadata.room_name"
+	case dimension == models.DimensionParticipant:
+		dimensionExpr, keyExpr = dimension, bson.M{"$ifNull": bson.A{"$metadata.participant_identity", "$metadata.participant_id"}}
+	case dimension == models.DimensionTagPrefix:
+		pipeline = append(pipeline,
+			bson.D{{Key: "$addFields", Value: bson.M{
+				"tag": bson.M{"$objectToArray": bson.M{"$ifNull": bson.A{"$metadata.tags", bson.M{}}}},
+			}}},
+			bson.D{{Key: "$unwind", Value: "$tag"}},
+		)
+		dimensionExpr = bson.M{"$concat": bson.A{models.DimensionTagPrefix, "$tag.k"}}
+		keyExpr = bson.M{"$toString": "$tag.v"}
+	default:
+		// tag:<key>, validated by ValidateBreakdownDimension
+		dimensionExpr = dimension
+		keyExpr = bson.M{"$toString": "$metadata.tags." + strings.TrimPrefix(dimension, models.DimensionTagPrefix)}
+	}
+
+	sumIf := func(eventType string, value interface{}) bson.M {
+		return bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$event_type", eventType}}, value, 0}}}
+	}
+
+	return append(pipeline,
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{
+				{Key: "project_id", Value: "$project_id"},
+				{Key: "dimension", Value: dimensionExpr},
+				{Key: "key", Value: keyExpr},
+			}},
+			{Key: "participant_minutes", Value: sumIf(models.EventParticipantLeft, "$value")},
+			{Key: "egress_minutes", Value: sumIf(models.EventEgressEnded, "$value")},
+			{Key: "bandwidth_gb", Value: sumIf(models.EventBandwidthUsed, "$value")},
+			{Key: "sessions", Value: sumIf(models.EventParticipantLeft, 1)},
+		}}},
+		// Usage without a value for the dimension cannot be attributed
+		bson.D{{Key: "$match", Value: bson.M{"_id.key": bson.M{"$nin": bson.A{nil, ""}}}}},
+	)
+}
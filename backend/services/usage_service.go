@@ -7,6 +7,7 @@ import (
 
 	"pulse-control-plane/models"
 
+	"github.com/rs/zerolog/log"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -15,49 +16,90 @@ import (
 
 // UsageService handles usage metrics operations
 type UsageService struct {
-	db *mongo.Database
+	db       *mongo.Database
+	eventBus *EventBus
+	pipeline *MeteringPipeline
 }
 
-// NewUsageService creates a new usage service
-func NewUsageService(db *mongo.Database) *UsageService {
-	return &UsageService{db: db}
+// NewUsageService creates a new usage service. When pipeline is nil usage
+// events are written synchronously.
+func NewUsageService(db *mongo.Database, eventBus *EventBus, pipeline *MeteringPipeline) *UsageService {
+	return &UsageService{db: db, eventBus: eventBus, pipeline: pipeline}
 }
 
-// TrackUsage records a usage event
+// TrackUsage records a usage event with a generated idempotency key
 func (s *UsageService) TrackUsage(ctx context.Context, projectID primitive.ObjectID, eventType string, value float64, metadata map[string]interface{}) error {
-	collection := s.db.Collection(models.UsageMetric{}.TableName())
+	return s.TrackUsageIdempotent(ctx, projectID, eventType, value, metadata, "")
+}
+
+// TrackUsageIdempotent records a usage event. Events sharing an idempotency
+// key are only counted once, so callers that may replay an event (webhook
+// retries, worker restarts) should derive the key from the source event.
+func (s *UsageService) TrackUsageIdempotent(ctx context.Context, projectID primitive.ObjectID, eventType string, value float64, metadata map[string]interface{}, idempotencyKey string) error {
+	if idempotencyKey == "" {
+		idempotencyKey = primitive.NewObjectID().Hex()
+	}
 
 	usageMetric := models.UsageMetric{
-		ProjectID: projectID,
-		EventType: eventType,
-		Value:     value,
-		Timestamp: time.Now(),
-		Metadata:  metadata,
+		ProjectID:      projectID,
+		EventType:      eventType,
+		Value:          value,
+		Timestamp:      time.Now(),
+		Metadata:       metadata,
+		IdempotencyKey: fmt.Sprintf("%s:%s:%s", projectID.Hex(), eventType, idempotencyKey),
 	}
 
+	if s.pipeline != nil {
+		if !s.pipeline.Enqueue(usageMetric) {
+			return fmt.Errorf("failed to track usage: metering buffer full")
+		}
+		return nil
+	}
+
+	usageMetric.RecordedAt = time.Now()
+	collection := s.db.Collection(models.UsageMetric{}.TableName())
 	_, err := collection.InsertOne(ctx, usageMetric)
-	if err != nil {
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
 		return fmt.Errorf("failed to track usage: %w", err)
 	}
 
 	return nil
 }
 
-// TrackParticipantMinutes tracks participant minutes from webhook
-func (s *UsageService) TrackParticipantMinutes(ctx context.Context, projectID primitive.ObjectID, roomName string, participantID string, durationMinutes float64) error {
+// MeteringStats returns metering pipeline counters, or nil when usage is written synchronously
+func (s *UsageService) MeteringStats() *MeteringStats {
+	if s.pipeline == nil {
+		return nil
+	}
+	stats := s.pipeline.Stats()
+	return &stats
+}
+
+// TrackParticipantMinutes tracks participant minutes from webhook. The
+// identity and tags (from token metadata) make the usage attributable in
+// usage breakdowns.
+func (s *UsageService) TrackParticipantMinutes(ctx context.Context, projectID primitive.ObjectID, roomName string, participantID string, identity string, tags map[string]string, durationMinutes float64) error {
 	metadata := map[string]interface{}{
 		"room_name":      roomName,
 		"participant_id": participantID,
 	}
-	return s.TrackUsage(ctx, projectID, models.EventParticipantLeft, durationMinutes, metadata)
+	if identity != "" {
+		metadata["participant_identity"] = identity
+	}
+	if len(tags) > 0 {
+		metadata["tags"] = tags
+	}
+	// Participant IDs are unique per session, so a replayed leave event is a duplicate
+	return s.TrackUsageIdempotent(ctx, projectID, models.EventParticipantLeft, durationMinutes, metadata, roomName+":"+participantID)
 }
 
 // TrackEgressMinutes tracks egress minutes
-func (s *UsageService) TrackEgressMinutes(ctx context.Context, projectID primitive.ObjectID, egressID string, durationMinutes float64) error {
+func (s *UsageService) TrackEgressMinutes(ctx context.Context, projectID primitive.ObjectID, egressID string, roomName string, durationMinutes float64) error {
 	metadata := map[string]interface{}{
 		"egress_id": egressID,
+		"room_name": roomName,
 	}
-	return s.TrackUsage(ctx, projectID, models.EventEgressEnded, durationMinutes, metadata)
+	return s.TrackUsageIdempotent(ctx, projectID, models.EventEgressEnded, durationMinutes, metadata, egressID)
 }
 
 // TrackStorageUsage tracks storage usage in GB
@@ -122,136 +164,6 @@ func (s *UsageService) GetUsageMetrics(ctx context.Context, projectID primitive.
 	return metrics, total, nil
 }
 
-// GetUsageSummary calculates aggregated usage for a project
-func (s *UsageService) GetUsageSummary(ctx context.Context, projectID primitive.ObjectID, startDate, endDate time.Time) (*models.UsageSummary, error) {
-	collection := s.db.Collection(models.UsageMetric{}.TableName())
-
-	summary := &models.UsageSummary{
-		ProjectID: projectID.Hex(),
-		StartDate: startDate,
-		EndDate:   endDate,
-	}
-
-	// Aggregate participant minutes
-	participantFilter := bson.M{
-		"project_id": projectID,
-		"event_type": models.EventParticipantLeft,
-		"timestamp": bson.M{
-			"$gte": startDate,
-			"$lte": endDate,
-		},
-	}
-	participantPipeline := mongo.Pipeline{
-		{{Key: "$match", Value: participantFilter}},
-		{{Key: "$group", Value: bson.D{
-			{Key: "_id", Value: nil},
-			{Key: "total", Value: bson.D{{Key: "$sum", Value: "$value"}}},
-		}}},
-	}
-	participantCursor, err := collection.Aggregate(ctx, participantPipeline)
-	if err == nil {
-		defer participantCursor.Close(ctx)
-		var results []bson.M
-		if err := participantCursor.All(ctx, &results); err == nil && len(results) > 0 {
-			if total, ok := results[0]["total"].(float64); ok {
-				summary.ParticipantMinutes = total
-			}
-		}
-	}
-
-	// Aggregate egress minutes
-	egressFilter := bson.M{
-		"project_id": projectID,
-		"event_type": models.EventEgressEnded,
-		"timestamp": bson.M{
-			"$gte": startDate,
-			"$lte": endDate,
-		},
-	}
-	egressPipeline := mongo.Pipeline{
-		{{Key: "$match", Value: egressFilter}},
-		{{Key: "$group", Value: bson.D{
-			{Key: "_id", Value: nil},
-			{Key: "total", Value: bson.D{{Key: "$sum", Value: "$value"}}},
-		}}},
-	}
-	egressCursor, err := collection.Aggregate(ctx, egressPipeline)
-	if err == nil {
-		defer egressCursor.Close(ctx)
-		var results []bson.M
-		if err := egressCursor.All(ctx, &results); err == nil && len(results) > 0 {
-			if total, ok := results[0]["total"].(float64); ok {
-				summary.EgressMinutes = total
-			}
-		}
-	}
-
-	// Aggregate storage usage (get latest value)
-	storageFilter := bson.M{
-		"project_id": projectID,
-		"event_type": models.EventStorageUsed,
-	}
-	storagePipeline := mongo.Pipeline{
-		{{Key: "$match", Value: storageFilter}},
-		{{Key: "$sort", Value: bson.D{{Key: "timestamp", Value: -1}}}},
-		{{Key: "$limit", Value: 1}},
-	}
-	storageCursor, err := collection.Aggregate(ctx, storagePipeline)
-	if err == nil {
-		defer storageCursor.Close(ctx)
-		var results []models.UsageMetric
-		if err := storageCursor.All(ctx, &results); err == nil && len(results) > 0 {
-			summary.StorageGB = results[0].Value
-		}
-	}
-
-	// Aggregate bandwidth usage
-	bandwidthFilter := bson.M{
-		"project_id": projectID,
-		"event_type": models.EventBandwidthUsed,
-		"timestamp": bson.M{
-			"$gte": startDate,
-			"$lte": endDate,
-		},
-	}
-	bandwidthPipeline := mongo.Pipeline{
-		{{Key: "$match", Value: bandwidthFilter}},
-		{{Key: "$group", Value: bson.D{
-			{Key: "_id", Value: nil},
-			{Key: "total", Value: bson.D{{Key: "$sum", Value: "$value"}}},
-		}}},
-	}
-	bandwidthCursor, err := collection.Aggregate(ctx, bandwidthPipeline)
-	if err == nil {
-		defer bandwidthCursor.Close(ctx)
-		var results []bson.M
-		if err := bandwidthCursor.All(ctx, &results); err == nil && len(results) > 0 {
-			if total, ok := results[0]["total"].(float64); ok {
-				summary.BandwidthGB = total
-			}
-		}
-	}
-
-	// Count API requests
-	apiFilter := bson.M{
-		"project_id": projectID,
-		"event_type": models.EventAPIRequest,
-		"timestamp": bson.M{
-			"$gte": startDate,
-			"$lte": endDate,
-		},
-	}
-	apiCount, err := collection.CountDocuments(ctx, apiFilter)
-	if err == nil {
-		summary.APIRequests = apiCount
-	}
-
-	// Calculate total cost (will be done by billing service)
-	summary.TotalCost = 0
-
-	return summary, nil
-}
-
 // CheckLimits checks if usage is approaching or exceeding plan limits
 func (s *UsageService) CheckLimits(ctx context.Context, projectID primitive.ObjectID, plan string, startDate, endDate time.Time) ([]models.UsageAlert, error) {
 	// Get usage summary
@@ -261,17 +173,7 @@ func (s *UsageService) CheckLimits(ctx context.Context, projectID primitive.Obje
 	}
 
 	// Get plan limits
-	var limits models.PlanLimits
-	switch plan {
-	case "Free":
-		limits = models.FreePlanLimits
-	case "Pro":
-		limits = models.ProPlanLimits
-	case "Enterprise":
-		limits = models.EnterprisePlanLimits
-	default:
-		limits = models.FreePlanLimits
-	}
+	limits := models.GetPlanLimits(plan)
 
 	var alerts []models.UsageAlert
 
@@ -370,11 +272,30 @@ func (s *UsageService) CheckLimits(ctx context.Context, projectID primitive.Obje
 		}
 	}
 
-	// Store alerts in database
+	// Store alerts in database. Each metric fires once per severity and
+	// period, so repeated checks do not notify subscribers again.
 	if len(alerts) > 0 {
 		alertCollection := s.db.Collection(models.UsageAlert{}.TableName())
-		for _, alert := range alerts {
-			_, _ = alertCollection.InsertOne(ctx, alert)
+		for i := range alerts {
+			alert := &alerts[i]
+			alert.PeriodStart = startDate
+			if _, err := alertCollection.InsertOne(ctx, alert); err != nil {
+				if !mongo.IsDuplicateKeyError(err) {
+					log.Error().Err(err).Str("project_id", projectID.Hex()).Str("metric", alert.MetricType).Msg("Failed to store usage alert")
+				}
+				continue
+			}
+
+			s.eventBus.PublishAsync(projectID, &models.WebhookPayload{
+				Event: models.WebhookEventUsageThresholdReached,
+				Usage: &models.UsageInfo{
+					MetricType:   alert.MetricType,
+					CurrentUsage: alert.CurrentUsage,
+					Limit:        alert.Limit,
+					Percentage:   alert.Percentage,
+					Severity:     alert.Severity,
+				},
+			})
 		}
 	}
 
@@ -0,0 +1,303 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"pulse-control-plane/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// rollupThreshold is the shortest range for which pre-computed
+// usage_aggregates are consulted; shorter ranges only scan raw metrics
+const rollupThreshold = 24 * time.Hour
+
+// timeRange is a half-open [Start, End) interval
+type timeRange struct {
+	Start time.Time
+	End   time.Time
+}
+
+// usageTotals accumulates usage from raw metrics and rollups
+type usageTotals struct {
+	participantMinutes float64
+	egressMinutes      float64
+	bandwidthGB        float64
+	apiRequests        int64
+}
+
+func (t *usageTotals) addAggregate(agg *models.UsageAggregate) {
+	t.participantMinutes += agg.ParticipantMinutes
+	t.egressMinutes += agg.EgressMinutes
+	t.bandwidthGB += agg.BandwidthGB
+	t.apiRequests += agg.APIRequests
+}
+
+// GetUsageSummary calculates aggregated usage for a project. Complete
+// hours, days and months inside long ranges are read from usage_aggregates;
+// only the uncovered edges are scanned in usage_metrics, in a single pipeline.
+func (s *UsageService) GetUsageSummary(ctx context.Context, projectID primitive.ObjectID, startDate, endDate time.Time) (*models.UsageSummary, error) {
+	// The summary range is inclusive of endDate; Mongo dates have millisecond precision
+	end := endDate.Add(time.Millisecond)
+
+	totals := &usageTotals{}
+	rawRanges := []timeRange{{Start: startDate, End: end}}
+
+	if end.Sub(startDate) >= rollupThreshold {
+		aggregates, err := s.findRollups(ctx, projectID, startDate, end)
+		if err != nil {
+			return nil, err
+		}
+		rawRanges = planRollupCoverage(startDate, end, aggregates, totals)
+	}
+
+	storageGB, err := s.sumRawUsage(ctx, projectID, rawRanges, end, totals)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.UsageSummary{
+		ProjectID:          projectID.Hex(),
+		ParticipantMinutes: totals.participantMinutes,
+		EgressMinutes:      totals.egressMinutes,
+		StorageGB:          storageGB,
+		BandwidthGB:        totals.bandwidthGB,
+		APIRequests:        totals.apiRequests,
+		StartDate:          startDate,
+		EndDate:            endDate,
+		// Cost is calculated by the billing service
+		TotalCost: 0,
+	}, nil
+}
+
+// GetOrgUsageSummary sums usage across every active project of an
+// organization, keeping the per-project figures
+func (s *UsageService) GetOrgUsageSummary(ctx context.Context, orgID primitive.ObjectID, startDate, endDate time.Time) (*models.OrgUsageSummary, error) {
+	var org models.Organization
+	err := s.db.Collection(models.Organization{}.TableName()).FindOne(ctx, bson.M{"_id": orgID, "is_deleted": false}).Decode(&org)
+	if err == mongo.ErrNoDocuments {
+		return nil, errors.New("organization not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find organization: %w", err)
+	}
+
+	cursor, err := s.db.Collection(models.Project{}.TableName()).Find(ctx,
+		bson.M{"org_id": orgID, "is_deleted": false},
+		options.Find().SetProjection(bson.M{"_id": 1, "name": 1}).SetSort(bson.D{{Key: "created_at", Value: 1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find projects: %w", err)
+	}
+	var projects []models.Project
+	if err := cursor.All(ctx, &projects); err != nil {
+		return nil, fmt.Errorf("failed to decode projects: %w", err)
+	}
+
+	summary := &models.OrgUsageSummary{
+		OrgID:     orgID.Hex(),
+		Plan:      org.Plan,
+		StartDate: startDate,
+		EndDate:   endDate,
+		Totals:    models.UsageSummary{StartDate: startDate, EndDate: endDate},
+		Projects:  make([]models.ProjectUsage, 0, len(projects)),
+	}
+
+	for _, project := range projects {
+		usage, err := s.GetUsageSummary(ctx, project.ID, startDate, endDate)
+		if err != nil {
+			return nil, err
+		}
+
+		summary.Totals.ParticipantMinutes += usage.ParticipantMinutes
+		summary.Totals.EgressMinutes += usage.EgressMinutes
+		summary.Totals.StorageGB += usage.StorageGB
+		summary.Totals.BandwidthGB += usage.BandwidthGB
+		summary.Totals.APIRequests += usage.APIRequests
+		summary.Projects = append(summary.Projects, models.ProjectUsage{ProjectName: project.Name, UsageSummary: *usage})
+	}
+
+	return summary, nil
+}
+
+// findRollups loads every aggregate that lies entirely inside the range
+func (s *UsageService) findRollups(ctx context.Context, projectID primitive.ObjectID, start, end time.Time) (map[string]map[int64]*models.UsageAggregate, error) {
+	collection := s.db.Collection(models.UsageAggregate{}.TableName())
+
+	cursor, err := collection.Find(ctx, bson.M{
+		"project_id":   projectID,
+		"period_start": bson.M{"$gte": start},
+		"period_end":   bson.M{"$lte": end},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find usage aggregates: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var aggregates []models.UsageAggregate
+	if err := cursor.All(ctx, &aggregates); err != nil {
+		return nil, fmt.Errorf("failed to decode usage aggregates: %w", err)
+	}
+
+	byPeriod := map[string]map[int64]*models.UsageAggregate{
+		models.PeriodHourly:  {},
+		models.PeriodDaily:   {},
+		models.PeriodMonthly: {},
+	}
+	for i := range aggregates {
+		agg := &aggregates[i]
+		if periods, ok := byPeriod[agg.PeriodType]; ok {
+			periods[agg.PeriodStart.UTC().Unix()] = agg
+		}
+	}
+	return byPeriod, nil
+}
+
+// planRollupCoverage walks the range from start to end, consuming the
+// largest available rollup at each step and adding it to totals. The
+// returned ranges are the gaps that still need a raw scan.
+func planRollupCoverage(start, end time.Time, rollups map[string]map[int64]*models.UsageAggregate, totals *usageTotals) []timeRange {
+	var raw []timeRange
+	addRaw := func(from, to time.Time) {
+		if n := len(raw); n > 0 && raw[n-1].End.Equal(from) {
+			raw[n-1].End = to
+			return
+		}
+		raw = append(raw, timeRange{Start: from, End: to})
+	}
+
+	cursor := start
+	for cursor.Before(end) {
+		if next, agg := rollupAt(cursor, end, rollups); agg != nil {
+			totals.addAggregate(agg)
+			cursor = next
+			continue
+		}
+
+		// No rollup starts here; scan raw up to the next hour boundary
+		next := cursor.UTC().Truncate(time.Hour).Add(time.Hour)
+		if next.After(end) {
+			next = end
+		}
+		addRaw(cursor, next)
+		cursor = next
+	}
+	return raw
+}
+
+// rollupAt returns the largest rollup that starts at t and ends by end
+func rollupAt(t, end time.Time, rollups map[string]map[int64]*models.UsageAggregate) (time.Time, *models.UsageAggregate) {
+	u := t.UTC()
+	key := u.Unix()
+
+	if u.Day() == 1 && u.Hour() == 0 && u.Minute() == 0 && u.Second() == 0 && u.Nanosecond() == 0 {
+		next := u.AddDate(0, 1, 0)
+		if !next.After(end) {
+			if agg, ok := rollups[models.PeriodMonthly][key]; ok {
+				return next, agg
+			}
+		}
+	}
+	if u.Equal(u.Truncate(24 * time.Hour)) {
+		next := u.Add(24 * time.Hour)
+		if !next.After(end) {
+			if agg, ok := rollups[models.PeriodDaily][key]; ok {
+				return next, agg
+			}
+		}
+	}
+	if u.Equal(u.Truncate(time.Hour)) {
+		next := u.Add(time.Hour)
+		if !next.After(end) {
+			if agg, ok := rollups[models.PeriodHourly][key]; ok {
+				return next, agg
+			}
+		}
+	}
+	return time.Time{}, nil
+}
+
+// sumRawUsage totals raw metrics by event_type over the given ranges, which
+// bound the scan to the gaps between rollups, and returns the latest storage
+// reading as of end.
+func (s *UsageService) sumRawUsage(ctx context.Context, projectID primitive.ObjectID, ranges []timeRange, end time.Time, totals *usageTotals) (float64, error) {
+	collection := s.db.Collection(models.UsageMetric{}.TableName())
+
+	if len(ranges) > 0 {
+		if err := s.sumRawRanges(ctx, collection, projectID, ranges, totals); err != nil {
+			return 0, err
+		}
+	}
+
+	var storage models.UsageMetric
+	err := collection.FindOne(ctx,
+		bson.M{
+			"project_id": projectID,
+			"event_type": models.EventStorageUsed,
+			"timestamp":  bson.M{"$lt": end},
+		},
+		options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: -1}}),
+	).Decode(&storage)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to find storage usage: %w", err)
+	}
+	return storage.Value, nil
+}
+
+// sumRawRanges adds raw metric totals over ranges to totals
+func (s *UsageService) sumRawRanges(ctx context.Context, collection *mongo.Collection, projectID primitive.ObjectID, ranges []timeRange, totals *usageTotals) error {
+	rangeFilters := make(bson.A, 0, len(ranges))
+	for _, r := range ranges {
+		rangeFilters = append(rangeFilters, bson.M{"timestamp": bson.M{"$gte": r.Start, "$lt": r.End}})
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"project_id": projectID,
+			"$or":        rangeFilters,
+		}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$event_type"},
+			{Key: "total", Value: bson.D{{Key: "$sum", Value: "$value"}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return fmt.Errorf("failed to aggregate usage: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		EventType string  `bson:"_id"`
+		Total     float64 `bson:"total"`
+		Count     int64   `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return fmt.Errorf("failed to decode usage summary: %w", err)
+	}
+
+	for _, row := range rows {
+		switch row.EventType {
+		case models.EventParticipantLeft:
+			totals.participantMinutes += row.Total
+		case models.EventEgressEnded:
+			totals.egressMinutes += row.Total
+		case models.EventBandwidthUsed:
+			totals.bandwidthGB += row.Total
+		case models.EventAPIRequest:
+			totals.apiRequests += row.Count
+		}
+	}
+	return nil
+}
@@ -15,6 +15,7 @@ import (
 
 	"pulse-control-plane/database"
 	"pulse-control-plane/models"
+	"pulse-control-plane/utils"
 
 	"github.com/rs/zerolog/log"
 	"go.mongodb.org/mongo-driver/bson"
@@ -48,12 +49,18 @@ func (s *WebhookService) SendWebhook(ctx context.Context, project *models.Projec
 		return nil
 	}
 	
+	body, matched, err := ApplyWebhookRules(project.WebhookFilter, project.WebhookTemplate, payload)
+	if err == nil && !matched {
+		log.Debug().Str("project_id", project.ID.Hex()).Str("event", string(payload.Event)).Msg("Webhook filtered out, skipping")
+		return nil
+	}
+	
 	// Create webhook log
 	webhookLog := &models.WebhookLog{
 		ID: primitive.NewObjectID(),
 		ProjectID: project.ID,
 		EventType: payload.Event,
-		Payload: convertToMap(payload),
+		Payload: body,
 		WebhookURL: project.WebhookURL,
 		Status: models.WebhookStatusPending,
 		Attempts: 0,
@@ -62,11 +69,23 @@ func (s *WebhookService) SendWebhook(ctx context.Context, project *models.Projec
 		UpdatedAt: time.Now(),
 	}
 	
+	// A broken filter or template is recorded as a failed delivery so it
+	// shows up in the customer's webhook logs
+	if err != nil {
+		webhookLog.Payload = convertToMap(payload)
+		webhookLog.Status = models.WebhookStatusFailed
+		webhookLog.Error = err.Error()
+	}
+	
 	// Save webhook log
-	_, err := s.collection.InsertOne(ctx, webhookLog)
+	if _, insertErr := s.collection.InsertOne(ctx, webhookLog); insertErr != nil {
+		log.Error().Err(insertErr).Msg("Failed to create webhook log")
+		return insertErr
+	}
+	
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to create webhook log")
-		return err
+		log.Warn().Err(err).Str("project_id", project.ID.Hex()).Msg("Webhook filter or template failed")
+		return nil
 	}
 	
 	// Send webhook (async in background)
@@ -257,6 +276,95 @@ func (s *WebhookService) GetWebhookLogs(ctx context.Context, projectID primitive
 	return logs, total, nil
 }
 
+// PreviewWebhook runs a sample payload through a filter and template without delivering it
+func (s *WebhookService) PreviewWebhook(project *models.Project, req *models.WebhookPreviewRequest) *models.WebhookPreviewResponse {
+	filter := project.WebhookFilter
+	if req.Filter != nil {
+		filter = *req.Filter
+	}
+	template := project.WebhookTemplate
+	if req.Template != nil {
+		template = *req.Template
+	}
+	
+	if req.Payload.ProjectID == "" {
+		req.Payload.ProjectID = project.ID.Hex()
+	}
+	if req.Payload.Timestamp == 0 {
+		req.Payload.Timestamp = time.Now().Unix()
+	}
+	
+	body, matched, err := ApplyWebhookRules(filter, template, &req.Payload)
+	if err != nil {
+		return &models.WebhookPreviewResponse{Error: err.Error()}
+	}
+	if !matched {
+		return &models.WebhookPreviewResponse{Matched: false}
+	}
+	
+	return &models.WebhookPreviewResponse{Matched: true, Body: body}
+}
+
+// ValidateWebhookRules checks that a filter expression and body template compile
+func ValidateWebhookRules(filter, template string) error {
+	if filter != "" {
+		if _, err := utils.CompileExpression(filter); err != nil {
+			return fmt.Errorf("invalid webhook filter: %w", err)
+		}
+	}
+	if template != "" {
+		if err := utils.ValidateTemplate(template); err != nil {
+			return fmt.Errorf("invalid webhook template: %w", err)
+		}
+	}
+	return nil
+}
+
+// ApplyWebhookRules evaluates the filter and template for a payload. It returns
+// the body to deliver and whether the payload passed the filter. Payload fields
+// are available by name (room_name, participant.identity) and as `payload`.
+func ApplyWebhookRules(filter, template string, payload *models.WebhookPayload) (map[string]interface{}, bool, error) {
+	body := convertToMap(payload)
+	if filter == "" && template == "" {
+		return body, true, nil
+	}
+	
+	env := make(map[string]interface{}, len(body)+1)
+	for k, v := range body {
+		env[k] = v
+	}
+	env["payload"] = body
+	
+	if filter != "" {
+		expr, err := utils.CompileExpression(filter)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid webhook filter: %w", err)
+		}
+		matched, err := expr.EvaluateBool(env)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to evaluate webhook filter: %w", err)
+		}
+		if !matched {
+			return nil, false, nil
+		}
+	}
+	
+	if template == "" {
+		return body, true, nil
+	}
+	
+	rendered, err := utils.RenderTemplate(template, env)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to render webhook template: %w", err)
+	}
+	shaped, ok := rendered.(map[string]interface{})
+	if !ok {
+		return nil, false, fmt.Errorf("webhook template must produce a JSON object")
+	}
+	
+	return shaped, true, nil
+}
+
 // convertToMap converts a struct to map[string]interface{}
 func convertToMap(v interface{}) map[string]interface{} {
 	data, _ := json.Marshal(v)
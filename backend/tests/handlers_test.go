@@ -9,6 +9,7 @@ import (
 
 	"pulse-control-plane/handlers"
 	"pulse-control-plane/models"
+	"pulse-control-plane/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -106,7 +107,7 @@ func TestOrganizationHandler_CreateOrganization(t *testing.T) {
 func TestProjectHandler_CreateProject(t *testing.T) {
 	t.Run("Valid project creation", func(t *testing.T) {
 		router := gin.Default()
-		handler := handlers.NewProjectHandler()
+		handler := handlers.NewProjectHandler(services.NewProjectService(nil))
 		router.POST("/projects", handler.CreateProject)
 		
 		project := map[string]interface{}{
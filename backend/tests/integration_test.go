@@ -36,7 +36,11 @@ func TestMain(m *testing.M) {
 	
 	// Initialize router
 	testRouter = gin.Default()
-	routes.SetupRoutes(testRouter, cfg)
+	svc, err := routes.NewServices(cfg, nil)
+	if err != nil {
+		panic(err)
+	}
+	routes.SetupRoutes(testRouter, cfg, svc)
 	
 	// Run tests
 	code := m.Run()
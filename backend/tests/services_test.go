@@ -1,14 +1,36 @@
 package services_test
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"pulse-control-plane/database"
 	"pulse-control-plane/models"
+	"pulse-control-plane/services"
 	"pulse-control-plane/utils"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
 )
 
 // TestTokenGeneration tests token generation functionality
@@ -134,6 +156,977 @@ func TestUsageMetricsCalculation(t *testing.T) {
 	})
 }
 
+// TestPlanLimitOverrides tests per-organization limit overrides
+func TestPlanLimitOverrides(t *testing.T) {
+	t.Run("Nil overrides keep plan limits", func(t *testing.T) {
+		var overrides *models.PlanLimitOverrides
+		assert.Equal(t, models.ProPlanLimits, overrides.Apply(models.ProPlanLimits))
+	})
+
+	t.Run("Set fields replace plan limits", func(t *testing.T) {
+		minutes := float64(5000)
+		grace := 20
+		limits := (&models.PlanLimitOverrides{
+			MaxParticipantMinutes: &minutes,
+			GracePercentage:       &grace,
+		}).Apply(models.GetPlanLimits("Free"))
+
+		assert.Equal(t, 5000.0, limits.MaxParticipantMinutes)
+		assert.Equal(t, 20, limits.GracePercentage)
+		assert.Equal(t, models.FreePlanLimits.MaxEgressMinutes, limits.MaxEgressMinutes)
+	})
+
+	t.Run("Unknown plan falls back to Free", func(t *testing.T) {
+		assert.Equal(t, models.FreePlanLimits, models.GetPlanLimits("Starter"))
+	})
+
+	t.Run("Project concurrency overrides", func(t *testing.T) {
+		rooms := 50
+		limits := (&models.ConcurrencyLimitOverrides{MaxConcurrentRooms: &rooms}).Apply(models.ProPlanLimits.Concurrency)
+
+		assert.Equal(t, 50, limits.MaxConcurrentRooms)
+		assert.Equal(t, models.ProPlanLimits.Concurrency.MaxParticipantsPerRoom, limits.MaxParticipantsPerRoom)
+	})
+}
+
+// TestUsageBreakdown tests breakdown dimension validation and CSV output
+func TestUsageBreakdown(t *testing.T) {
+	t.Run("Dimensions", func(t *testing.T) {
+		assert.NoError(t, services.ValidateBreakdownDimension("room"))
+		assert.NoError(t, services.ValidateBreakdownDimension("participant"))
+		assert.NoError(t, services.ValidateBreakdownDimension("tag:customer_id"))
+		assert.Error(t, services.ValidateBreakdownDimension("tag:"))
+		assert.Error(t, services.ValidateBreakdownDimension("tag:a.b"))
+		assert.Error(t, services.ValidateBreakdownDimension("region"))
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		csvData, err := services.UsageBreakdownCSV(&models.UsageBreakdown{
+			GroupBy: "tag:customer",
+			Rows: []models.UsageBreakdownRow{
+				{Key: "acme, inc", ParticipantMinutes: 12.5, Sessions: 3},
+			},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "tag:customer,Participant Minutes,Sessions,Egress Minutes,Bandwidth GB\n\"acme, inc\",12.50,3,0.00,0.0000\n", csvData)
+	})
+}
+
+// TestPricingPlanTiers tests graduated tiers, allowances and minimum commit
+func TestPricingPlanTiers(t *testing.T) {
+	minutes := models.MetricPricing{
+		Metric:           models.QuotaMetricParticipantMinutes,
+		Unit:             "minutes",
+		IncludedQuantity: 1000,
+		Tiers: []models.PricingTier{
+			{UpTo: 10000, UnitPrice: 0.004},
+			{UpTo: 110000, UnitPrice: 0.003},
+			{UnitPrice: 0.002},
+		},
+	}
+
+	t.Run("Allowance then graduated tiers", func(t *testing.T) {
+		included, charges := minutes.Price(131000)
+		assert.Equal(t, 1000.0, included)
+		assert.Len(t, charges, 3)
+		assert.Equal(t, 10000.0, charges[0].Quantity)
+		assert.Equal(t, 100000.0, charges[1].Quantity)
+		assert.Equal(t, 20000.0, charges[2].Quantity)
+		assert.InDelta(t, 40+300+40, minutes.Amount(131000), 1e-9)
+	})
+
+	t.Run("Usage inside the allowance is free", func(t *testing.T) {
+		included, charges := minutes.Price(600)
+		assert.Equal(t, 600.0, included)
+		assert.Empty(t, charges)
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		plan := models.PricingPlan{Currency: "USD", LimitsPlan: "Pro", Metrics: []models.MetricPricing{minutes}}
+		assert.NoError(t, plan.Validate())
+
+		plan.Metrics = []models.MetricPricing{{Metric: models.QuotaMetricEgressMinutes, Tiers: []models.PricingTier{{UpTo: 100, UnitPrice: 0.01}}}}
+		assert.Error(t, plan.Validate(), "last tier must be open-ended")
+
+		plan.Metrics = []models.MetricPricing{{Metric: "seats", Tiers: []models.PricingTier{{UnitPrice: 1}}}}
+		assert.Error(t, plan.Validate(), "unknown metric")
+	})
+
+	t.Run("Default plans match flat pricing", func(t *testing.T) {
+		plan := models.DefaultPricingPlan("Pro")
+		assert.Equal(t, "pro", plan.Code)
+		assert.NoError(t, plan.Validate())
+
+		start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		summary := &models.UsageSummary{
+			StartDate:          start,
+			EndDate:            start.AddDate(0, 1, 0),
+			ParticipantMinutes: 1000,
+			APIRequests:        5000,
+		}
+		cost := services.NewBillingService(nil, nil, nil, nil, nil, nil, nil).CalculateCost(context.Background(), summary, &plan, 1)
+		assert.InDelta(t, 1000*0.004+0.01+49, cost, 1e-9, "each line is rounded to the cent")
+	})
+
+	t.Run("Minimum commit tops up the period", func(t *testing.T) {
+		plan := models.DefaultPricingPlan("Pro")
+		plan.MinimumCommit = 500
+
+		start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		summary := &models.UsageSummary{StartDate: start, EndDate: start.AddDate(0, 1, 0), ParticipantMinutes: 1000}
+		cost := services.NewBillingService(nil, nil, nil, nil, nil, nil, nil).CalculateCost(context.Background(), summary, &plan, 1)
+		assert.InDelta(t, 500, cost, 1e-9)
+	})
+}
+
+// TestBillingCycle tests billing day anchors and calendar proration
+func TestBillingCycle(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	t.Run("Cycles start on the billing day", func(t *testing.T) {
+		start, end := services.BillingCycle(15, day(2025, 3, 20))
+		assert.Equal(t, day(2025, 3, 15), start)
+		assert.Equal(t, day(2025, 4, 15), end)
+
+		start, end = services.BillingCycle(15, day(2025, 1, 3))
+		assert.Equal(t, day(2024, 12, 15), start)
+		assert.Equal(t, day(2025, 1, 15), end)
+	})
+
+	t.Run("Billing day is clamped in short months", func(t *testing.T) {
+		start, end := services.BillingCycle(31, day(2025, 2, 28))
+		assert.Equal(t, day(2025, 2, 28), start)
+		assert.Equal(t, day(2025, 3, 31), end)
+
+		start, end = services.BillingCycle(31, day(2024, 2, 10))
+		assert.Equal(t, day(2024, 1, 31), start)
+		assert.Equal(t, day(2024, 2, 29), end)
+	})
+
+	t.Run("Proration uses each cycle's real length", func(t *testing.T) {
+		assert.InDelta(t, 1.0, services.CycleProration(1, day(2025, 2, 1), day(2025, 3, 1)), 1e-9)
+		assert.InDelta(t, 1.0, services.CycleProration(1, day(2025, 3, 1), day(2025, 4, 1)), 1e-9)
+		assert.InDelta(t, 14.0/28, services.CycleProration(1, day(2025, 2, 15), day(2025, 3, 1)), 1e-9)
+		assert.InDelta(t, 17.0/31+14.0/28, services.CycleProration(1, day(2025, 1, 15), day(2025, 2, 15)), 1e-9)
+		assert.InDelta(t, 1.0, services.CycleProration(15, day(2025, 1, 15), day(2025, 2, 15)), 1e-9)
+	})
+}
+
+// TestCreditDrawdownOrder tests the order credit grants are applied in
+func TestCreditDrawdownOrder(t *testing.T) {
+	now := time.Now()
+	soon := now.Add(24 * time.Hour)
+	later := now.Add(72 * time.Hour)
+
+	grants := []models.CreditEntry{
+		{Description: "purchase old", Type: models.CreditTypePurchase, CreatedAt: now.Add(-time.Hour)},
+		{Description: "promo never", Type: models.CreditTypePromo, CreatedAt: now.Add(-2 * time.Hour)},
+		{Description: "sla", Type: models.CreditTypeSLA, CreatedAt: now},
+		{Description: "promo later", Type: models.CreditTypePromo, ExpiresAt: &later, CreatedAt: now},
+		{Description: "purchase oldest", Type: models.CreditTypePurchase, CreatedAt: now.Add(-48 * time.Hour)},
+		{Description: "promo soon", Type: models.CreditTypePromo, ExpiresAt: &soon, CreatedAt: now},
+	}
+	services.SortCreditGrants(grants)
+
+	order := make([]string, len(grants))
+	for i, g := range grants {
+		order[i] = g.Description
+	}
+	assert.Equal(t, []string{"promo soon", "promo later", "promo never", "sla", "purchase oldest", "purchase old"}, order)
+}
+
+// TestTaxEngine tests GST and VAT rules for a seller registered in Karnataka
+func TestTaxEngine(t *testing.T) {
+	engine := services.NewTaxEngine("IN", "KA")
+
+	_, ok := services.ValidateTaxID("IN", services.NormalizeTaxID("29abcde1234f1z5"))
+	assert.True(t, ok)
+	_, ok = services.ValidateTaxID("IN", "99ABCDE1234F1Z5")
+	assert.False(t, ok, "unknown GST state code")
+	idType, ok := services.ValidateTaxID("DE", "DE123456789")
+	assert.True(t, ok)
+	assert.Equal(t, models.TaxIDTypeEUVAT, idType)
+
+	tests := []struct {
+		name    string
+		profile *models.TaxProfile
+		lines   []string
+		tax     float64
+		reverse bool
+	}{
+		{"no profile taxed as domestic", nil, []string{"CGST", "SGST"}, 18, false},
+		{"same state", &models.TaxProfile{BillingAddress: models.BillingAddress{Country: "IN", State: "KA"}}, []string{"CGST", "SGST"}, 18, false},
+		{"other state", &models.TaxProfile{BillingAddress: models.BillingAddress{Country: "IN", State: "MH"}}, []string{"IGST"}, 18, false},
+		{"GSTIN state wins", &models.TaxProfile{BillingAddress: models.BillingAddress{Country: "IN", State: "MH"}, TaxID: "29ABCDE1234F1Z5", TaxIDType: models.TaxIDTypeGSTIN, TaxIDValid: true}, []string{"CGST", "SGST"}, 18, false},
+		{"EU consumer", &models.TaxProfile{BillingAddress: models.BillingAddress{Country: "DE"}}, []string{"VAT"}, 19, false},
+		{"EU business reverse charge", &models.TaxProfile{BillingAddress: models.BillingAddress{Country: "FR"}, TaxID: "FR12345678901", TaxIDType: models.TaxIDTypeEUVAT, TaxIDValid: true}, []string{"VAT"}, 0, true},
+		{"export", &models.TaxProfile{BillingAddress: models.BillingAddress{Country: "US"}}, []string{}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := engine.Calculate(tt.profile, 100)
+			names := make([]string, len(result.Lines))
+			for i, line := range result.Lines {
+				names[i] = line.Name
+			}
+			assert.Equal(t, tt.lines, names)
+			assert.InDelta(t, tt.tax, result.Total, 0.001)
+			assert.Equal(t, tt.reverse, result.ReverseCharge)
+		})
+	}
+}
+
+// TestInvoicePDF tests invoice rendering, including page breaks
+func TestInvoicePDF(t *testing.T) {
+	now := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	invoice := &models.Invoice{
+		InvoiceNumber: "INV-1A2B3C4D-000042",
+		Status:        models.InvoiceStatusPaid,
+		PeriodStart:   now.AddDate(0, -1, 0),
+		PeriodEnd:     now,
+		Subtotal:      100000,
+		Tax:           18000,
+		TaxLines: []models.TaxLine{
+			{Name: "CGST", Jurisdiction: "IN", Rate: 9, TaxableAmount: 100000, Amount: 9000},
+			{Name: "SGST", Jurisdiction: "IN-KA", Rate: 9, TaxableAmount: 100000, Amount: 9000},
+		},
+		CreditsApplied: 5000,
+		Total:          113000,
+		Currency:       "INR",
+		CreatedAt:      now,
+		DueDate:        now.AddDate(0, 0, 30),
+	}
+	for i := 0; i < 80; i++ {
+		invoice.LineItems = append(invoice.LineItems, models.InvoiceLineItem{Description: "Participant Minutes (project (north))", Quantity: 1000, Unit: "minutes", UnitPrice: 0.0125, Amount: 1250})
+	}
+	org := &models.Organization{Name: "Acme", AdminEmail: "billing@acme.test"}
+
+	pdf := string(services.RenderInvoicePDF(invoice, org, services.InvoiceBranding{CompanyName: "Pulse"}))
+	assert.True(t, strings.HasPrefix(pdf, "%PDF-1.4"))
+	assert.True(t, strings.HasSuffix(pdf, "%%EOF\n"))
+	assert.Contains(t, pdf, "/Count 2")
+	assert.Contains(t, pdf, "(INV-1A2B3C4D-000042)")
+	assert.Contains(t, pdf, "\\(project \\(north\\)\\)", "parentheses are escaped")
+	assert.Contains(t, pdf, "(INR 1,130.00)")
+
+	// startxref points at the cross-reference table
+	var offset int
+	_, err := fmt.Sscanf(pdf[strings.LastIndex(pdf, "startxref"):], "startxref\n%d", &offset)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(pdf[offset:], "xref"))
+}
+
+// TestBillingRunSchedule tests which cycle a billing run closes and when
+// dunning reminders and suspension fall due
+func TestBillingRunSchedule(t *testing.T) {
+	org := &models.Organization{BillingDay: 15, CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	start, end, ok := services.LastClosedCycle(org, time.Date(2025, 3, 20, 9, 0, 0, 0, time.UTC))
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2025, 2, 15, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC), end)
+
+	// A new organization's first cycle starts when it was created
+	org.CreatedAt = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	start, _, ok = services.LastClosedCycle(org, time.Date(2025, 3, 20, 9, 0, 0, 0, time.UTC))
+	assert.True(t, ok)
+	assert.Equal(t, org.CreatedAt, start)
+
+	_, _, ok = services.LastClosedCycle(org, time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC))
+	assert.False(t, ok, "no cycle has closed since the organization was created")
+
+	stages := map[int]int{0: 0, 2: 0, 3: 1, 6: 1, 7: 2, 13: 2, 14: 3, 40: 3}
+	for days, stage := range stages {
+		assert.Equal(t, stage, models.DunningStageDue(days), "day %d", days)
+	}
+}
+
+// TestStripeProvider tests the Stripe payment provider against a local fake
+// of the Stripe API
+func TestStripeProvider(t *testing.T) {
+	type request struct {
+		path           string
+		form           url.Values
+		idempotencyKey string
+	}
+	var mu sync.Mutex
+	var requests []request
+
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer sk_test_fake", r.Header.Get("Authorization"))
+		r.ParseForm()
+		mu.Lock()
+		requests = append(requests, request{r.URL.Path, r.PostForm, r.Header.Get("Idempotency-Key")})
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/v1/customers":
+			fmt.Fprint(w, `{"id":"cus_123"}`)
+		case r.URL.Path == "/v1/invoices":
+			fmt.Fprint(w, `{"id":"in_123","status":"draft"}`)
+		case r.URL.Path == "/v1/invoiceitems":
+			fmt.Fprint(w, `{"id":"ii_123"}`)
+		case r.URL.Path == "/v1/invoices/in_123/finalize":
+			fmt.Fprint(w, `{"id":"in_123","status":"open","hosted_invoice_url":"https://invoice.stripe.com/i/in_123"}`)
+		case r.URL.Path == "/v1/payment_intents":
+			fmt.Fprintf(w, `{"id":"pi_123","client_secret":"pi_123_secret","amount":%s,"currency":"inr","status":"requires_payment_method"}`, r.PostForm.Get("amount"))
+		case r.URL.Path == "/v1/payment_methods/pm_declined/attach":
+			w.WriteHeader(http.StatusPaymentRequired)
+			fmt.Fprint(w, `{"error":{"type":"card_error","code":"card_declined","message":"Your card was declined."}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"type":"invalid_request_error","message":"Unrecognized request URL"}}`)
+		}
+	}))
+	defer fake.Close()
+
+	stripe := services.NewStripeService("sk_test_fake", "whsec_test", fake.URL)
+	ctx := context.Background()
+
+	org := &models.Organization{
+		ID:         primitive.NewObjectID(),
+		Name:       "Acme",
+		AdminEmail: "billing@acme.test",
+		TaxProfile: &models.TaxProfile{
+			BillingAddress: models.BillingAddress{Line1: "1 MG Road", City: "Bengaluru", State: "KA", Country: "IN"},
+			TaxID:          "29ABCDE1234F1Z5",
+			TaxIDType:      models.TaxIDTypeGSTIN,
+			TaxIDValid:     true,
+		},
+	}
+	customerID, err := stripe.RegisterCustomer(ctx, org)
+	assert.NoError(t, err)
+	assert.Equal(t, "cus_123", customerID)
+	assert.Equal(t, "in_gst", requests[0].form.Get("tax_id_data[0][type]"))
+	assert.Equal(t, org.ID.Hex(), requests[0].form.Get("metadata[org_id]"))
+	assert.Equal(t, "customer-"+org.ID.Hex(), requests[0].idempotencyKey)
+
+	t.Run("Push invoice", func(t *testing.T) {
+		requests = nil
+		invoice := &models.Invoice{
+			ID:            primitive.NewObjectID(),
+			InvoiceNumber: "INV-0001",
+			Currency:      "INR",
+			LineItems: []models.InvoiceLineItem{
+				{Description: "Participant minutes", Amount: 1000},
+				{Description: "Egress minutes", Amount: 500},
+				{Description: "Promotional credit", Amount: -229},
+			},
+			TaxLines: []models.TaxLine{{Name: "IGST", Rate: 18, Amount: 270}},
+			Total:    1541,
+		}
+
+		pushed, err := stripe.PushInvoice(ctx, customerID, invoice)
+		assert.NoError(t, err)
+		assert.Equal(t, "in_123", pushed.ID)
+		assert.Equal(t, "https://invoice.stripe.com/i/in_123", pushed.URL)
+		assert.Equal(t, invoice.ID.Hex(), requests[0].form.Get("metadata[invoice_id]"))
+		assert.Equal(t, "inr", requests[0].form.Get("currency"))
+
+		// Items are pushed in minor units and add up to the total
+		var sum int64
+		var descriptions []string
+		for _, r := range requests {
+			if r.path == "/v1/invoiceitems" {
+				amount, _ := strconv.ParseInt(r.form.Get("amount"), 10, 64)
+				sum += amount
+				descriptions = append(descriptions, r.form.Get("description"))
+				assert.Equal(t, "in_123", r.form.Get("invoice"))
+			}
+		}
+		assert.Equal(t, int64(1541), sum)
+		assert.Equal(t, []string{"Participant minutes", "Egress minutes", "Promotional credit", "IGST (18.00%)"}, descriptions)
+		assert.Equal(t, "/v1/invoices/in_123/finalize", requests[len(requests)-1].path)
+
+		intent, err := stripe.CreatePaymentIntent(ctx, customerID, invoice)
+		assert.NoError(t, err)
+		assert.Equal(t, "pi_123_secret", intent.ClientSecret)
+		assert.Equal(t, int64(1541), intent.Amount)
+		assert.Equal(t, "INR", intent.Currency)
+	})
+
+	t.Run("API errors", func(t *testing.T) {
+		err := stripe.AttachPaymentMethod(ctx, customerID, "pm_declined")
+		var stripeErr *services.StripeError
+		assert.True(t, errors.As(err, &stripeErr))
+		assert.Equal(t, "card_error", stripeErr.Type)
+		assert.Equal(t, http.StatusPaymentRequired, stripeErr.StatusCode)
+	})
+
+	t.Run("Webhook signature", func(t *testing.T) {
+		invoiceID := primitive.NewObjectID()
+		payload := []byte(fmt.Sprintf(`{"id":"evt_1","type":"invoice.paid","data":{"object":{"id":"in_123","status":"paid","metadata":{"invoice_id":"%s"}}}}`, invoiceID.Hex()))
+		sign := func(at time.Time, secret string) http.Header {
+			timestamp := strconv.FormatInt(at.Unix(), 10)
+			mac := hmac.New(sha256.New, []byte(secret))
+			mac.Write([]byte(timestamp + "." + string(payload)))
+			header := http.Header{}
+			header.Set("Stripe-Signature", "t="+timestamp+",v1="+hex.EncodeToString(mac.Sum(nil)))
+			return header
+		}
+
+		event, err := stripe.VerifyWebhook(payload, sign(time.Now(), "whsec_test"))
+		assert.NoError(t, err)
+		assert.Equal(t, services.PaymentOutcomePaid, event.Outcome)
+		assert.Equal(t, invoiceID, event.InvoiceID)
+		assert.Equal(t, "in_123", event.ProviderInvoiceID)
+
+		_, err = stripe.VerifyWebhook(payload, sign(time.Now(), "whsec_other"))
+		assert.ErrorIs(t, err, services.ErrInvalidWebhookSignature)
+
+		_, err = stripe.VerifyWebhook(payload, sign(time.Now().Add(-time.Hour), "whsec_test"))
+		assert.ErrorIs(t, err, services.ErrInvalidWebhookSignature, "stale signatures are replays")
+
+		_, err = stripe.VerifyWebhook(payload, http.Header{})
+		assert.ErrorIs(t, err, services.ErrInvalidWebhookSignature)
+	})
+}
+
+// TestProviderEventRetry tests how stored provider events are identified and
+// when failed ones are retried
+func TestProviderEventRetry(t *testing.T) {
+	delays := map[int]time.Duration{1: time.Minute, 2: 2 * time.Minute, 5: 16 * time.Minute, 9: 256 * time.Minute, 10: 6 * time.Hour, 30: 6 * time.Hour}
+	for attempts, delay := range delays {
+		assert.Equal(t, delay, services.ProviderEventRetryDelay(attempts), "attempt %d", attempts)
+	}
+
+	payload := []byte(`{"event":"payment.captured","created_at":1700000000}`)
+	assert.Equal(t, "evt_Nx1", services.RazorpayEventID("evt_Nx1", payload))
+	assert.Equal(t, services.RazorpayEventID("", payload), services.RazorpayEventID("", payload), "redeliveries hash alike")
+	assert.True(t, strings.HasPrefix(services.RazorpayEventID("", payload), "sha256:"))
+	assert.NotEqual(t, services.RazorpayEventID("", payload), services.RazorpayEventID("", []byte(`{"event":"payment.failed"}`)))
+
+	// Stored events are reprocessed without their signature
+	stripe := services.NewStripeService("sk_test_fake", "whsec_test", "")
+	event, err := stripe.ParseWebhook([]byte(`{"id":"evt_2","type":"payment_intent.payment_failed","data":{"object":{"id":"pi_9","metadata":{},"last_payment_error":{"message":"Insufficient funds"}}}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, services.PaymentOutcomeFailed, event.Outcome)
+	assert.Equal(t, "Insufficient funds", event.Message)
+	assert.True(t, event.InvoiceID.IsZero())
+}
+
+// TestMultiCurrency tests minor units, exchange rate sources and per-currency
+// plan prices
+func TestMultiCurrency(t *testing.T) {
+	ctx := context.Background()
+
+	assert.Equal(t, int64(4900), models.ToMinorUnits(49, "USD"))
+	assert.Equal(t, int64(4900), models.ToMinorUnits(4900.4, "JPY"))
+	assert.Equal(t, int64(12346), models.ToMinorUnits(12.3456, "KWD"))
+	assert.Equal(t, "49.00", models.FormatMinorUnits(4900, "usd"))
+	assert.Equal(t, "12.346", models.FormatMinorUnits(12346, "KWD"))
+
+	t.Run("Static rate file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "rates.json")
+		assert.NoError(t, os.WriteFile(path, []byte(`{"base":"usd","as_of":"2025-01-31T00:00:00Z","rates":{"INR":84,"EUR":0.8}}`), 0o600))
+
+		source, err := services.NewStaticRateSource(path)
+		assert.NoError(t, err)
+
+		rate, err := source.Rate(ctx, "USD", "INR")
+		assert.NoError(t, err)
+		assert.Equal(t, 84.0, rate.Rate)
+		assert.Equal(t, time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC), rate.AsOf)
+
+		rate, err = source.Rate(ctx, "eur", "inr")
+		assert.NoError(t, err)
+		assert.InDelta(t, 105, rate.Rate, 1e-9, "cross rates go through the base")
+		assert.Equal(t, "EUR", rate.From)
+
+		_, err = source.Rate(ctx, "USD", "JPY")
+		assert.ErrorIs(t, err, services.ErrExchangeRateUnavailable)
+	})
+
+	t.Run("HTTP rates are cached", func(t *testing.T) {
+		fetches := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fetches++
+			fmt.Fprint(w, `{"base":"USD","timestamp":1738281600,"rates":{"INR":84}}`)
+		}))
+		defer server.Close()
+
+		source := services.NewHTTPRateSource(server.URL, time.Hour)
+		for i := 0; i < 3; i++ {
+			rate, err := source.Rate(ctx, "USD", "INR")
+			assert.NoError(t, err)
+			assert.Equal(t, 84.0, rate.Rate)
+			assert.Equal(t, time.Unix(1738281600, 0).UTC(), rate.AsOf)
+		}
+		assert.Equal(t, 1, fetches)
+	})
+
+	t.Run("Plans carry prices per currency", func(t *testing.T) {
+		plan := models.DefaultPricingPlan("Pro")
+		inrMetrics := make([]models.MetricPricing, len(plan.Metrics))
+		for i, m := range plan.Metrics {
+			m.Tiers = []models.PricingTier{{UnitPrice: m.Tiers[0].UnitPrice * 80}}
+			inrMetrics[i] = m
+		}
+		plan.Prices = []models.CurrencyPrices{{Currency: "INR", BasePrice: 3999, Metrics: inrMetrics}}
+		assert.NoError(t, plan.Validate())
+
+		inr, ok := plan.InCurrency("inr")
+		assert.True(t, ok)
+		assert.Equal(t, "INR", inr.Currency)
+		assert.Equal(t, 3999.0, inr.BasePrice)
+		assert.Equal(t, "USD", plan.Currency, "the plan itself is unchanged")
+
+		_, ok = plan.InCurrency("EUR")
+		assert.False(t, ok)
+
+		plan.Prices[0].Metrics = inrMetrics[:1]
+		assert.Error(t, plan.Validate(), "every metric must be priced")
+
+		plan.Prices[0].Metrics = inrMetrics
+		plan.Prices = append(plan.Prices, plan.Prices[0])
+		assert.Error(t, plan.Validate(), "currency priced twice")
+	})
+}
+
+// TestSubscriptionLifecycle tests plan change direction and the Stripe
+// subscription calls behind upgrades, downgrades, pauses and cancellations
+func TestSubscriptionLifecycle(t *testing.T) {
+	free := &models.PricingPlan{Name: "Free", LimitsPlan: "Free"}
+	pro := &models.PricingPlan{Name: "Pro", LimitsPlan: "Pro", BasePrice: 49}
+	proPlus := &models.PricingPlan{Name: "Pro Plus", LimitsPlan: "Pro", BasePrice: 99}
+	enterprise := &models.PricingPlan{Name: "Enterprise", LimitsPlan: "Enterprise", BasePrice: 10}
+
+	assert.True(t, services.IsPlanUpgrade(free, pro))
+	assert.True(t, services.IsPlanUpgrade(pro, proPlus), "same limits, higher price")
+	assert.True(t, services.IsPlanUpgrade(proPlus, enterprise), "higher limits outrank price")
+	assert.False(t, services.IsPlanUpgrade(enterprise, pro))
+	assert.False(t, services.IsPlanUpgrade(pro, pro))
+
+	type request struct {
+		method string
+		path   string
+		form   url.Values
+	}
+	var requests []request
+
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		requests = append(requests, request{r.Method, r.URL.Path, r.PostForm})
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/subscriptions":
+			fmt.Fprint(w, `{"id":"sub_123","status":"active"}`)
+		case "/v1/subscriptions/sub_123":
+			fmt.Fprint(w, `{"id":"sub_123","status":"active","items":{"data":[{"id":"si_1"}]}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"type":"invalid_request_error","message":"No such subscription"}}`)
+		}
+	}))
+	defer fake.Close()
+
+	stripe := services.NewStripeService("sk_test_fake", "whsec_test", fake.URL)
+	ctx := context.Background()
+	orgID := primitive.NewObjectID()
+
+	started, err := stripe.StartSubscription(ctx, orgID, "cus_123", "price_pro")
+	assert.NoError(t, err)
+	assert.Equal(t, "sub_123", started.ID)
+	assert.Equal(t, "price_pro", requests[0].form.Get("items[0][price]"))
+	assert.Equal(t, orgID.Hex(), requests[0].form.Get("metadata[org_id]"))
+
+	t.Run("Plan changes", func(t *testing.T) {
+		requests = nil
+		assert.NoError(t, stripe.ChangeSubscriptionPlan(ctx, "sub_123", "price_enterprise", true))
+		assert.Len(t, requests, 2)
+		assert.Equal(t, http.MethodGet, requests[0].method)
+		assert.Equal(t, "si_1", requests[1].form.Get("items[0][id]"), "the existing item is swapped, not added to")
+		assert.Equal(t, "price_enterprise", requests[1].form.Get("items[0][price]"))
+		assert.Equal(t, "create_prorations", requests[1].form.Get("proration_behavior"))
+
+		requests = nil
+		assert.NoError(t, stripe.ChangeSubscriptionPlan(ctx, "sub_123", "price_pro", false))
+		assert.Equal(t, "none", requests[1].form.Get("proration_behavior"), "downgrades apply at renewal")
+
+		err := stripe.ChangeSubscriptionPlan(ctx, "sub_missing", "price_pro", true)
+		var stripeErr *services.StripeError
+		assert.True(t, errors.As(err, &stripeErr))
+	})
+
+	t.Run("Pause, resume and cancel", func(t *testing.T) {
+		requests = nil
+		assert.NoError(t, stripe.PauseSubscription(ctx, "sub_123"))
+		assert.NoError(t, stripe.ResumeSubscription(ctx, "sub_123"))
+		assert.NoError(t, stripe.CancelSubscription(ctx, "sub_123"))
+		assert.Equal(t, "void", requests[0].form.Get("pause_collection[behavior]"))
+		assert.Contains(t, requests[1].form, "pause_collection")
+		assert.Equal(t, http.MethodDelete, requests[2].method)
+	})
+
+	t.Run("Provider webhooks", func(t *testing.T) {
+		events := map[string]string{
+			`{"id":"evt_1","type":"customer.subscription.deleted","data":{"object":{"id":"sub_123","status":"canceled"}}}`:                                        models.SubscriptionStatusCancelled,
+			`{"id":"evt_2","type":"customer.subscription.updated","data":{"object":{"id":"sub_123","status":"active","pause_collection":{"behavior":"void"}}}}`: models.SubscriptionStatusPaused,
+			`{"id":"evt_3","type":"customer.subscription.updated","data":{"object":{"id":"sub_123","status":"active","pause_collection":null}}}`:                models.SubscriptionStatusActive,
+		}
+		for payload, status := range events {
+			event, err := stripe.ParseWebhook([]byte(payload))
+			assert.NoError(t, err)
+			assert.Equal(t, "sub_123", event.SubscriptionID)
+			assert.Equal(t, status, event.SubscriptionStatus, payload)
+		}
+	})
+}
+
+// TestBudgetThresholds tests which budget alerts are due and when a hard cap
+// blocks a project
+func TestBudgetThresholds(t *testing.T) {
+	budget := &models.Budget{Amount: 200, Thresholds: models.DefaultBudgetThresholds}
+	assert.Empty(t, budget.DueThresholds(99))
+	assert.Equal(t, []int{50}, budget.DueThresholds(100))
+	assert.Equal(t, []int{50, 80}, budget.DueThresholds(170), "a jump crosses several thresholds")
+
+	budget.AlertedThresholds = []int{50, 80}
+	assert.Empty(t, budget.DueThresholds(170), "each threshold is alerted once per cycle")
+	assert.Equal(t, []int{100}, budget.DueThresholds(200))
+
+	now := time.Now()
+	until := now.Add(24 * time.Hour)
+	budget.CappedUntil = &until
+	assert.False(t, budget.Capped(now), "caps only block with a hard cap")
+	budget.HardCap = true
+	assert.True(t, budget.Capped(now))
+	assert.False(t, budget.Capped(until), "caps lift when the cycle ends")
+
+	projectID := primitive.NewObjectID()
+	assert.True(t, models.SpendCap{}.Applies(projectID), "organization caps block every project")
+	assert.True(t, models.SpendCap{ProjectID: projectID.Hex()}.Applies(projectID))
+	assert.False(t, models.SpendCap{ProjectID: primitive.NewObjectID().Hex()}.Applies(projectID))
+
+	assert.NoError(t, (&models.BudgetInput{Amount: 100, Thresholds: []int{25, 90, 150}, NotifyEmails: []string{"ops@acme.test"}}).Validate())
+	assert.Error(t, (&models.BudgetInput{Amount: 100, Thresholds: []int{0}}).Validate())
+	assert.Error(t, (&models.BudgetInput{Amount: 100, Thresholds: []int{50, 50}}).Validate())
+	assert.Error(t, (&models.BudgetInput{Amount: 100, NotifyEmails: []string{"not an email"}}).Validate())
+}
+
+// TestLiveKitEgressClient tests Twirp calls to the LiveKit Egress API
+// against a fake LiveKit server
+func TestLiveKitEgressClient(t *testing.T) {
+	var body map[string]interface{}
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := &services.TokenClaims{}
+		_, err := jwt.ParseWithClaims(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), claims, func(*jwt.Token) (interface{}, error) {
+			return []byte("lk_secret"), nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "lk_key", claims.Issuer)
+		if assert.NotNil(t, claims.Video) {
+			assert.True(t, claims.Video.RoomRecord)
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/twirp/livekit.Egress/StartRoomCompositeEgress":
+			fmt.Fprint(w, `{"egress_id":"EG_123","room_name":"standup","status":"EGRESS_ACTIVE","started_at":"1700000000000000000"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"code":"not_found","msg":"egress does not exist"}`)
+		}
+	}))
+	defer fake.Close()
+
+	// Server URLs are given as websocket URLs and called over HTTP
+	client := services.NewLiveKitEgressClient(strings.Replace(fake.URL, "http://", "ws://", 1), "lk_key", "lk_secret")
+	ctx := context.Background()
+
+	info, err := client.StartRoomCompositeEgress(ctx, &services.RoomCompositeEgressRequest{
+		RoomName: "standup",
+		Layout:   "grid",
+		EgressOutputs: services.EgressOutputs{
+			FileOutputs:   []*services.EncodedFileOutput{{FileType: "MP4", Filepath: "recordings/p/standup.mp4", S3: &services.S3Upload{Bucket: "media"}}},
+			StreamOutputs: []*services.StreamOutput{{Protocol: "RTMP", URLs: []string{"rtmp://a.rtmp.youtube.com/live2/key"}}},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "EG_123", info.EgressID)
+	assert.Equal(t, services.LiveKitEgressActive, info.Status)
+	if assert.NotNil(t, info.StartedAt.Time()) {
+		assert.Equal(t, int64(1700000000), info.StartedAt.Time().Unix())
+	}
+	assert.Equal(t, "standup", body["room_name"])
+	assert.Equal(t, "grid", body["layout"])
+	assert.Equal(t, "recordings/p/standup.mp4", body["file_outputs"].([]interface{})[0].(map[string]interface{})["filepath"])
+	assert.Len(t, body["stream_outputs"], 1)
+	assert.NotContains(t, body, "segment_outputs")
+
+	_, err = client.StopEgress(ctx, "EG_missing")
+	var liveKitErr *services.LiveKitError
+	if assert.ErrorAs(t, err, &liveKitErr) {
+		assert.Equal(t, "not_found", liveKitErr.Code)
+		assert.Equal(t, http.StatusNotFound, liveKitErr.StatusCode)
+	}
+	assert.Equal(t, "EG_missing", body["egress_id"])
+
+	var clients *services.LiveKitEgressClients
+	_, err = clients.ForProject(ctx, &models.Project{})
+	assert.ErrorIs(t, err, services.ErrLiveKitNotConfigured)
+}
+
+// TestEgressOutputs tests converting single-output egress requests to the
+// list of outputs
+func TestEgressOutputs(t *testing.T) {
+	single := &models.EgressRequest{OutputType: models.OutputTypeRTMP, RTMPURL: "rtmp://live.twitch.tv/app/key"}
+	assert.Equal(t, []models.EgressOutput{{Type: models.OutputTypeRTMP, URLs: []string{"rtmp://live.twitch.tv/app/key"}}}, single.OutputList())
+
+	multi := &models.EgressRequest{
+		OutputType: models.OutputTypeFile,
+		Outputs: []models.EgressOutput{
+			{Type: models.OutputTypeFile},
+			{Type: models.OutputTypeHLS},
+			{Type: models.OutputTypeRTMP, URLs: []string{"rtmp://a.rtmp.youtube.com/live2/key", "rtmp://live.twitch.tv/app/key"}},
+		},
+	}
+	assert.Len(t, multi.OutputList(), 3, "outputs take precedence over output_type")
+	assert.Empty(t, (&models.EgressRequest{}).OutputList())
+}
+
+// TestEgressStatusTransitions tests that late updates never bring a finished
+// egress back to life
+func TestEgressStatusTransitions(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("Active after ended is a no-op", func(mt *mtest.T) {
+		database.Database = mt.DB
+		egressService := services.NewEgressService(nil, nil, nil, nil, nil)
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}),
+		)
+
+		err := egressService.UpdateEgressStatus(context.Background(), "EG_late", models.EgressStatusActive, "")
+		assert.NoError(t, err)
+
+		updates := startedCommands(mt, "findAndModify", "egresses")
+		assert.Len(t, updates, 1)
+		notIn := updates[0].Lookup("query", "status", "$nin").Array()
+		assert.Equal(t, string(models.EgressStatusEnded), notIn.Index(0).Value().StringValue())
+		assert.Equal(t, string(models.EgressStatusFailed), notIn.Index(1).Value().StringValue())
+		// Only the started_at update ran; outputs were left alone
+		assert.Len(t, startedCommands(mt, "update", "egresses"), 1)
+	})
+
+	mt.Run("Ending is not guarded", func(mt *mtest.T) {
+		database.Database = mt.DB
+		egressService := services.NewEgressService(nil, nil, nil, nil, nil)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}))
+
+		err := egressService.UpdateEgressStatus(context.Background(), "EG_done", models.EgressStatusEnded, "")
+		assert.NoError(t, err)
+		query := startedCommands(mt, "findAndModify", "egresses")[0].Lookup("query").Document()
+		_, err = query.LookupErr("status")
+		assert.Error(t, err)
+	})
+
+	mt.Run("Ending meters the minutes the egress ran", func(mt *mtest.T) {
+		database.Database = mt.DB
+		egressService := services.NewEgressService(nil, nil, services.NewUsageService(mt.DB, nil, nil), nil, nil)
+		egressID, projectID := primitive.NewObjectID(), primitive.NewObjectID()
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{
+				{Key: "_id", Value: egressID},
+				{Key: "project_id", Value: projectID},
+				{Key: "room_name", Value: "standup"},
+				{Key: "status", Value: models.EgressStatusActive},
+				{Key: "started_at", Value: time.Now().Add(-30 * time.Minute)},
+			}}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateSuccessResponse(),
+		)
+
+		err := egressService.UpdateEgressStatus(context.Background(), "EG_done", models.EgressStatusEnded, "")
+		assert.NoError(t, err)
+
+		inserts := startedCommands(mt, "insert", "usage_metrics")
+		if assert.Len(t, inserts, 1) {
+			metric := inserts[0].Lookup("documents").Array().Index(0).Value().Document()
+			assert.Equal(t, models.EventEgressEnded, metric.Lookup("event_type").StringValue())
+			assert.InDelta(t, 30.0, metric.Lookup("value").Double(), 0.1)
+			assert.Equal(t, projectID.Hex()+":"+models.EventEgressEnded+":"+egressID.Hex(), metric.Lookup("idempotency_key").StringValue())
+		}
+	})
+}
+
+// TestRecordingRules tests which rooms and tracks a recording rule records
+// and which egresses each trigger can start
+func TestRecordingRules(t *testing.T) {
+	rule := &models.RecordingRule{RoomPattern: "class-*", TrackKind: "audio"}
+	assert.True(t, rule.MatchesRoom("class-101"))
+	assert.False(t, rule.MatchesRoom("standup"))
+	assert.True(t, rule.MatchesTrack("AUDIO"), "LiveKit reports track kinds in upper case")
+	assert.False(t, rule.MatchesTrack("VIDEO"))
+	assert.True(t, (&models.RecordingRule{}).MatchesRoom("anything"), "an empty pattern matches every room")
+
+	outputs := []models.EgressOutput{{Type: models.OutputTypeFile}}
+	valid := []models.RecordingRuleInput{
+		{Trigger: models.RecordingTriggerRoomStarted, RoomPattern: "class-*", EgressType: models.EgressTypeRoomComposite, Outputs: outputs},
+		{Trigger: models.RecordingTriggerTrackPublished, TrackKind: "audio", EgressType: models.EgressTypeTrack, Outputs: outputs},
+	}
+	for _, input := range valid {
+		assert.NoError(t, input.Validate())
+	}
+
+	invalid := []models.RecordingRuleInput{
+		{Trigger: models.RecordingTriggerRoomStarted, EgressType: models.EgressTypeTrack},
+		{Trigger: models.RecordingTriggerRoomStarted, TrackKind: "audio", EgressType: models.EgressTypeRoomComposite},
+		{Trigger: models.RecordingTriggerTrackPublished, EgressType: models.EgressTypeRoomComposite},
+		{Trigger: models.RecordingTriggerRoomStarted, RoomPattern: "class-[", EgressType: models.EgressTypeRoomComposite},
+		{Trigger: "participant_joined", EgressType: models.EgressTypeRoomComposite},
+	}
+	for _, input := range invalid {
+		assert.Error(t, input.Validate(), input.Trigger)
+	}
+}
+
+func TestEncodingPresets(t *testing.T) {
+	for name, options := range models.BuiltinEncodingPresets {
+		options := options
+		assert.NoError(t, options.Validate(), name)
+	}
+
+	invalid := []models.EncodingOptions{
+		{Width: 1280},
+		{Width: 1281, Height: 720},
+		{Width: 1280, Height: 720, Framerate: 120},
+		{VideoCodec: "h265"},
+		{AudioOnly: true, Width: 1280, Height: 720},
+		{AudioFrequency: 22050},
+	}
+	for _, options := range invalid {
+		options := options
+		assert.Error(t, options.Validate(), "%+v", options)
+	}
+
+	free := models.FreePlanLimits.Encoding
+	pro := models.ProPlanLimits.Encoding
+	hd := models.BuiltinEncodingPresets["1080p30"]
+	smooth := models.BuiltinEncodingPresets["720p60"]
+	audio := models.BuiltinEncodingPresets["audio-only-opus"]
+	portrait := models.EncodingOptions{Width: 720, Height: 1280, Framerate: 30}
+
+	assert.Error(t, free.Allows(&hd), "1080p is a Pro feature")
+	assert.Error(t, free.Allows(&smooth))
+	assert.NoError(t, free.Allows(&audio))
+	assert.NoError(t, free.Allows(&portrait), "portrait video is limited by its shorter side")
+	assert.NoError(t, pro.Allows(&hd))
+	assert.NoError(t, pro.Allows(&smooth))
+	assert.False(t, free.CustomTemplates)
+	assert.True(t, pro.CustomTemplates)
+
+	assert.Error(t, (&models.EncodingPresetInput{Name: "1080p60"}).Validate(), "built-in names are reserved")
+	assert.Error(t, (&models.EncodingPresetInput{Name: "My Preset"}).Validate())
+	assert.NoError(t, (&models.EncodingPresetInput{Name: "webinar-540p", Options: models.EncodingOptions{Width: 960, Height: 540}}).Validate())
+}
+
+func TestRecordingLibrary(t *testing.T) {
+	t.Run("Storage locations and formats", func(t *testing.T) {
+		bucket, key, ok := services.ParseStorageLocation("s3://media/recordings/p1/class-101_1700000000.mp4")
+		assert.True(t, ok)
+		assert.Equal(t, "media", bucket)
+		assert.Equal(t, "recordings/p1/class-101_1700000000.mp4", key)
+		_, _, ok = services.ParseStorageLocation("rtmp://live.example.com/app/key")
+		assert.False(t, ok)
+
+		assert.Equal(t, "mp4", models.RecordingFormat(models.OutputTypeFile, key))
+		assert.Equal(t, "hls", models.RecordingFormat(models.OutputTypeHLS, "hls/p1/class-101.m3u8"))
+	})
+
+	t.Run("LiveKit results become recording files", func(t *testing.T) {
+		var info services.LiveKitEgressInfo
+		err := json.Unmarshal([]byte(`{"file_results": [{"filename": "recordings/p1/a.mp4", "size": "1048576", "duration": "90000000000"}],
+			"segment_results": [{"playlist_name": "hls/p1/a.m3u8", "size": 2048}]}`), &info)
+		assert.NoError(t, err)
+
+		files := services.RecordingFiles(&info)
+		assert.Len(t, files, 2)
+		assert.Equal(t, services.RecordingFile{Key: "recordings/p1/a.mp4", SizeBytes: 1048576, Duration: 90 * time.Second}, files[0])
+		assert.Equal(t, "hls/p1/a.m3u8", files[1].Key)
+		assert.Nil(t, services.RecordingFiles(nil))
+	})
+
+	t.Run("Retention policies", func(t *testing.T) {
+		recording := &models.Recording{RoomName: "class-101", Tags: []string{"lecture"}}
+		assert.True(t, (&models.RetentionPolicy{RetentionDays: 30}).Matches(recording))
+		assert.True(t, (&models.RetentionPolicy{RoomPattern: "class-*", Tag: "lecture"}).Matches(recording))
+		assert.False(t, (&models.RetentionPolicy{RoomPattern: "standup-*"}).Matches(recording))
+		assert.False(t, (&models.RetentionPolicy{Tag: "keep"}).Matches(recording))
+
+		now := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+		assert.Equal(t, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), (&models.RetentionPolicy{RetentionDays: 30}).ExpiresBefore(now))
+
+		assert.NoError(t, (&models.RetentionPolicyInput{Name: "monthly", RetentionDays: 30}).Validate())
+		assert.Error(t, (&models.RetentionPolicyInput{Name: "never", RetentionDays: 0}).Validate())
+		assert.Error(t, (&models.RetentionPolicyInput{Name: "bad", RetentionDays: 7, RoomPattern: "class-["}).Validate())
+	})
+
+	t.Run("Object storage head, list and delete", func(t *testing.T) {
+		objects := map[string]string{
+			"/media/hls/p1/a.m3u8":      "playlist",
+			"/media/hls/p1/a_00000.ts":  "segment",
+			"/media/hls/p1/a_00001.ts":  "segment",
+			"/media/hls/p1/ab_00000.ts": "other recording",
+		}
+		var mu sync.Mutex
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Contains(t, r.Header.Get("Authorization"), "SignedHeaders=host;x-amz-content-sha256;x-amz-date")
+
+			switch r.Method {
+			case http.MethodHead:
+				body, ok := objects[r.URL.Path]
+				if !ok {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+				w.Header().Set("ETag", `"0123abcd"`)
+			case http.MethodDelete:
+				delete(objects, r.URL.Path)
+				w.WriteHeader(http.StatusNoContent)
+			case http.MethodGet:
+				prefix := "/media/" + r.URL.Query().Get("prefix")
+				fmt.Fprint(w, "<ListBucketResult>")
+				for path := range objects {
+					if strings.HasPrefix(path, prefix) {
+						fmt.Fprintf(w, "<Contents><Key>%s</Key></Contents>", strings.TrimPrefix(path, "/media/"))
+					}
+				}
+				fmt.Fprint(w, "<IsTruncated>false</IsTruncated></ListBucketResult>")
+			}
+		}))
+		defer server.Close()
+
+		storage := services.NewObjectStorage()
+		cfg := models.StorageConfig{Bucket: "media", AccessKeyID: "key", SecretAccessKey: "secret", Endpoint: server.URL}
+		ctx := context.Background()
+
+		info, err := storage.HeadObject(ctx, cfg, "hls/p1/a.m3u8")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len("playlist")), info.Size)
+		assert.Equal(t, "0123abcd", info.ETag)
+		_, err = storage.HeadObject(ctx, cfg, "hls/p1/missing.m3u8")
+		assert.ErrorIs(t, err, services.ErrObjectNotFound)
+
+		keys, err := storage.ListObjects(ctx, cfg, "hls/p1/a_")
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"hls/p1/a_00000.ts", "hls/p1/a_00001.ts"}, keys)
+
+		assert.NoError(t, storage.DeleteObject(ctx, cfg, "hls/p1/a.m3u8"))
+		assert.NoError(t, storage.DeleteObject(ctx, cfg, "hls/p1/a.m3u8"), "deleting a missing object succeeds")
+		assert.NotContains(t, objects, "/media/hls/p1/a.m3u8")
+	})
+}
+
 // TestInvitationExpiry tests invitation expiry logic
 func TestInvitationExpiry(t *testing.T) {
 	t.Run("Valid invitation", func(t *testing.T) {
@@ -179,3 +1172,909 @@ func TestRolePermissions(t *testing.T) {
 		})
 	}
 }
+
+// TestWebhookExpressions tests webhook filter and template evaluation
+func TestWebhookExpressions(t *testing.T) {
+	env := map[string]interface{}{
+		"event":     "participant_joined",
+		"room_name": "prod-standup",
+		"participant": map[string]interface{}{
+			"identity": "alice",
+		},
+	}
+	
+	t.Run("Filter expressions", func(t *testing.T) {
+		cases := map[string]bool{
+			`room_name startsWith "prod-"`:                           true,
+			`room_name startsWith "dev-" || event == "room_started"`: false,
+			`participant.identity in ["alice", "bob"] and not (event endsWith "_left")`: true,
+			`len(room_name) > 5 && missing.field == null`:           true,
+		}
+		for source, expected := range cases {
+			expr, err := utils.CompileExpression(source)
+			assert.NoError(t, err, source)
+			matched, err := expr.EvaluateBool(env)
+			assert.NoError(t, err, source)
+			assert.Equal(t, expected, matched, source)
+		}
+	})
+	
+	t.Run("Rejects unsafe or invalid expressions", func(t *testing.T) {
+		_, err := utils.CompileExpression(`os.exit(1)`)
+		assert.Error(t, err)
+		_, err = utils.CompileExpression(`exec("rm -rf /")`)
+		assert.Error(t, err)
+		_, err = utils.CompileExpression(`room_name ==`)
+		assert.Error(t, err)
+	})
+	
+	t.Run("Template reshapes payload", func(t *testing.T) {
+		body, err := utils.RenderTemplate(`{"text": "{{ participant.identity }} joined {{ upper(room_name) }}"}`, env)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"text": "alice joined PROD-STANDUP"}, body)
+		
+		flat, err := utils.RenderTemplate(`{"row": "{{ flatten(participant, '.') }}"}`, env)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"row": map[string]interface{}{"identity": "alice"}}, flat)
+	})
+}
+
+// TestEventBus tests event delivery to subscribers for projects and organizations
+func TestEventBus(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("Publish stamps the project", func(mt *mtest.T) {
+		database.Database = mt.DB
+		bus := services.NewEventBus(mt.DB, services.NewWebhookService())
+		received := make(chan *models.WebhookPayload, 1)
+		bus.Subscribe(models.WebhookEventUsageThresholdReached, func(ctx context.Context, project *models.Project, payload *models.WebhookPayload) {
+			received <- payload
+		})
+
+		projectID := primitive.NewObjectID()
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "pulse.projects", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: projectID},
+			{Key: "name", Value: "demo"},
+		}))
+
+		err := bus.Publish(context.Background(), projectID, &models.WebhookPayload{Event: models.WebhookEventUsageThresholdReached})
+		assert.NoError(t, err)
+
+		payload := <-received
+		assert.Equal(t, projectID.Hex(), payload.ProjectID)
+		assert.NotZero(t, payload.Timestamp)
+	})
+
+	mt.Run("Publish fails for an unknown project", func(mt *mtest.T) {
+		database.Database = mt.DB
+		bus := services.NewEventBus(mt.DB, services.NewWebhookService())
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "pulse.projects", mtest.FirstBatch))
+
+		err := bus.Publish(context.Background(), primitive.NewObjectID(), &models.WebhookPayload{Event: models.WebhookEventUsageThresholdReached})
+		assert.Error(t, err)
+	})
+
+	mt.Run("PublishToOrg reaches every project", func(mt *mtest.T) {
+		database.Database = mt.DB
+		bus := services.NewEventBus(mt.DB, services.NewWebhookService())
+		received := make(chan string, 2)
+		bus.Subscribe(models.WebhookEventUsageThresholdReached, func(ctx context.Context, project *models.Project, payload *models.WebhookPayload) {
+			received <- payload.ProjectID
+		})
+
+		first, second := primitive.NewObjectID(), primitive.NewObjectID()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "pulse.projects", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: first}},
+				bson.D{{Key: "_id", Value: second}},
+			),
+			mtest.CreateCursorResponse(0, "pulse.projects", mtest.FirstBatch, bson.D{{Key: "_id", Value: first}}),
+			mtest.CreateCursorResponse(0, "pulse.projects", mtest.FirstBatch, bson.D{{Key: "_id", Value: second}}),
+		)
+
+		bus.PublishToOrg(context.Background(), primitive.NewObjectID(), &models.WebhookPayload{Event: models.WebhookEventUsageThresholdReached})
+
+		var projectIDs []string
+		for i := 0; i < 2; i++ {
+			select {
+			case id := <-received:
+				projectIDs = append(projectIDs, id)
+			case <-time.After(2 * time.Second):
+				t.Fatal("event not delivered to every project")
+			}
+		}
+		assert.ElementsMatch(t, []string{first.Hex(), second.Hex()}, projectIDs)
+	})
+}
+
+// TestUsageAlertDedup tests that a usage threshold is only published once per period
+func TestUsageAlertDedup(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("Threshold fires once", func(mt *mtest.T) {
+		database.Database = mt.DB
+		bus := services.NewEventBus(mt.DB, services.NewWebhookService())
+		published := make(chan *models.WebhookPayload, 2)
+		bus.Subscribe(models.WebhookEventUsageThresholdReached, func(ctx context.Context, project *models.Project, payload *models.WebhookPayload) {
+			published <- payload
+		})
+		usageService := services.NewUsageService(mt.DB, bus, nil)
+
+		projectID := primitive.NewObjectID()
+		start := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+		end := start.Add(time.Hour)
+		// 900 of the Free plan's 1000 participant minutes, and no storage
+		usage := mtest.CreateCursorResponse(0, "pulse.usage_metrics", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: models.EventParticipantLeft},
+			{Key: "total", Value: 900.0},
+			{Key: "count", Value: int64(3)},
+		})
+		storage := mtest.CreateCursorResponse(0, "pulse.usage_metrics", mtest.FirstBatch)
+
+		// First check stores the alert and publishes it
+		mt.AddMockResponses(usage, storage, mtest.CreateSuccessResponse(),
+			mtest.CreateCursorResponse(0, "pulse.projects", mtest.FirstBatch, bson.D{{Key: "_id", Value: projectID}}))
+		alerts, err := usageService.CheckLimits(context.Background(), projectID, "Free", start, end)
+		assert.NoError(t, err)
+		assert.Len(t, alerts, 1)
+		select {
+		case payload := <-published:
+			assert.Equal(t, projectID.Hex(), payload.ProjectID)
+		case <-time.After(2 * time.Second):
+			t.Fatal("threshold not published")
+		}
+
+		// The same threshold in the same period is already stored
+		mt.AddMockResponses(usage, storage, mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key"}))
+		alerts, err = usageService.CheckLimits(context.Background(), projectID, "Free", start, end)
+		assert.NoError(t, err)
+		assert.Len(t, alerts, 1)
+		select {
+		case <-published:
+			t.Fatal("threshold published twice in one period")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
+
+// TestMeteringPipeline tests batching, idempotent replays and draining on shutdown
+func TestMeteringPipeline(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	// insertedBatches returns the number of documents in each insert command
+	insertedBatches := func(mt *mtest.T) []int {
+		var sizes []int
+		for _, started := range mt.GetAllStartedEvents() {
+			if started.CommandName != "insert" {
+				continue
+			}
+			docs, _ := started.Command.Lookup("documents").Array().Values()
+			sizes = append(sizes, len(docs))
+		}
+		return sizes
+	}
+
+	mt.Run("Writes full batches", func(mt *mtest.T) {
+		pipeline := services.NewMeteringPipeline(mt.DB, services.MeteringConfig{BatchSize: 2, FlushInterval: time.Hour})
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+
+		projectID := primitive.NewObjectID()
+		for i := 0; i < 5; i++ {
+			assert.True(t, pipeline.Enqueue(models.UsageMetric{
+				ProjectID:      projectID,
+				EventType:      models.EventAPIRequest,
+				Value:          1,
+				IdempotencyKey: fmt.Sprintf("request-%d", i),
+			}))
+		}
+		pipeline.Start()
+		assert.NoError(t, pipeline.Stop(context.Background()))
+
+		assert.Equal(t, []int{2, 2, 1}, insertedBatches(mt))
+		stats := pipeline.Stats()
+		assert.Equal(t, int64(5), stats.Enqueued)
+		assert.Equal(t, int64(5), stats.Inserted)
+	})
+
+	mt.Run("Replayed events are counted once", func(mt *mtest.T) {
+		pipeline := services.NewMeteringPipeline(mt.DB, services.MeteringConfig{FlushInterval: time.Hour})
+		usageService := services.NewUsageService(mt.DB, nil, pipeline)
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 1, Code: 11000, Message: "duplicate key"}))
+
+		projectID := primitive.NewObjectID()
+		for i := 0; i < 2; i++ {
+			// A retried participant_left webhook carries the same participant session
+			assert.NoError(t, usageService.TrackParticipantMinutes(context.Background(), projectID, "standup", "PA_1", "alice", nil, 12))
+		}
+		pipeline.Start()
+		assert.NoError(t, pipeline.Stop(context.Background()))
+
+		started := mt.GetStartedEvent()
+		docs, _ := started.Command.Lookup("documents").Array().Values()
+		assert.Len(t, docs, 2)
+		assert.Equal(t, docs[0].Document().Lookup("idempotency_key"), docs[1].Document().Lookup("idempotency_key"))
+
+		stats := pipeline.Stats()
+		assert.Equal(t, int64(1), stats.Inserted)
+		assert.Equal(t, int64(1), stats.Duplicates)
+		assert.Zero(t, stats.Failed)
+	})
+
+	mt.Run("Stop flushes buffered events", func(mt *mtest.T) {
+		pipeline := services.NewMeteringPipeline(mt.DB, services.MeteringConfig{FlushInterval: time.Hour})
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		pipeline.Start()
+
+		projectID := primitive.NewObjectID()
+		for i := 0; i < 3; i++ {
+			assert.True(t, pipeline.Enqueue(models.UsageMetric{ProjectID: projectID, EventType: models.EventAPIRequest, Value: 1}))
+		}
+		assert.NoError(t, pipeline.Stop(context.Background()))
+
+		assert.Equal(t, []int{3}, insertedBatches(mt))
+		assert.Equal(t, int64(3), pipeline.Stats().Inserted)
+
+		// Events after shutdown are rejected rather than lost silently
+		assert.False(t, pipeline.Enqueue(models.UsageMetric{ProjectID: projectID, EventType: models.EventAPIRequest, Value: 1}))
+		assert.Equal(t, int64(1), pipeline.Stats().Dropped)
+	})
+}
+
+// startedCommands returns the mocked commands of one kind sent to a collection
+func startedCommands(mt *mtest.T, name, collection string) []bson.Raw {
+	var commands []bson.Raw
+	for _, started := range mt.GetAllStartedEvents() {
+		if started.CommandName == name && started.Command.Lookup(name).StringValue() == collection {
+			commands = append(commands, started.Command)
+		}
+	}
+	return commands
+}
+
+// TestUsageAggregator tests watermark catch-up and re-aggregation of late events
+func TestUsageAggregator(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	hour := func(h int) time.Time {
+		return time.Date(2026, 10, 1, h, 0, 0, 0, time.UTC)
+	}
+	active, idle := primitive.NewObjectID(), primitive.NewObjectID()
+
+	// mockPeriod queues the responses for aggregating one hour in which only
+	// the active project has usage
+	mockPeriod := func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "pulse.projects", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: active}},
+				bson.D{{Key: "_id", Value: idle}},
+			),
+			mtest.CreateCursorResponse(0, "pulse.usage_metrics", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: bson.D{{Key: "project_id", Value: active}, {Key: "event_type", Value: models.EventParticipantLeft}}},
+				{Key: "total", Value: 30.0},
+				{Key: "average", Value: 15.0},
+				{Key: "count", Value: int64(2)},
+			}),
+			mtest.CreateSuccessResponse(),
+		)
+	}
+
+	mt.Run("Catches up from the watermark", func(mt *mtest.T) {
+		aggregator := services.NewAggregatorService(mt.DB)
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "pulse.aggregation_watermarks", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: models.PeriodHourly},
+				{Key: "aggregated_until", Value: hour(7)},
+				{Key: "updated_at", Value: hour(7).Add(2 * time.Minute)},
+				{Key: "late_events_checked_at", Value: hour(7).Add(2 * time.Minute)},
+			}),
+			mtest.CreateCursorResponse(0, "pulse.usage_metrics", mtest.FirstBatch),
+			mtest.CreateSuccessResponse(),
+		)
+		for i := 0; i < 3; i++ {
+			mockPeriod(mt)
+			mt.AddMockResponses(mtest.CreateSuccessResponse())
+		}
+
+		n, err := aggregator.CatchUp(context.Background(), models.PeriodHourly, hour(10).Add(30*time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, 3, n)
+
+		// One rollup per hour, and none for the idle project
+		rollups := startedCommands(mt, "update", "usage_aggregates")
+		assert.Len(t, rollups, 3)
+		for i, command := range rollups {
+			updates, _ := command.Lookup("updates").Array().Values()
+			assert.Len(t, updates, 1)
+			filter := updates[0].Document().Lookup("q").Document()
+			assert.Equal(t, active, filter.Lookup("project_id").ObjectID())
+			assert.True(t, hour(7+i).Equal(filter.Lookup("period_start").Time()))
+		}
+
+		// The watermark advances after each hour, the late-event check first
+		watermarks := startedCommands(mt, "update", "aggregation_watermarks")
+		assert.Len(t, watermarks, 4)
+		for i, command := range watermarks[1:] {
+			until := command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u", "$set", "aggregated_until").Time()
+			assert.True(t, hour(8+i).Equal(until))
+		}
+	})
+
+	mt.Run("Re-aggregates periods with late events", func(mt *mtest.T) {
+		aggregator := services.NewAggregatorService(mt.DB)
+		now := hour(10).Add(30 * time.Minute)
+		checkedAt := hour(9).Add(50 * time.Minute)
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "pulse.aggregation_watermarks", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: models.PeriodHourly},
+				{Key: "aggregated_until", Value: hour(10)},
+				{Key: "updated_at", Value: hour(10).Add(2 * time.Minute)},
+				{Key: "late_events_checked_at", Value: checkedAt},
+			}),
+			// An event for 08:00 landed after that hour was rolled up
+			mtest.CreateCursorResponse(0, "pulse.usage_metrics", mtest.FirstBatch, bson.D{{Key: "_id", Value: hour(8)}}),
+		)
+		mockPeriod(mt)
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		n, err := aggregator.CatchUp(context.Background(), models.PeriodHourly, now)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		late := startedCommands(mt, "aggregate", "usage_metrics")[0]
+		match := late.Lookup("pipeline").Array().Index(0).Value().Document().Lookup("$match")
+		assert.True(t, checkedAt.Add(-time.Minute).Equal(match.Document().Lookup("recorded_at", "$gte").Time()))
+		assert.True(t, hour(10).Equal(match.Document().Lookup("timestamp", "$lt").Time()))
+
+		rollups := startedCommands(mt, "update", "usage_aggregates")
+		assert.Len(t, rollups, 1)
+		filter := rollups[0].Lookup("updates").Array().Index(0).Value().Document().Lookup("q").Document()
+		assert.True(t, hour(8).Equal(filter.Lookup("period_start").Time()))
+
+		// The check advances only after the late hour is re-aggregated; the
+		// watermark itself does not move since 10:00 is still in progress
+		watermarks := startedCommands(mt, "update", "aggregation_watermarks")
+		assert.Len(t, watermarks, 1)
+		set := watermarks[0].Lookup("updates").Array().Index(0).Value().Document().Lookup("u", "$set").Document()
+		assert.True(t, now.Equal(set.Lookup("late_events_checked_at").Time()))
+	})
+}
+
+// TestLeaderLock tests acquiring, renewing and taking over an expired lease
+func TestLeaderLock(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("Acquire and renew", func(mt *mtest.T) {
+		lock := services.NewLeaderLock(mt.DB, "usage_aggregator", time.Minute)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+
+		leader, err := lock.TryAcquire(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, leader)
+		leader, err = lock.TryAcquire(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, leader)
+
+		// Both attempts match our own lease or any expired one, so a renewal
+		// and a takeover are the same upsert
+		commands := startedCommands(mt, "update", "worker_locks")
+		assert.Len(t, commands, 2)
+		for _, command := range commands {
+			update := command.Lookup("updates").Array().Index(0).Value().Document()
+			owner := update.Lookup("u", "$set", "owner").StringValue()
+			or, _ := update.Lookup("q", "$or").Array().Values()
+			assert.Len(t, or, 2)
+			assert.Equal(t, owner, or[0].Document().Lookup("owner").StringValue())
+			assert.Equal(t, bson.TypeDateTime, or[1].Document().Lookup("expires_at", "$lt").Type)
+			assert.True(t, update.Lookup("upsert").Boolean())
+		}
+	})
+
+	mt.Run("Live lease held by another replica", func(mt *mtest.T) {
+		lock := services.NewLeaderLock(mt.DB, "usage_aggregator", time.Minute)
+		// The filter misses the other owner's unexpired lease, so the upsert collides with it
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key"}))
+
+		leader, err := lock.TryAcquire(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, leader)
+	})
+
+	mt.Run("Other failures are errors", func(mt *mtest.T) {
+		lock := services.NewLeaderLock(mt.DB, "usage_aggregator", time.Minute)
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 91, Message: "shutting down"}))
+
+		leader, err := lock.TryAcquire(context.Background())
+		assert.Error(t, err)
+		assert.False(t, leader)
+	})
+}
+
+// TestUsageSummaryRollupCoverage tests that summaries read each instant once,
+// from a rollup or from the raw scan of the gaps between rollups
+func TestUsageSummaryRollupCoverage(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("Raw scan covers hours without rollups", func(mt *mtest.T) {
+		usageService := services.NewUsageService(mt.DB, nil, nil)
+		projectID := primitive.NewObjectID()
+		start := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+		end := start.Add(25*time.Hour + 30*time.Minute)
+
+		// Hourly rollups for the first day, except 05:00 which had no usage
+		var rollups []bson.D
+		for h := 0; h < 24; h++ {
+			if h == 5 {
+				continue
+			}
+			periodStart := start.Add(time.Duration(h) * time.Hour)
+			rollups = append(rollups, bson.D{
+				{Key: "project_id", Value: projectID},
+				{Key: "period_type", Value: models.PeriodHourly},
+				{Key: "period_start", Value: periodStart},
+				{Key: "period_end", Value: periodStart.Add(time.Hour)},
+				{Key: "participant_minutes", Value: 10.0},
+				{Key: "api_requests", Value: int64(4)},
+			})
+		}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "pulse.usage_aggregates", mtest.FirstBatch, rollups...),
+			mtest.CreateCursorResponse(0, "pulse.usage_metrics", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: models.EventParticipantLeft}, {Key: "total", Value: 7.0}, {Key: "count", Value: int64(1)}},
+				bson.D{{Key: "_id", Value: models.EventAPIRequest}, {Key: "total", Value: 3.0}, {Key: "count", Value: int64(3)}},
+			),
+			mtest.CreateCursorResponse(0, "pulse.usage_metrics", mtest.FirstBatch, bson.D{
+				{Key: "event_type", Value: models.EventStorageUsed},
+				{Key: "value", Value: 2.5},
+			}),
+		)
+
+		summary, err := usageService.GetUsageSummary(context.Background(), projectID, start, end)
+		assert.NoError(t, err)
+		assert.Equal(t, 23*10.0+7, summary.ParticipantMinutes)
+		assert.Equal(t, int64(23*4+3), summary.APIRequests)
+		assert.Equal(t, 2.5, summary.StorageGB)
+
+		// The latest storage reading is looked up on its own
+		storageFind := startedCommands(mt, "find", "usage_metrics")
+		if assert.Len(t, storageFind, 1) {
+			assert.Equal(t, models.EventStorageUsed, storageFind[0].Lookup("filter", "event_type").StringValue())
+		}
+
+		// The raw scan is limited to exactly the uncovered hour and the tail
+		pipeline := startedCommands(mt, "aggregate", "usage_metrics")[0].Lookup("pipeline").Array()
+		ranges, _ := pipeline.Index(0).Value().Document().Lookup("$match", "$or").Array().Values()
+		assert.Len(t, ranges, 2)
+		expected := [][2]time.Time{
+			{start.Add(5 * time.Hour), start.Add(6 * time.Hour)},
+			{start.Add(24 * time.Hour), end.Add(time.Millisecond)},
+		}
+		for i, r := range ranges {
+			timestamp := r.Document().Lookup("timestamp").Document()
+			assert.True(t, expected[i][0].Equal(timestamp.Lookup("$gte").Time()), "range %d start", i)
+			assert.True(t, expected[i][1].Equal(timestamp.Lookup("$lt").Time()), "range %d end", i)
+		}
+	})
+}
+
+// TestOrganizationInvoicing tests the organization usage rollup and that only
+// the consolidated invoice charges the subscription and draws down credit
+func TestOrganizationInvoicing(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	orgID, planID := primitive.NewObjectID(), primitive.NewObjectID()
+	alpha, beta := primitive.NewObjectID(), primitive.NewObjectID()
+	periodStart := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	periodEnd := periodStart.Add(12 * time.Hour)
+
+	org := mtest.CreateCursorResponse(0, "pulse.organizations", mtest.FirstBatch, bson.D{
+		{Key: "_id", Value: orgID},
+		{Key: "name", Value: "Acme"},
+		{Key: "plan", Value: "Pro"},
+		{Key: "pricing_plan_id", Value: planID},
+		{Key: "billing_day", Value: 1},
+	})
+	projects := mtest.CreateCursorResponse(0, "pulse.projects", mtest.FirstBatch,
+		bson.D{{Key: "_id", Value: alpha}, {Key: "name", Value: "alpha"}},
+		bson.D{{Key: "_id", Value: beta}, {Key: "name", Value: "beta"}},
+	)
+	// participantMinutes queues a project's raw usage and its (absent)
+	// storage reading
+	participantMinutes := func(mt *mtest.T, minutes ...float64) {
+		for _, m := range minutes {
+			mt.AddMockResponses(
+				mtest.CreateCursorResponse(0, "pulse.usage_metrics", mtest.FirstBatch, bson.D{
+					{Key: "_id", Value: models.EventParticipantLeft},
+					{Key: "total", Value: m},
+					{Key: "count", Value: int64(1)},
+				}),
+				mtest.CreateCursorResponse(0, "pulse.usage_metrics", mtest.FirstBatch),
+			)
+		}
+	}
+	// 200 minutes included, then a cent a minute, with a base fee and a
+	// minimum commit that only the organization invoice may charge
+	plan := mtest.CreateCursorResponse(0, "pulse.pricing_plans", mtest.FirstBatch, bson.D{
+		{Key: "_id", Value: planID},
+		{Key: "code", Value: "acme"},
+		{Key: "name", Value: "Acme"},
+		{Key: "version", Value: 1},
+		{Key: "currency", Value: "USD"},
+		{Key: "base_price", Value: 60.0},
+		{Key: "minimum_commit", Value: 600.0},
+		{Key: "metrics", Value: bson.A{bson.D{
+			{Key: "metric", Value: models.QuotaMetricParticipantMinutes},
+			{Key: "unit", Value: "minutes"},
+			{Key: "unit_size", Value: 1.0},
+			{Key: "included_quantity", Value: 200.0},
+			{Key: "tiers", Value: bson.A{bson.D{{Key: "up_to", Value: 0.0}, {Key: "unit_price", Value: 0.01}}}},
+		}}},
+	})
+	// The organization's plan and its (empty) plan history
+	subscription := []bson.D{
+		org,
+		plan,
+		mtest.CreateCursorResponse(0, "pulse.plan_changes", mtest.FirstBatch),
+		mtest.CreateCursorResponse(0, "pulse.plan_changes", mtest.FirstBatch),
+	}
+	invoiceNumber := mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{{Key: "_id", Value: orgID}, {Key: "seq", Value: 7}}})
+
+	mt.Run("Usage rolls up across projects", func(mt *mtest.T) {
+		usageService := services.NewUsageService(mt.DB, nil, nil)
+		mt.AddMockResponses(org, projects)
+		participantMinutes(mt, 600, 400)
+
+		usage, err := usageService.GetOrgUsageSummary(context.Background(), orgID, periodStart, periodEnd)
+		assert.NoError(t, err)
+		assert.Equal(t, "Pro", usage.Plan)
+		assert.Equal(t, 1000.0, usage.Totals.ParticipantMinutes)
+		assert.Len(t, usage.Projects, 2)
+		assert.Equal(t, "alpha", usage.Projects[0].ProjectName)
+		assert.Equal(t, 600.0, usage.Projects[0].ParticipantMinutes)
+		assert.Equal(t, "beta", usage.Projects[1].ProjectName)
+		assert.Equal(t, 400.0, usage.Projects[1].ParticipantMinutes)
+	})
+
+	mt.Run("Organization invoice charges usage once", func(mt *mtest.T) {
+		pricingService := services.NewPricingService(mt.DB)
+		billingService := services.NewBillingService(mt.DB, services.NewUsageService(mt.DB, nil, nil), pricingService, nil, nil, nil, nil)
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "pulse.invoices", mtest.FirstBatch), org, projects)
+		participantMinutes(mt, 600, 400)
+		mt.AddMockResponses(subscription...)
+		mt.AddMockResponses(invoiceNumber, mtest.CreateSuccessResponse())
+
+		invoice, err := billingService.GenerateOrgInvoice(context.Background(), orgID, periodStart, periodEnd)
+		assert.NoError(t, err)
+		assert.Equal(t, models.InvoiceScopeOrganization, invoice.Scope)
+		assert.True(t, invoice.ProjectID.IsZero())
+		assert.Equal(t, "INV-"+strings.ToUpper(orgID.Hex()[16:])+"-000007", invoice.InvoiceNumber)
+
+		// The allowance applies to the total; the 800 billed minutes are
+		// split between the projects by their share of usage
+		usage := map[string]int64{}
+		for _, item := range invoice.LineItems {
+			if item.ProjectID != "" {
+				usage[item.ProjectName] = item.Amount
+			}
+		}
+		assert.Equal(t, map[string]int64{"alpha": 480, "beta": 320}, usage)
+
+		// Base fee and the commit shortfall are charged once, on this invoice
+		proration := services.CycleProration(1, periodStart, periodEnd)
+		baseFee := models.ToMinorUnits(60*proration, "USD")
+		commit := models.ToMinorUnits(600*proration, "USD")
+		assert.Equal(t, commit, invoice.Subtotal)
+		assert.Equal(t, commit-800-baseFee, invoice.LineItems[len(invoice.LineItems)-1].Amount)
+		assert.Len(t, startedCommands(mt, "insert", "invoices"), 1)
+	})
+
+	mt.Run("Organization invoice is generated once per period", func(mt *mtest.T) {
+		pricingService := services.NewPricingService(mt.DB)
+		billingService := services.NewBillingService(mt.DB, services.NewUsageService(mt.DB, nil, nil), pricingService, services.NewCreditService(mt.DB, pricingService), nil, nil, nil)
+		existingID := primitive.NewObjectID()
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "pulse.invoices", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: existingID},
+			{Key: "org_id", Value: orgID},
+			{Key: "scope", Value: models.InvoiceScopeOrganization},
+			{Key: "period_start", Value: periodStart},
+			{Key: "period_end", Value: periodEnd},
+			{Key: "status", Value: models.InvoiceStatusIssued},
+		}))
+
+		invoice, err := billingService.GenerateOrgInvoice(context.Background(), orgID, periodStart, periodEnd)
+		assert.NoError(t, err)
+		assert.Equal(t, existingID, invoice.ID)
+		assert.Empty(t, startedCommands(mt, "insert", "invoices"))
+		assert.Empty(t, startedCommands(mt, "update", "credit_ledger"))
+	})
+
+	mt.Run("Operators set statuses of the organization's open invoices only", func(mt *mtest.T) {
+		billingService := services.NewBillingService(mt.DB, nil, nil, nil, nil, nil, nil)
+		invoiceID := primitive.NewObjectID()
+
+		err := billingService.SetOrgInvoiceStatus(context.Background(), orgID, invoiceID, "refunded")
+		assert.ErrorIs(t, err, services.ErrInvalidInvoiceStatus)
+		assert.Empty(t, startedCommands(mt, "find", "invoices"))
+
+		// Another organization's invoice is not found
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "pulse.invoices", mtest.FirstBatch))
+		err = billingService.SetOrgInvoiceStatus(context.Background(), orgID, invoiceID, models.InvoiceStatusPaid)
+		assert.EqualError(t, err, "invoice not found")
+		filter := startedCommands(mt, "find", "invoices")[0].Lookup("filter").Document()
+		assert.Equal(t, orgID, filter.Lookup("org_id").ObjectID())
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "pulse.invoices", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: invoiceID},
+			{Key: "org_id", Value: orgID},
+			{Key: "status", Value: models.InvoiceStatusVoid},
+		}))
+		err = billingService.SetOrgInvoiceStatus(context.Background(), orgID, invoiceID, models.InvoiceStatusPaid)
+		assert.ErrorIs(t, err, services.ErrInvalidInvoiceStatus)
+		assert.Empty(t, startedCommands(mt, "findAndModify", "invoices"))
+	})
+
+	mt.Run("Project invoice lists usage only", func(mt *mtest.T) {
+		pricingService := services.NewPricingService(mt.DB)
+		creditService := services.NewCreditService(mt.DB, pricingService)
+		billingService := services.NewBillingService(mt.DB, services.NewUsageService(mt.DB, nil, nil), pricingService, creditService, nil, nil, nil)
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "pulse.projects", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: alpha},
+			{Key: "org_id", Value: orgID},
+			{Key: "name", Value: "alpha"},
+		}))
+		mt.AddMockResponses(subscription...)
+		participantMinutes(mt, 600)
+		mt.AddMockResponses(invoiceNumber, mtest.CreateSuccessResponse())
+
+		invoice, err := billingService.GenerateInvoice(context.Background(), alpha, periodStart, periodEnd)
+		assert.NoError(t, err)
+		assert.Equal(t, models.InvoiceScopeProject, invoice.Scope)
+		for _, item := range invoice.LineItems {
+			assert.NotContains(t, item.Description, "Subscription")
+			assert.NotContains(t, item.Description, "Minimum Commit")
+		}
+		// 400 minutes over the allowance at a cent each, with no credit drawn
+		assert.Equal(t, int64(400), invoice.Subtotal)
+		assert.Equal(t, int64(400), invoice.Total)
+		assert.Zero(t, invoice.CreditsApplied)
+		assert.Empty(t, startedCommands(mt, "update", "credit_ledger"))
+	})
+}
+
+// TestPricingPlanLookup tests missing plans and the built-in plan fallback
+func TestPricingPlanLookup(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("Missing versions fall back to the built-in plan", func(mt *mtest.T) {
+		pricingService := services.NewPricingService(mt.DB)
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "pulse.pricing_plans", mtest.FirstBatch),
+			mtest.CreateCursorResponse(0, "pulse.pricing_plans", mtest.FirstBatch),
+		)
+
+		_, err := pricingService.GetPlan(context.Background(), primitive.NewObjectID())
+		assert.ErrorIs(t, err, services.ErrPricingPlanNotFound)
+
+		plan, err := pricingService.LatestPlanFor(context.Background(), "Pro")
+		assert.NoError(t, err)
+		assert.Equal(t, models.DefaultPricingPlan("Pro").Code, plan.Code)
+	})
+
+	mt.Run("Lookup failures are not treated as missing", func(mt *mtest.T) {
+		pricingService := services.NewPricingService(mt.DB)
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 91, Message: "shutting down"}))
+
+		_, err := pricingService.LatestPlanFor(context.Background(), "Pro")
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, services.ErrPricingPlanNotFound)
+	})
+}
+
+// TestOrganizationPlanUpdate tests that organization updates cannot change the plan
+func TestOrganizationPlanUpdate(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("Plan changes are rejected", func(mt *mtest.T) {
+		database.Database = mt.DB
+		orgService := services.NewOrganizationService()
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "pulse.organizations", mtest.FirstBatch))
+
+		_, err := orgService.UpdateOrganization(context.Background(), primitive.NewObjectID(), &models.OrganizationUpdate{Plan: "Enterprise"})
+		assert.ErrorIs(t, err, services.ErrPlanChangeNotAllowed)
+		assert.Empty(t, startedCommands(mt, "findAndModify", "organizations"))
+	})
+
+	mt.Run("Re-sending the current plan is allowed", func(mt *mtest.T) {
+		database.Database = mt.DB
+		orgService := services.NewOrganizationService()
+		id := primitive.NewObjectID()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "pulse.organizations", mtest.FirstBatch, bson.D{{Key: "_id", Value: id}, {Key: "plan", Value: "Pro"}}),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{{Key: "_id", Value: id}, {Key: "name", Value: "Acme"}, {Key: "plan", Value: "Pro"}}}),
+		)
+
+		org, err := orgService.UpdateOrganization(context.Background(), id, &models.OrganizationUpdate{Name: "Acme", Plan: "Pro"})
+		assert.NoError(t, err)
+		assert.Equal(t, "Acme", org.Name)
+		assert.Len(t, startedCommands(mt, "findAndModify", "organizations"), 1)
+	})
+}
+
+// TestCreditPurchaseVerification tests that purchased credit is only granted
+// for succeeded payments made by the organization
+func TestCreditPurchaseVerification(t *testing.T) {
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/payment_intents/pi_paid":
+			fmt.Fprint(w, `{"id":"pi_paid","customer":"cus_123","amount_received":50000,"currency":"inr","status":"succeeded"}`)
+		case "/v1/payment_intents/pi_processing":
+			fmt.Fprint(w, `{"id":"pi_processing","customer":"cus_123","amount_received":0,"currency":"inr","status":"processing"}`)
+		case "/v1/payment_intents/pi_other":
+			fmt.Fprint(w, `{"id":"pi_other","customer":"cus_999","amount_received":50000,"currency":"inr","status":"succeeded"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"type":"invalid_request_error","message":"No such payment_intent"}}`)
+		}
+	}))
+	defer fake.Close()
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	orgID := primitive.NewObjectID()
+	org := bson.D{
+		{Key: "_id", Value: orgID},
+		{Key: "is_deleted", Value: false},
+		{Key: "payment_customers", Value: bson.D{{Key: models.PaymentProviderStripe, Value: "cus_123"}}},
+	}
+
+	mt.Run("Succeeded payment is credited", func(mt *mtest.T) {
+		paymentService := services.NewPaymentService(mt.DB, nil, services.NewProviderEventStore(mt.DB), services.NewStripeService("sk_test_fake", "whsec_test", fake.URL))
+		creditService := services.NewCreditService(mt.DB, services.NewPricingService(mt.DB))
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "pulse.organizations", mtest.FirstBatch, org),
+			mtest.CreateSuccessResponse(),
+		)
+
+		payment, err := paymentService.VerifyPayment(context.Background(), orgID, models.PaymentProviderStripe, "pi_paid")
+		assert.NoError(t, err)
+		entry, err := creditService.PurchaseCredits(context.Background(), orgID, payment)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(50000), entry.Amount)
+		assert.Equal(t, "INR", entry.Currency)
+		assert.Equal(t, "pi_paid", entry.Reference)
+	})
+
+	mt.Run("Unconfirmed payments are rejected", func(mt *mtest.T) {
+		paymentService := services.NewPaymentService(mt.DB, nil, services.NewProviderEventStore(mt.DB), services.NewStripeService("sk_test_fake", "whsec_test", fake.URL))
+		for _, paymentID := range []string{"pi_processing", "pi_other"} {
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, "pulse.organizations", mtest.FirstBatch, org))
+
+			_, err := paymentService.VerifyPayment(context.Background(), orgID, models.PaymentProviderStripe, paymentID)
+			assert.ErrorIs(t, err, services.ErrPaymentNotConfirmed, paymentID)
+		}
+	})
+}
+
+// TestMinorUnitsMigration tests converting amounts stored as decimal doubles
+func TestMinorUnitsMigration(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("Legacy invoices and credit are converted", func(mt *mtest.T) {
+		modified := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1})
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "pulse.invoices", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: primitive.NewObjectID()},
+				{Key: "currency", Value: "USD"},
+				{Key: "subtotal", Value: 49.99},
+				{Key: "tax", Value: 9.0},
+				{Key: "credits_applied", Value: 5.5},
+				{Key: "total", Value: 53.49},
+				{Key: "line_items", Value: bson.A{bson.D{{Key: "description", Value: "Pro Plan"}, {Key: "amount", Value: 49.99}}}},
+				{Key: "tax_lines", Value: bson.A{bson.D{{Key: "taxable_amount", Value: 49.99}, {Key: "amount", Value: 9.0}}}},
+			}),
+			modified,
+			mtest.CreateCursorResponse(0, "pulse.credit_ledger", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: primitive.NewObjectID()},
+				{Key: "currency", Value: "JPY"},
+				{Key: "amount", Value: 1000.0},
+				{Key: "remaining", Value: 400.0},
+			}),
+			modified,
+			mtest.CreateCursorResponse(0, "pulse.promo_codes", mtest.FirstBatch),
+		)
+
+		assert.NoError(t, services.MigrateMinorUnits(context.Background(), mt.DB))
+
+		invoiceUpdates := startedCommands(mt, "update", "invoices")
+		if assert.Len(t, invoiceUpdates, 1) {
+			set := invoiceUpdates[0].Lookup("updates").Array().Index(0).Value().Document().Lookup("u", "$set").Document()
+			assert.Equal(t, int64(4999), set.Lookup("subtotal").Int64())
+			assert.Equal(t, int64(900), set.Lookup("tax").Int64())
+			assert.Equal(t, int64(550), set.Lookup("credits_applied").Int64())
+			assert.Equal(t, int64(5349), set.Lookup("total").Int64())
+			assert.Equal(t, int64(4999), set.Lookup("line_items.0.amount").Int64())
+			assert.Equal(t, int64(900), set.Lookup("tax_lines.0.amount").Int64())
+		}
+
+		creditUpdates := startedCommands(mt, "update", "credit_ledger")
+		if assert.Len(t, creditUpdates, 1) {
+			set := creditUpdates[0].Lookup("updates").Array().Index(0).Value().Document().Lookup("u", "$set").Document()
+			assert.Equal(t, int64(1000), set.Lookup("amount").Int64())
+			assert.Equal(t, int64(400), set.Lookup("remaining").Int64())
+		}
+	})
+}
+
+// TestRetentionEnforcement tests that retention policies select recordings
+// in the query and step over recordings that fail to delete
+func TestRetentionEnforcement(t *testing.T) {
+	t.Run("Room patterns match as globs", func(t *testing.T) {
+		patterns := []string{"class-*", "class-?01", "room[0-9]", "room[^0-9]", `a\*b`, "[a-c]x", "team.*"}
+		names := []string{"class-101", "class-", "standup-101", "class-1/01", "room5", "roomA", "room/", "a*b", "ab", "-x", "bx", "dx", "team.alpha", "teamXalpha"}
+		for _, pattern := range patterns {
+			re := regexp.MustCompile((&models.RetentionPolicy{RoomPattern: pattern}).RoomRegex())
+			for _, name := range names {
+				matched, err := path.Match(pattern, name)
+				assert.NoError(t, err)
+				assert.Equal(t, matched, re.MatchString(name), "%s against %s", pattern, name)
+			}
+		}
+	})
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("Failed deletions do not stall the policy", func(mt *mtest.T) {
+		database.Database = mt.DB
+		projectID := primitive.NewObjectID()
+		recordingService := services.NewRecordingService(mt.DB, services.NewObjectStorage(), nil, services.NewProjectService(nil))
+
+		// Older recordings of other rooms are left out by the query, so the
+		// batch is all class recordings
+		recorded := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		recording := func(i int) bson.D {
+			return bson.D{
+				{Key: "_id", Value: primitive.NewObjectID()},
+				{Key: "project_id", Value: projectID},
+				{Key: "room_name", Value: fmt.Sprintf("class-%d", i)},
+				{Key: "external", Value: true},
+				{Key: "recorded_at", Value: recorded.Add(time.Duration(i) * time.Minute)},
+			}
+		}
+		batch := make([]bson.D, 500)
+		for i := range batch {
+			batch[i] = recording(i)
+		}
+		deletedOne := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1})
+
+		responses := []primitive.D{
+			mtest.CreateCursorResponse(0, "pulse.recording_retention_policies", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: primitive.NewObjectID()},
+				{Key: "project_id", Value: projectID},
+				{Key: "retention_days", Value: 30},
+				{Key: "room_pattern", Value: "class-*"},
+				{Key: "enabled", Value: true},
+			}),
+			mtest.CreateCursorResponse(0, "pulse.recordings", mtest.FirstBatch, batch...),
+			mtest.CreateCursorResponse(0, "pulse.projects", mtest.FirstBatch, bson.D{{Key: "_id", Value: projectID}, {Key: "is_deleted", Value: false}}),
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 91, Message: "shutting down"}),
+		}
+		for i := 1; i < len(batch); i++ {
+			responses = append(responses, deletedOne)
+		}
+		responses = append(responses,
+			mtest.CreateCursorResponse(0, "pulse.recordings", mtest.FirstBatch, recording(500)),
+			deletedOne,
+		)
+		mt.AddMockResponses(responses...)
+
+		deleted, err := recordingService.EnforceRetention(context.Background(), time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+		assert.NoError(t, err)
+		assert.Equal(t, 500, deleted)
+
+		finds := startedCommands(mt, "find", "recordings")
+		if assert.Len(t, finds, 2) {
+			assert.Equal(t, "^class-[^/]*$", finds[0].Lookup("filter", "room_name", "$regex").StringValue())
+			after := finds[1].Lookup("filter", "$or").Array().Index(1).Value().Document()
+			assert.Equal(t, batch[len(batch)-1][0].Value, after.Lookup("_id", "$gt").ObjectID())
+		}
+	})
+}
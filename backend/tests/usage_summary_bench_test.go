@@ -0,0 +1,252 @@
+package services_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"pulse-control-plane/models"
+	"pulse-control-plane/services"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Seeded dataset: 30 days of usage at eventsPerHour raw events
+const (
+	benchDays          = 30
+	benchEventsPerHour = 40
+)
+
+// BenchmarkGetUsageSummary compares the previous five-query summary with the
+// faceted pipeline, with and without rollups. Requires MONGO_URI.
+//
+//	MONGO_URI=mongodb://localhost:27017 go test -bench UsageSummary -run ^$ ./tests/usage_summary_bench_test.go
+func BenchmarkGetUsageSummary(b *testing.B) {
+	db, cleanup := seedUsageBenchDB(b)
+	defer cleanup()
+
+	ctx := context.Background()
+	projectID, end := benchProjectID(db), benchEnd()
+	start := end.AddDate(0, 0, -benchDays)
+	usageService := services.NewUsageService(db, nil, nil)
+
+	b.Run("legacy_five_queries", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := legacyUsageSummary(ctx, db, projectID, start, end); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("faceted_raw_only", func(b *testing.B) {
+		rollups := db.Collection(models.UsageAggregate{}.TableName())
+		saved := hideRollups(b, ctx, rollups)
+		defer restoreRollups(b, ctx, rollups, saved)
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := usageService.GetUsageSummary(ctx, projectID, start, end); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("faceted_with_rollups", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := usageService.GetUsageSummary(ctx, projectID, start, end); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// TestGetUsageSummaryMatchesRawTotals checks that rollup reads agree with raw scans
+func TestGetUsageSummaryMatchesRawTotals(t *testing.T) {
+	db, cleanup := seedUsageBenchDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	projectID, end := benchProjectID(db), benchEnd()
+	// Deliberately misaligned so the edges need raw scans
+	start := end.AddDate(0, 0, -benchDays).Add(90 * time.Minute)
+	end = end.Add(-45 * time.Minute)
+	usageService := services.NewUsageService(db, nil, nil)
+
+	withRollups, err := usageService.GetUsageSummary(ctx, projectID, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rollups := db.Collection(models.UsageAggregate{}.TableName())
+	saved := hideRollups(t, ctx, rollups)
+	rawOnly, err := usageService.GetUsageSummary(ctx, projectID, start, end)
+	restoreRollups(t, ctx, rollups, saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if withRollups.APIRequests != rawOnly.APIRequests || withRollups.ParticipantMinutes != rawOnly.ParticipantMinutes {
+		t.Fatalf("rollup summary %+v does not match raw summary %+v", withRollups, rawOnly)
+	}
+}
+
+func benchEnd() time.Time {
+	return time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func benchProjectID(db *mongo.Database) primitive.ObjectID {
+	var project models.Project
+	_ = db.Collection(models.Project{}.TableName()).FindOne(context.Background(), bson.M{}).Decode(&project)
+	return project.ID
+}
+
+// seedUsageBenchDB creates a throwaway database with raw metrics and
+// matching hourly and daily rollups
+func seedUsageBenchDB(tb testing.TB) (*mongo.Database, func()) {
+	uri := os.Getenv("MONGO_URI")
+	if uri == "" {
+		tb.Skip("MONGO_URI not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		tb.Skipf("MongoDB unavailable: %v", err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		tb.Skipf("MongoDB unavailable: %v", err)
+	}
+
+	db := client.Database(fmt.Sprintf("pulse_bench_%s", primitive.NewObjectID().Hex()))
+	cleanup := func() {
+		_ = db.Drop(context.Background())
+		_ = client.Disconnect(context.Background())
+	}
+
+	projectID := primitive.NewObjectID()
+	if _, err := db.Collection(models.Project{}.TableName()).InsertOne(ctx, models.Project{ID: projectID, Name: "bench"}); err != nil {
+		cleanup()
+		tb.Fatal(err)
+	}
+
+	metrics := db.Collection(models.UsageMetric{}.TableName())
+	_, _ = metrics.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "project_id", Value: 1}, {Key: "timestamp", Value: -1}},
+	})
+
+	start := benchEnd().AddDate(0, 0, -benchDays)
+	var rollups []interface{}
+	for day := 0; day < benchDays; day++ {
+		dayStart := start.AddDate(0, 0, day)
+		daily := models.UsageAggregate{ProjectID: projectID, PeriodType: models.PeriodDaily, PeriodStart: dayStart, PeriodEnd: dayStart.Add(24 * time.Hour)}
+
+		docs := make([]interface{}, 0, 24*benchEventsPerHour)
+		for hour := 0; hour < 24; hour++ {
+			hourStart := dayStart.Add(time.Duration(hour) * time.Hour)
+			hourly := models.UsageAggregate{ProjectID: projectID, PeriodType: models.PeriodHourly, PeriodStart: hourStart, PeriodEnd: hourStart.Add(time.Hour)}
+
+			for i := 0; i < benchEventsPerHour; i++ {
+				ts := hourStart.Add(time.Duration(i) * time.Hour / benchEventsPerHour)
+				eventType, value := models.EventAPIRequest, 1.0
+				if i%4 == 0 {
+					eventType, value = models.EventParticipantLeft, float64(i%7+1)
+					hourly.ParticipantMinutes += value
+				} else {
+					hourly.APIRequests++
+				}
+				docs = append(docs, models.UsageMetric{ProjectID: projectID, EventType: eventType, Value: value, Timestamp: ts})
+			}
+
+			daily.ParticipantMinutes += hourly.ParticipantMinutes
+			daily.APIRequests += hourly.APIRequests
+			rollups = append(rollups, hourly)
+		}
+		rollups = append(rollups, daily)
+
+		if _, err := metrics.InsertMany(ctx, docs); err != nil {
+			cleanup()
+			tb.Fatal(err)
+		}
+	}
+
+	if _, err := db.Collection(models.UsageAggregate{}.TableName()).InsertMany(ctx, rollups); err != nil {
+		cleanup()
+		tb.Fatal(err)
+	}
+
+	return db, cleanup
+}
+
+// hideRollups moves rollups aside so summaries fall back to raw scans
+func hideRollups(tb testing.TB, ctx context.Context, rollups *mongo.Collection) []interface{} {
+	cursor, err := rollups.Find(ctx, bson.M{})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var saved []bson.M
+	if err := cursor.All(ctx, &saved); err != nil {
+		tb.Fatal(err)
+	}
+	if _, err := rollups.DeleteMany(ctx, bson.M{}); err != nil {
+		tb.Fatal(err)
+	}
+
+	docs := make([]interface{}, len(saved))
+	for i := range saved {
+		docs[i] = saved[i]
+	}
+	return docs
+}
+
+func restoreRollups(tb testing.TB, ctx context.Context, rollups *mongo.Collection, saved []interface{}) {
+	if len(saved) == 0 {
+		return
+	}
+	if _, err := rollups.InsertMany(ctx, saved); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// legacyUsageSummary reproduces the previous implementation: four
+// aggregations and a count over raw usage_metrics
+func legacyUsageSummary(ctx context.Context, db *mongo.Database, projectID primitive.ObjectID, start, end time.Time) error {
+	collection := db.Collection(models.UsageMetric{}.TableName())
+	inRange := bson.M{"$gte": start, "$lte": end}
+
+	for _, eventType := range []string{models.EventParticipantLeft, models.EventEgressEnded, models.EventBandwidthUsed} {
+		cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+			{{Key: "$match", Value: bson.M{"project_id": projectID, "event_type": eventType, "timestamp": inRange}}},
+			{{Key: "$group", Value: bson.D{{Key: "_id", Value: nil}, {Key: "total", Value: bson.D{{Key: "$sum", Value: "$value"}}}}}},
+		})
+		if err != nil {
+			return err
+		}
+		var results []bson.M
+		if err := cursor.All(ctx, &results); err != nil {
+			return err
+		}
+	}
+
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"project_id": projectID, "event_type": models.EventStorageUsed}}},
+		{{Key: "$sort", Value: bson.D{{Key: "timestamp", Value: -1}}}},
+		{{Key: "$limit", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+	var storage []bson.M
+	if err := cursor.All(ctx, &storage); err != nil {
+		return err
+	}
+
+	_, err = collection.CountDocuments(ctx, bson.M{"project_id": projectID, "event_type": models.EventAPIRequest, "timestamp": inRange})
+	return err
+}
@@ -0,0 +1,940 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Limits that keep customer-supplied expressions sandboxed. Expressions can
+// only read the environment they are given, have no loops, and are bounded
+// in size, nesting and evaluation steps.
+const (
+	MaxExpressionLength = 1024
+	MaxExpressionDepth  = 32
+	MaxEvaluationSteps  = 10000
+	MaxTemplateLength   = 16 * 1024
+)
+
+// Expression is a compiled filter or template expression
+type Expression struct {
+	source string
+	root   exprNode
+}
+
+// CompileExpression parses an expression such as
+// `room_name startsWith "prod-" && participant.identity != "bot"`
+func CompileExpression(source string) (*Expression, error) {
+	if len(source) > MaxExpressionLength {
+		return nil, fmt.Errorf("expression exceeds %d characters", MaxExpressionLength)
+	}
+
+	tokens, err := tokenizeExpression(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseExpression(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.peek().text, p.peek().pos)
+	}
+
+	return &Expression{source: source, root: root}, nil
+}
+
+// String returns the expression source
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Evaluate runs the expression against an environment of JSON-like values
+func (e *Expression) Evaluate(env map[string]interface{}) (interface{}, error) {
+	ev := &exprEvaluator{env: env}
+	return ev.eval(e.root)
+}
+
+// EvaluateBool runs the expression and requires a boolean result
+func (e *Expression) EvaluateBool(env map[string]interface{}) (bool, error) {
+	value, err := e.Evaluate(env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression must evaluate to a boolean, got %s", typeName(value))
+	}
+	return b, nil
+}
+
+// RenderTemplate reshapes env using a JSON template. String values that are
+// exactly "{{ expr }}" are replaced by the expression result (keeping its
+// type); other strings have each "{{ expr }}" interpolated as text.
+func RenderTemplate(template string, env map[string]interface{}) (interface{}, error) {
+	if len(template) > MaxTemplateLength {
+		return nil, fmt.Errorf("template exceeds %d characters", MaxTemplateLength)
+	}
+
+	var shape interface{}
+	if err := json.Unmarshal([]byte(template), &shape); err != nil {
+		return nil, fmt.Errorf("template must be valid JSON: %w", err)
+	}
+
+	return renderValue(shape, env, 0)
+}
+
+// ValidateTemplate checks a template's JSON and every embedded expression
+func ValidateTemplate(template string) error {
+	if len(template) > MaxTemplateLength {
+		return fmt.Errorf("template exceeds %d characters", MaxTemplateLength)
+	}
+
+	var shape interface{}
+	if err := json.Unmarshal([]byte(template), &shape); err != nil {
+		return fmt.Errorf("template must be valid JSON: %w", err)
+	}
+
+	return validateValue(shape, 0)
+}
+
+func renderValue(value interface{}, env map[string]interface{}, depth int) (interface{}, error) {
+	if depth > MaxExpressionDepth {
+		return nil, errors.New("template nesting too deep")
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			rendered, err := renderValue(item, env, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = rendered
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			rendered, err := renderValue(item, env, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = rendered
+		}
+		return out, nil
+	case string:
+		return renderString(v, env)
+	default:
+		return v, nil
+	}
+}
+
+func renderString(s string, env map[string]interface{}) (interface{}, error) {
+	segments, err := splitTemplateString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	// A lone placeholder keeps the type of its result
+	if len(segments) == 1 && segments[0].isExpr {
+		expr, err := CompileExpression(segments[0].text)
+		if err != nil {
+			return nil, err
+		}
+		return expr.Evaluate(env)
+	}
+
+	var sb strings.Builder
+	for _, seg := range segments {
+		if !seg.isExpr {
+			sb.WriteString(seg.text)
+			continue
+		}
+		expr, err := CompileExpression(seg.text)
+		if err != nil {
+			return nil, err
+		}
+		value, err := expr.Evaluate(env)
+		if err != nil {
+			return nil, err
+		}
+		sb.WriteString(toText(value))
+	}
+	return sb.String(), nil
+}
+
+func validateValue(value interface{}, depth int) error {
+	if depth > MaxExpressionDepth {
+		return errors.New("template nesting too deep")
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, item := range v {
+			if err := validateValue(item, depth+1); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := validateValue(item, depth+1); err != nil {
+				return err
+			}
+		}
+	case string:
+		segments, err := splitTemplateString(v)
+		if err != nil {
+			return err
+		}
+		for _, seg := range segments {
+			if !seg.isExpr {
+				continue
+			}
+			if _, err := CompileExpression(seg.text); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type templateSegment struct {
+	text   string
+	isExpr bool
+}
+
+func splitTemplateString(s string) ([]templateSegment, error) {
+	var segments []templateSegment
+	for {
+		start := strings.Index(s, "{{")
+		if start < 0 {
+			if s != "" {
+				segments = append(segments, templateSegment{text: s})
+			}
+			return segments, nil
+		}
+		end := strings.Index(s[start:], "}}")
+		if end < 0 {
+			return nil, errors.New("unterminated {{ in template")
+		}
+		if start > 0 {
+			segments = append(segments, templateSegment{text: s[:start]})
+		}
+		segments = append(segments, templateSegment{
+			text:   strings.TrimSpace(s[start+2 : start+end]),
+			isExpr: true,
+		})
+		s = s[start+end+2:]
+	}
+}
+
+// ---- Tokenizer ----
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOperator
+	tokLParen
+	tokRParen
+	tokLBracket
+	tokRBracket
+	tokComma
+	tokDot
+)
+
+type exprToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func tokenizeExpression(src string) ([]exprToken, error) {
+	var tokens []exprToken
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '\'':
+			quote := c
+			start := i
+			i++
+			var sb strings.Builder
+			for i < len(src) && src[i] != quote {
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+				}
+				sb.WriteByte(src[i])
+				i++
+			}
+			if i >= len(src) {
+				return nil, fmt.Errorf("unterminated string at position %d", start)
+			}
+			i++
+			tokens = append(tokens, exprToken{kind: tokString, text: sb.String(), pos: start})
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(src) && (src[i] >= '0' && src[i] <= '9' || src[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: tokNumber, text: src[start:i], pos: start})
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			start := i
+			for i < len(src) && (src[i] == '_' || src[i] >= 'a' && src[i] <= 'z' || src[i] >= 'A' && src[i] <= 'Z' || src[i] >= '0' && src[i] <= '9') {
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: tokIdent, text: src[start:i], pos: start})
+		case c == '(':
+			tokens = append(tokens, exprToken{kind: tokLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, exprToken{kind: tokRParen, text: ")", pos: i})
+			i++
+		case c == '[':
+			tokens = append(tokens, exprToken{kind: tokLBracket, text: "[", pos: i})
+			i++
+		case c == ']':
+			tokens = append(tokens, exprToken{kind: tokRBracket, text: "]", pos: i})
+			i++
+		case c == ',':
+			tokens = append(tokens, exprToken{kind: tokComma, text: ",", pos: i})
+			i++
+		case c == '.':
+			tokens = append(tokens, exprToken{kind: tokDot, text: ".", pos: i})
+			i++
+		default:
+			if i+1 < len(src) {
+				two := src[i : i+2]
+				switch two {
+				case "==", "!=", "<=", ">=", "&&", "||":
+					tokens = append(tokens, exprToken{kind: tokOperator, text: two, pos: i})
+					i += 2
+					continue
+				}
+			}
+			if strings.IndexByte("<>!+-*/%", c) >= 0 {
+				tokens = append(tokens, exprToken{kind: tokOperator, text: string(c), pos: i})
+				i++
+				continue
+			}
+			return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+		}
+	}
+	tokens = append(tokens, exprToken{kind: tokEOF, pos: len(src)})
+	return tokens, nil
+}
+
+// ---- Parser ----
+
+type exprNode interface{}
+
+type literalNode struct{ value interface{} }
+
+type identNode struct{ path []string }
+
+type listNode struct{ items []exprNode }
+
+type unaryNode struct {
+	op      string
+	operand exprNode
+}
+
+type binaryNode struct {
+	op          string
+	left, right exprNode
+}
+
+type callNode struct {
+	name string
+	args []exprNode
+}
+
+// Keyword operators are normalised to their symbolic form
+var keywordOperators = map[string]string{
+	"and":        "&&",
+	"or":         "||",
+	"not":        "!",
+	"startsWith": "startsWith",
+	"endsWith":   "endsWith",
+	"contains":   "contains",
+	"in":         "in",
+}
+
+var binaryPrecedence = map[string]int{
+	"||":         1,
+	"&&":         2,
+	"==":         3,
+	"!=":         3,
+	"<":          4,
+	"<=":         4,
+	">":          4,
+	">=":         4,
+	"startsWith": 4,
+	"endsWith":   4,
+	"contains":   4,
+	"in":         4,
+	"+":          5,
+	"-":          5,
+	"*":          6,
+	"/":          6,
+	"%":          6,
+}
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+	depth  int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// binaryOperator returns the operator at the cursor, if any
+func (p *exprParser) binaryOperator() (string, bool) {
+	tok := p.peek()
+	switch tok.kind {
+	case tokOperator:
+		if _, ok := binaryPrecedence[tok.text]; ok {
+			return tok.text, true
+		}
+	case tokIdent:
+		if op, ok := keywordOperators[tok.text]; ok && op != "!" {
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) parseExpression(minPrec int) (exprNode, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > MaxExpressionDepth {
+		return nil, errors.New("expression nesting too deep")
+	}
+
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, ok := p.binaryOperator()
+		if !ok || binaryPrecedence[op] <= minPrec {
+			return left, nil
+		}
+		p.next()
+
+		right, err := p.parseExpression(binaryPrecedence[op])
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	tok := p.peek()
+	if (tok.kind == tokOperator && (tok.text == "!" || tok.text == "-")) || (tok.kind == tokIdent && tok.text == "not") {
+		p.next()
+		op := tok.text
+		if op == "not" {
+			op = "!"
+		}
+		p.depth++
+		defer func() { p.depth-- }()
+		if p.depth > MaxExpressionDepth {
+			return nil, errors.New("expression nesting too deep")
+		}
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: op, operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokNumber:
+		n, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", tok.text, tok.pos)
+		}
+		return &literalNode{value: n}, nil
+	case tokString:
+		return &literalNode{value: tok.text}, nil
+	case tokLParen:
+		inner, err := p.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokRParen {
+			return nil, fmt.Errorf("missing ) for ( at position %d", tok.pos)
+		}
+		return inner, nil
+	case tokLBracket:
+		list := &listNode{}
+		if p.peek().kind == tokRBracket {
+			p.next()
+			return list, nil
+		}
+		for {
+			item, err := p.parseExpression(0)
+			if err != nil {
+				return nil, err
+			}
+			list.items = append(list.items, item)
+			sep := p.next()
+			if sep.kind == tokRBracket {
+				return list, nil
+			}
+			if sep.kind != tokComma {
+				return nil, fmt.Errorf("expected , or ] at position %d", sep.pos)
+			}
+		}
+	case tokIdent:
+		switch tok.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null", "nil":
+			return &literalNode{value: nil}, nil
+		}
+
+		if p.peek().kind == tokLParen {
+			return p.parseCall(tok)
+		}
+
+		path := []string{tok.text}
+		for p.peek().kind == tokDot {
+			p.next()
+			field := p.next()
+			if field.kind != tokIdent {
+				return nil, fmt.Errorf("expected field name at position %d", field.pos)
+			}
+			path = append(path, field.text)
+		}
+		return &identNode{path: path}, nil
+	}
+
+	if tok.kind == tokEOF {
+		return nil, errors.New("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+}
+
+func (p *exprParser) parseCall(name exprToken) (exprNode, error) {
+	if _, ok := exprFunctions[name.text]; !ok {
+		return nil, fmt.Errorf("unknown function %q", name.text)
+	}
+	p.next() // (
+
+	call := &callNode{name: name.text}
+	if p.peek().kind == tokRParen {
+		p.next()
+		return call, nil
+	}
+	for {
+		arg, err := p.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+		sep := p.next()
+		if sep.kind == tokRParen {
+			return call, nil
+		}
+		if sep.kind != tokComma {
+			return nil, fmt.Errorf("expected , or ) at position %d", sep.pos)
+		}
+	}
+}
+
+// ---- Evaluator ----
+
+type exprFunction func(args []interface{}) (interface{}, error)
+
+// exprFunctions is the complete set of functions an expression may call
+var exprFunctions = map[string]exprFunction{
+	"lower": func(args []interface{}) (interface{}, error) {
+		s, err := stringArg("lower", args)
+		return strings.ToLower(s), err
+	},
+	"upper": func(args []interface{}) (interface{}, error) {
+		s, err := stringArg("upper", args)
+		return strings.ToUpper(s), err
+	},
+	"trim": func(args []interface{}) (interface{}, error) {
+		s, err := stringArg("trim", args)
+		return strings.TrimSpace(s), err
+	},
+	"string": func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, errors.New("string() takes 1 argument")
+		}
+		return toText(args[0]), nil
+	},
+	"len": func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, errors.New("len() takes 1 argument")
+		}
+		switch v := args[0].(type) {
+		case string:
+			return float64(len(v)), nil
+		case []interface{}:
+			return float64(len(v)), nil
+		case map[string]interface{}:
+			return float64(len(v)), nil
+		case nil:
+			return float64(0), nil
+		}
+		return nil, fmt.Errorf("len() not supported for %s", typeName(args[0]))
+	},
+	"default": func(args []interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, errors.New("default() takes 2 arguments")
+		}
+		if args[0] == nil || args[0] == "" {
+			return args[1], nil
+		}
+		return args[0], nil
+	},
+	"flatten": func(args []interface{}) (interface{}, error) {
+		if len(args) < 1 || len(args) > 2 {
+			return nil, errors.New("flatten() takes 1 or 2 arguments")
+		}
+		sep := "_"
+		if len(args) == 2 {
+			s, ok := args[1].(string)
+			if !ok {
+				return nil, errors.New("flatten() separator must be a string")
+			}
+			sep = s
+		}
+		out := make(map[string]interface{})
+		flattenInto(out, "", sep, args[0], 0)
+		return out, nil
+	},
+}
+
+func stringArg(name string, args []interface{}) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("%s() takes 1 argument", name)
+	}
+	s, ok := args[0].(string)
+	if !ok && args[0] != nil {
+		return "", fmt.Errorf("%s() requires a string, got %s", name, typeName(args[0]))
+	}
+	return s, nil
+}
+
+func flattenInto(out map[string]interface{}, prefix, sep string, value interface{}, depth int) {
+	m, ok := value.(map[string]interface{})
+	if !ok || depth > MaxExpressionDepth {
+		if prefix != "" {
+			out[prefix] = value
+		}
+		return
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		key := k
+		if prefix != "" {
+			key = prefix + sep + k
+		}
+		flattenInto(out, key, sep, m[k], depth+1)
+	}
+}
+
+type exprEvaluator struct {
+	env   map[string]interface{}
+	steps int
+}
+
+func (ev *exprEvaluator) eval(node exprNode) (interface{}, error) {
+	ev.steps++
+	if ev.steps > MaxEvaluationSteps {
+		return nil, errors.New("expression evaluation limit exceeded")
+	}
+
+	switch n := node.(type) {
+	case *literalNode:
+		return n.value, nil
+	case *identNode:
+		return ev.lookup(n.path), nil
+	case *listNode:
+		items := make([]interface{}, len(n.items))
+		for i, item := range n.items {
+			v, err := ev.eval(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = v
+		}
+		return items, nil
+	case *unaryNode:
+		v, err := ev.eval(n.operand)
+		if err != nil {
+			return nil, err
+		}
+		if n.op == "!" {
+			return !truthy(v), nil
+		}
+		f, ok := v.(float64)
+		if !ok {
+			return nil, fmt.Errorf("cannot negate %s", typeName(v))
+		}
+		return -f, nil
+	case *binaryNode:
+		return ev.evalBinary(n)
+	case *callNode:
+		args := make([]interface{}, len(n.args))
+		for i, arg := range n.args {
+			v, err := ev.eval(arg)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = v
+		}
+		return exprFunctions[n.name](args)
+	}
+	return nil, errors.New("invalid expression")
+}
+
+func (ev *exprEvaluator) lookup(path []string) interface{} {
+	var current interface{} = ev.env
+	for _, key := range path {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[key]
+	}
+	return current
+}
+
+func (ev *exprEvaluator) evalBinary(n *binaryNode) (interface{}, error) {
+	left, err := ev.eval(n.left)
+	if err != nil {
+		return nil, err
+	}
+
+	// Short-circuit logical operators
+	switch n.op {
+	case "&&":
+		if !truthy(left) {
+			return false, nil
+		}
+		right, err := ev.eval(n.right)
+		if err != nil {
+			return nil, err
+		}
+		return truthy(right), nil
+	case "||":
+		if truthy(left) {
+			return true, nil
+		}
+		right, err := ev.eval(n.right)
+		if err != nil {
+			return nil, err
+		}
+		return truthy(right), nil
+	}
+
+	right, err := ev.eval(n.right)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return valuesEqual(left, right), nil
+	case "!=":
+		return !valuesEqual(left, right), nil
+	case "startsWith", "endsWith":
+		ls, lok := left.(string)
+		rs, rok := right.(string)
+		if !lok || !rok {
+			return false, nil
+		}
+		if n.op == "startsWith" {
+			return strings.HasPrefix(ls, rs), nil
+		}
+		return strings.HasSuffix(ls, rs), nil
+	case "contains":
+		return containsValue(left, right), nil
+	case "in":
+		return containsValue(right, left), nil
+	case "+":
+		if ls, ok := left.(string); ok {
+			return ls + toText(right), nil
+		}
+		if rs, ok := right.(string); ok {
+			return toText(left) + rs, nil
+		}
+	}
+
+	lf, lok := left.(float64)
+	rf, rok := right.(float64)
+	if !lok || !rok {
+		if ls, ok := left.(string); ok {
+			if rs, ok := right.(string); ok {
+				switch n.op {
+				case "<":
+					return ls < rs, nil
+				case "<=":
+					return ls <= rs, nil
+				case ">":
+					return ls > rs, nil
+				case ">=":
+					return ls >= rs, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("operator %s not supported for %s and %s", n.op, typeName(left), typeName(right))
+	}
+
+	switch n.op {
+	case "<":
+		return lf < rf, nil
+	case "<=":
+		return lf <= rf, nil
+	case ">":
+		return lf > rf, nil
+	case ">=":
+		return lf >= rf, nil
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return lf / rf, nil
+	case "%":
+		if rf == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return math.Mod(lf, rf), nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", n.op)
+}
+
+func containsValue(container, item interface{}) bool {
+	switch c := container.(type) {
+	case string:
+		s, ok := item.(string)
+		return ok && strings.Contains(c, s)
+	case []interface{}:
+		for _, v := range c {
+			if valuesEqual(v, item) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		s, ok := item.(string)
+		if ok {
+			_, exists := c[s]
+			return exists
+		}
+	}
+	return false
+}
+
+func valuesEqual(a, b interface{}) bool {
+	switch av := a.(type) {
+	case nil:
+		return b == nil
+	case string:
+		bv, ok := b.(string)
+		return ok && av == bv
+	case float64:
+		bv, ok := b.(float64)
+		return ok && av == bv
+	case bool:
+		bv, ok := b.(bool)
+		return ok && av == bv
+	}
+	return false
+}
+
+func truthy(v interface{}) bool {
+	switch val := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return val
+	case string:
+		return val != ""
+	case float64:
+		return val != 0
+	}
+	return true
+}
+
+func toText(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
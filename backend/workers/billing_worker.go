@@ -0,0 +1,133 @@
+package workers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"pulse-control-plane/models"
+	"pulse-control-plane/services"
+
+	"github.com/rs/zerolog/log"
+)
+
+// billingRunTimeout bounds one pass over all organizations
+const billingRunTimeout = 30 * time.Minute
+
+// BillingWorker applies scheduled plan changes, closes billing cycles and
+// runs dunning every hour. Runs are idempotent per organization and period,
+// so the hourly cadence only decides how soon after midnight on the billing
+// day an organization is invoiced.
+type BillingWorker struct {
+	billingRunService   *services.BillingRunService
+	subscriptionService *services.SubscriptionService
+	lock                *services.LeaderLock
+	stopChan            chan struct{}
+	doneChan            chan struct{}
+	stopOnce            sync.Once
+
+	// ctx is cancelled on Stop so an in-progress run does not delay shutdown
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewBillingWorker creates a new billing worker. The lock ensures only one
+// replica bills at a time.
+func NewBillingWorker(billingRunService *services.BillingRunService, subscriptionService *services.SubscriptionService, lock *services.LeaderLock) *BillingWorker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &BillingWorker{
+		billingRunService:   billingRunService,
+		subscriptionService: subscriptionService,
+		lock:                lock,
+		stopChan:            make(chan struct{}),
+		doneChan:            make(chan struct{}),
+		ctx:                 ctx,
+		cancel:              cancel,
+	}
+}
+
+// Start starts the background worker
+func (w *BillingWorker) Start() {
+	log.Info().Msg("Starting billing worker")
+
+	go func() {
+		defer close(w.doneChan)
+
+		// Run immediately on startup to catch up on cycles closed while down
+		w.runBilling()
+
+		for {
+			now := time.Now()
+			_, hourEnd := services.PeriodBounds(models.PeriodHourly, now)
+			timer := time.NewTimer(hourEnd.Add(aggregationDelay).Sub(now))
+
+			select {
+			case <-timer.C:
+				w.runBilling()
+
+			case <-w.stopChan:
+				timer.Stop()
+				log.Info().Msg("Stopping billing worker")
+				return
+			}
+		}
+	}()
+
+	log.Info().Msg("Billing worker started successfully")
+}
+
+// Stop stops the background worker and releases the leader lock
+func (w *BillingWorker) Stop() {
+	log.Info().Msg("Stopping billing worker...")
+	w.stopOnce.Do(func() {
+		close(w.stopChan)
+		w.cancel()
+	})
+	<-w.doneChan
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := w.lock.Release(ctx); err != nil {
+		log.Error().Err(err).Msg("Failed to release billing lock")
+	}
+	log.Info().Msg("Billing worker stopped")
+}
+
+// runBilling runs billing if this replica is the leader
+func (w *BillingWorker) runBilling() {
+	ctx, cancel := context.WithTimeout(w.ctx, billingRunTimeout)
+	defer cancel()
+
+	leader, err := w.lock.TryAcquire(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to acquire billing lock")
+		return
+	}
+	if !leader {
+		log.Debug().Msg("Another replica is running billing, skipping")
+		return
+	}
+
+	// Downgrades and cancellations take effect before the closed cycle is
+	// invoiced; they are dated at the cycle boundary so it is billed in full
+	applied, err := w.subscriptionService.ApplyScheduledChanges(ctx, time.Now())
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to apply scheduled plan changes")
+	} else if applied > 0 {
+		log.Info().Int("applied", applied).Msg("Scheduled plan changes applied")
+	}
+
+	summary, err := w.billingRunService.Run(ctx, time.Now())
+	if err != nil {
+		log.Error().Err(err).Msg("Billing run failed")
+		return
+	}
+	if summary.Invoiced > 0 || summary.Failed > 0 || summary.Reminded > 0 {
+		log.Info().
+			Int("invoiced", summary.Invoiced).
+			Int("failed", summary.Failed).
+			Int("reminded", summary.Reminded).
+			Int("suspended", summary.Suspended).
+			Msg("Billing run completed")
+	}
+}
@@ -0,0 +1,117 @@
+package workers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"pulse-control-plane/services"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// budgetEvaluationInterval is how often budgets are evaluated, and so
+	// how long spend can run past a hard cap before it blocks
+	budgetEvaluationInterval = 15 * time.Minute
+
+	// budgetEvaluationTimeout bounds one pass over all budgets
+	budgetEvaluationTimeout = 10 * time.Minute
+)
+
+// BudgetWorker evaluates budgets, sending threshold and forecast alerts and
+// applying hard caps
+type BudgetWorker struct {
+	budgetService *services.BudgetService
+	lock          *services.LeaderLock
+	stopChan      chan struct{}
+	doneChan      chan struct{}
+	stopOnce      sync.Once
+
+	// ctx is cancelled on Stop so an in-progress evaluation does not delay shutdown
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewBudgetWorker creates a new budget worker. The lock ensures only one
+// replica evaluates budgets, so each alert is sent once.
+func NewBudgetWorker(budgetService *services.BudgetService, lock *services.LeaderLock) *BudgetWorker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &BudgetWorker{
+		budgetService: budgetService,
+		lock:          lock,
+		stopChan:      make(chan struct{}),
+		doneChan:      make(chan struct{}),
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+}
+
+// Start starts the background worker
+func (w *BudgetWorker) Start() {
+	log.Info().Msg("Starting budget worker")
+
+	go func() {
+		defer close(w.doneChan)
+
+		w.evaluate()
+
+		ticker := time.NewTicker(budgetEvaluationInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				w.evaluate()
+
+			case <-w.stopChan:
+				log.Info().Msg("Stopping budget worker")
+				return
+			}
+		}
+	}()
+
+	log.Info().Msg("Budget worker started successfully")
+}
+
+// Stop stops the background worker and releases the leader lock
+func (w *BudgetWorker) Stop() {
+	log.Info().Msg("Stopping budget worker...")
+	w.stopOnce.Do(func() {
+		close(w.stopChan)
+		w.cancel()
+	})
+	<-w.doneChan
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := w.lock.Release(ctx); err != nil {
+		log.Error().Err(err).Msg("Failed to release budget lock")
+	}
+	log.Info().Msg("Budget worker stopped")
+}
+
+// evaluate evaluates budgets if this replica is the leader
+func (w *BudgetWorker) evaluate() {
+	ctx, cancel := context.WithTimeout(w.ctx, budgetEvaluationTimeout)
+	defer cancel()
+
+	leader, err := w.lock.TryAcquire(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to acquire budget lock")
+		return
+	}
+	if !leader {
+		log.Debug().Msg("Another replica is evaluating budgets, skipping")
+		return
+	}
+
+	sent, err := w.budgetService.EvaluateAll(ctx, time.Now())
+	if err != nil {
+		log.Error().Err(err).Msg("Budget evaluation failed")
+		return
+	}
+	if sent > 0 {
+		log.Info().Int("alerts", sent).Msg("Budget alerts sent")
+	}
+}
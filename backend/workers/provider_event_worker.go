@@ -0,0 +1,96 @@
+package workers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"pulse-control-plane/services"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// providerEventRetryInterval is how often failed provider events are
+	// checked for a due retry
+	providerEventRetryInterval = time.Minute
+
+	// providerEventRetryBatch bounds the events retried per pass
+	providerEventRetryBatch = 100
+)
+
+// ProviderEventWorker retries payment provider webhook events whose handler
+// failed. Each event is claimed atomically, so every replica can run it.
+type ProviderEventWorker struct {
+	eventStore *services.ProviderEventStore
+	stopChan   chan struct{}
+	doneChan   chan struct{}
+	stopOnce   sync.Once
+
+	// ctx is cancelled on Stop so an in-progress retry does not delay shutdown
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewProviderEventWorker creates a new provider event retry worker
+func NewProviderEventWorker(eventStore *services.ProviderEventStore) *ProviderEventWorker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ProviderEventWorker{
+		eventStore: eventStore,
+		stopChan:   make(chan struct{}),
+		doneChan:   make(chan struct{}),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+// Start starts the background worker
+func (w *ProviderEventWorker) Start() {
+	log.Info().Msg("Starting provider event worker")
+
+	go func() {
+		defer close(w.doneChan)
+
+		ticker := time.NewTicker(providerEventRetryInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				w.retryDue()
+
+			case <-w.stopChan:
+				log.Info().Msg("Stopping provider event worker")
+				return
+			}
+		}
+	}()
+
+	log.Info().Msg("Provider event worker started successfully")
+}
+
+// Stop stops the background worker
+func (w *ProviderEventWorker) Stop() {
+	log.Info().Msg("Stopping provider event worker...")
+	w.stopOnce.Do(func() {
+		close(w.stopChan)
+		w.cancel()
+	})
+	<-w.doneChan
+	log.Info().Msg("Provider event worker stopped")
+}
+
+// retryDue processes the failed events whose retry is due
+func (w *ProviderEventWorker) retryDue() {
+	ctx, cancel := context.WithTimeout(w.ctx, 5*time.Minute)
+	defer cancel()
+
+	processed, err := w.eventStore.RetryDue(ctx, time.Now(), providerEventRetryBatch)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to retry provider events")
+		return
+	}
+	if processed > 0 {
+		log.Info().Int("processed", processed).Msg("Retried provider events")
+	}
+}
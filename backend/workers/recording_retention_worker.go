@@ -0,0 +1,121 @@
+package workers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"pulse-control-plane/services"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// recordingRetentionInterval is how often retention policies are
+	// enforced and storage usage is sampled
+	recordingRetentionInterval = time.Hour
+
+	// recordingRetentionTimeout bounds one pass over all policies
+	recordingRetentionTimeout = 30 * time.Minute
+)
+
+// RecordingRetentionWorker deletes recordings whose retention policies have
+// expired them and reports each project's recording storage
+type RecordingRetentionWorker struct {
+	recordingService *services.RecordingService
+	lock             *services.LeaderLock
+	stopChan         chan struct{}
+	doneChan         chan struct{}
+	stopOnce         sync.Once
+
+	// ctx is cancelled on Stop so an in-progress pass does not delay shutdown
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewRecordingRetentionWorker creates a new recording retention worker. The
+// lock ensures only one replica deletes recordings and samples storage.
+func NewRecordingRetentionWorker(recordingService *services.RecordingService, lock *services.LeaderLock) *RecordingRetentionWorker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &RecordingRetentionWorker{
+		recordingService: recordingService,
+		lock:             lock,
+		stopChan:         make(chan struct{}),
+		doneChan:         make(chan struct{}),
+		ctx:              ctx,
+		cancel:           cancel,
+	}
+}
+
+// Start starts the background worker
+func (w *RecordingRetentionWorker) Start() {
+	log.Info().Msg("Starting recording retention worker")
+
+	go func() {
+		defer close(w.doneChan)
+
+		w.enforce()
+
+		ticker := time.NewTicker(recordingRetentionInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				w.enforce()
+
+			case <-w.stopChan:
+				log.Info().Msg("Stopping recording retention worker")
+				return
+			}
+		}
+	}()
+
+	log.Info().Msg("Recording retention worker started successfully")
+}
+
+// Stop stops the background worker and releases the leader lock
+func (w *RecordingRetentionWorker) Stop() {
+	log.Info().Msg("Stopping recording retention worker...")
+	w.stopOnce.Do(func() {
+		close(w.stopChan)
+		w.cancel()
+	})
+	<-w.doneChan
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := w.lock.Release(ctx); err != nil {
+		log.Error().Err(err).Msg("Failed to release recording retention lock")
+	}
+	log.Info().Msg("Recording retention worker stopped")
+}
+
+// enforce applies retention policies and samples storage usage if this
+// replica is the leader
+func (w *RecordingRetentionWorker) enforce() {
+	ctx, cancel := context.WithTimeout(w.ctx, recordingRetentionTimeout)
+	defer cancel()
+
+	leader, err := w.lock.TryAcquire(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to acquire recording retention lock")
+		return
+	}
+	if !leader {
+		log.Debug().Msg("Another replica is enforcing recording retention, skipping")
+		return
+	}
+
+	deleted, err := w.recordingService.EnforceRetention(ctx, time.Now())
+	if err != nil {
+		log.Error().Err(err).Msg("Recording retention failed")
+	}
+	if deleted > 0 {
+		log.Info().Int("recordings", deleted).Msg("Expired recordings deleted")
+	}
+
+	if err := w.recordingService.ReportStorageUsage(ctx); err != nil {
+		log.Error().Err(err).Msg("Failed to report recording storage usage")
+	}
+}
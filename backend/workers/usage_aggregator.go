@@ -2,26 +2,43 @@ package workers
 
 import (
 	"context"
+	"sync"
 	"time"
 
+	"pulse-control-plane/models"
 	"pulse-control-plane/services"
 
 	"github.com/rs/zerolog/log"
 )
 
+// aggregationDelay gives buffered usage events time to land before an hour is
+// rolled up. Events arriving later are re-aggregated on the next run.
+const aggregationDelay = 2 * time.Minute
+
 // UsageAggregatorWorker handles periodic usage aggregation
 type UsageAggregatorWorker struct {
 	aggregatorService *services.AggregatorService
+	lock              *services.LeaderLock
 	stopChan          chan struct{}
 	doneChan          chan struct{}
+	stopOnce          sync.Once
+
+	// ctx is cancelled on Stop so an in-progress catch-up does not delay shutdown
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
-// NewUsageAggregatorWorker creates a new usage aggregator worker
-func NewUsageAggregatorWorker(aggregatorService *services.AggregatorService) *UsageAggregatorWorker {
+// NewUsageAggregatorWorker creates a new usage aggregator worker. The lock
+// ensures only one replica aggregates at a time.
+func NewUsageAggregatorWorker(aggregatorService *services.AggregatorService, lock *services.LeaderLock) *UsageAggregatorWorker {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &UsageAggregatorWorker{
 		aggregatorService: aggregatorService,
+		lock:              lock,
 		stopChan:          make(chan struct{}),
 		doneChan:          make(chan struct{}),
+		ctx:               ctx,
+		cancel:            cancel,
 	}
 }
 
@@ -29,34 +46,24 @@ func NewUsageAggregatorWorker(aggregatorService *services.AggregatorService) *Us
 func (w *UsageAggregatorWorker) Start() {
 	log.Info().Msg("Starting usage aggregator worker")
 
-	// Run immediately on startup
-	go w.runAggregation()
-
-	// Setup tickers for periodic aggregation
-	hourlyTicker := time.NewTicker(1 * time.Hour)
-	dailyTicker := time.NewTicker(24 * time.Hour)
-
 	go func() {
 		defer close(w.doneChan)
-		defer hourlyTicker.Stop()
-		defer dailyTicker.Stop()
+
+		// Run immediately on startup to catch up on anything missed while down
+		w.runAggregation()
 
 		for {
+			// Align to the wall clock: shortly after the top of every hour
+			now := time.Now()
+			_, hourEnd := services.PeriodBounds(models.PeriodHourly, now)
+			timer := time.NewTimer(hourEnd.Add(aggregationDelay).Sub(now))
+
 			select {
-			case <-hourlyTicker.C:
-				log.Info().Msg("Hourly aggregation triggered")
-				w.aggregateHourly()
-
-			case <-dailyTicker.C:
-				log.Info().Msg("Daily aggregation triggered")
-				w.aggregateDaily()
-				// Also run monthly aggregation on the 1st of each month
-				if time.Now().Day() == 1 {
-					log.Info().Msg("Monthly aggregation triggered")
-					w.aggregateMonthly()
-				}
+			case <-timer.C:
+				w.runAggregation()
 
 			case <-w.stopChan:
+				timer.Stop()
 				log.Info().Msg("Stopping usage aggregator worker")
 				return
 			}
@@ -66,76 +73,68 @@ func (w *UsageAggregatorWorker) Start() {
 	log.Info().Msg("Usage aggregator worker started successfully")
 }
 
-// Stop stops the background worker
+// Stop stops the background worker and releases the leader lock
 func (w *UsageAggregatorWorker) Stop() {
 	log.Info().Msg("Stopping usage aggregator worker...")
-	close(w.stopChan)
+	w.stopOnce.Do(func() {
+		close(w.stopChan)
+		w.cancel()
+	})
 	<-w.doneChan
-	log.Info().Msg("Usage aggregator worker stopped")
-}
 
-// runAggregation runs initial aggregation on startup
-func (w *UsageAggregatorWorker) runAggregation() {
-	log.Info().Msg("Running initial usage aggregation")
-	
-	// Run hourly aggregation for any missing hours
-	w.aggregateHourly()
-	
-	// Check if we need to run daily aggregation
-	now := time.Now()
-	if now.Hour() == 0 {
-		w.aggregateDaily()
-	}
-	
-	// Check if we need to run monthly aggregation
-	if now.Day() == 1 && now.Hour() == 0 {
-		w.aggregateMonthly()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := w.lock.Release(ctx); err != nil {
+		log.Error().Err(err).Msg("Failed to release usage aggregator lock")
 	}
+	log.Info().Msg("Usage aggregator worker stopped")
 }
 
-// aggregateHourly performs hourly aggregation
-func (w *UsageAggregatorWorker) aggregateHourly() {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
-	defer cancel()
-
-	log.Info().Msg("Starting hourly usage aggregation")
-	
-	if err := w.aggregatorService.AggregateHourlyUsage(ctx); err != nil {
-		log.Error().Err(err).Msg("Failed to aggregate hourly usage")
-		return
+// runAggregation catches up every period type if this replica is the leader.
+// Daily and monthly periods are only aggregated once they are complete, so
+// running them every hour is cheap and picks up midnight and the 1st on time.
+func (w *UsageAggregatorWorker) runAggregation() {
+	periods := []struct {
+		periodType string
+		timeout    time.Duration
+	}{
+		{models.PeriodHourly, 10 * time.Minute},
+		{models.PeriodDaily, 30 * time.Minute},
+		{models.PeriodMonthly, 60 * time.Minute},
 	}
-	
-	log.Info().Msg("Hourly usage aggregation completed successfully")
-}
 
-// aggregateDaily performs daily aggregation
-func (w *UsageAggregatorWorker) aggregateDaily() {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
-	defer cancel()
+	for _, period := range periods {
+		select {
+		case <-w.stopChan:
+			return
+		default:
+		}
 
-	log.Info().Msg("Starting daily usage aggregation")
-	
-	if err := w.aggregatorService.AggregateDailyUsage(ctx); err != nil {
-		log.Error().Err(err).Msg("Failed to aggregate daily usage")
-		return
-	}
-	
-	log.Info().Msg("Daily usage aggregation completed successfully")
-}
+		ctx, cancel := context.WithTimeout(w.ctx, period.timeout)
 
-// aggregateMonthly performs monthly aggregation
-func (w *UsageAggregatorWorker) aggregateMonthly() {
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Minute)
-	defer cancel()
+		// Renew the lease before each period type so it outlives long catch-ups
+		leader, err := w.lock.TryAcquire(ctx)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to acquire usage aggregator lock")
+			cancel()
+			return
+		}
+		if !leader {
+			log.Debug().Msg("Another replica is aggregating usage, skipping")
+			cancel()
+			return
+		}
 
-	log.Info().Msg("Starting monthly usage aggregation")
-	
-	if err := w.aggregatorService.AggregateMonthlyUsage(ctx); err != nil {
-		log.Error().Err(err).Msg("Failed to aggregate monthly usage")
-		return
+		n, err := w.aggregatorService.CatchUp(ctx, period.periodType, time.Now())
+		cancel()
+		if err != nil {
+			log.Error().Err(err).Str("period_type", period.periodType).Msg("Failed to aggregate usage")
+			continue
+		}
+		if n > 0 {
+			log.Info().Str("period_type", period.periodType).Int("periods", n).Msg("Usage aggregation completed successfully")
+		}
 	}
-	
-	log.Info().Msg("Monthly usage aggregation completed successfully")
 }
 
 // GetStatus returns the worker status